@@ -72,6 +72,16 @@ func (s *Server) handleBacktestStart(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("提示词模板不存在: %s", cfg.PromptTemplate)})
 		return
 	}
+	for _, name := range cfg.ABPrompts {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, err := decision.GetPromptTemplate(name); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A/B 提示词模板不存在: %s", name)})
+			return
+		}
+	}
 	cfg.CustomPrompt = strings.TrimSpace(cfg.CustomPrompt)
 	cfg.UserID = normalizeUserID(c.GetString("user_id"))
 	if err := s.hydrateBacktestAIConfig(&cfg); err != nil {
@@ -1076,8 +1076,15 @@ func (s *Server) handleUpdateTraderPrompt(c *gin.Context) {
 	// 如果trader在内存中，更新其custom prompt和override设置
 	trader, err := s.traderManager.GetTrader(traderID)
 	if err == nil {
-		trader.SetCustomPrompt(req.CustomPrompt)
-		trader.SetOverrideBasePrompt(req.OverrideBasePrompt)
+		if err := trader.UpdatePrompt(req.CustomPrompt, req.OverrideBasePrompt); err != nil {
+			// prompt 已持久化并生效，平仓失败只作为警告返回，由用户手动处理剩余持仓
+			log.Printf("⚠️ 交易员 %s 切换prompt时平仓失败: %v", trader.GetName(), err)
+			c.JSON(http.StatusOK, gin.H{
+				"message": "自定义prompt已更新",
+				"warning": fmt.Sprintf("切换prompt时平仓失败，请手动检查持仓: %v", err),
+			})
+			return
+		}
 		log.Printf("✓ 已更新交易员 %s 的自定义prompt (覆盖基础=%v)", trader.GetName(), req.OverrideBasePrompt)
 	}
 
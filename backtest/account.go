@@ -8,6 +8,15 @@ import (
 
 const epsilon = 1e-8
 
+const (
+	// maxNotionalMultiplier 单笔交易名义价值相对账户总资产的上限倍数
+	maxNotionalMultiplier = 50.0
+	// maxOpenMarginBuffer 计算最大可开仓数量时预留的可用资金比例（覆盖价格波动等）
+	maxOpenMarginBuffer = 0.05
+	// maintenanceMarginRate 全仓模式下的维持保证金率（按持仓名义价值计）
+	maintenanceMarginRate = 0.005
+)
+
 type position struct {
 	Symbol           string
 	Side             string
@@ -20,15 +29,52 @@ type position struct {
 	OpenTime         int64
 	StopLoss         float64 // 止损价格，0 表示未设置
 	TakeProfit       float64 // 止盈价格，0 表示未设置
+	TrailPct         float64 // 跟踪止损回撤百分比，0 表示未启用
+	TrailAnchor      float64 // 跟踪止损参考的最优价格（多头为最高价，空头为最低价）
+	trailFrom        int64   // 跟踪止损生效时间：只用该时间之后的K线推进参考价
+}
+
+// PendingOrder 表示挂单中的限价开仓单（不冻结保证金，成交时再扣除）。
+type PendingOrder struct {
+	Symbol     string  `json:"symbol"`
+	Side       string  `json:"side"`
+	Quantity   float64 `json:"quantity"`
+	Leverage   int     `json:"leverage"`
+	LimitPrice float64 `json:"limit_price"`
+	StopLoss   float64 `json:"stop_loss,omitempty"`
+	TakeProfit float64 `json:"take_profit,omitempty"`
+	PlacedTS   int64   `json:"placed_ts"`
+	ExpiryBars int     `json:"expiry_bars"` // 有效K线数，超过仍未成交则撤单
+	BarsWaited int     `json:"bars_waited"` // 已经历的撮合K线数
+}
+
+// symbolFeeRates 单个标的的 maker/taker 费率。
+type symbolFeeRates struct {
+	maker float64
+	taker float64
+}
+
+// limitFill 表示一次限价单撮合结果（Err 非空表示触价但开仓失败，订单已撤销）。
+type limitFill struct {
+	Order     PendingOrder
+	Position  *position
+	Fee       float64
+	ExecPrice float64
+	Err       error
 }
 
 type BacktestAccount struct {
 	initialBalance float64
 	cash           float64
 	feeRate        float64
+	makerFeeRate   float64
+	symbolFees     map[string]symbolFeeRates // 按标的覆盖的 maker/taker 费率
 	slippageRate   float64
 	positions      map[string]*position
+	pendingOrders  []PendingOrder
 	realizedPnL    float64
+	crossMargin    bool // 全仓模式：不计算单个持仓爆仓价，由账户整体维持保证金判断强平
+	liqFeeRate     float64
 }
 
 func NewBacktestAccount(initialBalance, feeBps, slippageBps float64) *BacktestAccount {
@@ -60,7 +106,51 @@ func (acc *BacktestAccount) removePosition(pos *position) {
 	delete(acc.positions, key)
 }
 
-func (acc *BacktestAccount) Open(symbol, side string, quantity float64, leverage int, price, stopLoss, takeProfit float64, ts int64) (*position, float64, float64, error) {
+// SetMakerFeeBps 设置限价单（maker）成交费率，负值表示返佣。
+func (acc *BacktestAccount) SetMakerFeeBps(bps float64) {
+	acc.makerFeeRate = bps / 10000.0
+}
+
+// SetLiquidationFeeBps 设置强平罚金费率（在正常平仓手续费之外额外收取）。
+func (acc *BacktestAccount) SetLiquidationFeeBps(bps float64) {
+	acc.liqFeeRate = bps / 10000.0
+}
+
+// SetCrossMargin 设置是否使用全仓保证金模式。
+func (acc *BacktestAccount) SetCrossMargin(enabled bool) {
+	acc.crossMargin = enabled
+}
+
+// SetSymbolFeeBps 为指定标的覆盖 maker/taker 费率（maker 可为负值表示返佣）。
+func (acc *BacktestAccount) SetSymbolFeeBps(symbol string, makerBps, takerBps float64) {
+	if acc.symbolFees == nil {
+		acc.symbolFees = make(map[string]symbolFeeRates)
+	}
+	acc.symbolFees[strings.ToUpper(symbol)] = symbolFeeRates{maker: makerBps / 10000.0, taker: takerBps / 10000.0}
+}
+
+// feeRateFor 按成交流动性类型返回标的费率：限价挂单及按成交策略取价的成交为 maker，其余（市价）为 taker。
+func (acc *BacktestAccount) feeRateFor(symbol string, maker bool) float64 {
+	if rates, ok := acc.symbolFees[strings.ToUpper(symbol)]; ok {
+		if maker {
+			return rates.maker
+		}
+		return rates.taker
+	}
+	if maker {
+		return acc.makerFeeRate
+	}
+	return acc.feeRate
+}
+
+// Open 按给定价格开仓；maker 表示按成交策略模拟的挂单类成交，使用 maker 费率。
+func (acc *BacktestAccount) Open(symbol, side string, quantity float64, leverage int, price, stopLoss, takeProfit float64, ts int64, maker bool) (*position, float64, float64, error) {
+	execPrice := applySlippage(price, acc.slippageRate, side, true)
+	return acc.openAt(symbol, side, quantity, leverage, price, execPrice, acc.feeRateFor(symbol, maker), stopLoss, takeProfit, ts)
+}
+
+// openAt 按给定成交价与费率开仓；price 为估算账户总资产使用的标记价。
+func (acc *BacktestAccount) openAt(symbol, side string, quantity float64, leverage int, price, execPrice, feeRate, stopLoss, takeProfit float64, ts int64) (*position, float64, float64, error) {
 	if quantity <= 0 {
 		return nil, 0, 0, fmt.Errorf("quantity must be positive")
 	}
@@ -80,17 +170,15 @@ func (acc *BacktestAccount) Open(symbol, side string, quantity float64, leverage
 		return nil, 0, 0, fmt.Errorf("maximum position count (%d) reached, cannot open new position", MaxPositions)
 	}
 
-	execPrice := applySlippage(price, acc.slippageRate, side, true)
 	notional := execPrice * quantity
 	margin := notional / float64(leverage)
-	fee := notional * acc.feeRate
+	fee := notional * feeRate
 
 	// 风险保护：单笔交易名义价值不能超过账户总资产的50倍
 	totalEquity, _, _ := acc.TotalEquity(map[string]float64{symbol: price})
-	const MaxNotionalMultiplier = 50.0
-	if notional > totalEquity*MaxNotionalMultiplier {
+	if notional > totalEquity*maxNotionalMultiplier {
 		return nil, 0, 0, fmt.Errorf("notional value %.2f exceeds maximum allowed (%.2f x %.0fx = %.2f)",
-			notional, totalEquity, MaxNotionalMultiplier, totalEquity*MaxNotionalMultiplier)
+			notional, totalEquity, maxNotionalMultiplier, totalEquity*maxNotionalMultiplier)
 	}
 
 	if margin+fee > acc.cash+epsilon {
@@ -108,7 +196,7 @@ func (acc *BacktestAccount) Open(symbol, side string, quantity float64, leverage
 		pos.Margin = margin
 		pos.Notional = notional
 		pos.OpenTime = ts
-		pos.LiquidationPrice = computeLiquidation(execPrice, leverage, side)
+		pos.LiquidationPrice = acc.liquidationPrice(execPrice, leverage, side)
 		pos.StopLoss = stopLoss
 		pos.TakeProfit = takeProfit
 	} else {
@@ -121,7 +209,7 @@ func (acc *BacktestAccount) Open(symbol, side string, quantity float64, leverage
 		pos.Margin += margin
 		pos.EntryPrice = ((pos.EntryPrice * pos.Quantity) + execPrice*quantity) / (pos.Quantity + quantity)
 		pos.Quantity += quantity
-		pos.LiquidationPrice = computeLiquidation(pos.EntryPrice, pos.Leverage, side)
+		pos.LiquidationPrice = acc.liquidationPrice(pos.EntryPrice, pos.Leverage, side)
 		// 加仓时更新止损止盈（如果提供了新值）
 		if stopLoss > 0 {
 			pos.StopLoss = stopLoss
@@ -134,7 +222,114 @@ func (acc *BacktestAccount) Open(symbol, side string, quantity float64, leverage
 	return pos, fee, execPrice, nil
 }
 
-func (acc *BacktestAccount) Close(symbol, side string, quantity float64, price float64) (float64, float64, float64, error) {
+// MaxOpenQuantity 返回在给定杠杆下不超过可用保证金的最大开仓数量。
+// 可用资金（cash）已扣除现有持仓占用的保证金；另预留 maxOpenMarginBuffer 安全缓冲，
+// 并按不利方向的滑点和手续费估算单位成本。
+func (acc *BacktestAccount) MaxOpenQuantity(symbol string, price float64, leverage int) float64 {
+	// 与 Open 的名义价值上限保持一致（总资产按现金 + 已占用保证金估算）
+	equity := acc.cash
+	for _, pos := range acc.positions {
+		equity += pos.Margin
+	}
+	return acc.maxOpenQuantity(symbol, price, leverage, acc.cash, equity)
+}
+
+// MaxOpenQuantityAfterClose 返回按 closePrice 全部平掉 symbol 的 closeSide 持仓（释放保证金、结算盈亏并扣除 taker 手续费）后的最大开仓数量，
+// 用于反手时在平仓前按平仓后的可用资金校验开仓腿。
+func (acc *BacktestAccount) MaxOpenQuantityAfterClose(symbol, closeSide string, closePrice, price float64, leverage int) float64 {
+	cash, equity := acc.cash, acc.cash
+	for _, pos := range acc.positions {
+		equity += pos.Margin
+	}
+	if pos, ok := acc.positions[positionKey(symbol, closeSide)]; ok && pos.Quantity > epsilon {
+		execPrice := applySlippage(closePrice, acc.slippageRate, closeSide, false)
+		settled := realizedPnL(pos, pos.Quantity, execPrice) - execPrice*pos.Quantity*acc.feeRateFor(symbol, false)
+		cash += pos.Margin + settled
+		equity += settled
+	}
+	return acc.maxOpenQuantity(symbol, price, leverage, cash, equity)
+}
+
+func (acc *BacktestAccount) maxOpenQuantity(symbol string, price float64, leverage int, cash, equity float64) float64 {
+	if price <= 0 || leverage <= 0 {
+		return 0
+	}
+	available := cash * (1 - maxOpenMarginBuffer)
+	if available <= 0 {
+		return 0
+	}
+
+	execPrice := price * (1 + acc.slippageRate)
+	unitCost := execPrice/float64(leverage) + execPrice*acc.feeRateFor(symbol, false)
+	qty := available / unitCost
+
+	if maxQty := equity * maxNotionalMultiplier / execPrice; qty > maxQty {
+		qty = maxQty
+	}
+	return qty
+}
+
+// PlaceLimitOrder 挂出限价开仓单，等待后续K线价格触及限价后成交。
+func (acc *BacktestAccount) PlaceLimitOrder(order PendingOrder) error {
+	if order.Quantity <= 0 || order.LimitPrice <= 0 {
+		return fmt.Errorf("limit order requires positive quantity and price")
+	}
+	if order.ExpiryBars <= 0 {
+		return fmt.Errorf("limit order expiry must be positive")
+	}
+	order.Symbol = strings.ToUpper(order.Symbol)
+	acc.pendingOrders = append(acc.pendingOrders, order)
+	return nil
+}
+
+// PendingOrders 返回当前挂单列表的副本。
+func (acc *BacktestAccount) PendingOrders() []PendingOrder {
+	orders := make([]PendingOrder, len(acc.pendingOrders))
+	copy(orders, acc.pendingOrders)
+	return orders
+}
+
+// MatchPendingOrders 用一根K线的最高/最低价撮合挂单：
+// 多单在最低价 <= 限价、空单在最高价 >= 限价时以限价按 maker 费率成交（无滑点）；
+// 撮合 ExpiryBars 根K线后仍未成交的订单撤销并返回。
+func (acc *BacktestAccount) MatchPendingOrders(highMap, lowMap map[string]float64, ts int64) ([]limitFill, []PendingOrder) {
+	if len(acc.pendingOrders) == 0 {
+		return nil, nil
+	}
+	var (
+		fills     []limitFill
+		expired   []PendingOrder
+		remaining = acc.pendingOrders[:0]
+	)
+	for _, order := range acc.pendingOrders {
+		high, hasHigh := highMap[order.Symbol]
+		low, hasLow := lowMap[order.Symbol]
+		if !hasHigh || !hasLow {
+			remaining = append(remaining, order)
+			continue
+		}
+		order.BarsWaited++
+
+		touched := (order.Side == "long" && low <= order.LimitPrice) ||
+			(order.Side == "short" && high >= order.LimitPrice)
+		if touched {
+			pos, fee, execPrice, err := acc.openAt(order.Symbol, order.Side, order.Quantity, order.Leverage,
+				order.LimitPrice, order.LimitPrice, acc.feeRateFor(order.Symbol, true), order.StopLoss, order.TakeProfit, ts)
+			fills = append(fills, limitFill{Order: order, Position: pos, Fee: fee, ExecPrice: execPrice, Err: err})
+			continue
+		}
+		if order.BarsWaited >= order.ExpiryBars {
+			expired = append(expired, order)
+			continue
+		}
+		remaining = append(remaining, order)
+	}
+	acc.pendingOrders = remaining
+	return fills, expired
+}
+
+// Close 按给定价格平仓；maker 表示按成交策略模拟的挂单类成交，使用 maker 费率（止损/强平等为 taker）。
+func (acc *BacktestAccount) Close(symbol, side string, quantity float64, price float64, maker bool) (float64, float64, float64, error) {
 	key := positionKey(symbol, side)
 	pos, ok := acc.positions[key]
 	if !ok || pos.Quantity <= epsilon {
@@ -151,7 +346,7 @@ func (acc *BacktestAccount) Close(symbol, side string, quantity float64, price f
 
 	execPrice := applySlippage(price, acc.slippageRate, side, false)
 	notional := execPrice * quantity
-	fee := notional * acc.feeRate
+	fee := notional * acc.feeRateFor(symbol, maker)
 
 	realized := realizedPnL(pos, quantity, execPrice)
 
@@ -170,6 +365,58 @@ func (acc *BacktestAccount) Close(symbol, side string, quantity float64, price f
 	return realized, fee, execPrice, nil
 }
 
+// ClosePartial 按 taker 费率平掉持仓的 qty 部分，已实现盈亏、手续费与释放的保证金按比例计算；
+// 剩余部分保留开仓价和止损/止盈，并重新计算爆仓价。返回剩余数量（全部平掉时为 0），qty 超过持仓数量时报错。
+func (acc *BacktestAccount) ClosePartial(symbol, side string, qty, price float64) (realized, fee, execPrice, remaining float64, err error) {
+	key := positionKey(symbol, side)
+	pos, ok := acc.positions[key]
+	if !ok || pos.Quantity <= epsilon {
+		return 0, 0, 0, 0, fmt.Errorf("no active %s position for %s", side, symbol)
+	}
+	if qty <= 0 {
+		return 0, 0, 0, 0, fmt.Errorf("invalid close quantity %.8f", qty)
+	}
+	if qty > pos.Quantity+epsilon {
+		return 0, 0, 0, 0, fmt.Errorf("close quantity %.8f exceeds open %s quantity %.8f for %s", qty, side, pos.Quantity, symbol)
+	}
+
+	realized, fee, execPrice, err = acc.Close(symbol, side, math.Min(qty, pos.Quantity), price, false)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	if rest, ok := acc.positions[key]; ok {
+		rest.LiquidationPrice = acc.liquidationPrice(rest.EntryPrice, rest.Leverage, side)
+		remaining = rest.Quantity
+	}
+	return realized, fee, execPrice, remaining, nil
+}
+
+// ApplyFunding 按标记价对持仓结算一次资金费：多头支付 名义价值*rate，空头收取（rate 为负时相反）。
+// 返回本次支付金额（负值表示收取），资金费计入已实现盈亏。
+func (acc *BacktestAccount) ApplyFunding(symbol, side string, markPrice, rate float64) (float64, error) {
+	key := positionKey(symbol, side)
+	pos, ok := acc.positions[key]
+	if !ok || pos.Quantity <= epsilon {
+		return 0, fmt.Errorf("no active %s position for %s", side, symbol)
+	}
+
+	payment := pos.Quantity * markPrice * rate
+	if side == "short" {
+		payment = -payment
+	}
+	acc.cash -= payment
+	acc.realizedPnL -= payment
+	return payment, nil
+}
+
+// ChargeLiquidationFee 按强平成交的名义价值收取强平罚金，计入已实现盈亏，返回罚金金额。
+func (acc *BacktestAccount) ChargeLiquidationFee(notional float64) float64 {
+	penalty := notional * acc.liqFeeRate
+	acc.cash -= penalty
+	acc.realizedPnL -= penalty
+	return penalty
+}
+
 // UpdateStopLoss 更新指定持仓的止损价格
 func (acc *BacktestAccount) UpdateStopLoss(symbol, side string, newStopLoss float64) error {
 	key := positionKey(symbol, side)
@@ -181,6 +428,56 @@ func (acc *BacktestAccount) UpdateStopLoss(symbol, side string, newStopLoss floa
 	return nil
 }
 
+// SetTrailingStop 为指定持仓启用跟踪止损：以 markPrice 为初始参考价，止损只会朝有利方向移动。
+func (acc *BacktestAccount) SetTrailingStop(symbol, side string, trailPct, markPrice float64, ts int64) error {
+	key := positionKey(symbol, side)
+	pos, ok := acc.positions[key]
+	if !ok || pos.Quantity <= epsilon {
+		return fmt.Errorf("no active %s position for %s", side, symbol)
+	}
+	if trailPct <= 0 || trailPct >= 100 {
+		return fmt.Errorf("trail pct must be in (0,100): %.2f", trailPct)
+	}
+	pos.TrailPct = trailPct
+	pos.TrailAnchor = markPrice
+	pos.trailFrom = ts
+	pos.advanceTrailingStop(markPrice, markPrice)
+	return nil
+}
+
+// AdvanceTrailingStops 按K线最高/最低价推进所有跟踪止损（ts 之前或同时启用的跟踪止损不使用本K线价格）。
+func (acc *BacktestAccount) AdvanceTrailingStops(highMap, lowMap map[string]float64, ts int64) {
+	for _, pos := range acc.positions {
+		if pos.TrailPct <= 0 || ts <= pos.trailFrom {
+			continue
+		}
+		high, low := highMap[pos.Symbol], lowMap[pos.Symbol]
+		if high <= 0 || low <= 0 {
+			continue
+		}
+		pos.advanceTrailingStop(high, low)
+	}
+}
+
+// advanceTrailingStop 更新参考价并据此收紧止损：多头取最高价向下回撤 TrailPct，空头取最低价向上回撤。
+func (pos *position) advanceTrailingStop(high, low float64) {
+	if pos.Side == "long" {
+		if high > pos.TrailAnchor {
+			pos.TrailAnchor = high
+		}
+		if stop := pos.TrailAnchor * (1 - pos.TrailPct/100); stop > pos.StopLoss {
+			pos.StopLoss = stop
+		}
+		return
+	}
+	if low < pos.TrailAnchor {
+		pos.TrailAnchor = low
+	}
+	if stop := pos.TrailAnchor * (1 + pos.TrailPct/100); pos.StopLoss <= 0 || stop < pos.StopLoss {
+		pos.StopLoss = stop
+	}
+}
+
 // UpdateTakeProfit 更新指定持仓的止盈价格
 func (acc *BacktestAccount) UpdateTakeProfit(symbol, side string, newTakeProfit float64) error {
 	key := positionKey(symbol, side)
@@ -227,6 +524,42 @@ func applySlippage(price float64, rate float64, side string, isOpen bool) float6
 	return price * adjust
 }
 
+// liquidationPrice 返回逐仓爆仓价；全仓模式下单个持仓没有独立爆仓价，返回 0。
+func (acc *BacktestAccount) liquidationPrice(entry float64, leverage int, side string) float64 {
+	if acc.crossMargin {
+		return 0
+	}
+	return computeLiquidation(entry, leverage, side)
+}
+
+// CrossMarginBreached 全仓模式下按各持仓的不利价格（多头取 lowMap、空头取 highMap）估算账户权益，
+// 权益低于全部持仓维持保证金之和时返回 true，同时返回估算的权益与维持保证金。逐仓模式始终返回 false。
+func (acc *BacktestAccount) CrossMarginBreached(highMap, lowMap map[string]float64) (bool, float64, float64) {
+	if !acc.crossMargin || len(acc.positions) == 0 {
+		return false, 0, 0
+	}
+	equity := acc.cash
+	maintenance := 0.0
+	for _, pos := range acc.positions {
+		price := adversePrice(pos, highMap, lowMap)
+		equity += pos.Margin + unrealizedPnL(pos, price)
+		maintenance += pos.Quantity * price * maintenanceMarginRate
+	}
+	return equity < maintenance, equity, maintenance
+}
+
+// adversePrice 返回持仓在K线内的最不利价格（多头取最低价、空头取最高价），缺少价格时退回开仓均价。
+func adversePrice(pos *position, highMap, lowMap map[string]float64) float64 {
+	price := highMap[pos.Symbol]
+	if pos.Side == "long" {
+		price = lowMap[pos.Symbol]
+	}
+	if price <= 0 {
+		return pos.EntryPrice
+	}
+	return price
+}
+
 func computeLiquidation(entry float64, leverage int, side string) float64 {
 	if leverage <= 0 {
 		return 0
@@ -360,8 +693,9 @@ func (acc *BacktestAccount) RealizedPnL() float64 {
 }
 
 // RestoreFromSnapshots 用于从检查点恢复账户状态。
-func (acc *BacktestAccount) RestoreFromSnapshots(cash float64, realized float64, snaps []PositionSnapshot) {
+func (acc *BacktestAccount) RestoreFromSnapshots(cash float64, realized float64, snaps []PositionSnapshot, pending []PendingOrder) {
 	acc.cash = cash
+	acc.pendingOrders = append([]PendingOrder(nil), pending...)
 	acc.realizedPnL = realized
 	acc.positions = make(map[string]*position)
 	for _, snap := range snaps {
@@ -375,6 +709,8 @@ func (acc *BacktestAccount) RestoreFromSnapshots(cash float64, realized float64,
 			Notional:         snap.Quantity * snap.AvgPrice,
 			LiquidationPrice: snap.LiquidationPrice,
 			OpenTime:         snap.OpenTime,
+			TrailPct:         snap.TrailPct,
+			TrailAnchor:      snap.TrailAnchor,
 		}
 		key := positionKey(pos.Symbol, pos.Side)
 		acc.positions[key] = pos
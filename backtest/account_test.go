@@ -1,6 +1,7 @@
 package backtest
 
 import (
+	"math"
 	"strings"
 	"testing"
 )
@@ -9,7 +10,7 @@ func TestBacktestAccount_RiskLimits(t *testing.T) {
 	t.Run("should reject leverage exceeding maximum", func(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2) // 10000 USDT, 5bps fee, 2bps slippage
 
-		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 150, 50000, 0, 0, 0)
+		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 150, 50000, 0, 0, 0, false)
 
 		if err == nil {
 			t.Fatal("Expected error for leverage > 100, got nil")
@@ -25,14 +26,14 @@ func TestBacktestAccount_RiskLimits(t *testing.T) {
 		// Open 20 positions (the maximum)
 		for i := 1; i <= 20; i++ {
 			symbol := "COIN" + string(rune('A'+i-1)) + "USDT"
-			_, _, _, err := acc.Open(symbol, "long", 0.1, 10, 100, 0, 0, 0)
+			_, _, _, err := acc.Open(symbol, "long", 0.1, 10, 100, 0, 0, 0, false)
 			if err != nil {
 				t.Fatalf("Failed to open position %d: %v", i, err)
 			}
 		}
 
 		// Try to open 21st position
-		_, _, _, err := acc.Open("NEWCOINUSDT", "long", 0.1, 10, 100, 0, 0, 0)
+		_, _, _, err := acc.Open("NEWCOINUSDT", "long", 0.1, 10, 100, 0, 0, 0, false)
 
 		if err == nil {
 			t.Fatal("Expected error for exceeding max positions, got nil")
@@ -47,7 +48,7 @@ func TestBacktestAccount_RiskLimits(t *testing.T) {
 
 		// Try to open a position with notional value > 50x equity (50,000 USDT)
 		// With 10x leverage, this would need quantity = 5.0 BTC at 50000 USDT
-		_, _, _, err := acc.Open("BTCUSDT", "long", 1.1, 10, 50000, 0, 0, 0)
+		_, _, _, err := acc.Open("BTCUSDT", "long", 1.1, 10, 50000, 0, 0, 0, false)
 
 		if err == nil {
 			t.Fatal("Expected error for excessive notional value, got nil")
@@ -61,7 +62,7 @@ func TestBacktestAccount_RiskLimits(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
 		// Open a reasonable position
-		pos, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 20, 50000, 0, 0, 0)
+		pos, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 20, 50000, 0, 0, 0, false)
 
 		if err != nil {
 			t.Fatalf("Expected successful open, got error: %v", err)
@@ -83,7 +84,7 @@ func TestBacktestAccount_BasicOperations(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
 		// Open long position
-		pos, _, _, err := acc.Open("ETHUSDT", "long", 1.0, 10, 3000, 0, 0, 0)
+		pos, _, _, err := acc.Open("ETHUSDT", "long", 1.0, 10, 3000, 0, 0, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to open position: %v", err)
 		}
@@ -91,7 +92,7 @@ func TestBacktestAccount_BasicOperations(t *testing.T) {
 		initialCash := acc.cash
 
 		// Close position at profit (symbol, side, quantity, price)
-		realizedPnL, _, _, err := acc.Close("ETHUSDT", "long", 1.0, 3300)
+		realizedPnL, _, _, err := acc.Close("ETHUSDT", "long", 1.0, 3300, false)
 		if err != nil {
 			t.Fatalf("Failed to close position: %v", err)
 		}
@@ -122,7 +123,7 @@ func TestBacktestAccount_BasicOperations(t *testing.T) {
 		}
 
 		// Open position
-		acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 0, 0, 0)
+		acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 0, 0, 0, false)
 
 		// Equity should change with position value
 		prices["BTCUSDT"] = 51000
@@ -140,7 +141,7 @@ func TestBacktestAccount_BasicOperations(t *testing.T) {
 
 		// Open 1 BTC @ $50,000, 10x leverage
 		// Slippage for long open: price * (1 + 0.0002) = 50010
-		pos, _, _, err := acc.Open("BTCUSDT", "long", 1.0, 10, 50000, 0, 0, 0)
+		pos, _, _, err := acc.Open("BTCUSDT", "long", 1.0, 10, 50000, 0, 0, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to open position: %v", err)
 		}
@@ -157,7 +158,7 @@ func TestBacktestAccount_BasicOperations(t *testing.T) {
 		initialEntryPrice := pos.EntryPrice
 
 		// Partial close 0.5 BTC @ $55,000 (price increased)
-		_, _, _, err = acc.Close("BTCUSDT", "long", 0.5, 55000)
+		_, _, _, err = acc.Close("BTCUSDT", "long", 0.5, 55000, false)
 		if err != nil {
 			t.Fatalf("Failed to close position: %v", err)
 		}
@@ -190,3 +191,141 @@ func TestBacktestAccount_BasicOperations(t *testing.T) {
 		}
 	})
 }
+
+func TestBacktestAccount_MaxOpenQuantity(t *testing.T) {
+	acc := NewBacktestAccount(10000, 5, 2) // 手续费 0.05%，滑点 0.02%
+
+	// 已有持仓占用保证金：0.1 BTC @ 50000，10 倍杠杆
+	if _, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 0, 0, 0, false); err != nil {
+		t.Fatalf("open existing position: %v", err)
+	}
+	cashAfterOpen := acc.Cash()
+	if cashAfterOpen >= 10000-499 {
+		t.Fatalf("existing margin should reduce cash, got %.2f", cashAfterOpen)
+	}
+
+	price, leverage := 2000.0, 5
+	maxQty := acc.MaxOpenQuantity("ETHUSDT", price, leverage)
+
+	execPrice := price * (1 + 0.0002)
+	wantQty := cashAfterOpen * (1 - maxOpenMarginBuffer) / (execPrice/float64(leverage) + execPrice*0.0005)
+	if math.Abs(maxQty-wantQty) > 1e-9 {
+		t.Fatalf("MaxOpenQuantity = %.6f, want %.6f", maxQty, wantQty)
+	}
+
+	// 所需保证金 + 手续费不超过扣除缓冲后的可用资金
+	required := maxQty*execPrice/float64(leverage) + maxQty*execPrice*0.0005
+	if required > cashAfterOpen*(1-maxOpenMarginBuffer)+1e-6 {
+		t.Fatalf("required %.4f exceeds available after buffer %.4f", required, cashAfterOpen*(1-maxOpenMarginBuffer))
+	}
+
+	// 按最大数量开仓应能成功
+	if _, _, _, err := acc.Open("ETHUSDT", "long", maxQty, leverage, price, 0, 0, 0, false); err != nil {
+		t.Fatalf("opening max quantity should succeed: %v", err)
+	}
+
+	if got := acc.MaxOpenQuantity("ETHUSDT", 0, leverage); got != 0 {
+		t.Errorf("MaxOpenQuantity with zero price = %v, want 0", got)
+	}
+}
+
+// TestBacktestAccount_SymbolFeeMakerTaker 测试按标的覆盖费率：限价挂单开仓获得 maker 返佣，市价平仓支付 taker
+func TestBacktestAccount_SymbolFeeMakerTaker(t *testing.T) {
+	acc := NewBacktestAccount(10000, 10, 0)
+	acc.SetMakerFeeBps(2)
+	acc.SetSymbolFeeBps("btcusdt", -2, 5) // 返佣 0.02%，taker 0.05%
+
+	if err := acc.PlaceLimitOrder(PendingOrder{Symbol: "BTCUSDT", Side: "long", Quantity: 10, Leverage: 5, LimitPrice: 98, ExpiryBars: 3}); err != nil {
+		t.Fatalf("PlaceLimitOrder: %v", err)
+	}
+	fills, _ := acc.MatchPendingOrders(map[string]float64{"BTCUSDT": 100}, map[string]float64{"BTCUSDT": 97}, 1)
+	if len(fills) != 1 || fills[0].Err != nil {
+		t.Fatalf("expected limit fill, got %+v", fills)
+	}
+	entryFee := fills[0].Fee
+	if want := -980 * 0.0002; math.Abs(entryFee-want) > 1e-9 {
+		t.Errorf("maker entry fee = %.6f, want rebate %.6f", entryFee, want)
+	}
+
+	realized, exitFee, _, err := acc.Close("BTCUSDT", "long", 0, 100, false)
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if want := 1000 * 0.0005; math.Abs(exitFee-want) > 1e-9 {
+		t.Errorf("taker exit fee = %.6f, want %.6f", exitFee, want)
+	}
+
+	netFee := entryFee + exitFee
+	if want := 0.5 - 0.196; math.Abs(netFee-want) > 1e-9 {
+		t.Errorf("net fee = %.6f, want %.6f", netFee, want)
+	}
+	if want := 10000 + realized - netFee; math.Abs(acc.Cash()-want) > 1e-9 {
+		t.Errorf("cash = %.6f, want %.6f", acc.Cash(), want)
+	}
+
+	// 未覆盖的标的仍使用全局费率
+	if got := acc.feeRateFor("ETHUSDT", false); got != 0.001 {
+		t.Errorf("global taker rate = %v, want 0.001", got)
+	}
+}
+
+// TestBacktestAccount_ClosePartial 测试平掉一半仓位：盈亏与手续费按比例结算，剩余仓位保留开仓价和止损止盈；超量平仓报错
+func TestBacktestAccount_ClosePartial(t *testing.T) {
+	acc := NewBacktestAccount(10000, 10, 0)
+	if _, _, _, err := acc.Open("BTCUSDT", "long", 10, 5, 100, 90, 120, 1, false); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	cashBefore := acc.Cash()
+
+	realized, fee, execPrice, remaining, err := acc.ClosePartial("BTCUSDT", "long", 5, 110)
+	if err != nil {
+		t.Fatalf("ClosePartial: %v", err)
+	}
+	if execPrice != 110 {
+		t.Errorf("execPrice = %v, want 110", execPrice)
+	}
+	if math.Abs(realized-50) > 1e-9 {
+		t.Errorf("realized = %.6f, want 50", realized)
+	}
+	if want := 5 * 110 * 0.001; math.Abs(fee-want) > 1e-9 {
+		t.Errorf("fee = %.6f, want %.6f", fee, want)
+	}
+	if remaining != 5 {
+		t.Errorf("remaining = %v, want 5", remaining)
+	}
+	// 释放一半保证金（200 → 100）加上已实现盈亏、扣除手续费
+	if want := cashBefore + 100 + realized - fee; math.Abs(acc.Cash()-want) > 1e-9 {
+		t.Errorf("cash = %.6f, want %.6f", acc.Cash(), want)
+	}
+
+	positions := acc.Positions()
+	if len(positions) != 1 {
+		t.Fatalf("positions = %d, want 1", len(positions))
+	}
+	pos := positions[0]
+	if pos.Quantity != 5 || pos.EntryPrice != 100 || pos.StopLoss != 90 || pos.TakeProfit != 120 {
+		t.Errorf("remaining position = qty %.4f entry %.4f sl %.4f tp %.4f, want 5/100/90/120",
+			pos.Quantity, pos.EntryPrice, pos.StopLoss, pos.TakeProfit)
+	}
+	if math.Abs(pos.Margin-100) > 1e-9 {
+		t.Errorf("margin = %.6f, want 100", pos.Margin)
+	}
+	if want := computeLiquidation(100, 5, "long"); math.Abs(pos.LiquidationPrice-want) > 1e-9 {
+		t.Errorf("liquidation price = %.6f, want %.6f", pos.LiquidationPrice, want)
+	}
+
+	if _, _, _, _, err := acc.ClosePartial("BTCUSDT", "long", 6, 110); err == nil {
+		t.Error("closing more than the open quantity should fail")
+	}
+	if got := acc.Positions()[0].Quantity; got != 5 {
+		t.Errorf("failed over-close changed quantity to %v", got)
+	}
+
+	// 平掉剩余部分后持仓移除
+	if _, _, _, remaining, err := acc.ClosePartial("BTCUSDT", "long", 5, 110); err != nil || remaining != 0 {
+		t.Errorf("closing the rest: remaining = %v, err = %v", remaining, err)
+	}
+	if len(acc.Positions()) != 0 {
+		t.Errorf("position should be removed after full close")
+	}
+}
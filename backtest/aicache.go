@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 
 	"nofx/decision"
 	"nofx/market"
@@ -25,6 +26,10 @@ type AICache struct {
 	mu      sync.RWMutex
 	path    string
 	Entries map[string]cachedDecision `json:"entries"`
+
+	// 命中/未命中计数（仅统计本进程内的 Get 调用，不持久化）
+	hits   atomic.Int64
+	misses atomic.Int64
 }
 
 func LoadAICache(path string) (*AICache, error) {
@@ -75,11 +80,21 @@ func (c *AICache) Get(key string) (*decision.FullDecision, bool) {
 	entry, ok := c.Entries[key]
 	c.mu.RUnlock()
 	if !ok || entry.Decision == nil {
+		c.misses.Add(1)
 		return nil, false
 	}
+	c.hits.Add(1)
 	return cloneDecision(entry.Decision), true
 }
 
+// Stats 返回缓存自加载以来的命中与未命中次数；多个回测共享同一缓存实例时为累计值。
+func (c *AICache) Stats() (hits, misses int) {
+	if c == nil {
+		return 0, 0
+	}
+	return int(c.hits.Load()), int(c.misses.Load())
+}
+
 func (c *AICache) Put(key string, variant string, ts int64, decision *decision.FullDecision) error {
 	if c == nil || key == "" || decision == nil {
 		return nil
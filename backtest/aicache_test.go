@@ -0,0 +1,87 @@
+package backtest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nofx/decision"
+)
+
+// TestAICacheStats 测试缓存命中/未命中计数及运行级命中率
+func TestAICacheStats(t *testing.T) {
+	cache, err := LoadAICache(filepath.Join(t.TempDir(), "ai_cache.json"))
+	if err != nil {
+		t.Fatalf("LoadAICache: %v", err)
+	}
+	r := &Runner{aiCache: cache}
+	if rate := r.aiCacheHitRate(); rate != 0 {
+		t.Fatalf("hit rate before any lookup = %v, want 0", rate)
+	}
+
+	if _, ok := r.lookupAICache("k1"); ok {
+		t.Fatal("expected cache miss for unknown key")
+	}
+	if err := cache.Put("k1", "", 1000, &decision.FullDecision{Decisions: []decision.Decision{{Symbol: "BTCUSDT", Action: "wait"}}}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, ok := r.lookupAICache("k1"); !ok {
+		t.Fatal("expected cache hit after Put")
+	}
+
+	if hits, misses := cache.Stats(); hits != 1 || misses != 1 {
+		t.Errorf("Stats() = (%d, %d), want (1, 1)", hits, misses)
+	}
+	if rate := r.aiCacheHitRate(); rate != 0.5 {
+		t.Errorf("hit rate = %v, want 0.5", rate)
+	}
+
+	// 共享同一缓存的另一运行只统计自身查询
+	other := &Runner{aiCache: cache}
+	if _, ok := other.lookupAICache("k1"); !ok {
+		t.Fatal("expected cache hit for shared cache")
+	}
+	if rate := other.aiCacheHitRate(); rate != 1 {
+		t.Errorf("shared cache run hit rate = %v, want 1", rate)
+	}
+	if rate := r.aiCacheHitRate(); rate != 0.5 {
+		t.Errorf("hit rate after other run lookup = %v, want 0.5", rate)
+	}
+
+	// 未启用缓存的运行命中率为 0
+	if rate := (&Runner{}).aiCacheHitRate(); rate != 0 {
+		t.Errorf("hit rate without cache = %v, want 0", rate)
+	}
+}
+
+// TestAICachePutOmitsRawResponse 测试原始 AI 回复不会写入缓存文件
+func TestAICachePutOmitsRawResponse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ai_cache.json")
+	cache, err := LoadAICache(path)
+	if err != nil {
+		t.Fatalf("LoadAICache: %v", err)
+	}
+	dec := &decision.FullDecision{
+		Decisions:   []decision.Decision{{Symbol: "BTCUSDT", Action: "wait"}},
+		RawResponse: "raw text with sk-secret",
+	}
+	if err := cache.Put("k1", "", 1000, dec); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read cache file: %v", err)
+	}
+	if strings.Contains(string(data), "sk-secret") {
+		t.Errorf("cache file contains raw AI response: %s", data)
+	}
+	cached, ok := cache.Get("k1")
+	if !ok {
+		t.Fatal("expected cache hit after Put")
+	}
+	if cached.RawResponse != "" {
+		t.Errorf("cached decision RawResponse = %q, want empty", cached.RawResponse)
+	}
+}
@@ -23,6 +23,18 @@ type LeverageConfig struct {
 	AltcoinLeverage int `json:"altcoin_leverage"`
 }
 
+// SymbolFeeConfig 单个标的的手续费覆盖（替代全局 fee_bps / maker_fee_bps）。
+type SymbolFeeConfig struct {
+	MakerBps float64 `json:"maker_bps"` // 限价挂单及按成交策略取价成交的费率，负值表示返佣
+	TakerBps float64 `json:"taker_bps"` // 市价成交（止损止盈、成交策略无法取价）的费率
+}
+
+// DrawdownDeleverageConfig 回撤降杠杆配置：净值相对峰值回撤超过阈值后，开仓杠杆乘以系数。
+type DrawdownDeleverageConfig struct {
+	ThresholdPct float64 `json:"threshold_pct"` // 触发降杠杆的回撤百分比，0 表示关闭
+	Factor       float64 `json:"factor"`        // 杠杆系数 (0,1]，默认 0.5（减半）
+}
+
 // BacktestConfig 描述一次回测运行的输入配置。
 type BacktestConfig struct {
 	RunID                string   `json:"run_id"`
@@ -47,11 +59,75 @@ type BacktestConfig struct {
 
 	AICfg    AIConfig       `json:"ai"`
 	Leverage LeverageConfig `json:"leverage"`
+	// SymbolLeverage 按标的覆盖杠杆（如山寨币限制 2x、主流币 10x），优先于 AI 请求的杠杆和 leverage 中的分类默认值
+	SymbolLeverage map[string]int `json:"symbol_leverage,omitempty"`
+	// QuantityPrecision 按标的设置下单数量的小数位数（对应实盘 stepSize），开仓数量向下取整；未设置的标的不取整
+	QuantityPrecision map[string]int `json:"quantity_precision,omitempty"`
 
 	SharedAICachePath         string `json:"ai_cache_path,omitempty"`
 	CheckpointIntervalBars    int    `json:"checkpoint_interval_bars,omitempty"`
 	CheckpointIntervalSeconds int    `json:"checkpoint_interval_seconds,omitempty"`
 	ReplayDecisionDir         string `json:"replay_decision_dir,omitempty"`
+
+	// PersistRawAIResponse 是否在决策日志中保存 AI 完整原始响应（用于审计，默认关闭避免日志膨胀）
+	PersistRawAIResponse bool `json:"persist_raw_ai_response,omitempty"`
+
+	// ABPrompts 同一回测中轮换使用的提示词模板列表（A/B 测试），为空时使用 PromptTemplate
+	// 每个周期选用的模板会写入决策记录的 PromptHash，便于按 prompt 分组统计
+	ABPrompts    []string `json:"ab_prompts,omitempty"`
+	ABPromptMode string   `json:"ab_prompt_mode,omitempty"` // round_robin（默认）或 hash
+
+	// StreamFormat 资金曲线/交易事件的存储格式：jsonl（默认）或 binary（更紧凑，读取更快）
+	StreamFormat string `json:"stream_format,omitempty"`
+
+	// PriceBandPct 开仓前价格合理性检查：成交价偏离参考价（上一根K线收盘价）超过该百分比则拒单（平仓不受限），0 表示关闭
+	PriceBandPct float64 `json:"price_band_pct,omitempty"`
+
+	// MaxPositionNotionalUSD 单个持仓名义价值上限（qty*price），超出时截断开仓数量，0 表示不限制
+	MaxPositionNotionalUSD float64 `json:"max_position_notional_usd,omitempty"`
+
+	// DrawdownDeleverage 回撤超过阈值时降低开仓杠杆，净值回升后恢复
+	DrawdownDeleverage DrawdownDeleverageConfig `json:"drawdown_deleverage"`
+
+	// MakerFeeBps 挂单类（maker）成交费率，适用于限价单及按 fill_policy 取价的开平仓，0 表示免手续费，负值表示返佣
+	MakerFeeBps float64 `json:"maker_fee_bps,omitempty"`
+	// LimitOrderExpiryBars 限价开仓单的有效K线数，超过仍未成交则撤单（默认 3）
+	LimitOrderExpiryBars int `json:"limit_order_expiry_bars,omitempty"`
+	// SymbolFees 按标的覆盖 maker/taker 费率（如做市策略：挂单开仓返佣、市价平仓付 taker）
+	SymbolFees map[string]SymbolFeeConfig `json:"symbol_fees,omitempty"`
+
+	// CacheCheckIntervalSeconds 后台校验交易缓存与决策文件一致性的间隔（秒），0 表示关闭
+	CacheCheckIntervalSeconds int `json:"cache_check_interval_seconds,omitempty"`
+
+	// FundingRateBps 每个结算周期的资金费率（基点），正值表示多头向空头支付，0 表示不模拟资金费
+	FundingRateBps float64 `json:"funding_rate_bps,omitempty"`
+	// FundingIntervalHours 资金费结算间隔（小时，从 UTC 0 点起算），默认 8
+	FundingIntervalHours int `json:"funding_interval_hours,omitempty"`
+
+	// SlippageModel 滑点模型：fixed（默认，固定 slippage_bps）或 volume_impact（额外按订单价值/K线成交额放大）
+	SlippageModel string `json:"slippage_model,omitempty"`
+
+	// DailyLossLimitPct 日内亏损熔断阈值（%）：当日权益较 UTC 日初回撤达到该值后，当日不再开新仓，0 表示不启用
+	DailyLossLimitPct float64 `json:"daily_loss_limit_pct,omitempty"`
+
+	// MaxHoldBars 最长持仓时间（决策K线根数），持仓超过该根数后按当根K线价格强制平仓，0 表示不限制
+	MaxHoldBars int `json:"max_hold_bars,omitempty"`
+	// MaxOpenPositions 同时持有的最大持仓数，达到上限后拒绝开新仓（平仓不受影响），0 表示不限制
+	MaxOpenPositions int `json:"max_open_positions,omitempty"`
+
+	// DecisionLatencyBars 决策延迟（决策K线根数），模拟 AI 调用耗时：市价决策按决策K线之后第 N 根K线的开盘价成交，0 表示不延迟
+	DecisionLatencyBars int `json:"decision_latency_bars,omitempty"`
+
+	// MarginMode 保证金模式：isolated（默认，逐仓按单个持仓爆仓价强平）或 cross（全仓，账户权益低于总维持保证金时整体强平）
+	MarginMode string `json:"margin_mode,omitempty"`
+
+	// LiquidationFeeBps 强平罚金费率（基点），在正常 taker 平仓手续费之外额外收取，默认 0
+	LiquidationFeeBps float64 `json:"liquidation_fee_bps,omitempty"`
+
+	// SizingMode 开仓仓位计算方式：fixed_fraction（默认，使用 AI 给出的仓位或权益的 5%）或 atr_risk（按 ATR 波动率归一化）
+	SizingMode string `json:"sizing_mode,omitempty"`
+	// RiskPerTradePct atr_risk 模式下价格逆向波动一个 ATR 时损失的权益百分比，默认 1
+	RiskPerTradePct float64 `json:"risk_per_trade_pct,omitempty"`
 }
 
 // Validate 对配置进行合法性检查并填充默认值。
@@ -134,6 +210,131 @@ func (cfg *BacktestConfig) Validate() error {
 	}
 	cfg.CustomPrompt = strings.TrimSpace(cfg.CustomPrompt)
 
+	abPrompts := make([]string, 0, len(cfg.ABPrompts))
+	for _, name := range cfg.ABPrompts {
+		if name = strings.TrimSpace(name); name != "" {
+			abPrompts = append(abPrompts, name)
+		}
+	}
+	cfg.ABPrompts = abPrompts
+	cfg.ABPromptMode = strings.TrimSpace(cfg.ABPromptMode)
+	if cfg.ABPromptMode == "" {
+		cfg.ABPromptMode = ABPromptModeRoundRobin
+	}
+	if cfg.ABPromptMode != ABPromptModeRoundRobin && cfg.ABPromptMode != ABPromptModeHash {
+		return fmt.Errorf("unsupported ab_prompt_mode '%s'", cfg.ABPromptMode)
+	}
+
+	cfg.StreamFormat = strings.TrimSpace(cfg.StreamFormat)
+	if cfg.StreamFormat == "" {
+		cfg.StreamFormat = StreamFormatJSONL
+	}
+	if err := validateStreamFormat(cfg.StreamFormat); err != nil {
+		return err
+	}
+
+	if cfg.PriceBandPct < 0 {
+		return fmt.Errorf("price_band_pct cannot be negative")
+	}
+	if cfg.MaxPositionNotionalUSD < 0 {
+		return fmt.Errorf("max_position_notional_usd cannot be negative")
+	}
+	if len(cfg.SymbolFees) > 0 {
+		normalized := make(map[string]SymbolFeeConfig, len(cfg.SymbolFees))
+		for sym, fees := range cfg.SymbolFees {
+			if fees.TakerBps < 0 {
+				return fmt.Errorf("symbol_fees[%s].taker_bps cannot be negative", sym)
+			}
+			normalized[market.Normalize(sym)] = fees
+		}
+		cfg.SymbolFees = normalized
+	}
+	if len(cfg.SymbolLeverage) > 0 {
+		normalized := make(map[string]int, len(cfg.SymbolLeverage))
+		for sym, leverage := range cfg.SymbolLeverage {
+			if leverage <= 0 {
+				return fmt.Errorf("symbol_leverage[%s] must be positive", sym)
+			}
+			normalized[market.Normalize(sym)] = leverage
+		}
+		cfg.SymbolLeverage = normalized
+	}
+	if len(cfg.QuantityPrecision) > 0 {
+		normalized := make(map[string]int, len(cfg.QuantityPrecision))
+		for sym, precision := range cfg.QuantityPrecision {
+			if precision < 0 {
+				return fmt.Errorf("quantity_precision[%s] cannot be negative", sym)
+			}
+			normalized[market.Normalize(sym)] = precision
+		}
+		cfg.QuantityPrecision = normalized
+	}
+	if cfg.CacheCheckIntervalSeconds < 0 {
+		return fmt.Errorf("cache_check_interval_seconds cannot be negative")
+	}
+	if cfg.LimitOrderExpiryBars <= 0 {
+		cfg.LimitOrderExpiryBars = defaultLimitOrderExpiryBars
+	}
+	cfg.SlippageModel = strings.TrimSpace(cfg.SlippageModel)
+	if cfg.SlippageModel == "" {
+		cfg.SlippageModel = SlippageModelFixed
+	}
+	if cfg.SlippageModel != SlippageModelFixed && cfg.SlippageModel != SlippageModelVolumeImpact {
+		return fmt.Errorf("unsupported slippage_model '%s'", cfg.SlippageModel)
+	}
+	if cfg.LiquidationFeeBps < 0 {
+		return fmt.Errorf("liquidation_fee_bps cannot be negative")
+	}
+	cfg.MarginMode = strings.ToLower(strings.TrimSpace(cfg.MarginMode))
+	if cfg.MarginMode == "" {
+		cfg.MarginMode = MarginModeIsolated
+	}
+	if cfg.MarginMode != MarginModeIsolated && cfg.MarginMode != MarginModeCross {
+		return fmt.Errorf("unsupported margin_mode '%s'", cfg.MarginMode)
+	}
+	cfg.SizingMode = strings.ToLower(strings.TrimSpace(cfg.SizingMode))
+	if cfg.SizingMode == "" {
+		cfg.SizingMode = SizingModeFixedFraction
+	}
+	if cfg.SizingMode != SizingModeFixedFraction && cfg.SizingMode != SizingModeATRRisk {
+		return fmt.Errorf("unsupported sizing_mode '%s'", cfg.SizingMode)
+	}
+	if cfg.RiskPerTradePct < 0 || cfg.RiskPerTradePct >= 100 {
+		return fmt.Errorf("risk_per_trade_pct must be in [0,100)")
+	}
+	if cfg.SizingMode == SizingModeATRRisk && cfg.RiskPerTradePct == 0 {
+		cfg.RiskPerTradePct = defaultRiskPerTradePct
+	}
+	if cfg.DailyLossLimitPct < 0 || cfg.DailyLossLimitPct >= 100 {
+		return fmt.Errorf("daily_loss_limit_pct must be in [0,100)")
+	}
+	if cfg.MaxHoldBars < 0 {
+		return fmt.Errorf("max_hold_bars cannot be negative")
+	}
+	if cfg.MaxOpenPositions < 0 {
+		return fmt.Errorf("max_open_positions cannot be negative")
+	}
+	if cfg.DecisionLatencyBars < 0 {
+		return fmt.Errorf("decision_latency_bars cannot be negative")
+	}
+	if cfg.FundingIntervalHours < 0 {
+		return fmt.Errorf("funding_interval_hours cannot be negative")
+	}
+	if cfg.FundingIntervalHours == 0 {
+		cfg.FundingIntervalHours = defaultFundingIntervalHours
+	}
+	if cfg.DrawdownDeleverage.ThresholdPct < 0 {
+		return fmt.Errorf("drawdown_deleverage.threshold_pct cannot be negative")
+	}
+	if cfg.DrawdownDeleverage.ThresholdPct > 0 {
+		if cfg.DrawdownDeleverage.Factor == 0 {
+			cfg.DrawdownDeleverage.Factor = 0.5
+		}
+		if cfg.DrawdownDeleverage.Factor < 0 || cfg.DrawdownDeleverage.Factor > 1 {
+			return fmt.Errorf("drawdown_deleverage.factor must be within (0, 1]")
+		}
+	}
+
 	if cfg.AICfg.Provider == "" {
 		cfg.AICfg.Provider = "inherit"
 	}
@@ -159,18 +360,57 @@ func (cfg *BacktestConfig) Duration() time.Duration {
 	return time.Unix(cfg.EndTS, 0).Sub(time.Unix(cfg.StartTS, 0))
 }
 
+// defaultLimitOrderExpiryBars 限价开仓单默认有效K线数。
+const defaultLimitOrderExpiryBars = 3
+
+// defaultFundingIntervalHours 资金费默认结算间隔（小时）。
+const defaultFundingIntervalHours = 8
+
+// defaultRiskPerTradePct atr_risk 模式下默认每笔风险（权益百分比）。
+const defaultRiskPerTradePct = 1.0
+
 const (
 	// FillPolicyNextOpen 使用下一根 K 线的开盘价成交。
 	FillPolicyNextOpen = "next_open"
-	// FillPolicyBarVWAP 采用当前 K 线的近似 VWAP 成交。
+	// FillPolicyBarVWAP 采用当前 K 线的近似 VWAP（OHLC 均价）成交。
 	FillPolicyBarVWAP = "bar_vwap"
+	// FillPolicyTrueVWAP 采用决策 K 线区间内按成交量加权的真实 VWAP 成交（优先使用已加载的更细周期K线）。
+	FillPolicyTrueVWAP = "true_vwap"
 	// FillPolicyMidPrice 采用 (high+low)/2 的中间价成交。
 	FillPolicyMidPrice = "mid"
 )
 
+const (
+	// MarginModeIsolated 逐仓：每个持仓独立计算爆仓价。
+	MarginModeIsolated = "isolated"
+	// MarginModeCross 全仓：账户全部余额共同担保所有持仓。
+	MarginModeCross = "cross"
+)
+
+const (
+	// SlippageModelFixed 固定滑点：每笔成交按 slippage_bps 计算。
+	SlippageModelFixed = "fixed"
+	// SlippageModelVolumeImpact 成交量冲击：在固定滑点之外，按 slippage_bps × 订单价值/K线成交额 额外调整成交价。
+	SlippageModelVolumeImpact = "volume_impact"
+)
+
+const (
+	// SizingModeFixedFraction 固定比例：使用 AI 给出的仓位金额，未给出时取权益的 5%。
+	SizingModeFixedFraction = "fixed_fraction"
+	// SizingModeATRRisk ATR 风险仓位：价格逆向波动一个 ATR 时恰好损失 risk_per_trade_pct 的权益。
+	SizingModeATRRisk = "atr_risk"
+)
+
+const (
+	// ABPromptModeRoundRobin 按决策周期依次轮换模板。
+	ABPromptModeRoundRobin = "round_robin"
+	// ABPromptModeHash 按 run_id + 周期号哈希选择模板（可复现的伪随机分配）。
+	ABPromptModeHash = "hash"
+)
+
 func validateFillPolicy(policy string) error {
 	switch policy {
-	case FillPolicyNextOpen, FillPolicyBarVWAP, FillPolicyMidPrice:
+	case FillPolicyNextOpen, FillPolicyBarVWAP, FillPolicyTrueVWAP, FillPolicyMidPrice:
 		return nil
 	default:
 		return fmt.Errorf("unsupported fill_policy '%s'", policy)
@@ -127,6 +127,13 @@ func (df *DataFeed) DecisionTimestamp(index int) int64 {
 	return df.decisionTimes[index]
 }
 
+// decisionBarIndex 返回不早于 ts 的第一根决策K线下标，ts 晚于全部决策K线时返回 DecisionBarCount()。
+func (df *DataFeed) decisionBarIndex(ts int64) int {
+	return sort.Search(len(df.decisionTimes), func(i int) bool {
+		return df.decisionTimes[i] >= ts
+	})
+}
+
 func (df *DataFeed) sliceUpTo(symbol, tf string, ts int64) []market.Kline {
 	series := df.symbolSeries[symbol].byTF[tf]
 	idx := sort.Search(len(series.closeTimes), func(i int) bool {
@@ -153,7 +160,7 @@ func (df *DataFeed) BuildMarketData(ts int64) (map[string]*market.Data, map[stri
 			if df.longerTF != "" && df.longerTF != tf {
 				longer = df.sliceUpTo(symbol, df.longerTF, ts)
 			}
-			data, err := market.BuildDataFromKlines(symbol, series, longer)
+			data, err := market.BuildDataFromKlinesAt(symbol, series, longer, ts)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -192,3 +199,91 @@ func (df *DataFeed) decisionBarSnapshot(symbol string, ts int64) (*market.Kline,
 	}
 	return curr, next
 }
+
+// primaryBarAfter 返回收盘时间为 ts 的主周期K线之后第 n 根K线，ts 不是K线收盘时间或超出数据范围时返回 nil。
+func (df *DataFeed) primaryBarAfter(symbol string, ts int64, n int) *market.Kline {
+	ss, ok := df.symbolSeries[symbol]
+	if !ok {
+		return nil
+	}
+	series, ok := ss.byTF[df.primaryTF]
+	if !ok {
+		return nil
+	}
+	idx := sort.Search(len(series.closeTimes), func(i int) bool {
+		return series.closeTimes[i] >= ts
+	})
+	if idx >= len(series.closeTimes) || series.closeTimes[idx] != ts || idx+n >= len(series.klines) {
+		return nil
+	}
+	return &series.klines[idx+n]
+}
+
+// barQuoteVolume 返回决策K线的成交额（计价币），缺少成交额时用 成交量×收盘价 估算，无数据返回 0。
+func (df *DataFeed) barQuoteVolume(symbol string, ts int64) float64 {
+	curr, _ := df.decisionBarSnapshot(symbol, ts)
+	if curr == nil {
+		return 0
+	}
+	if curr.QuoteVolume > 0 {
+		return curr.QuoteVolume
+	}
+	return curr.Volume * curr.Close
+}
+
+// intrabarKlines 返回决策K线时间区间内已加载的最细周期K线，用于计算真实 VWAP；
+// 未加载更细周期或区间内无数据时返回决策K线本身，找不到决策K线返回 nil。
+func (df *DataFeed) intrabarKlines(symbol string, ts int64) []market.Kline {
+	curr, _ := df.decisionBarSnapshot(symbol, ts)
+	if curr == nil {
+		return nil
+	}
+	fallback := []market.Kline{*curr}
+
+	finestTF := df.primaryTF
+	finestDur, err := market.TFDuration(df.primaryTF)
+	if err != nil {
+		return fallback
+	}
+	ss := df.symbolSeries[symbol]
+	for tf := range ss.byTF {
+		dur, err := market.TFDuration(tf)
+		if err == nil && dur < finestDur {
+			finestTF, finestDur = tf, dur
+		}
+	}
+	if finestTF == df.primaryTF {
+		return fallback
+	}
+
+	series := ss.byTF[finestTF]
+	start := sort.Search(len(series.klines), func(i int) bool {
+		return series.klines[i].OpenTime >= curr.OpenTime
+	})
+	end := sort.Search(len(series.closeTimes), func(i int) bool {
+		return series.closeTimes[i] > ts
+	})
+	if start >= end {
+		return fallback
+	}
+	return series.klines[start:end]
+}
+
+// previousClose 返回决策K线之前一根已收盘K线的收盘价（不存在时返回 0）。
+func (df *DataFeed) previousClose(symbol string, ts int64) float64 {
+	ss, ok := df.symbolSeries[symbol]
+	if !ok {
+		return 0
+	}
+	series, ok := ss.byTF[df.primaryTF]
+	if !ok {
+		return 0
+	}
+	idx := sort.Search(len(series.closeTimes), func(i int) bool {
+		return series.closeTimes[i] >= ts
+	})
+	if idx <= 0 || idx > len(series.klines) {
+		return 0
+	}
+	return series.klines[idx-1].Close
+}
@@ -0,0 +1,256 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"nofx/mcp"
+)
+
+// maxGridWorkers 参数网格扫描的最大并发回测数。
+const maxGridWorkers = 4
+
+// GridResult 记录参数网格中单个组合的回测结果。
+type GridResult struct {
+	RunID   string                 `json:"run_id"`
+	Params  map[string]interface{} `json:"params"`
+	State   RunState               `json:"state"`
+	Metrics *Metrics               `json:"metrics,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// RunGrid 展开参数网格的笛卡尔积，对每个组合运行一次回测并收集最终指标。
+// 支持的参数键：leverage（同时设置 BTC/ETH 与山寨币杠杆）、btc_eth_leverage、altcoin_leverage、
+// decision_cadence_nbars、fee_bps、slippage_bps、fill_policy、prompt_template。
+// 每个组合的 run_id 为 base.RunID_gridNNN；配置 SharedAICachePath 时所有组合共享同一份 AI 缓存以节省调用。
+// 结果按组合展开顺序返回，单个组合失败记录在 GridResult.Error 中，不影响其他组合。
+func RunGrid(base BacktestConfig, grid map[string][]interface{}, mcpClient mcp.AIClient) ([]GridResult, error) {
+	return runGrid(base, grid, mcpClient, NewDataFeed)
+}
+
+func runGrid(base BacktestConfig, grid map[string][]interface{}, mcpClient mcp.AIClient, newFeed func(BacktestConfig) (*DataFeed, error)) ([]GridResult, error) {
+	combos, err := expandGrid(grid)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先校验全部组合，避免跑到一半才发现非法参数
+	configs := make([]BacktestConfig, len(combos))
+	for i, params := range combos {
+		cfg := cloneConfig(base)
+		cfg.RunID = fmt.Sprintf("%s_grid%03d", base.RunID, i+1)
+		for key, value := range params {
+			if err := applyGridParam(&cfg, key, value); err != nil {
+				return nil, err
+			}
+		}
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("grid combo %v: %w", params, err)
+		}
+		configs[i] = cfg
+	}
+
+	var sharedCache *AICache
+	if base.SharedAICachePath != "" {
+		sharedCache, err = LoadAICache(base.SharedAICachePath)
+		if err != nil {
+			return nil, fmt.Errorf("load shared ai cache: %w", err)
+		}
+	}
+
+	results := make([]GridResult, len(configs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	workers := min(maxGridWorkers, len(configs))
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = runGridCombo(configs[i], combos[i], mcpClient, newFeed, sharedCache)
+			}
+		}()
+	}
+	for i := range configs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, nil
+}
+
+// runGridCombo 同步运行单个组合直至结束（完成、爆仓或失败）。
+func runGridCombo(cfg BacktestConfig, params map[string]interface{}, mcpClient mcp.AIClient, newFeed func(BacktestConfig) (*DataFeed, error), sharedCache *AICache) GridResult {
+	result := GridResult{RunID: cfg.RunID, Params: params, State: RunStateFailed}
+
+	persistCfg := cfg
+	persistCfg.AICfg.APIKey = ""
+	if err := SaveConfig(cfg.RunID, &persistCfg); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// 通过 newRunnerWithFeed 获取运行锁，与其他进程中的同名回测互斥
+	runner, err := newRunnerWithFeed(cfg, mcpClient, newFeed)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if sharedCache != nil {
+		runner.aiCache = sharedCache
+		runner.cachePath = sharedCache.Path()
+	}
+
+	if err := runner.Start(context.Background()); err != nil {
+		runner.releaseLock()
+		result.Error = err.Error()
+		return result
+	}
+	runErr := runner.Wait()
+	result.State = runner.Status()
+	if runErr != nil && !errors.Is(runErr, errLiquidated) {
+		result.Error = runErr.Error()
+	}
+
+	state := runner.snapshotState()
+	metrics, err := CalculateMetrics(cfg.RunID, &runner.cfg, &state)
+	if err != nil {
+		if result.Error == "" {
+			result.Error = err.Error()
+		}
+		return result
+	}
+	metrics.AICacheHitRate = runner.aiCacheHitRate()
+	result.Metrics = metrics
+	return result
+}
+
+// expandGrid 按参数名排序后展开笛卡尔积，保证组合顺序稳定。
+func expandGrid(grid map[string][]interface{}) ([]map[string]interface{}, error) {
+	if len(grid) == 0 {
+		return nil, fmt.Errorf("grid is empty")
+	}
+	keys := make([]string, 0, len(grid))
+	for key, values := range grid {
+		if len(values) == 0 {
+			return nil, fmt.Errorf("grid parameter %s has no values", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	combos := []map[string]interface{}{{}}
+	for _, key := range keys {
+		next := make([]map[string]interface{}, 0, len(combos)*len(grid[key]))
+		for _, combo := range combos {
+			for _, value := range grid[key] {
+				expanded := make(map[string]interface{}, len(combo)+1)
+				for k, v := range combo {
+					expanded[k] = v
+				}
+				expanded[key] = value
+				next = append(next, expanded)
+			}
+		}
+		combos = next
+	}
+	return combos, nil
+}
+
+// applyGridParam 将单个网格参数写入配置。
+func applyGridParam(cfg *BacktestConfig, key string, value interface{}) error {
+	var err error
+	switch key {
+	case "leverage":
+		var n int
+		if n, err = gridInt(key, value); err == nil {
+			cfg.Leverage.BTCETHLeverage = n
+			cfg.Leverage.AltcoinLeverage = n
+		}
+	case "btc_eth_leverage":
+		cfg.Leverage.BTCETHLeverage, err = gridInt(key, value)
+	case "altcoin_leverage":
+		cfg.Leverage.AltcoinLeverage, err = gridInt(key, value)
+	case "decision_cadence_nbars":
+		cfg.DecisionCadenceNBars, err = gridInt(key, value)
+	case "fee_bps":
+		cfg.FeeBps, err = gridFloat(key, value)
+	case "slippage_bps":
+		cfg.SlippageBps, err = gridFloat(key, value)
+	case "fill_policy":
+		cfg.FillPolicy, err = gridString(key, value)
+	case "prompt_template":
+		cfg.PromptTemplate, err = gridString(key, value)
+	default:
+		return fmt.Errorf("unsupported grid parameter %s", key)
+	}
+	return err
+}
+
+// gridInt 将网格参数值转换为整数（兼容 JSON 解码得到的 float64）。
+func gridInt(key string, value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v == math.Trunc(v) {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("grid parameter %s expects integer, got %v", key, value)
+}
+
+// gridFloat 将网格参数值转换为浮点数。
+func gridFloat(key string, value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	}
+	return 0, fmt.Errorf("grid parameter %s expects number, got %v", key, value)
+}
+
+// gridString 将网格参数值转换为字符串。
+func gridString(key string, value interface{}) (string, error) {
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	return "", fmt.Errorf("grid parameter %s expects string, got %T", key, value)
+}
+
+// cloneConfig 复制配置中的切片与映射，避免 Validate 就地规范化时影响其他组合。
+func cloneConfig(base BacktestConfig) BacktestConfig {
+	cfg := base
+	cfg.Symbols = append([]string(nil), base.Symbols...)
+	cfg.Timeframes = append([]string(nil), base.Timeframes...)
+	cfg.ABPrompts = append([]string(nil), base.ABPrompts...)
+	if base.SymbolFees != nil {
+		cfg.SymbolFees = make(map[string]SymbolFeeConfig, len(base.SymbolFees))
+		for sym, fees := range base.SymbolFees {
+			cfg.SymbolFees[sym] = fees
+		}
+	}
+	if base.SymbolLeverage != nil {
+		cfg.SymbolLeverage = make(map[string]int, len(base.SymbolLeverage))
+		for sym, leverage := range base.SymbolLeverage {
+			cfg.SymbolLeverage[sym] = leverage
+		}
+	}
+	if base.QuantityPrecision != nil {
+		cfg.QuantityPrecision = make(map[string]int, len(base.QuantityPrecision))
+		for sym, precision := range base.QuantityPrecision {
+			cfg.QuantityPrecision[sym] = precision
+		}
+	}
+	return cfg
+}
@@ -0,0 +1,175 @@
+package backtest
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"nofx/decision"
+	"nofx/market"
+	"nofx/mcp"
+)
+
+// stubAIClient 返回固定响应并计数的 AI 客户端（嵌入 mcp.Client 以满足接口的未导出方法）
+type stubAIClient struct {
+	*mcp.Client
+	calls atomic.Int32
+}
+
+func (c *stubAIClient) CallWithMessages(systemPrompt, userPrompt string) (string, error) {
+	c.calls.Add(1)
+	return `<decision>[{"symbol":"BTCUSDT","action":"wait"}]</decision>`, nil
+}
+
+// TestRunGrid 测试参数网格展开、逐组合运行并收集指标
+func TestRunGrid(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	const barMs = int64(5 * 60 * 1000)
+	klines := make([]market.Kline, 40)
+	closeTimes := make([]int64, len(klines))
+	for i := range klines {
+		klines[i] = market.Kline{
+			OpenTime:  int64(i) * barMs,
+			Open:      100,
+			High:      100,
+			Low:       100,
+			Close:     100,
+			Volume:    10,
+			CloseTime: int64(i+1)*barMs - 1,
+		}
+		closeTimes[i] = klines[i].CloseTime
+	}
+	newFeed := func(cfg BacktestConfig) (*DataFeed, error) {
+		return &DataFeed{
+			cfg:           cfg,
+			symbols:       []string{"BTCUSDT"},
+			timeframes:    []string{"5m"},
+			primaryTF:     "5m",
+			decisionTimes: closeTimes[30:36],
+			symbolSeries: map[string]*symbolSeries{
+				"BTCUSDT": {byTF: map[string]*timeframeSeries{"5m": {klines: klines, closeTimes: closeTimes}}},
+			},
+		}, nil
+	}
+
+	base := BacktestConfig{
+		RunID:             "grid",
+		Symbols:           []string{"btcusdt"},
+		Timeframes:        []string{"5m"},
+		DecisionTimeframe: "5m",
+		StartTS:           closeTimes[30] / 1000,
+		EndTS:             closeTimes[35] / 1000,
+		InitialBalance:    1000,
+		CacheAI:           true,
+		SharedAICachePath: filepath.Join("shared", "ai_cache.json"),
+		// 覆盖基础提示词，测试不依赖 prompts 目录中的模板文件
+		CustomPrompt:       "grid test",
+		OverrideBasePrompt: true,
+	}
+	grid := map[string][]interface{}{
+		"leverage":               {3, 5.0},
+		"decision_cadence_nbars": {1, 3},
+	}
+
+	// 实时 AI 路径会拉取线上行情，这里预先写入共享缓存：每个决策点都命中缓存，不再调用 AI
+	cache, err := LoadAICache(base.SharedAICachePath)
+	if err != nil {
+		t.Fatalf("LoadAICache: %v", err)
+	}
+	seedCfg := cloneConfig(base)
+	if err := seedCfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	seedFeed, _ := newFeed(seedCfg)
+	for _, cadence := range []int{1, 3} {
+		for bar := 0; bar < seedFeed.DecisionBarCount(); bar += cadence {
+			ts := seedFeed.DecisionTimestamp(bar)
+			r := &Runner{cfg: seedCfg, feed: seedFeed, account: NewBacktestAccount(1000, 0, 0)}
+			marketData, multiTF, err := seedFeed.BuildMarketData(ts)
+			if err != nil {
+				t.Fatalf("BuildMarketData: %v", err)
+			}
+			ctx, _, err := r.buildDecisionContext(ts, marketData, multiTF, map[string]float64{"BTCUSDT": 100}, bar/cadence+1)
+			if err != nil {
+				t.Fatalf("buildDecisionContext: %v", err)
+			}
+			key, err := computeCacheKey(ctx, seedCfg.PromptVariant, ts)
+			if err != nil {
+				t.Fatalf("computeCacheKey: %v", err)
+			}
+			if err := cache.Put(key, seedCfg.PromptVariant, ts, &decision.FullDecision{Decisions: []decision.Decision{
+				{Symbol: "BTCUSDT", Action: "wait"},
+			}}); err != nil {
+				t.Fatalf("cache.Put: %v", err)
+			}
+		}
+	}
+	client := &stubAIClient{Client: &mcp.Client{}}
+
+	results, err := runGrid(base, grid, client, newFeed)
+	if err != nil {
+		t.Fatalf("runGrid: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("got %d results, want 4", len(results))
+	}
+
+	// 参数名排序后展开：decision_cadence_nbars 为外层，leverage 为内层
+	wantParams := []struct {
+		cadence  int
+		leverage float64
+	}{{1, 3}, {1, 5}, {3, 3}, {3, 5}}
+	for i, res := range results {
+		if res.Error != "" || res.State != RunStateCompleted || res.Metrics == nil {
+			t.Fatalf("result %d: state=%s err=%s metrics=%v", i, res.State, res.Error, res.Metrics)
+		}
+		if res.Metrics.AICacheHitRate != 1 {
+			t.Errorf("result %d ai cache hit rate = %v, want 1", i, res.Metrics.AICacheHitRate)
+		}
+		cadence, _ := gridInt("decision_cadence_nbars", res.Params["decision_cadence_nbars"])
+		leverage, _ := gridFloat("leverage", res.Params["leverage"])
+		if cadence != wantParams[i].cadence || leverage != wantParams[i].leverage {
+			t.Errorf("result %d params = %v, want cadence=%d leverage=%.0f", i, res.Params, wantParams[i].cadence, wantParams[i].leverage)
+		}
+		cfg, err := LoadConfig(res.RunID)
+		if err != nil {
+			t.Fatalf("LoadConfig(%s): %v", res.RunID, err)
+		}
+		if cfg.DecisionCadenceNBars != cadence || cfg.Leverage.BTCETHLeverage != int(leverage) {
+			t.Errorf("%s persisted config = cadence %d leverage %d", res.RunID, cfg.DecisionCadenceNBars, cfg.Leverage.BTCETHLeverage)
+		}
+		if _, err := loadRunLock(res.RunID); err == nil {
+			t.Errorf("%s lock should be released after completion", res.RunID)
+		}
+	}
+	if base.Symbols[0] != "btcusdt" {
+		t.Errorf("base config mutated: %v", base.Symbols)
+	}
+
+	if calls := client.calls.Load(); calls != 0 {
+		t.Errorf("AI calls = %d, want 0 (all decisions served by shared cache)", calls)
+	}
+}
+
+// TestRunGrid_InvalidParams 测试非法网格参数在运行前即报错
+func TestRunGrid_InvalidParams(t *testing.T) {
+	tests := []struct {
+		name string
+		grid map[string][]interface{}
+	}{
+		{"empty grid", map[string][]interface{}{}},
+		{"no values", map[string][]interface{}{"leverage": {}}},
+		{"unknown key", map[string][]interface{}{"moon_mode": {true}}},
+		{"fractional leverage", map[string][]interface{}{"leverage": {2.5}}},
+		{"invalid fill policy", map[string][]interface{}{"fill_policy": {"teleport"}}},
+	}
+	base := BacktestConfig{RunID: "grid-invalid", Symbols: []string{"BTCUSDT"}, StartTS: 1, EndTS: 2}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := runGrid(base, tt.grid, nil, NewDataFeed); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -14,7 +14,7 @@ func TestIntraBarStopLossTrigger(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
 		// 开多仓，止损 49000
-		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0)
+		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to open position: %v", err)
 		}
@@ -54,7 +54,7 @@ func TestIntraBarStopLossTrigger(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
 		// 开多仓，止损 49000
-		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0)
+		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to open position: %v", err)
 		}
@@ -89,7 +89,7 @@ func TestIntraBarStopLossTrigger(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
 		// 开空仓，止损 3100
-		_, _, _, err := acc.Open("ETHUSDT", "short", 1.0, 10, 3000, 3100, 2900, 0)
+		_, _, _, err := acc.Open("ETHUSDT", "short", 1.0, 10, 3000, 3100, 2900, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to open position: %v", err)
 		}
@@ -113,7 +113,7 @@ func TestIntraBarStopLossTrigger(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
 		// 开多仓，止盈 52000
-		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0)
+		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to open position: %v", err)
 		}
@@ -135,7 +135,7 @@ func TestIntraBarStopLossTrigger(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
 		// 开多仓，高杠杆，接近爆仓价
-		pos, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 20, 50000, 0, 0, 0)
+		pos, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 20, 50000, 0, 0, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to open position: %v", err)
 		}
@@ -164,7 +164,7 @@ func TestStopLossVsLiquidationPriority(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
 		// 开多仓
-		pos, _, _, _ := acc.Open("BTCUSDT", "long", 0.1, 20, 50000, 49000, 52000, 0)
+		pos, _, _, _ := acc.Open("BTCUSDT", "long", 0.1, 20, 50000, 49000, 52000, 0, false)
 		liqPrice := pos.LiquidationPrice // 约 47500
 
 		// 止损价：49000
@@ -190,7 +190,7 @@ func TestAIDecisionThenStopLoss(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
 		// T0: 开仓，止损 49000，当前价 50000
-		acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0)
+		acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0, false)
 
 		// T1: 当前价仍然是 50000
 		priceMap := map[string]float64{"BTCUSDT": 50000}
@@ -229,7 +229,7 @@ func TestAIDecisionThenStopLoss(t *testing.T) {
 		priceMap := map[string]float64{"BTCUSDT": 48000}
 
 		// AI 决策：开仓，止损 49000
-		acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0)
+		acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0, false)
 
 		// 期望：立即检查并触发止损（48000 < 49000）
 		triggers := acc.CheckStopLossTakeProfit(priceMap)
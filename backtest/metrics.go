@@ -45,10 +45,26 @@ func CalculateMetrics(runID string, cfg *BacktestConfig, state *BacktestState) (
 	metrics.SharpeRatio = sharpeRatio(points)
 
 	fillTradeMetrics(metrics, events)
+	fillPnLBreakdown(metrics, events, state)
 
 	return metrics, nil
 }
 
+// fillPnLBreakdown 汇总盈亏构成：已实现盈亏、手续费与资金费来自交易事件，未实现盈亏取自当前状态。
+func fillPnLBreakdown(metrics *Metrics, events []TradeEvent, state *BacktestState) {
+	for _, evt := range events {
+		if evt.Action == "funding" {
+			metrics.TotalFundingPaid += evt.Fee
+			continue
+		}
+		metrics.RealizedPnL += evt.RealizedPnL
+		metrics.TotalFeesPaid += evt.Fee
+	}
+	if state != nil {
+		metrics.UnrealizedPnL = state.UnrealizedPnL
+	}
+}
+
 func determineLiquidation(events []TradeEvent, state *BacktestState) bool {
 	if state != nil && state.Liquidated {
 		return true
@@ -138,6 +154,11 @@ func sharpeRatio(points []EquityPoint) float64 {
 	return mean / std
 }
 
+// isCompletedTrade 判断交易事件是否计为一笔完成的交易（平仓、强平或产生已实现盈亏）。
+func isCompletedTrade(evt TradeEvent) bool {
+	return evt.LiquidationFlag || strings.HasPrefix(evt.Action, "close") || evt.RealizedPnL != 0
+}
+
 func fillTradeMetrics(metrics *Metrics, events []TradeEvent) {
 	if metrics == nil {
 		return
@@ -150,11 +171,7 @@ func fillTradeMetrics(metrics *Metrics, events []TradeEvent) {
 	totalLossAmount := 0.0
 
 	for _, evt := range events {
-		include := evt.LiquidationFlag || strings.HasPrefix(evt.Action, "close")
-		if evt.RealizedPnL != 0 {
-			include = true
-		}
-		if !include {
+		if !isCompletedTrade(evt) {
 			continue
 		}
 		totalTrades++
@@ -0,0 +1,54 @@
+package backtest
+
+import (
+	"math"
+	"testing"
+)
+
+// TestCalculateMetrics_PnLBreakdown 一笔已平仓、一笔持仓中的回测：已实现/未实现盈亏、手续费和资金费分别汇总
+func TestCalculateMetrics_PnLBreakdown(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	const runID = "pnl-run"
+	cfg := &BacktestConfig{RunID: runID, InitialBalance: 1000}
+	events := []TradeEvent{
+		{Timestamp: 1, Symbol: "BTCUSDT", Action: "open_long", Side: "long", Fee: 0.4},
+		{Timestamp: 2, Symbol: "ETHUSDT", Action: "open_short", Side: "short", Fee: 0.3},
+		{Timestamp: 3, Symbol: "BTCUSDT", Action: "funding", Side: "long", Fee: 0.25},
+		{Timestamp: 3, Symbol: "ETHUSDT", Action: "funding", Side: "short", Fee: -0.1},
+		{Timestamp: 4, Symbol: "BTCUSDT", Action: "close_long", Side: "long", Fee: 0.5, RealizedPnL: 19.5},
+	}
+	for _, evt := range events {
+		if err := appendTradeEvent(runID, evt, StreamFormatJSONL); err != nil {
+			t.Fatalf("appendTradeEvent: %v", err)
+		}
+	}
+	if err := appendEquityPoint(runID, EquityPoint{Timestamp: 4, Equity: 1012}, StreamFormatJSONL); err != nil {
+		t.Fatalf("appendEquityPoint: %v", err)
+	}
+	state := &BacktestState{Equity: 1012, UnrealizedPnL: -6.85}
+
+	metrics, err := CalculateMetrics(runID, cfg, state)
+	if err != nil {
+		t.Fatalf("CalculateMetrics: %v", err)
+	}
+
+	checks := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"RealizedPnL", metrics.RealizedPnL, 19.5},
+		{"UnrealizedPnL", metrics.UnrealizedPnL, -6.85},
+		{"TotalFeesPaid", metrics.TotalFeesPaid, 1.2},
+		{"TotalFundingPaid", metrics.TotalFundingPaid, 0.15},
+	}
+	for _, c := range checks {
+		if math.Abs(c.got-c.want) > 1e-9 {
+			t.Errorf("%s = %.4f, want %.4f", c.name, c.got, c.want)
+		}
+	}
+	if metrics.Trades != 1 {
+		t.Errorf("Trades = %d, want 1 (funding and opens are not trades)", metrics.Trades)
+	}
+}
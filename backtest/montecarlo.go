@@ -0,0 +1,126 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// MonteCarloResult 汇总交易重采样模拟的最终净值与回撤分布。
+type MonteCarloResult struct {
+	RunID           string  `json:"run_id"`
+	Iterations      int     `json:"iterations"`
+	Trades          int     `json:"trades"` // 参与重采样的交易笔数
+	InitialBalance  float64 `json:"initial_balance"`
+	EquityP5        float64 `json:"equity_p5"`        // 最终净值第 5 百分位
+	EquityP50       float64 `json:"equity_p50"`       // 最终净值中位数
+	EquityP95       float64 `json:"equity_p95"`       // 最终净值第 95 百分位
+	MaxDrawdownP50  float64 `json:"max_drawdown_p50"` // 最大回撤百分比中位数
+	MaxDrawdownP95  float64 `json:"max_drawdown_p95"` // 最大回撤百分比第 95 百分位（较差情形）
+	RuinProbability float64 `json:"ruin_probability"` // 净值曾跌至 0 及以下的路径占比
+}
+
+// MonteCarloResample 对已完成回测的交易盈亏做有放回重采样，估计最终净值置信区间与破产概率。
+func MonteCarloResample(runID string, iterations int) (*MonteCarloResult, error) {
+	return MonteCarloResampleWithSeed(runID, iterations, time.Now().UnixNano())
+}
+
+// MonteCarloResampleWithSeed 与 MonteCarloResample 相同，但使用固定随机种子（结果可复现）。
+func MonteCarloResampleWithSeed(runID string, iterations int, seed int64) (*MonteCarloResult, error) {
+	if iterations <= 0 {
+		return nil, fmt.Errorf("iterations must be positive")
+	}
+
+	cfg, err := LoadConfig(runID)
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	events, err := LoadTradeEvents(runID)
+	if err != nil {
+		return nil, fmt.Errorf("load trade events: %w", err)
+	}
+
+	var pnls []float64
+	for _, evt := range events {
+		if isCompletedTrade(evt) {
+			pnls = append(pnls, evt.RealizedPnL)
+		}
+	}
+	if len(pnls) == 0 {
+		return nil, fmt.Errorf("no completed trades in run %s", runID)
+	}
+
+	initialBalance := cfg.InitialBalance
+	if initialBalance <= 0 {
+		initialBalance = 1
+	}
+
+	result := resampleTrades(pnls, initialBalance, iterations, rand.New(rand.NewSource(seed)))
+	result.RunID = runID
+	return result, nil
+}
+
+// resampleTrades 生成 iterations 条与原交易数相同长度的重采样路径并统计分布。
+func resampleTrades(pnls []float64, initialBalance float64, iterations int, rng *rand.Rand) *MonteCarloResult {
+	finalEquities := make([]float64, iterations)
+	maxDrawdowns := make([]float64, iterations)
+	ruined := 0
+
+	for i := 0; i < iterations; i++ {
+		equity := initialBalance
+		peak := equity
+		maxDD := 0.0
+		isRuined := false
+		for range pnls {
+			equity += pnls[rng.Intn(len(pnls))]
+			if equity > peak {
+				peak = equity
+			}
+			if peak > 0 {
+				if dd := (peak - equity) / peak * 100; dd > maxDD {
+					maxDD = dd
+				}
+			}
+			if equity <= 0 {
+				isRuined = true
+			}
+		}
+		finalEquities[i] = equity
+		maxDrawdowns[i] = maxDD
+		if isRuined {
+			ruined++
+		}
+	}
+
+	sort.Float64s(finalEquities)
+	sort.Float64s(maxDrawdowns)
+
+	return &MonteCarloResult{
+		Iterations:      iterations,
+		Trades:          len(pnls),
+		InitialBalance:  initialBalance,
+		EquityP5:        percentile(finalEquities, 5),
+		EquityP50:       percentile(finalEquities, 50),
+		EquityP95:       percentile(finalEquities, 95),
+		MaxDrawdownP50:  percentile(maxDrawdowns, 50),
+		MaxDrawdownP95:  percentile(maxDrawdowns, 95),
+		RuinProbability: float64(ruined) / float64(iterations),
+	}
+}
+
+// percentile 返回已排序序列的第 p 百分位（最近秩法）。
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
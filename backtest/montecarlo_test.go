@@ -0,0 +1,91 @@
+package backtest
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestMonteCarloResample 测试交易重采样：固定种子结果可复现，分位数有序，只统计已完成交易
+func TestMonteCarloResample(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	const runID = "mc-run"
+	if err := SaveConfig(runID, &BacktestConfig{RunID: runID, InitialBalance: 1000}); err != nil {
+		t.Fatalf("SaveConfig: %v", err)
+	}
+	events := []TradeEvent{
+		{Timestamp: 1, Symbol: "BTCUSDT", Action: "open_long", Fee: 0.5},
+		{Timestamp: 2, Symbol: "BTCUSDT", Action: "close_long", RealizedPnL: 120},
+		{Timestamp: 3, Symbol: "ETHUSDT", Action: "close_short", RealizedPnL: -80},
+		{Timestamp: 4, Symbol: "BTCUSDT", Action: "close_long", RealizedPnL: 60},
+		{Timestamp: 5, Symbol: "ETHUSDT", Action: "close_long", RealizedPnL: -150},
+		{Timestamp: 6, Symbol: "BTCUSDT", Action: "funding", Fee: 0.2},
+	}
+	for _, evt := range events {
+		if err := appendTradeEvent(runID, evt, StreamFormatJSONL); err != nil {
+			t.Fatalf("appendTradeEvent: %v", err)
+		}
+	}
+
+	first, err := MonteCarloResampleWithSeed(runID, 500, 42)
+	if err != nil {
+		t.Fatalf("MonteCarloResampleWithSeed: %v", err)
+	}
+	second, err := MonteCarloResampleWithSeed(runID, 500, 42)
+	if err != nil {
+		t.Fatalf("MonteCarloResampleWithSeed: %v", err)
+	}
+	if *first != *second {
+		t.Errorf("same seed produced different results:\n%+v\n%+v", first, second)
+	}
+
+	if first.Trades != 4 || first.InitialBalance != 1000 || first.RunID != runID {
+		t.Errorf("unexpected header: %+v", first)
+	}
+	if !(first.EquityP5 <= first.EquityP50 && first.EquityP50 <= first.EquityP95) {
+		t.Errorf("equity percentiles not ordered: %+v", first)
+	}
+	// 4 笔交易的路径净值范围为 [1000-600, 1000+480]
+	if first.EquityP5 < 400 || first.EquityP95 > 1480 {
+		t.Errorf("equity percentiles out of range: %+v", first)
+	}
+	if first.MaxDrawdownP50 > first.MaxDrawdownP95 || first.RuinProbability != 0 {
+		t.Errorf("unexpected drawdown/ruin stats: %+v", first)
+	}
+
+	if _, err := MonteCarloResampleWithSeed(runID, 0, 42); err == nil {
+		t.Error("expected error for non-positive iterations")
+	}
+}
+
+// TestResampleTrades 测试重采样分布的边界情形
+func TestResampleTrades(t *testing.T) {
+	tests := []struct {
+		name           string
+		pnls           []float64
+		initialBalance float64
+		wantP50        float64
+		wantDDP50      float64
+		wantRuin       float64
+	}{
+		// 所有交易盈亏相同：每条路径一致
+		{"identical gains", []float64{10, 10, 10}, 100, 130, 0, 0},
+		{"identical losses", []float64{-20, -20}, 100, 60, 40, 0},
+		{"always ruined", []float64{-60, -60}, 100, -20, 120, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resampleTrades(tt.pnls, tt.initialBalance, 50, rand.New(rand.NewSource(1)))
+			if math.Abs(got.EquityP5-tt.wantP50) > 1e-9 || math.Abs(got.EquityP50-tt.wantP50) > 1e-9 || math.Abs(got.EquityP95-tt.wantP50) > 1e-9 {
+				t.Errorf("equity P5/P50/P95 = %.2f/%.2f/%.2f, want all %.2f", got.EquityP5, got.EquityP50, got.EquityP95, tt.wantP50)
+			}
+			if math.Abs(got.MaxDrawdownP50-tt.wantDDP50) > 1e-9 {
+				t.Errorf("MaxDrawdownP50 = %.4f, want %.4f", got.MaxDrawdownP50, tt.wantDDP50)
+			}
+			if got.RuinProbability != tt.wantRuin {
+				t.Errorf("RuinProbability = %.2f, want %.2f", got.RuinProbability, tt.wantRuin)
+			}
+		})
+	}
+}
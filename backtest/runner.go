@@ -5,12 +5,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"nofx/decision"
@@ -22,11 +26,14 @@ import (
 var (
 	errBacktestCompleted = errors.New("backtest completed")
 	errLiquidated        = errors.New("account liquidated")
+	// errPositionLimitReached 开仓被持仓数上限拒绝：记为失败动作，但不算本周期执行错误
+	errPositionLimitReached = errors.New("position limit reached")
 )
 
 const (
 	metricsWriteInterval = 5 * time.Second
 	aiDecisionMaxRetries = 3
+	cycleResultBuffer    = 64
 )
 
 // Runner 封装单次回测运行的生命周期。
@@ -61,12 +68,36 @@ type Runner struct {
 	aiCache   *AICache
 	cachePath string
 
+	// 本次运行的缓存命中/未命中计数；网格回测中多个运行共享同一 AICache，其累计计数不能代表单次运行
+	aiCacheHits   atomic.Int64
+	aiCacheMisses atomic.Int64
+
+	cycleMu   sync.RWMutex
+	lastCycle *CycleResult
+	cycleCh   chan CycleResult
+
+	// 缓存一致性健康检查（后台执行，不阻塞回测循环）
+	cacheHealthMu      sync.RWMutex
+	cacheHealth        *logger.CacheConsistencyReport
+	lastCacheCheck     time.Time
+	cacheCheckInFlight atomic.Bool
+	cacheCheckWG       sync.WaitGroup
+
+	lockMu   sync.Mutex
 	lockInfo *RunLockInfo
 	lockStop chan struct{}
+
+	// cycleATR 当前决策周期各币种的最新 ATR（atr_risk 仓位模式使用），每个周期重建
+	cycleATR map[string]float64
 }
 
 // NewRunner 构建回测运行器。
 func NewRunner(cfg BacktestConfig, mcpClient mcp.AIClient) (*Runner, error) {
+	return newRunnerWithFeed(cfg, mcpClient, NewDataFeed)
+}
+
+// newRunnerWithFeed 使用指定的数据源构造函数构建回测运行器。
+func newRunnerWithFeed(cfg BacktestConfig, mcpClient mcp.AIClient, newFeed func(BacktestConfig) (*DataFeed, error)) (*Runner, error) {
 	if err := ensureRunDir(cfg.RunID); err != nil {
 		return nil, err
 	}
@@ -76,7 +107,7 @@ func NewRunner(cfg BacktestConfig, mcpClient mcp.AIClient) (*Runner, error) {
 		return nil, err
 	}
 
-	feed, err := NewDataFeed(cfg)
+	feed, err := newFeed(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -87,6 +118,12 @@ func NewRunner(cfg BacktestConfig, mcpClient mcp.AIClient) (*Runner, error) {
 
 	dLog := logger.NewDecisionLogger(decisionLogDir(cfg.RunID))
 	account := NewBacktestAccount(cfg.InitialBalance, cfg.FeeBps, cfg.SlippageBps)
+	account.SetMakerFeeBps(cfg.MakerFeeBps)
+	account.SetCrossMargin(cfg.MarginMode == MarginModeCross)
+	account.SetLiquidationFeeBps(cfg.LiquidationFeeBps)
+	for symbol, fees := range cfg.SymbolFees {
+		account.SetSymbolFeeBps(symbol, fees.MakerBps, fees.TakerBps)
+	}
 
 	// 生成 prompt 内容快照（启动时的完整prompt，用于记录）
 	// 回测默认使用 hyperliquid 的最小开仓金额（12 USDT）
@@ -142,6 +179,7 @@ func NewRunner(cfg BacktestConfig, mcpClient mcp.AIClient) (*Runner, error) {
 		resumeCh:       make(chan struct{}, 1),
 		stopCh:         make(chan struct{}, 1),
 		doneCh:         make(chan struct{}),
+		cycleCh:        make(chan CycleResult, cycleResultBuffer),
 		createdAt:      createdAt,
 		aiCache:        aiCache,
 		cachePath:      cachePath,
@@ -162,28 +200,34 @@ func (r *Runner) initLock() error {
 	if err != nil {
 		return err
 	}
+	stop := make(chan struct{})
+	r.lockMu.Lock()
 	r.lockInfo = info
-	r.lockStop = make(chan struct{})
-	go r.lockHeartbeatLoop()
+	r.lockStop = stop
+	r.lockMu.Unlock()
+	go r.lockHeartbeatLoop(info, stop)
 	return nil
 }
 
-func (r *Runner) lockHeartbeatLoop() {
+// lockHeartbeatLoop 定期刷新锁心跳；info 与 stop 以参数传入，避免与 releaseLock 竞争字段。
+func (r *Runner) lockHeartbeatLoop(info *RunLockInfo, stop <-chan struct{}) {
 	ticker := time.NewTicker(lockHeartbeatInterval)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
-			if err := updateRunLockHeartbeat(r.lockInfo); err != nil {
+			if err := updateRunLockHeartbeat(info); err != nil {
 				log.Printf("failed to update lock heartbeat for %s: %v", r.cfg.RunID, err)
 			}
-		case <-r.lockStop:
+		case <-stop:
 			return
 		}
 	}
 }
 
 func (r *Runner) releaseLock() {
+	r.lockMu.Lock()
+	defer r.lockMu.Unlock()
 	if r.lockStop != nil {
 		close(r.lockStop)
 		r.lockStop = nil
@@ -240,6 +284,7 @@ func (r *Runner) CurrentMetadata() *RunMetadata {
 
 func (r *Runner) loop(ctx context.Context) {
 	defer close(r.doneCh)
+	defer r.cacheCheckWG.Wait()
 
 	for {
 		select {
@@ -256,7 +301,9 @@ func (r *Runner) loop(ctx context.Context) {
 		default:
 		}
 
-		err := r.stepOnce()
+		result, err := r.stepOnce()
+		r.publishCycleResult(result)
+		r.maybeCheckCacheHealth()
 		if errors.Is(err, errBacktestCompleted) {
 			r.handleCompletion()
 			return
@@ -272,25 +319,30 @@ func (r *Runner) loop(ctx context.Context) {
 	}
 }
 
-func (r *Runner) stepOnce() error {
+// stepOnce 推进一根决策K线，并返回该周期的执行结果（已完成时结果为 nil）。
+func (r *Runner) stepOnce() (*CycleResult, error) {
 	state := r.snapshotState()
 	if state.BarIndex >= r.feed.DecisionBarCount() {
-		return errBacktestCompleted
+		return nil, errBacktestCompleted
 	}
 
 	ts := r.feed.DecisionTimestamp(state.BarIndex)
+	result := &CycleResult{BarIndex: state.BarIndex, Timestamp: ts, Cycle: state.DecisionCycle}
 
 	marketData, multiTF, err := r.feed.BuildMarketData(ts)
 	if err != nil {
-		return err
+		result.Errors = append(result.Errors, err.Error())
+		return result, err
 	}
 
 	// 构建 Close/High/Low 价格映射（用于OHLC风控检查）
 	priceMap := make(map[string]float64, len(marketData))
 	highMap := make(map[string]float64, len(marketData))
 	lowMap := make(map[string]float64, len(marketData))
+	r.cycleATR = make(map[string]float64, len(marketData))
 
 	for symbol := range marketData {
+		r.cycleATR[symbol] = market.LatestATR(marketData[symbol])
 		// 获取当前K线的OHLC数据
 		currentBar, _ := r.feed.decisionBarSnapshot(symbol, ts)
 		if currentBar != nil {
@@ -316,6 +368,26 @@ func (r *Runner) stepOnce() error {
 		hadError        bool
 	)
 
+	// 结算上一根决策K线到本K线之间跨过的资金费（仅对已持有的仓位）
+	if state.BarIndex > 0 {
+		fundingEvents, fundingLog := r.settleFunding(priceMap, r.feed.DecisionTimestamp(state.BarIndex-1), ts, callCount)
+		tradeEvents = append(tradeEvents, fundingEvents...)
+		execLog = append(execLog, fundingLog...)
+	}
+
+	// 日内亏损熔断：触发后当日不再撮合限价开仓、不再请求 AI 决策，已有仓位照常风控
+	halted, haltNote := r.updateDailyLossBreaker(priceMap, ts)
+	if haltNote != "" {
+		execLog = append(execLog, haltNote)
+	}
+
+	// 撮合此前挂出的限价开仓单（本K线价格区间触及限价即成交）
+	if !halted {
+		limitEvents, limitLog := r.matchPendingOrders(highMap, lowMap, ts, callCount)
+		tradeEvents = append(tradeEvents, limitEvents...)
+		execLog = append(execLog, limitLog...)
+	}
+
 	// 🔧 修复 BUG 2&3: 使用 OHLC 数据统一检查止损止盈和爆仓（在 AI 决策之前，风控优先）
 	slTpEvents, liqEvents := r.checkRiskEventsWithOHLC(priceMap, highMap, lowMap, ts, callCount)
 	tradeEvents = append(tradeEvents, slTpEvents...)
@@ -330,6 +402,21 @@ func (r *Runner) stepOnce() error {
 		}
 	}
 
+	// 最长持仓时间：超时仓位按当根K线价格强制平仓（与止损止盈同属风控，先于 AI 决策执行）
+	maxHoldEvents := r.checkMaxHold(priceMap, ts, state.BarIndex, callCount)
+	tradeEvents = append(tradeEvents, maxHoldEvents...)
+	for _, evt := range maxHoldEvents {
+		execLog = append(execLog, fmt.Sprintf("⏱ %s", evt.Note))
+	}
+
+	// 止损/爆仓后再检查一次熔断，避免本K线风控亏损触线后仍继续开仓
+	if !halted {
+		halted, haltNote = r.updateDailyLossBreaker(priceMap, ts)
+		if haltNote != "" {
+			execLog = append(execLog, haltNote)
+		}
+	}
+
 	decisionAttempted := shouldDecide
 
 	if shouldDecide {
@@ -338,7 +425,9 @@ func (r *Runner) stepOnce() error {
 			rec.Success = false
 			rec.ErrorMessage = fmt.Sprintf("构建交易上下文失败: %v", err)
 			_ = r.logDecision(rec)
-			return err
+			result.DecisionAttempted = true
+			result.Errors = append(result.Errors, rec.ErrorMessage)
+			return result, err
 		}
 		record = rec
 
@@ -347,10 +436,18 @@ func (r *Runner) stepOnce() error {
 			fromCache    bool
 			cacheKey     string
 		)
-		if r.aiCache != nil {
-			if key, err := computeCacheKey(ctx, r.cfg.PromptVariant, ts); err == nil {
+		promptTemplate := r.promptTemplateForCycle(callCount)
+		cacheVariant := r.cfg.PromptVariant
+		if len(r.cfg.ABPrompts) > 0 {
+			cacheVariant = r.cfg.PromptVariant + ":" + promptTemplate
+		}
+
+		if halted {
+			execLog = append(execLog, "⛔ 日内亏损熔断中，跳过本周期 AI 决策")
+		} else if r.aiCache != nil {
+			if key, err := computeCacheKey(ctx, cacheVariant, ts); err == nil {
 				cacheKey = key
-				if cached, ok := r.aiCache.Get(cacheKey); ok {
+				if cached, ok := r.lookupAICache(cacheKey); ok {
 					fullDecision = cached
 					fromCache = true
 				} else if r.cfg.ReplayOnly {
@@ -358,26 +455,29 @@ func (r *Runner) stepOnce() error {
 					record.Success = false
 					record.ErrorMessage = fmt.Sprintf("没有找到 ts=%d 的缓存决策", ts)
 					_ = r.logDecision(record)
-					return decisionErr
+					result.DecisionAttempted = true
+					result.Errors = append(result.Errors, decisionErr.Error())
+					return result, decisionErr
 				}
 			} else {
 				log.Printf("failed to compute ai cache key: %v", err)
 			}
 		}
 
-		if !fromCache {
-			fd, err := r.invokeAIWithRetry(ctx)
+		if !fromCache && !halted {
+			fd, err := r.invokeAIWithRetry(ctx, promptTemplate)
 			if err != nil {
 				decisionAttempted = true
 				hadError = true
 				record.Success = false
 				record.ErrorMessage = fmt.Sprintf("AI决策失败: %v", err)
 				execLog = append(execLog, fmt.Sprintf("⚠️ AI决策失败: %v", err))
+				result.Errors = append(result.Errors, record.ErrorMessage)
 				r.setLastError(err)
 			} else {
 				fullDecision = fd
 				if r.cfg.CacheAI && r.aiCache != nil && cacheKey != "" {
-					if err := r.aiCache.Put(cacheKey, r.cfg.PromptVariant, ts, fullDecision); err != nil {
+					if err := r.aiCache.Put(cacheKey, cacheVariant, ts, fullDecision); err != nil {
 						log.Printf("failed to persist ai cache for %s: %v", r.cfg.RunID, err)
 					}
 				}
@@ -397,23 +497,40 @@ func (r *Runner) stepOnce() error {
 			}
 
 			for _, dec := range sorted {
-				actionRecord, trades, logEntry, execErr := r.executeDecision(dec, priceMap, ts, callCount)
-				if execErr != nil {
-					actionRecord.Success = false
-					actionRecord.Error = execErr.Error()
+				result.DecisionsAttempted++
+				actionRecords, trades, logEntry, execErr := r.executeDecisionActions(dec, priceMap, ts, callCount)
+				if errors.Is(execErr, errPositionLimitReached) {
+					// 风控拒绝不算执行错误，本周期其余决策照常执行
+					execLog = append(execLog, fmt.Sprintf("⛔ %s %s: %v", dec.Symbol, dec.Action, execErr))
+				} else if execErr != nil {
 					hadError = true
 					execLog = append(execLog, fmt.Sprintf("❌ %s %s: %v", dec.Symbol, dec.Action, execErr))
+					result.Errors = append(result.Errors, fmt.Sprintf("%s %s: %v", dec.Symbol, dec.Action, execErr))
 				} else {
-					actionRecord.Success = true
+					result.DecisionsExecuted++
 					execLog = append(execLog, fmt.Sprintf("✓ %s %s", dec.Symbol, dec.Action))
 				}
+				for i := range actionRecords {
+					action := &actionRecords[i]
+					// 展开的动作已各自标记结果，其余动作按整体执行结果标记
+					if !action.Success && action.Error == "" {
+						if execErr != nil {
+							action.Error = execErr.Error()
+						} else {
+							action.Success = true
+						}
+					}
+					if action.Success && (action.Action == "open_long" || action.Action == "open_short") {
+						action.Regime = market.ClassifyVolatilityRegime(marketData[action.Symbol])
+					}
+				}
 				if len(trades) > 0 {
 					tradeEvents = append(tradeEvents, trades...)
 				}
 				if logEntry != "" {
 					execLog = append(execLog, logEntry)
 				}
-				decisionActions = append(decisionActions, actionRecord)
+				decisionActions = append(decisionActions, actionRecords...)
 			}
 		}
 	}
@@ -439,6 +556,9 @@ func (r *Runner) stepOnce() error {
 		}
 	}
 
+	// 本K线风控检查完成后再按最高/最低价推进跟踪止损，新止损从下一根K线开始生效
+	r.account.AdvanceTrailingStops(highMap, lowMap, ts)
+
 	if record != nil {
 		record.Decisions = decisionActions
 		record.ExecutionLog = execLog
@@ -453,6 +573,13 @@ func (r *Runner) stepOnce() error {
 
 	r.updateState(ts, equity, unrealized, marginUsed, priceMap, decisionAttempted)
 
+	result.Cycle = cycleForLog
+	result.DecisionAttempted = decisionAttempted
+	result.Actions = decisionActions
+	result.Trades = tradeEvents
+	result.Equity = equity
+	result.UnrealizedPnL = unrealized
+
 	snapshot := r.snapshotState()
 	drawdownPct := 0.0
 	if snapshot.MaxEquity > 0 {
@@ -469,28 +596,28 @@ func (r *Runner) stepOnce() error {
 		Cycle:       snapshot.DecisionCycle,
 	}
 
-	if err := appendEquityPoint(r.cfg.RunID, equityPoint); err != nil {
-		return err
+	if err := appendEquityPoint(r.cfg.RunID, equityPoint, r.cfg.StreamFormat); err != nil {
+		return result, err
 	}
 
 	for _, evt := range tradeEvents {
-		if err := appendTradeEvent(r.cfg.RunID, evt); err != nil {
-			return err
+		if err := appendTradeEvent(r.cfg.RunID, evt, r.cfg.StreamFormat); err != nil {
+			return result, err
 		}
 	}
 
 	if record != nil {
 		if err := r.logDecision(record); err != nil {
-			return err
+			return result, err
 		}
 	}
 
 	if err := saveProgress(r.cfg.RunID, &snapshot, &r.cfg); err != nil {
-		return err
+		return result, err
 	}
 
 	if err := r.maybeCheckpoint(); err != nil {
-		return err
+		return result, err
 	}
 
 	r.persistMetadata()
@@ -500,11 +627,42 @@ func (r *Runner) stepOnce() error {
 		r.setLastError(nil)
 	}
 
+	result.Liquidated = snapshot.Liquidated
 	if snapshot.Liquidated {
-		return errLiquidated
+		return result, errLiquidated
 	}
 
-	return nil
+	return result, nil
+}
+
+// CycleResults 返回逐周期执行结果通道；缓冲区满时丢弃新结果，不会阻塞回测循环。
+func (r *Runner) CycleResults() <-chan CycleResult {
+	return r.cycleCh
+}
+
+// LastCycleResult 返回最近一个周期的执行结果（尚未执行任何周期时为 nil）。
+func (r *Runner) LastCycleResult() *CycleResult {
+	r.cycleMu.RLock()
+	defer r.cycleMu.RUnlock()
+	if r.lastCycle == nil {
+		return nil
+	}
+	copyResult := *r.lastCycle
+	return &copyResult
+}
+
+func (r *Runner) publishCycleResult(result *CycleResult) {
+	if result == nil {
+		return
+	}
+	r.cycleMu.Lock()
+	r.lastCycle = result
+	r.cycleMu.Unlock()
+
+	select {
+	case r.cycleCh <- *result:
+	default:
+	}
 }
 
 func (r *Runner) buildDecisionContext(ts int64, marketData map[string]*market.Data, multiTF map[string]map[string]*market.Data, priceMap map[string]float64, callCount int) (*decision.Context, *logger.DecisionRecord, error) {
@@ -570,14 +728,57 @@ func (r *Runner) buildDecisionContext(ts int64, marketData map[string]*market.Da
 func (r *Runner) fillDecisionRecord(record *logger.DecisionRecord, full *decision.FullDecision) {
 	record.InputPrompt = full.UserPrompt
 	record.CoTTrace = full.CoTTrace
+	record.PromptHash = full.PromptHash
 	if len(full.Decisions) > 0 {
 		if data, err := json.MarshalIndent(full.Decisions, "", "  "); err == nil {
 			record.DecisionJSON = string(data)
 		}
 	}
+	if r.cfg.PersistRawAIResponse {
+		record.RawAIResponse = redactSecrets(full.RawResponse, r.cfg.AICfg.APIKey, r.cfg.AICfg.SecretKey)
+	}
+}
+
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`sk-[A-Za-z0-9_\-]{16,}`),
+	regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._\-]{16,}`),
+}
+
+// redactSecrets 对原始 AI 响应脱敏：移除已知密钥以及常见的 API Key/Token 形态
+func redactSecrets(raw string, knownSecrets ...string) string {
+	if raw == "" {
+		return ""
+	}
+	for _, secret := range knownSecrets {
+		if len(secret) >= 8 {
+			raw = strings.ReplaceAll(raw, secret, "****")
+		}
+	}
+	for _, re := range secretPatterns {
+		raw = re.ReplaceAllString(raw, "****")
+	}
+	return raw
+}
+
+// promptTemplateForCycle 返回指定决策周期使用的提示词模板（未配置 A/B 时固定为 PromptTemplate）。
+func (r *Runner) promptTemplateForCycle(cycle int) string {
+	n := len(r.cfg.ABPrompts)
+	if n == 0 {
+		return r.cfg.PromptTemplate
+	}
+	if r.cfg.ABPromptMode == ABPromptModeHash {
+		h := fnv.New32a()
+		_, _ = fmt.Fprintf(h, "%s:%d", r.cfg.RunID, cycle)
+		return r.cfg.ABPrompts[int(h.Sum32()%uint32(n))]
+	}
+	idx := (cycle - 1) % n
+	if idx < 0 {
+		idx += n
+	}
+	return r.cfg.ABPrompts[idx]
 }
 
-func (r *Runner) invokeAIWithRetry(ctx *decision.Context) (*decision.FullDecision, error) {
+func (r *Runner) invokeAIWithRetry(ctx *decision.Context, promptTemplate string) (*decision.FullDecision, error) {
 	var lastErr error
 	for attempt := 0; attempt < aiDecisionMaxRetries; attempt++ {
 		fd, err := decision.GetFullDecisionWithCustomPrompt(
@@ -585,7 +786,7 @@ func (r *Runner) invokeAIWithRetry(ctx *decision.Context) (*decision.FullDecisio
 			r.mcpClient,
 			r.cfg.CustomPrompt,
 			r.cfg.OverrideBasePrompt,
-			r.cfg.PromptTemplate,
+			promptTemplate,
 		)
 		if err == nil {
 			return fd, nil
@@ -611,15 +812,44 @@ func (r *Runner) executeDecision(dec decision.Decision, priceMap map[string]floa
 	if basePrice <= 0 {
 		return actionRecord, nil, "", fmt.Errorf("price unavailable for %s", symbol)
 	}
-	fillPrice := r.executionPrice(symbol, basePrice, ts)
+	if err := r.checkPositionLimit(dec); err != nil {
+		log.Printf("  ⛔ 拒绝开仓 %s %s: %v", symbol, dec.Action, err)
+		return actionRecord, nil, "", err
+	}
+	if side, resting := restingLimitSide(dec, basePrice); resting {
+		return r.placeLimitOrder(dec, actionRecord, side, usedLeverage, ts)
+	}
 
+	// 先确定下单数量：成交量冲击滑点依赖订单价值与方向
+	var (
+		orderQty float64
+		buy      bool
+	)
 	switch dec.Action {
 	case "open_long":
-		qty := r.determineQuantity(dec, basePrice)
+		orderQty, buy = r.determineQuantity(dec, basePrice), true
+	case "open_short":
+		orderQty = r.determineQuantity(dec, basePrice)
+	case "close_long":
+		orderQty = r.determineCloseQuantity(symbol, "long", dec)
+	case "close_short":
+		orderQty, buy = r.determineCloseQuantity(symbol, "short", dec), true
+	}
+
+	fillPrice, maker := r.decisionFillPrice(symbol, basePrice, ts, orderQty*basePrice, buy)
+	actionRecord.IsMaker = maker
+	if err := r.checkPriceBand(symbol, dec.Action, fillPrice, ts); err != nil {
+		log.Printf("  ⚠️ 拒绝下单 %s %s: %v", symbol, dec.Action, err)
+		return actionRecord, nil, "", err
+	}
+
+	switch dec.Action {
+	case "open_long":
+		qty := orderQty
 		if qty <= 0 {
 			return actionRecord, nil, "", fmt.Errorf("invalid qty")
 		}
-		pos, fee, execPrice, err := r.account.Open(symbol, "long", qty, usedLeverage, fillPrice, dec.StopLoss, dec.TakeProfit, ts)
+		pos, fee, execPrice, err := r.account.Open(symbol, "long", qty, usedLeverage, fillPrice, dec.StopLoss, dec.TakeProfit, ts, maker)
 		if err != nil {
 			return actionRecord, nil, "", err
 		}
@@ -641,14 +871,15 @@ func (r *Runner) executeDecision(dec decision.Decision, priceMap map[string]floa
 			Cycle:         cycle,
 			PositionAfter: pos.Quantity,
 		}
+		actionRecord.Slippage = trade.Slippage
 		return actionRecord, []TradeEvent{trade}, "", nil
 
 	case "open_short":
-		qty := r.determineQuantity(dec, basePrice)
+		qty := orderQty
 		if qty <= 0 {
 			return actionRecord, nil, "", fmt.Errorf("invalid qty")
 		}
-		pos, fee, execPrice, err := r.account.Open(symbol, "short", qty, usedLeverage, fillPrice, dec.StopLoss, dec.TakeProfit, ts)
+		pos, fee, execPrice, err := r.account.Open(symbol, "short", qty, usedLeverage, fillPrice, dec.StopLoss, dec.TakeProfit, ts, maker)
 		if err != nil {
 			return actionRecord, nil, "", err
 		}
@@ -670,15 +901,16 @@ func (r *Runner) executeDecision(dec decision.Decision, priceMap map[string]floa
 			Cycle:         cycle,
 			PositionAfter: pos.Quantity,
 		}
+		actionRecord.Slippage = trade.Slippage
 		return actionRecord, []TradeEvent{trade}, "", nil
 
 	case "close_long":
-		qty := r.determineCloseQuantity(symbol, "long", dec)
+		qty := orderQty
 		if qty <= 0 {
 			return actionRecord, nil, "", fmt.Errorf("invalid close qty")
 		}
 		posLev := r.account.positionLeverage(symbol, "long")
-		realized, fee, execPrice, err := r.account.Close(symbol, "long", qty, fillPrice)
+		realized, fee, execPrice, err := r.account.Close(symbol, "long", qty, fillPrice, maker)
 		if err != nil {
 			return actionRecord, nil, "", err
 		}
@@ -700,15 +932,16 @@ func (r *Runner) executeDecision(dec decision.Decision, priceMap map[string]floa
 			Cycle:         cycle,
 			PositionAfter: r.remainingPosition(symbol, "long"),
 		}
+		actionRecord.Slippage = trade.Slippage
 		return actionRecord, []TradeEvent{trade}, "", nil
 
 	case "close_short":
-		qty := r.determineCloseQuantity(symbol, "short", dec)
+		qty := orderQty
 		if qty <= 0 {
 			return actionRecord, nil, "", fmt.Errorf("invalid close qty")
 		}
 		posLev := r.account.positionLeverage(symbol, "short")
-		realized, fee, execPrice, err := r.account.Close(symbol, "short", qty, fillPrice)
+		realized, fee, execPrice, err := r.account.Close(symbol, "short", qty, fillPrice, maker)
 		if err != nil {
 			return actionRecord, nil, "", err
 		}
@@ -730,6 +963,7 @@ func (r *Runner) executeDecision(dec decision.Decision, priceMap map[string]floa
 			Cycle:         cycle,
 			PositionAfter: r.remainingPosition(symbol, "short"),
 		}
+		actionRecord.Slippage = trade.Slippage
 		return actionRecord, []TradeEvent{trade}, "", nil
 
 	case "update_stop_loss":
@@ -762,6 +996,18 @@ func (r *Runner) executeDecision(dec decision.Decision, priceMap map[string]floa
 		msg := fmt.Sprintf("更新 %s %s 止盈至 %.4f", symbol, side, dec.NewTakeProfit)
 		return actionRecord, nil, msg, nil
 
+	case "trailing_stop":
+		// 尝试为多头或空头持仓启用跟踪止损
+		side := "long"
+		if err := r.account.SetTrailingStop(symbol, side, dec.TrailPct, basePrice, ts); err != nil {
+			side = "short"
+			if err := r.account.SetTrailingStop(symbol, side, dec.TrailPct, basePrice, ts); err != nil {
+				return actionRecord, nil, "", fmt.Errorf("no position to trail stop for %s: %w", symbol, err)
+			}
+		}
+		msg := fmt.Sprintf("启用 %s %s 跟踪止损 %.2f%%", symbol, side, dec.TrailPct)
+		return actionRecord, nil, msg, nil
+
 	case "partial_close":
 		// TODO: 实现部分平仓逻辑
 		return actionRecord, nil, "部分平仓暂不支持", nil
@@ -774,6 +1020,12 @@ func (r *Runner) executeDecision(dec decision.Decision, priceMap map[string]floa
 }
 
 func (r *Runner) determineQuantity(dec decision.Decision, price float64) float64 {
+	leverage := r.resolveLeverage(dec.Leverage, dec.Symbol)
+	return r.determineQuantityWithin(dec, price, r.account.MaxOpenQuantity(dec.Symbol, price, leverage))
+}
+
+// determineQuantityWithin 按决策计算开仓数量，并截断到 maxQty（可用保证金允许的最大开仓量）
+func (r *Runner) determineQuantityWithin(dec decision.Decision, price, maxQty float64) float64 {
 	snapshot := r.snapshotState()
 	equity := snapshot.Equity
 	if equity <= 0 {
@@ -783,11 +1035,372 @@ func (r *Runner) determineQuantity(dec decision.Decision, price float64) float64
 	if sizeUSD <= 0 {
 		sizeUSD = 0.05 * equity
 	}
+	// atr_risk 模式按波动率归一化仓位，覆盖 AI 给出的仓位金额；缺少 ATR 数据时退回上面的结果
+	if r.cfg.SizingMode == SizingModeATRRisk {
+		if atrSize := atrPositionSize(equity, r.cfg.RiskPerTradePct, r.cycleATR[dec.Symbol], price); atrSize > 0 {
+			sizeUSD = atrSize
+		}
+	}
 	qty := sizeUSD / price
 	if qty < 0 {
 		qty = 0
 	}
-	return qty
+	// 单个持仓名义价值上限（风控硬约束，与杠杆和仓位模式无关）
+	if maxNotional := r.cfg.MaxPositionNotionalUSD; maxNotional > 0 && qty*price > maxNotional {
+		capped := maxNotional / price
+		log.Printf("  ⚠️ %s 开仓名义价值 %.2f 超过上限 %.2f，数量 %.6f → %.6f",
+			dec.Symbol, qty*price, maxNotional, qty, capped)
+		qty = capped
+	}
+	// 不超过可用保证金允许的最大开仓量
+	if qty > maxQty {
+		qty = maxQty
+	}
+	return r.roundQuantity(dec.Symbol, qty)
+}
+
+// roundQuantity 按 QuantityPrecision 将数量向下取整到配置的小数位（与实盘按 stepSize 截断一致），未配置的标的原样返回。
+func (r *Runner) roundQuantity(symbol string, qty float64) float64 {
+	precision, ok := r.cfg.QuantityPrecision[market.Normalize(symbol)]
+	if !ok || qty <= 0 {
+		return qty
+	}
+	scale := math.Pow(10, float64(precision))
+	// 加一个极小量，避免 0.3 这类数在乘法后变成 2.9999999 被多截掉一位
+	return math.Floor(qty*scale+1e-9) / scale
+}
+
+// atrPositionSize 计算使价格逆向波动一个 ATR 时恰好损失 riskPct% 权益的仓位名义价值（USD）。
+// 数量 = 风险金额 / ATR，名义价值 = 数量 × 价格；ATR 或价格无效时返回 0。
+func atrPositionSize(equity, riskPct, atr, price float64) float64 {
+	if equity <= 0 || riskPct <= 0 || atr <= 0 || price <= 0 {
+		return 0
+	}
+	riskUSD := equity * riskPct / 100
+	return riskUSD / atr * price
+}
+
+// checkPositionLimit 持仓数达到 MaxOpenPositions 时拒绝开新仓；加仓已有的同向持仓不增加持仓数，不受限制。
+func (r *Runner) checkPositionLimit(dec decision.Decision) error {
+	if r.cfg.MaxOpenPositions <= 0 {
+		return nil
+	}
+	var side string
+	switch dec.Action {
+	case "open_long":
+		side = "long"
+	case "open_short":
+		side = "short"
+	default:
+		return nil
+	}
+	// 同标的反向持仓会在反手时先平掉，不占用名额
+	symbol := strings.ToUpper(dec.Symbol)
+	occupied := 0
+	for _, pos := range r.account.Positions() {
+		if pos.Symbol != symbol {
+			occupied++
+		} else if pos.Side == side {
+			return nil
+		}
+	}
+	if occupied >= r.cfg.MaxOpenPositions {
+		return fmt.Errorf("%w (%d/%d)", errPositionLimitReached, occupied, r.cfg.MaxOpenPositions)
+	}
+	return nil
+}
+
+// executeDecisionActions 执行单个 AI 决策并返回其展开后的全部决策动作：
+// close_all 展开为每个持仓一条平仓动作，其余决策（包括反手）只对应一条动作。
+// 展开过程中已确定结果的动作自带 Success/Error，其余动作由调用方按返回的错误标记。
+func (r *Runner) executeDecisionActions(dec decision.Decision, priceMap map[string]float64, ts int64, cycle int) ([]logger.DecisionAction, []TradeEvent, string, error) {
+	if dec.Action == "close_all" {
+		return r.closeAllPositions(dec, priceMap, ts, cycle)
+	}
+	if basePrice := priceMap[dec.Symbol]; basePrice > 0 {
+		if opposite, ok := r.oppositePositionSide(dec, basePrice); ok {
+			return r.flipPosition(dec, opposite, priceMap, ts, cycle)
+		}
+	}
+	actionRecord, trades, logEntry, err := r.executeDecision(dec, priceMap, ts, cycle)
+	return []logger.DecisionAction{actionRecord}, trades, logEntry, err
+}
+
+// closeAllPositions 执行 close_all：按 symbol/方向顺序逐个全部平仓（与 close_long/close_short 相同的成交价逻辑），
+// 每个持仓产生一条 close_long/close_short 动作和一条 TradeEvent；单个持仓平仓失败不影响其他持仓，所有失败合并返回。
+func (r *Runner) closeAllPositions(dec decision.Decision, priceMap map[string]float64, ts int64, cycle int) ([]logger.DecisionAction, []TradeEvent, string, error) {
+	positions := append([]*position(nil), r.account.Positions()...)
+	if len(positions) == 0 {
+		actionRecord := logger.DecisionAction{Action: dec.Action, Timestamp: time.UnixMilli(ts).UTC()}
+		return []logger.DecisionAction{actionRecord}, nil, "🧹 close_all: 无持仓", nil
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return positionKey(positions[i].Symbol, positions[i].Side) < positionKey(positions[j].Symbol, positions[j].Side)
+	})
+
+	var (
+		actions = make([]logger.DecisionAction, 0, len(positions))
+		trades  []TradeEvent
+		errs    []string
+	)
+	for _, pos := range positions {
+		closeDec := decision.Decision{Symbol: pos.Symbol, Action: "close_" + pos.Side}
+		actionRecord, closeTrades, _, err := r.executeDecision(closeDec, priceMap, ts, cycle)
+		if err != nil {
+			actionRecord.Error = err.Error()
+			errs = append(errs, fmt.Sprintf("%s %s: %v", pos.Symbol, pos.Side, err))
+		} else {
+			actionRecord.Success = true
+			for i := range closeTrades {
+				closeTrades[i].Note = "close_all"
+			}
+			trades = append(trades, closeTrades...)
+		}
+		actions = append(actions, actionRecord)
+	}
+
+	logEntry := fmt.Sprintf("🧹 close_all: 平仓 %d/%d 个持仓", len(positions)-len(errs), len(positions))
+	if len(errs) > 0 {
+		return actions, trades, logEntry, fmt.Errorf("close_all 部分平仓失败: %s", strings.Join(errs, "; "))
+	}
+	return actions, trades, logEntry, nil
+}
+
+// oppositePositionSide 判断市价开仓决策是否与同标的的反向持仓冲突（如持有多头时 open_short），返回需要先平掉的方向。
+// 挂单类限价开仓不视为反手，按原路径挂单。
+func (r *Runner) oppositePositionSide(dec decision.Decision, basePrice float64) (string, bool) {
+	var opposite string
+	switch dec.Action {
+	case "open_long":
+		opposite = "short"
+	case "open_short":
+		opposite = "long"
+	default:
+		return "", false
+	}
+	if _, resting := restingLimitSide(dec, basePrice); resting {
+		return "", false
+	}
+	return opposite, r.determineCloseQuantity(dec.Symbol, opposite, dec) > 0
+}
+
+// flipPosition 反手：先按平仓后的可用资金校验开仓腿（持仓数上限、保证金、价格带），再平掉反向持仓并按原决策开仓，
+// 作为一个决策动作记录，产生平仓与开仓两条交易事件。校验或平仓失败时不做任何开仓；开仓失败时保留已完成的平仓。
+func (r *Runner) flipPosition(dec decision.Decision, opposite string, priceMap map[string]float64, ts int64, cycle int) ([]logger.DecisionAction, []TradeEvent, string, error) {
+	if err := r.checkFlipOpen(dec, opposite, priceMap[dec.Symbol], ts); err != nil {
+		actionRecord := logger.DecisionAction{
+			Action:    dec.Action,
+			Symbol:    dec.Symbol,
+			Leverage:  r.resolveLeverage(dec.Leverage, dec.Symbol),
+			Timestamp: time.UnixMilli(ts).UTC(),
+		}
+		return []logger.DecisionAction{actionRecord}, nil, "", err
+	}
+
+	closeDec := decision.Decision{Symbol: dec.Symbol, Action: "close_" + opposite}
+	closeRecord, closeTrades, _, err := r.executeDecision(closeDec, priceMap, ts, cycle)
+	if err != nil {
+		closeRecord.Action = dec.Action
+		return []logger.DecisionAction{closeRecord}, nil, "", fmt.Errorf("反手平仓失败: %w", err)
+	}
+	for i := range closeTrades {
+		closeTrades[i].Note = "flip"
+	}
+
+	actionRecord, openTrades, logEntry, err := r.executeDecision(dec, priceMap, ts, cycle)
+	for i := range openTrades {
+		openTrades[i].Note = "flip"
+	}
+	trades := append(closeTrades, openTrades...)
+	if err != nil {
+		return []logger.DecisionAction{actionRecord}, trades, logEntry, fmt.Errorf("反手开仓失败（%s 已平仓）: %w", opposite, err)
+	}
+	if logEntry == "" {
+		logEntry = fmt.Sprintf("🔄 %s 反手: close_%s → %s", dec.Symbol, opposite, dec.Action)
+	}
+	return []logger.DecisionAction{actionRecord}, trades, logEntry, nil
+}
+
+// checkFlipOpen 在反手平仓前校验开仓腿，避免平仓后开仓才被风控拒绝。
+// 开仓数量按平掉 opposite 持仓、释放其保证金后的可用资金计算，满仓反手不会因平仓前的保证金占用被误拒。
+func (r *Runner) checkFlipOpen(dec decision.Decision, opposite string, basePrice float64, ts int64) error {
+	if err := r.checkPositionLimit(dec); err != nil {
+		return err
+	}
+	buy := dec.Action == "open_long"
+	closeQty := r.determineCloseQuantity(dec.Symbol, opposite, dec)
+	closePrice, _ := r.decisionFillPrice(dec.Symbol, basePrice, ts, closeQty*basePrice, buy) // 平多与开空同为卖出，反之同为买入
+	leverage := r.resolveLeverage(dec.Leverage, dec.Symbol)
+	maxQty := r.account.MaxOpenQuantityAfterClose(dec.Symbol, opposite, closePrice, basePrice, leverage)
+	orderQty := r.determineQuantityWithin(dec, basePrice, maxQty)
+	if orderQty <= 0 {
+		return fmt.Errorf("反手开仓腿可用保证金不足（平仓后最大可开 %.6f）", maxQty)
+	}
+	fillPrice, _ := r.decisionFillPrice(dec.Symbol, basePrice, ts, orderQty*basePrice, buy)
+	return r.checkPriceBand(dec.Symbol, dec.Action, fillPrice, ts)
+}
+
+// restingLimitSide 判断开仓决策是否为需要挂单的限价单（买单限价低于市价或卖单限价高于市价）；
+// 可立即成交的限价单按市价路径执行。
+func restingLimitSide(dec decision.Decision, marketPrice float64) (string, bool) {
+	if dec.LimitPrice <= 0 {
+		return "", false
+	}
+	switch dec.Action {
+	case "open_long":
+		return "long", dec.LimitPrice < marketPrice
+	case "open_short":
+		return "short", dec.LimitPrice > marketPrice
+	}
+	return "", false
+}
+
+// placeLimitOrder 挂出限价开仓单，成交前不产生交易事件。
+func (r *Runner) placeLimitOrder(dec decision.Decision, actionRecord logger.DecisionAction, side string, leverage int, ts int64) (logger.DecisionAction, []TradeEvent, string, error) {
+	actionRecord.Action = "limit_" + dec.Action
+	qty := r.determineQuantity(dec, dec.LimitPrice)
+	if qty <= 0 {
+		return actionRecord, nil, "", fmt.Errorf("invalid qty")
+	}
+	expiry := r.cfg.LimitOrderExpiryBars
+	if expiry <= 0 {
+		expiry = defaultLimitOrderExpiryBars
+	}
+	order := PendingOrder{
+		Symbol:     dec.Symbol,
+		Side:       side,
+		Quantity:   qty,
+		Leverage:   leverage,
+		LimitPrice: dec.LimitPrice,
+		StopLoss:   dec.StopLoss,
+		TakeProfit: dec.TakeProfit,
+		PlacedTS:   ts,
+		ExpiryBars: expiry,
+	}
+	if err := r.account.PlaceLimitOrder(order); err != nil {
+		return actionRecord, nil, "", err
+	}
+	actionRecord.Quantity = qty
+	actionRecord.Price = dec.LimitPrice
+	logEntry := fmt.Sprintf("📌 %s %s 限价挂单 %.4f x %.6f（%d 根K线内有效）", dec.Symbol, side, dec.LimitPrice, qty, expiry)
+	return actionRecord, nil, logEntry, nil
+}
+
+// matchPendingOrders 用当前K线撮合挂单，返回成交事件与执行日志。
+func (r *Runner) matchPendingOrders(highMap, lowMap map[string]float64, ts int64, cycle int) ([]TradeEvent, []string) {
+	fills, expired := r.account.MatchPendingOrders(highMap, lowMap, ts)
+	events := make([]TradeEvent, 0, len(fills))
+	var logs []string
+	for _, fill := range fills {
+		order := fill.Order
+		if fill.Err != nil {
+			log.Printf("  ⚠️ 限价单成交失败 %s %s @ %.4f: %v", order.Symbol, order.Side, order.LimitPrice, fill.Err)
+			logs = append(logs, fmt.Sprintf("❌ 限价单成交失败 %s %s: %v", order.Symbol, order.Side, fill.Err))
+			continue
+		}
+		events = append(events, TradeEvent{
+			Timestamp:     ts,
+			Symbol:        order.Symbol,
+			Action:        "open_" + order.Side,
+			Side:          order.Side,
+			Quantity:      order.Quantity,
+			Price:         fill.ExecPrice,
+			Fee:           fill.Fee,
+			OrderValue:    fill.ExecPrice * order.Quantity,
+			Leverage:      fill.Position.Leverage,
+			Cycle:         cycle,
+			PositionAfter: fill.Position.Quantity,
+			Note:          fmt.Sprintf("limit fill @ %.4f (maker)", order.LimitPrice),
+		})
+		logs = append(logs, fmt.Sprintf("📌 限价单成交 %s %s @ %.4f", order.Symbol, order.Side, fill.ExecPrice))
+	}
+	for _, order := range expired {
+		logs = append(logs, fmt.Sprintf("⌛ 限价单过期撤销 %s %s @ %.4f（%d 根K线未成交）",
+			order.Symbol, order.Side, order.LimitPrice, order.BarsWaited))
+	}
+	return events, logs
+}
+
+// updateDailyLossBreaker 跟踪 UTC 日初权益，当日亏损达到 daily_loss_limit_pct 时熔断至次日。
+// 返回当前是否处于熔断状态；本次调用新触发熔断时同时返回执行日志说明。
+func (r *Runner) updateDailyLossBreaker(priceMap map[string]float64, ts int64) (bool, string) {
+	if r.cfg.DailyLossLimitPct <= 0 {
+		return false, ""
+	}
+	const dayMs = int64(24 * time.Hour / time.Millisecond)
+	equity, _, _ := r.account.TotalEquity(priceMap)
+
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	if day := ts - ts%dayMs; r.state.DayStart != day || r.state.DayStartEquity <= 0 {
+		// 新的 UTC 日（或首次进入）：以上一根K线结束时的权益作为日初权益，并解除熔断
+		startEquity := r.state.Equity
+		if startEquity <= 0 {
+			startEquity = r.account.InitialBalance()
+		}
+		r.state.DayStart = day
+		r.state.DayStartEquity = startEquity
+		r.state.DailyHalted = false
+	}
+	if r.state.DailyHalted {
+		return true, ""
+	}
+	lossPct := (r.state.DayStartEquity - equity) / r.state.DayStartEquity * 100
+	if lossPct < r.cfg.DailyLossLimitPct {
+		return false, ""
+	}
+	r.state.DailyHalted = true
+	return true, fmt.Sprintf("⛔ 日内亏损熔断: 当日亏损 %.2f%% 达到上限 %.2f%%，暂停开仓至 UTC 次日", lossPct, r.cfg.DailyLossLimitPct)
+}
+
+// settleFunding 对 (prevTS, ts] 区间内跨过的每个资金费结算时点，按当前标记价向持仓收取资金费。
+// 资金费记为 Action 为 "funding" 的事件，金额写入 Fee（负值表示收取），不计入交易笔数统计。
+func (r *Runner) settleFunding(priceMap map[string]float64, prevTS, ts int64, cycle int) ([]TradeEvent, []string) {
+	if r.cfg.FundingRateBps == 0 || r.cfg.FundingIntervalHours <= 0 {
+		return nil, nil
+	}
+	intervalMs := int64(r.cfg.FundingIntervalHours) * int64(time.Hour/time.Millisecond)
+	settlements := ts/intervalMs - prevTS/intervalMs
+	if settlements <= 0 {
+		return nil, nil
+	}
+	rate := r.cfg.FundingRateBps / 10000.0 * float64(settlements)
+
+	positions := r.account.Positions()
+	sort.Slice(positions, func(i, j int) bool {
+		return positionKey(positions[i].Symbol, positions[i].Side) < positionKey(positions[j].Symbol, positions[j].Side)
+	})
+
+	var (
+		events []TradeEvent
+		logs   []string
+	)
+	for _, pos := range positions {
+		price, ok := priceMap[pos.Symbol]
+		if !ok || price <= 0 {
+			continue
+		}
+		payment, err := r.account.ApplyFunding(pos.Symbol, pos.Side, price, rate)
+		if err != nil {
+			continue
+		}
+		events = append(events, TradeEvent{
+			Timestamp:     ts,
+			Symbol:        pos.Symbol,
+			Action:        "funding",
+			Side:          pos.Side,
+			Quantity:      pos.Quantity,
+			Price:         price,
+			Fee:           payment,
+			OrderValue:    price * pos.Quantity,
+			Leverage:      pos.Leverage,
+			Cycle:         cycle,
+			PositionAfter: pos.Quantity,
+			Note:          fmt.Sprintf("funding x%d @ %.4f bps", settlements, r.cfg.FundingRateBps),
+		})
+		logs = append(logs, fmt.Sprintf("💸 资金费结算 %s %s 支付 %.4f USDT", pos.Symbol, pos.Side, payment))
+	}
+	return events, logs
 }
 
 func (r *Runner) determineCloseQuantity(symbol, side string, dec decision.Decision) float64 {
@@ -800,10 +1413,39 @@ func (r *Runner) determineCloseQuantity(symbol, side string, dec decision.Decisi
 }
 
 func (r *Runner) resolveLeverage(requested int, symbol string) int {
+	return r.applyDrawdownDeleverage(r.baseLeverage(requested, symbol))
+}
+
+// applyDrawdownDeleverage 净值相对峰值（state.MaxEquity）回撤超过阈值时按系数降低杠杆，回撤收窄后恢复原杠杆。
+func (r *Runner) applyDrawdownDeleverage(leverage int) int {
+	cfg := r.cfg.DrawdownDeleverage
+	if cfg.ThresholdPct <= 0 || r.state == nil {
+		return leverage
+	}
+	snapshot := r.snapshotState()
+	if snapshot.MaxEquity <= 0 {
+		return leverage
+	}
+	drawdownPct := (snapshot.MaxEquity - snapshot.Equity) / snapshot.MaxEquity * 100
+	if drawdownPct <= cfg.ThresholdPct {
+		return leverage
+	}
+	reduced := int(math.Floor(float64(leverage) * cfg.Factor))
+	if reduced < 1 {
+		reduced = 1
+	}
+	return reduced
+}
+
+// baseLeverage 按优先级确定开仓杠杆：symbol_leverage 按标的覆盖 > AI 请求的杠杆 > BTC/ETH 与山寨币分类默认值。
+func (r *Runner) baseLeverage(requested int, symbol string) int {
+	sym := strings.ToUpper(symbol)
+	if leverage, ok := r.cfg.SymbolLeverage[sym]; ok && leverage > 0 {
+		return leverage
+	}
 	if requested > 0 {
 		return requested
 	}
-	sym := strings.ToUpper(symbol)
 	if sym == "BTCUSDT" || sym == "ETHUSDT" {
 		if r.cfg.Leverage.BTCETHLeverage > 0 {
 			return r.cfg.Leverage.BTCETHLeverage
@@ -866,25 +1508,136 @@ func (r *Runner) convertPositions(priceMap map[string]float64) []decision.Positi
 	return list
 }
 
-func (r *Runner) executionPrice(symbol string, markPrice float64, ts int64) float64 {
+// PositionHeatmap 汇总每个持仓的未实现盈亏、强平距离与保证金占比，按 symbol/side 排序。
+// priceMap 缺少标记价的持仓只标记 MarkMissing，不按 0 价格计算（否则会显示为全额亏损）。
+func (r *Runner) PositionHeatmap(priceMap map[string]float64) []PositionHeat {
+	equity, _, _ := r.account.TotalEquity(priceMap)
+	positions := r.account.Positions()
+	heat := make([]PositionHeat, 0, len(positions))
+	for _, pos := range positions {
+		price := priceMap[pos.Symbol]
+		item := PositionHeat{
+			Symbol:           pos.Symbol,
+			Side:             pos.Side,
+			Quantity:         pos.Quantity,
+			EntryPrice:       pos.EntryPrice,
+			MarkPrice:        price,
+			Leverage:         pos.Leverage,
+			LiquidationPrice: pos.LiquidationPrice,
+			MarginUsed:       pos.Margin,
+			MarkMissing:      price <= 0,
+		}
+		if price > 0 {
+			item.UnrealizedPnL = unrealizedPnL(pos, price)
+			if pos.Margin > 0 {
+				item.UnrealizedPnLPct = item.UnrealizedPnL / pos.Margin * 100
+			}
+		}
+		if price > 0 && pos.LiquidationPrice > 0 {
+			if pos.Side == "long" {
+				item.DistanceToLiqPct = (price - pos.LiquidationPrice) / price * 100
+			} else {
+				item.DistanceToLiqPct = (pos.LiquidationPrice - price) / price * 100
+			}
+		}
+		if equity > 0 {
+			item.MarginSharePct = pos.Margin / equity * 100
+		}
+		heat = append(heat, item)
+	}
+	sort.Slice(heat, func(i, j int) bool {
+		if heat[i].Symbol == heat[j].Symbol {
+			return heat[i].Side < heat[j].Side
+		}
+		return heat[i].Symbol < heat[j].Symbol
+	})
+	return heat
+}
+
+// executionPrice 按成交策略计算成交价，并叠加成交量冲击滑点（volume_impact 模型）；
+// 第二个返回值表示是否为挂单类成交（按 maker 费率收费）。orderValue 为订单价值，buy 表示买入方向。
+func (r *Runner) executionPrice(symbol string, markPrice float64, ts int64, orderValue float64, buy bool) (float64, bool) {
+	price, maker := r.policyPrice(symbol, markPrice, ts)
+	return r.applyVolumeImpact(symbol, price, ts, orderValue, buy), maker
+}
+
+// decisionFillPrice 计算市价决策的成交价。DecisionLatencyBars > 0 时模拟 AI 调用延迟：
+// 按决策K线之后第 N 根K线的开盘价成交（叠加该K线的成交量冲击），不再使用 fill_policy；
+// 延迟成交模拟的是晚到的市价单，按 taker 计费。
+// 延迟K线超出数据范围时退回正常成交策略。
+func (r *Runner) decisionFillPrice(symbol string, markPrice float64, ts int64, orderValue float64, buy bool) (float64, bool) {
+	if n := r.cfg.DecisionLatencyBars; n > 0 {
+		if bar := r.feed.primaryBarAfter(symbol, ts, n); bar != nil && bar.Open > 0 {
+			return r.applyVolumeImpact(symbol, bar.Open, bar.CloseTime, orderValue, buy), false
+		}
+	}
+	return r.executionPrice(symbol, markPrice, ts, orderValue, buy)
+}
+
+// applyVolumeImpact 成交量冲击：额外滑点率 = slippage_bps × 订单价值 / 当前K线成交额，买入抬高、卖出压低成交价。
+func (r *Runner) applyVolumeImpact(symbol string, price float64, ts int64, orderValue float64, buy bool) float64 {
+	if r.cfg.SlippageModel != SlippageModelVolumeImpact || r.cfg.SlippageBps <= 0 || orderValue <= 0 {
+		return price
+	}
+	quoteVolume := r.feed.barQuoteVolume(symbol, ts)
+	if quoteVolume <= 0 {
+		return price
+	}
+	impact := r.cfg.SlippageBps / 10000.0 * orderValue / quoteVolume
+	if buy {
+		return price * (1 + impact)
+	}
+	return price * (1 - impact)
+}
+
+// policyPrice 按成交策略取价；成交策略无法取价时退回标记价，视为市价吃单（taker）。
+func (r *Runner) policyPrice(symbol string, markPrice float64, ts int64) (float64, bool) {
 	curr, next := r.feed.decisionBarSnapshot(symbol, ts)
 	switch r.cfg.FillPolicy {
 	case FillPolicyNextOpen:
 		if next != nil && next.Open > 0 {
-			return next.Open
+			return next.Open, true
 		}
 	case FillPolicyBarVWAP:
 		if curr != nil {
 			if vwap := barVWAP(*curr); vwap > 0 {
-				return vwap
+				return vwap, true
+			}
+		}
+	case FillPolicyTrueVWAP:
+		if bars := r.feed.intrabarKlines(symbol, ts); len(bars) > 0 {
+			if vwap := market.CalculateVWAP(bars); vwap > 0 {
+				return vwap, true
 			}
 		}
 	case FillPolicyMidPrice:
 		if curr != nil && curr.High > 0 && curr.Low > 0 {
-			return (curr.High + curr.Low) / 2
+			return (curr.High + curr.Low) / 2, true
 		}
 	}
-	return markPrice
+	return markPrice, false
+}
+
+// checkPriceBand 开仓前检查成交价是否偏离参考价过多（防止追价或数据异常导致的离谱成交）。
+// 平仓只减仓，快速行情中更需要及时退出，不受价格带限制。
+func (r *Runner) checkPriceBand(symbol, action string, price float64, ts int64) error {
+	if r.cfg.PriceBandPct <= 0 || r.feed == nil {
+		return nil
+	}
+	switch action {
+	case "open_long", "open_short":
+	default:
+		return nil
+	}
+	reference := r.feed.previousClose(symbol, ts)
+	if reference <= 0 {
+		return nil
+	}
+	deviationPct := math.Abs(price-reference) / reference * 100
+	if deviationPct > r.cfg.PriceBandPct {
+		return fmt.Errorf("price %.4f deviates %.2f%% from reference %.4f (band %.2f%%)", price, deviationPct, reference, r.cfg.PriceBandPct)
+	}
+	return nil
 }
 
 func (r *Runner) totalMarginUsed() float64 {
@@ -926,6 +1679,8 @@ func (r *Runner) updateState(ts int64, equity, unrealized, marginUsed float64, p
 			OpenTime:         pos.OpenTime,
 			StopLoss:         pos.StopLoss,
 			TakeProfit:       pos.TakeProfit,
+			TrailPct:         pos.TrailPct,
+			TrailAnchor:      pos.TrailAnchor,
 		}
 	}
 
@@ -984,6 +1739,10 @@ func (r *Runner) snapshotForCheckpoint(state BacktestState) []PositionSnapshot {
 }
 
 func (r *Runner) checkLiquidation(ts int64, priceMap map[string]float64, cycle int) ([]TradeEvent, string, error) {
+	if events, note := r.checkCrossLiquidation(priceMap, priceMap, ts, cycle); len(events) > 0 {
+		return events, note, nil
+	}
+
 	positions := append([]*position(nil), r.account.Positions()...)
 	events := make([]TradeEvent, 0)
 	var noteBuilder strings.Builder
@@ -1008,10 +1767,12 @@ func (r *Runner) checkLiquidation(ts int64, priceMap map[string]float64, cycle i
 			continue
 		}
 
-		realized, fee, finalPrice, err := r.account.Close(pos.Symbol, pos.Side, pos.Quantity, execPrice)
+		qty := pos.Quantity
+		realized, fee, finalPrice, err := r.account.Close(pos.Symbol, pos.Side, qty, execPrice, false)
 		if err != nil {
 			return nil, "", err
 		}
+		fee += r.account.ChargeLiquidationFee(finalPrice * qty)
 
 		noteBuilder.WriteString(fmt.Sprintf("%s %s @ %.4f; ", pos.Symbol, pos.Side, finalPrice))
 
@@ -1020,11 +1781,11 @@ func (r *Runner) checkLiquidation(ts int64, priceMap map[string]float64, cycle i
 			Symbol:          pos.Symbol,
 			Action:          "liquidated",
 			Side:            pos.Side,
-			Quantity:        pos.Quantity,
+			Quantity:        qty,
 			Price:           finalPrice,
 			Fee:             fee,
 			Slippage:        0,
-			OrderValue:      finalPrice * pos.Quantity,
+			OrderValue:      finalPrice * qty,
 			RealizedPnL:     realized - fee,
 			Leverage:        pos.Leverage,
 			Cycle:           cycle,
@@ -1060,6 +1821,11 @@ func (r *Runner) checkRiskEventsWithOHLC(
 	slTpEvents := make([]TradeEvent, 0)
 	liqEvents := make([]TradeEvent, 0)
 
+	// 全仓模式：账户整体跌破维持保证金时全部强平（优先于逐个持仓的止损止盈）
+	if events, _ := r.checkCrossLiquidation(highMap, lowMap, ts, cycle); len(events) > 0 {
+		return slTpEvents, events
+	}
+
 	// 复制持仓列表以避免迭代时修改
 	positions := append([]*position(nil), r.account.Positions()...)
 
@@ -1127,7 +1893,8 @@ func (r *Runner) checkRiskEventsWithOHLC(
 		}
 
 		// 执行平仓，应用滑点
-		fillPrice := r.executionPrice(pos.Symbol, triggerPrice, ts)
+		// 止损/止盈触发按市价平仓，始终使用 taker 费率；平空为买入方向
+		fillPrice, _ := r.executionPrice(pos.Symbol, triggerPrice, ts, pos.Quantity*triggerPrice, pos.Side == "short")
 
 		// 🔧 修复：所有触发都应该使用更真实的成交价
 		// 止损/止盈/爆仓都是市价单，在市场继续向不利方向移动时会以更差的价格成交
@@ -1151,11 +1918,13 @@ func (r *Runner) checkRiskEventsWithOHLC(
 			}
 		}
 
+		qty := pos.Quantity
 		realized, fee, execPrice, err := r.account.Close(
 			pos.Symbol,
 			pos.Side,
-			pos.Quantity,
+			qty,
 			fillPrice,
+			false,
 		)
 
 		if err != nil {
@@ -1163,6 +1932,10 @@ func (r *Runner) checkRiskEventsWithOHLC(
 				triggerType, pos.Symbol, pos.Side, err)
 			continue
 		}
+		if triggerType == "liquidation" {
+			// 强平在正常手续费之外额外收取罚金
+			fee += r.account.ChargeLiquidationFee(execPrice * qty)
+		}
 
 		action := fmt.Sprintf("auto_close_%s_%s", pos.Side, triggerType)
 		trade := TradeEvent{
@@ -1170,7 +1943,7 @@ func (r *Runner) checkRiskEventsWithOHLC(
 			Symbol:          pos.Symbol,
 			Action:          action,
 			Side:            pos.Side,
-			Quantity:        pos.Quantity,
+			Quantity:        qty,
 			Price:           execPrice,
 			Fee:             fee,
 			RealizedPnL:     realized - fee,
@@ -1199,6 +1972,117 @@ func (r *Runner) checkRiskEventsWithOHLC(
 	return slTpEvents, liqEvents
 }
 
+// checkMaxHold 强制平掉持仓超过 MaxHoldBars 根决策K线的仓位，按当根K线价格以市价（taker）成交。
+// 持仓时长 = 当前决策K线下标 - 开仓时间所在决策K线下标；MaxHoldBars 为 0 时不检查。
+func (r *Runner) checkMaxHold(priceMap map[string]float64, ts int64, barIndex int, cycle int) []TradeEvent {
+	if r.cfg.MaxHoldBars <= 0 {
+		return nil
+	}
+
+	positions := append([]*position(nil), r.account.Positions()...)
+	sort.Slice(positions, func(i, j int) bool {
+		return positionKey(positions[i].Symbol, positions[i].Side) < positionKey(positions[j].Symbol, positions[j].Side)
+	})
+
+	var events []TradeEvent
+	for _, pos := range positions {
+		age := barIndex - r.feed.decisionBarIndex(pos.OpenTime)
+		if age <= r.cfg.MaxHoldBars {
+			continue
+		}
+		price := priceMap[pos.Symbol]
+		if price <= 0 {
+			continue
+		}
+
+		qty := pos.Quantity
+		fillPrice, _ := r.executionPrice(pos.Symbol, price, ts, qty*price, pos.Side == "short")
+		realized, fee, execPrice, err := r.account.Close(pos.Symbol, pos.Side, qty, fillPrice, false)
+		if err != nil {
+			log.Printf("⚠️ 超时平仓失败 [%s %s]: %v", pos.Symbol, pos.Side, err)
+			continue
+		}
+
+		// 与 executeDecision 一致：平多卖出、平空买入，滑点为正表示成交价不利
+		slippage := price - execPrice
+		if pos.Side == "short" {
+			slippage = execPrice - price
+		}
+
+		reason := fmt.Sprintf("max hold exceeded: %s %s 持仓 %d 根K线 > 上限 %d", pos.Symbol, pos.Side, age, r.cfg.MaxHoldBars)
+		events = append(events, TradeEvent{
+			Timestamp:   ts,
+			Symbol:      pos.Symbol,
+			Action:      fmt.Sprintf("auto_close_%s_max_hold", pos.Side),
+			Side:        pos.Side,
+			Quantity:    qty,
+			Price:       execPrice,
+			Fee:         fee,
+			Slippage:    slippage,
+			OrderValue:  execPrice * qty,
+			RealizedPnL: realized - fee,
+			Leverage:    pos.Leverage,
+			Cycle:       cycle,
+			Note:        reason,
+		})
+		log.Printf("  ⏱ %s (实际价格: %.4f, 盈亏: %.2f USDT)", reason, execPrice, realized-fee)
+	}
+	return events
+}
+
+// checkCrossLiquidation 全仓模式下按各持仓的不利价格检查账户权益，低于总维持保证金时
+// 以该不利价格强平全部持仓（保守估计）；返回强平事件及说明，未触发时返回 nil。
+func (r *Runner) checkCrossLiquidation(highMap, lowMap map[string]float64, ts int64, cycle int) ([]TradeEvent, string) {
+	breached, equity, maintenance := r.account.CrossMarginBreached(highMap, lowMap)
+	if !breached {
+		return nil, ""
+	}
+
+	positions := append([]*position(nil), r.account.Positions()...)
+	sort.Slice(positions, func(i, j int) bool {
+		return positionKey(positions[i].Symbol, positions[i].Side) < positionKey(positions[j].Symbol, positions[j].Side)
+	})
+	reason := fmt.Sprintf("全仓强制平仓: 权益 %.2f < 维持保证金 %.2f", equity, maintenance)
+	events := make([]TradeEvent, 0, len(positions))
+	var noteBuilder strings.Builder
+	for _, pos := range positions {
+		qty := pos.Quantity
+		realized, fee, execPrice, err := r.account.Close(pos.Symbol, pos.Side, qty, adversePrice(pos, highMap, lowMap), false)
+		if err != nil {
+			log.Printf("⚠️ 全仓强平失败 [%s %s]: %v", pos.Symbol, pos.Side, err)
+			continue
+		}
+		fee += r.account.ChargeLiquidationFee(execPrice * qty)
+		noteBuilder.WriteString(fmt.Sprintf("%s %s @ %.4f; ", pos.Symbol, pos.Side, execPrice))
+		events = append(events, TradeEvent{
+			Timestamp:       ts,
+			Symbol:          pos.Symbol,
+			Action:          "liquidated",
+			Side:            pos.Side,
+			Quantity:        qty,
+			Price:           execPrice,
+			Fee:             fee,
+			OrderValue:      execPrice * qty,
+			RealizedPnL:     realized - fee,
+			Leverage:        pos.Leverage,
+			Cycle:           cycle,
+			LiquidationFlag: true,
+			Note:            reason,
+		})
+	}
+	if len(events) == 0 {
+		return nil, ""
+	}
+	log.Printf("  🚨 %s", reason)
+
+	note := strings.TrimSuffix(noteBuilder.String(), "; ")
+	r.stateMu.Lock()
+	r.state.Liquidated = true
+	r.state.LiquidationNote = note
+	r.stateMu.Unlock()
+	return events, note
+}
+
 func (r *Runner) shouldTriggerDecision(barIndex int) bool {
 	if r.cfg.DecisionCadenceNBars <= 1 {
 		return true
@@ -1333,9 +2217,59 @@ func (r *Runner) StatusPayload() StatusPayload {
 		LastError:      r.lastErrorString(),
 		LastUpdatedIso: snapshot.LastUpdate.UTC().Format(time.RFC3339),
 	}
+	if report := r.CacheHealth(); report != nil {
+		healthy := report.Consistent
+		payload.CacheHealthy = &healthy
+		payload.CacheCheckedAt = report.CheckedAt.UTC().Format(time.RFC3339)
+	}
 	return payload
 }
 
+// maybeCheckCacheHealth 达到配置间隔时在后台协程中校验交易缓存与决策文件是否一致；
+// 上一次校验尚未结束时跳过，保证回测循环不被阻塞。
+func (r *Runner) maybeCheckCacheHealth() {
+	interval := time.Duration(r.cfg.CacheCheckIntervalSeconds) * time.Second
+	if interval <= 0 || r.decisionLogger == nil {
+		return
+	}
+	if !r.lastCacheCheck.IsZero() && time.Since(r.lastCacheCheck) < interval {
+		return
+	}
+	if !r.cacheCheckInFlight.CompareAndSwap(false, true) {
+		return
+	}
+	r.lastCacheCheck = time.Now()
+	r.cacheCheckWG.Add(1)
+	go func() {
+		defer r.cacheCheckWG.Done()
+		defer r.cacheCheckInFlight.Store(false)
+		r.runCacheHealthCheck()
+	}()
+}
+
+// runCacheHealthCheck 执行一次缓存一致性校验并记录结果。
+func (r *Runner) runCacheHealthCheck() {
+	report, err := r.decisionLogger.VerifyCacheConsistency()
+	if err != nil {
+		log.Printf("cache consistency check failed for %s: %v", r.cfg.RunID, err)
+		return
+	}
+	if !report.Consistent {
+		log.Printf("⚠️ 回测 %s 交易缓存与决策文件不一致: 缺失 %d, 多余 %d, 盈亏不符 %d",
+			r.cfg.RunID, len(report.MissingInCache), len(report.UnexpectedInCache), len(report.Mismatched))
+	}
+	r.cacheHealthMu.Lock()
+	r.cacheHealth = report
+	r.cacheHealthMu.Unlock()
+}
+
+// CacheHealth 返回最近一次缓存一致性校验结果（未开启或尚未校验时为 nil）。
+func (r *Runner) CacheHealth() *logger.CacheConsistencyReport {
+	r.cacheHealthMu.RLock()
+	defer r.cacheHealthMu.RUnlock()
+	return r.cacheHealth
+}
+
 func (r *Runner) snapshotState() BacktestState {
 	r.stateMu.RLock()
 	defer r.stateMu.RUnlock()
@@ -1392,6 +2326,7 @@ func (r *Runner) persistMetrics(force bool) {
 	if metrics == nil {
 		return
 	}
+	metrics.AICacheHitRate = r.aiCacheHitRate()
 	if err := PersistMetrics(r.cfg.RunID, metrics); err != nil {
 		log.Printf("failed to persist metrics for %s: %v", r.cfg.RunID, err)
 		return
@@ -1399,6 +2334,26 @@ func (r *Runner) persistMetrics(force bool) {
 	r.lastMetricsWrite = time.Now()
 }
 
+// lookupAICache 查询 AI 决策缓存并记录本次运行的命中情况。
+func (r *Runner) lookupAICache(key string) (*decision.FullDecision, bool) {
+	cached, ok := r.aiCache.Get(key)
+	if ok {
+		r.aiCacheHits.Add(1)
+	} else {
+		r.aiCacheMisses.Add(1)
+	}
+	return cached, ok
+}
+
+// aiCacheHitRate 返回本次运行的 AI 决策缓存命中率（0-1），未启用缓存或尚无查询时为 0。
+func (r *Runner) aiCacheHitRate() float64 {
+	hits, misses := r.aiCacheHits.Load(), r.aiCacheMisses.Load()
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
 func (r *Runner) buildMetadata(state BacktestState, runState RunState) *RunMetadata {
 	if state.Liquidated && runState != RunStateLiquidated {
 		runState = RunStateLiquidated
@@ -1420,6 +2375,7 @@ func (r *Runner) buildMetadata(state BacktestState, runState RunState) *RunMetad
 		CustomPrompt:          r.cfg.CustomPrompt,
 		OverridePrompt:        r.cfg.OverrideBasePrompt,
 		PromptContentSnapshot: r.promptSnapshot,
+		AICacheHitRate:        r.aiCacheHitRate(),
 	}
 
 	meta := &RunMetadata{
@@ -1480,6 +2436,10 @@ func (r *Runner) buildCheckpointFromState(state BacktestState) *Checkpoint {
 		MinEquity:       state.MinEquity,
 		MaxDrawdownPct:  state.MaxDrawdownPct,
 		AICacheRef:      r.cachePath,
+		PendingOrders:   r.account.PendingOrders(),
+		DayStart:        state.DayStart,
+		DayStartEquity:  state.DayStartEquity,
+		DailyHalted:     state.DailyHalted,
 	}
 }
 
@@ -1514,7 +2474,7 @@ func (r *Runner) applyCheckpoint(ckpt *Checkpoint) error {
 	if ckpt == nil {
 		return fmt.Errorf("checkpoint is nil")
 	}
-	r.account.RestoreFromSnapshots(ckpt.Cash, ckpt.RealizedPnL, ckpt.Positions)
+	r.account.RestoreFromSnapshots(ckpt.Cash, ckpt.RealizedPnL, ckpt.Positions, ckpt.PendingOrders)
 	r.decisionLogger.SetCycleNumber(ckpt.DecisionCycle)
 	r.stateMu.Lock()
 	defer r.stateMu.Unlock()
@@ -1530,6 +2490,9 @@ func (r *Runner) applyCheckpoint(ckpt *Checkpoint) error {
 	r.state.MaxEquity = ckpt.MaxEquity
 	r.state.MinEquity = ckpt.MinEquity
 	r.state.MaxDrawdownPct = ckpt.MaxDrawdownPct
+	r.state.DayStart = ckpt.DayStart
+	r.state.DayStartEquity = ckpt.DayStartEquity
+	r.state.DailyHalted = ckpt.DailyHalted
 	r.state.Positions = snapshotsToMap(ckpt.Positions)
 	r.state.LastUpdate = time.Now().UTC()
 	r.lastCheckpoint = time.Now()
@@ -1552,6 +2515,8 @@ func sortDecisionsByPriority(decisions []decision.Decision) []decision.Decision
 
 	priority := func(action string) int {
 		switch action {
+		case "close_all":
+			return 0
 		case "close_long", "close_short":
 			return 1
 		case "open_long", "open_short":
@@ -1578,6 +2543,7 @@ func sortDecisionsByPriority(decisions []decision.Decision) []decision.Decision
 	return result
 }
 
+// barVWAP 以 OHLC 均价近似 VWAP（不考虑成交量），真实 VWAP 见 FillPolicyTrueVWAP。
 func barVWAP(k market.Kline) float64 {
 	values := []float64{k.Open, k.High, k.Low, k.Close}
 	sum := 0.0
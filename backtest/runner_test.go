@@ -0,0 +1,1750 @@
+package backtest
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"nofx/decision"
+	"nofx/logger"
+	"nofx/market"
+)
+
+// TestFillDecisionRecord_RawAIResponse 测试原始 AI 响应按配置落盘且已脱敏
+func TestFillDecisionRecord_RawAIResponse(t *testing.T) {
+	const apiKey = "my-provider-key-1234567890"
+	raw := "<reasoning>think</reasoning>\n[{\"symbol\":\"BTCUSDT\",\"action\":\"hold\"}]\nmeta: key=" + apiKey + " token=sk-abcdefghijklmnopqrstuvwx"
+	full := &decision.FullDecision{
+		CoTTrace:    "think",
+		Decisions:   []decision.Decision{{Symbol: "BTCUSDT", Action: "hold"}},
+		RawResponse: raw,
+	}
+
+	tests := []struct {
+		name    string
+		persist bool
+	}{
+		{name: "option on", persist: true},
+		{name: "option off", persist: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Runner{cfg: BacktestConfig{
+				PersistRawAIResponse: tt.persist,
+				AICfg:                AIConfig{APIKey: apiKey},
+			}}
+			record := &logger.DecisionRecord{}
+			r.fillDecisionRecord(record, full)
+
+			if record.CoTTrace != "think" {
+				t.Errorf("CoTTrace = %q, want %q", record.CoTTrace, "think")
+			}
+			if !strings.Contains(record.DecisionJSON, "BTCUSDT") {
+				t.Errorf("DecisionJSON missing parsed decision: %s", record.DecisionJSON)
+			}
+
+			if !tt.persist {
+				if record.RawAIResponse != "" {
+					t.Errorf("RawAIResponse should be empty when disabled, got %q", record.RawAIResponse)
+				}
+				return
+			}
+			if !strings.Contains(record.RawAIResponse, "<reasoning>think</reasoning>") {
+				t.Errorf("RawAIResponse missing original content: %q", record.RawAIResponse)
+			}
+			if strings.Contains(record.RawAIResponse, apiKey) || strings.Contains(record.RawAIResponse, "sk-abcdef") {
+				t.Errorf("RawAIResponse leaked secret: %q", record.RawAIResponse)
+			}
+		})
+	}
+}
+
+// TestPositionHeatmap 测试持仓热力图的强平距离与保证金占比
+func TestPositionHeatmap(t *testing.T) {
+	acc := NewBacktestAccount(10000, 0, 0)
+	if _, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 0, 0, 0, false); err != nil {
+		t.Fatalf("open BTC: %v", err)
+	}
+	if _, _, _, err := acc.Open("ETHUSDT", "short", 1, 5, 3000, 0, 0, 0, false); err != nil {
+		t.Fatalf("open ETH: %v", err)
+	}
+	r := &Runner{account: acc}
+
+	priceMap := map[string]float64{"BTCUSDT": 48000, "ETHUSDT": 3300}
+	heat := r.PositionHeatmap(priceMap)
+	if len(heat) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(heat))
+	}
+
+	// 按 symbol 排序：BTCUSDT 在前
+	btc, eth := heat[0], heat[1]
+	if btc.Symbol != "BTCUSDT" || eth.Symbol != "ETHUSDT" {
+		t.Fatalf("unexpected order: %s, %s", btc.Symbol, eth.Symbol)
+	}
+
+	approx := func(name string, got, want float64) {
+		t.Helper()
+		if math.Abs(got-want) > 1e-6 {
+			t.Errorf("%s = %.6f, want %.6f", name, got, want)
+		}
+	}
+
+	// BTC 多头：强平价 45000，距标记价 (48000-45000)/48000
+	approx("btc.DistanceToLiqPct", btc.DistanceToLiqPct, 6.25)
+	approx("btc.UnrealizedPnL", btc.UnrealizedPnL, -200)
+	approx("btc.UnrealizedPnLPct", btc.UnrealizedPnLPct, -40)
+	// ETH 空头：强平价 3600，距标记价 (3600-3300)/3300
+	approx("eth.DistanceToLiqPct", eth.DistanceToLiqPct, 300.0/3300*100)
+	approx("eth.UnrealizedPnL", eth.UnrealizedPnL, -300)
+
+	// 净值 = 10000 - 200 - 300 = 9500，保证金 500 + 600
+	equity := 9500.0
+	approx("btc.MarginSharePct", btc.MarginSharePct, 500/equity*100)
+	approx("eth.MarginSharePct", eth.MarginSharePct, 600/equity*100)
+	approx("total margin share", btc.MarginSharePct+eth.MarginSharePct, r.totalMarginUsed()/equity*100)
+	if btc.MarkMissing || eth.MarkMissing {
+		t.Errorf("marks are present, MarkMissing should be false")
+	}
+
+	// 缺少标记价的持仓不显示为全额亏损
+	missing := r.PositionHeatmap(map[string]float64{"BTCUSDT": 48000})
+	if len(missing) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(missing))
+	}
+	if eth := missing[1]; !eth.MarkMissing || eth.UnrealizedPnL != 0 || eth.UnrealizedPnLPct != 0 || eth.DistanceToLiqPct != 0 {
+		t.Errorf("ETH without mark = %+v, want MarkMissing with zero PnL", eth)
+	}
+}
+
+// TestABPrompts_AlternateAndSplitStats 测试 A/B 提示词按周期轮换，交易按 PromptHash 拆分统计
+func TestABPrompts_AlternateAndSplitStats(t *testing.T) {
+	cfg := BacktestConfig{
+		RunID:          "ab-test",
+		Symbols:        []string{"BTCUSDT"},
+		StartTS:        1,
+		EndTS:          2,
+		PromptTemplate: "default",
+		ABPrompts:      []string{" alpha ", "beta", ""},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if len(cfg.ABPrompts) != 2 || cfg.ABPromptMode != ABPromptModeRoundRobin {
+		t.Fatalf("unexpected normalized config: %v / %s", cfg.ABPrompts, cfg.ABPromptMode)
+	}
+
+	r := &Runner{cfg: cfg}
+	dLog := logger.NewDecisionLogger(t.TempDir())
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	const cycles = 6
+	for cycle := 1; cycle <= cycles; cycle++ {
+		template := r.promptTemplateForCycle(cycle)
+		want := cfg.ABPrompts[(cycle-1)%2]
+		if template != want {
+			t.Fatalf("cycle %d: template = %s, want %s", cycle, template, want)
+		}
+
+		// alpha 每笔盈利，beta 每笔亏损
+		closePrice := 101.0
+		if template == "beta" {
+			closePrice = 99.0
+		}
+		openTime := base.Add(time.Duration(cycle) * time.Hour)
+		record := &logger.DecisionRecord{Success: true, Exchange: "binance"}
+		r.fillDecisionRecord(record, &decision.FullDecision{PromptHash: "hash-" + template})
+		record.Decisions = []logger.DecisionAction{
+			{Action: "open_long", Symbol: "BTCUSDT", Quantity: 1, Leverage: 5, Price: 100, Timestamp: openTime, Success: true},
+			{Action: "close_long", Symbol: "BTCUSDT", Quantity: 1, Price: closePrice, Timestamp: openTime.Add(30 * time.Minute), Success: true},
+		}
+		if err := dLog.LogDecision(record); err != nil {
+			t.Fatalf("LogDecision: %v", err)
+		}
+	}
+
+	all, err := dLog.GetPerformanceWithCache(100, false)
+	if err != nil {
+		t.Fatalf("GetPerformanceWithCache: %v", err)
+	}
+	if all.TotalTrades != cycles {
+		t.Fatalf("expected %d trades in total, got %d", cycles, all.TotalTrades)
+	}
+
+	// 最新一笔来自 beta（第 6 周期），按 prompt 过滤后只统计 beta 的交易
+	filtered, err := dLog.GetPerformanceWithCache(100, true)
+	if err != nil {
+		t.Fatalf("GetPerformanceWithCache(filter): %v", err)
+	}
+	if filtered.TotalTrades != cycles/2 {
+		t.Fatalf("expected %d beta trades, got %d", cycles/2, filtered.TotalTrades)
+	}
+	for _, trade := range filtered.RecentTrades {
+		if trade.PromptHash != "hash-beta" {
+			t.Errorf("unexpected prompt hash %s in filtered stats", trade.PromptHash)
+		}
+	}
+	if filtered.WinRate != 0 {
+		t.Errorf("beta win rate = %.2f, want 0", filtered.WinRate)
+	}
+}
+
+// TestPromptTemplateForCycle_HashMode 测试 hash 模式下的模板选择可复现
+func TestPromptTemplateForCycle_HashMode(t *testing.T) {
+	r := &Runner{cfg: BacktestConfig{RunID: "run-a", ABPrompts: []string{"alpha", "beta"}, ABPromptMode: ABPromptModeHash}}
+	seen := map[string]bool{}
+	for cycle := 1; cycle <= 20; cycle++ {
+		first := r.promptTemplateForCycle(cycle)
+		if again := r.promptTemplateForCycle(cycle); again != first {
+			t.Fatalf("cycle %d: non-deterministic choice %s vs %s", cycle, first, again)
+		}
+		seen[first] = true
+	}
+	if !seen["alpha"] || !seen["beta"] {
+		t.Errorf("expected both prompts to be sampled, got %v", seen)
+	}
+
+	plain := &Runner{cfg: BacktestConfig{PromptTemplate: "default"}}
+	if got := plain.promptTemplateForCycle(3); got != "default" {
+		t.Errorf("without ABPrompts expected default template, got %s", got)
+	}
+}
+
+// TestExecuteDecision_PriceBand 测试成交价偏离参考价过多时拒单
+func TestExecuteDecision_PriceBand(t *testing.T) {
+	const barMs = int64(5 * 60 * 1000)
+	newRunner := func(nextOpen float64) *Runner {
+		klines := []market.Kline{
+			{OpenTime: 0, Open: 100, High: 101, Low: 99, Close: 100, CloseTime: barMs},
+			{OpenTime: barMs, Open: 100, High: 101, Low: 99, Close: 100, CloseTime: 2 * barMs},
+			{OpenTime: 2 * barMs, Open: nextOpen, High: nextOpen, Low: nextOpen, Close: nextOpen, CloseTime: 3 * barMs},
+		}
+		closeTimes := make([]int64, len(klines))
+		for i, k := range klines {
+			closeTimes[i] = k.CloseTime
+		}
+		feed := &DataFeed{
+			primaryTF: "5m",
+			symbolSeries: map[string]*symbolSeries{
+				"BTCUSDT": {byTF: map[string]*timeframeSeries{"5m": {klines: klines, closeTimes: closeTimes}}},
+			},
+		}
+		return &Runner{
+			cfg:     BacktestConfig{FillPolicy: FillPolicyNextOpen, PriceBandPct: 10},
+			feed:    feed,
+			account: NewBacktestAccount(10000, 0, 0),
+			state:   &BacktestState{Equity: 10000, Positions: map[string]PositionSnapshot{}},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		nextOpen   float64
+		wantReject bool
+	}{
+		{name: "2% deviation passes", nextOpen: 102, wantReject: false},
+		{name: "50% deviation rejected", nextOpen: 150, wantReject: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRunner(tt.nextOpen)
+			dec := decision.Decision{Symbol: "BTCUSDT", Action: "open_long", Leverage: 5, PositionSizeUSD: 500}
+			// 决策在第二根K线收盘时做出，参考价为上一根收盘价 100
+			_, trades, _, err := r.executeDecision(dec, map[string]float64{"BTCUSDT": 100}, 2*barMs, 1)
+			if tt.wantReject {
+				if err == nil || !strings.Contains(err.Error(), "deviates") {
+					t.Fatalf("expected price band rejection, got err=%v", err)
+				}
+				if len(trades) != 0 || len(r.account.Positions()) != 0 {
+					t.Fatalf("rejected order must not open a position")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(trades) != 1 || trades[0].Price != tt.nextOpen {
+				t.Fatalf("trades = %+v, want one fill at %.2f", trades, tt.nextOpen)
+			}
+		})
+	}
+
+	// 平仓只减仓，偏离参考价也照常成交
+	r := newRunner(150)
+	if _, _, _, err := r.account.Open("BTCUSDT", "long", 5, 5, 100, 0, 0, barMs, false); err != nil {
+		t.Fatalf("open position: %v", err)
+	}
+	closeDec := decision.Decision{Symbol: "BTCUSDT", Action: "close_long"}
+	_, trades, _, err := r.executeDecision(closeDec, map[string]float64{"BTCUSDT": 100}, 2*barMs, 1)
+	if err != nil {
+		t.Fatalf("close outside band rejected: %v", err)
+	}
+	if len(trades) != 1 || trades[0].Price != 150 || len(r.account.Positions()) != 0 {
+		t.Fatalf("trades = %+v, want close filled at 150", trades)
+	}
+
+	// 未配置时不做检查
+	r = newRunner(150)
+	r.cfg.PriceBandPct = 0
+	dec := decision.Decision{Symbol: "BTCUSDT", Action: "open_long", Leverage: 5, PositionSizeUSD: 500}
+	if _, _, _, err := r.executeDecision(dec, map[string]float64{"BTCUSDT": 100}, 2*barMs, 1); err != nil {
+		t.Fatalf("band disabled: unexpected error %v", err)
+	}
+}
+
+// TestExecuteDecision_DecisionLatency 测试决策延迟 N 根K线时按延迟后那根K线的开盘价成交（taker 计费），而不是决策K线的价格
+func TestExecuteDecision_DecisionLatency(t *testing.T) {
+	const barMs = int64(5 * 60 * 1000)
+	klines := make([]market.Kline, 6)
+	closeTimes := make([]int64, len(klines))
+	for i := range klines {
+		price := 100 + float64(i)*10 // 各K线价格互不相同：100, 110, 120...
+		klines[i] = market.Kline{OpenTime: int64(i) * barMs, Open: price, High: price + 2, Low: price - 2, Close: price + 1, CloseTime: int64(i+1) * barMs}
+		closeTimes[i] = klines[i].CloseTime
+	}
+
+	tests := []struct {
+		name      string
+		latency   int
+		wantPrice float64
+		wantMaker bool
+	}{
+		{"no latency uses decision bar mid price", 0, 110, true},
+		{"1 bar latency fills at next open", 1, 120, false},
+		{"2 bar latency fills at open two bars later", 2, 130, false},
+		{"latency beyond data falls back to fill policy", 10, 110, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Runner{
+				cfg: BacktestConfig{FillPolicy: FillPolicyMidPrice, DecisionLatencyBars: tt.latency},
+				feed: &DataFeed{
+					primaryTF: "5m",
+					symbolSeries: map[string]*symbolSeries{
+						"BTCUSDT": {byTF: map[string]*timeframeSeries{"5m": {klines: klines, closeTimes: closeTimes}}},
+					},
+				},
+				account: NewBacktestAccount(10000, 0, 0),
+				state:   &BacktestState{Equity: 10000, Positions: map[string]PositionSnapshot{}},
+			}
+			// 决策在第 2 根K线（下标 1，收盘价 111）收盘时做出
+			dec := decision.Decision{Symbol: "BTCUSDT", Action: "open_long", Leverage: 5, PositionSizeUSD: 500}
+			action, trades, _, err := r.executeDecision(dec, map[string]float64{"BTCUSDT": klines[1].Close}, closeTimes[1], 1)
+			if err != nil {
+				t.Fatalf("executeDecision: %v", err)
+			}
+			if len(trades) != 1 || trades[0].Price != tt.wantPrice {
+				t.Fatalf("trades = %+v, want one fill at %.2f", trades, tt.wantPrice)
+			}
+			if action.IsMaker != tt.wantMaker {
+				t.Errorf("IsMaker = %v, want %v", action.IsMaker, tt.wantMaker)
+			}
+		})
+	}
+}
+
+// TestExecuteDecision_MakerFeeForFillPolicy 测试按成交策略取价的开平仓使用 maker 费率，无法取价退回标记价时使用 taker 费率
+func TestExecuteDecision_MakerFeeForFillPolicy(t *testing.T) {
+	const barMs = int64(5 * 60 * 1000)
+	klines := []market.Kline{
+		{OpenTime: 0, Open: 100, High: 100, Low: 100, Close: 100, CloseTime: barMs},
+		{OpenTime: barMs, Open: 100, High: 100, Low: 100, Close: 100, CloseTime: 2 * barMs},
+	}
+	closeTimes := []int64{barMs, 2 * barMs}
+
+	tests := []struct {
+		name      string
+		ts        int64
+		wantMaker bool
+		wantFee   float64 // 开仓 + 平仓，名义价值 500
+	}{
+		{"next open available uses maker", barMs, true, 2 * 500 * 0.0002},
+		{"fallback to mark price uses taker", 2 * barMs, false, 2 * 500 * 0.0005},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed := &DataFeed{
+				primaryTF: "5m",
+				symbolSeries: map[string]*symbolSeries{
+					"BTCUSDT": {byTF: map[string]*timeframeSeries{"5m": {klines: klines, closeTimes: closeTimes}}},
+				},
+			}
+			account := NewBacktestAccount(10000, 5, 0)
+			account.SetMakerFeeBps(2)
+			r := &Runner{
+				cfg:     BacktestConfig{FillPolicy: FillPolicyNextOpen},
+				feed:    feed,
+				account: account,
+				state:   &BacktestState{Equity: 10000, Positions: map[string]PositionSnapshot{}},
+			}
+			priceMap := map[string]float64{"BTCUSDT": 100}
+
+			totalFee := 0.0
+			for _, dec := range []decision.Decision{
+				{Symbol: "BTCUSDT", Action: "open_long", Leverage: 5, PositionSizeUSD: 500},
+				{Symbol: "BTCUSDT", Action: "close_long"},
+			} {
+				action, trades, _, err := r.executeDecision(dec, priceMap, tt.ts, 1)
+				if err != nil {
+					t.Fatalf("%s: %v", dec.Action, err)
+				}
+				if action.IsMaker != tt.wantMaker {
+					t.Errorf("%s IsMaker = %v, want %v", dec.Action, action.IsMaker, tt.wantMaker)
+				}
+				for _, trade := range trades {
+					totalFee += trade.Fee
+				}
+			}
+			if math.Abs(totalFee-tt.wantFee) > 1e-9 {
+				t.Errorf("total fee = %.6f, want %.6f", totalFee, tt.wantFee)
+			}
+		})
+	}
+}
+
+// TestExecuteDecision_VolumeImpactSlippage 测试 volume_impact 模型下同一根K线上大单成交价劣于小单
+func TestExecuteDecision_VolumeImpactSlippage(t *testing.T) {
+	const barMs = int64(5 * 60 * 1000)
+	klines := []market.Kline{
+		{OpenTime: 0, Open: 100, High: 100, Low: 100, Close: 100, QuoteVolume: 10000, CloseTime: barMs},
+	}
+	closeTimes := []int64{barMs}
+
+	fill := func(model, action string, sizeUSD float64) float64 {
+		feed := &DataFeed{
+			primaryTF: "5m",
+			symbolSeries: map[string]*symbolSeries{
+				"BTCUSDT": {byTF: map[string]*timeframeSeries{"5m": {klines: klines, closeTimes: closeTimes}}},
+			},
+		}
+		r := &Runner{
+			cfg:     BacktestConfig{SlippageModel: model, SlippageBps: 10},
+			feed:    feed,
+			account: NewBacktestAccount(100000, 0, 0),
+			state:   &BacktestState{Equity: 100000, Positions: map[string]PositionSnapshot{}},
+		}
+		dec := decision.Decision{Symbol: "BTCUSDT", Action: action, Leverage: 5, PositionSizeUSD: sizeUSD}
+		_, trades, _, err := r.executeDecision(dec, map[string]float64{"BTCUSDT": 100}, barMs, 1)
+		if err != nil || len(trades) != 1 {
+			t.Fatalf("%s %s %.0f: trades=%d err=%v", model, action, sizeUSD, len(trades), err)
+		}
+		return trades[0].Price
+	}
+
+	tests := []struct {
+		name   string
+		model  string
+		action string
+		worse  func(large, small float64) bool
+	}{
+		{"long pays more", SlippageModelVolumeImpact, "open_long", func(l, s float64) bool { return l > s }},
+		{"short receives less", SlippageModelVolumeImpact, "open_short", func(l, s float64) bool { return l < s }},
+		{"fixed model ignores size", SlippageModelFixed, "open_long", func(l, s float64) bool { return l == s }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			small := fill(tt.model, tt.action, 100)
+			large := fill(tt.model, tt.action, 5000)
+			if !tt.worse(large, small) {
+				t.Errorf("large fill %.6f vs small fill %.6f", large, small)
+			}
+		})
+	}
+}
+
+// TestPolicyPrice_TrueVWAP 测试真实 VWAP 成交按更细周期成交量加权，而非 OHLC 简单平均
+func TestPolicyPrice_TrueVWAP(t *testing.T) {
+	const minute = int64(60 * 1000)
+	primary := []market.Kline{{OpenTime: 0, Open: 100, High: 110, Low: 100, Close: 110, Volume: 100, CloseTime: 5 * minute}}
+	// 5 根 1m K线中成交量集中在最后一根 110 附近的K线上
+	fine := make([]market.Kline, 5)
+	fineCloses := make([]int64, 5)
+	for i := range fine {
+		price := 100 + float64(i)*2.5
+		fine[i] = market.Kline{OpenTime: int64(i) * minute, Open: price, High: price, Low: price, Close: price, Volume: 1, CloseTime: int64(i+1) * minute}
+		fineCloses[i] = int64(i+1) * minute
+	}
+	fine[4].Volume = 96
+
+	tests := []struct {
+		name string
+		byTF map[string]*timeframeSeries
+		want float64
+	}{
+		{
+			name: "weighted by 1m volume",
+			byTF: map[string]*timeframeSeries{
+				"5m": {klines: primary, closeTimes: []int64{5 * minute}},
+				"1m": {klines: fine, closeTimes: fineCloses},
+			},
+			want: (100 + 102.5 + 105 + 107.5 + 110*96) / 100,
+		},
+		{
+			name: "decision bar only",
+			byTF: map[string]*timeframeSeries{"5m": {klines: primary, closeTimes: []int64{5 * minute}}},
+			want: (110 + 100 + 110) / 3.0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Runner{
+				cfg:  BacktestConfig{FillPolicy: FillPolicyTrueVWAP},
+				feed: &DataFeed{primaryTF: "5m", symbolSeries: map[string]*symbolSeries{"BTCUSDT": {byTF: tt.byTF}}},
+			}
+			price, ok := r.policyPrice("BTCUSDT", 0, 5*minute)
+			if !ok || math.Abs(price-tt.want) > 1e-9 {
+				t.Errorf("policyPrice = (%.6f, %v), want (%.6f, true)", price, ok, tt.want)
+			}
+			if naive := barVWAP(primary[0]); math.Abs(price-naive) < 1e-9 {
+				t.Errorf("true VWAP %.6f should differ from OHLC average %.6f", price, naive)
+			}
+		})
+	}
+}
+
+// TestDetermineQuantity_ClampedByMaxOpen 测试开仓数量不超过可用保证金允许的最大值
+func TestDetermineQuantity_ClampedByMaxOpen(t *testing.T) {
+	r := &Runner{
+		cfg:     BacktestConfig{Leverage: LeverageConfig{BTCETHLeverage: 5, AltcoinLeverage: 5}},
+		account: NewBacktestAccount(1000, 0, 0),
+		state:   &BacktestState{Equity: 1000, Positions: map[string]PositionSnapshot{}},
+	}
+
+	small := r.determineQuantity(decision.Decision{Symbol: "BTCUSDT", Action: "open_long", PositionSizeUSD: 1000}, 50000)
+	if math.Abs(small-0.02) > 1e-12 {
+		t.Errorf("unclamped qty = %v, want 0.02", small)
+	}
+
+	huge := r.determineQuantity(decision.Decision{Symbol: "BTCUSDT", Action: "open_long", PositionSizeUSD: 100000}, 50000)
+	maxQty := r.account.MaxOpenQuantity("BTCUSDT", 50000, 5)
+	if math.Abs(huge-maxQty) > 1e-12 {
+		t.Errorf("clamped qty = %v, want MaxOpenQuantity %v", huge, maxQty)
+	}
+}
+
+// TestDetermineQuantity_NotionalCap 测试开仓名义价值不超过配置上限
+func TestDetermineQuantity_NotionalCap(t *testing.T) {
+	r := &Runner{
+		cfg: BacktestConfig{
+			Leverage:               LeverageConfig{BTCETHLeverage: 10, AltcoinLeverage: 10},
+			MaxPositionNotionalUSD: 2000,
+		},
+		account: NewBacktestAccount(10000, 0, 0),
+		state:   &BacktestState{Equity: 10000, Positions: map[string]PositionSnapshot{}},
+	}
+
+	tests := []struct {
+		name    string
+		sizeUSD float64
+		wantQty float64
+	}{
+		{"within cap untouched", 1500, 0.03},
+		{"exactly at cap", 2000, 0.04},
+		{"clamped to cap", 8000, 0.04},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qty := r.determineQuantity(decision.Decision{Symbol: "BTCUSDT", Action: "open_long", PositionSizeUSD: tt.sizeUSD}, 50000)
+			if math.Abs(qty-tt.wantQty) > 1e-12 {
+				t.Errorf("qty = %v, want %v", qty, tt.wantQty)
+			}
+		})
+	}
+}
+
+// TestDetermineQuantity_ATRRisk 测试 atr_risk 模式下高波动币种仓位更小，且每个 ATR 的风险相同
+func TestDetermineQuantity_ATRRisk(t *testing.T) {
+	r := &Runner{
+		cfg: BacktestConfig{
+			Leverage:        LeverageConfig{BTCETHLeverage: 10, AltcoinLeverage: 10},
+			SizingMode:      SizingModeATRRisk,
+			RiskPerTradePct: 1,
+		},
+		account:  NewBacktestAccount(10000, 0, 0),
+		state:    &BacktestState{Equity: 10000, Positions: map[string]PositionSnapshot{}},
+		cycleATR: map[string]float64{"LOWUSDT": 1, "HIGHUSDT": 4},
+	}
+
+	// 两个币种价格相同，ATR 分别为 1 和 4：风险 100 USD → 数量 100 和 25
+	low := r.determineQuantity(decision.Decision{Symbol: "LOWUSDT", Action: "open_long", PositionSizeUSD: 500}, 100)
+	high := r.determineQuantity(decision.Decision{Symbol: "HIGHUSDT", Action: "open_long", PositionSizeUSD: 500}, 100)
+	if math.Abs(low-100) > 1e-9 || math.Abs(high-25) > 1e-9 {
+		t.Fatalf("qty low=%v high=%v, want 100 and 25", low, high)
+	}
+	if math.Abs(low*1-high*4) > 1e-9 {
+		t.Errorf("risk per ATR differs: low=%v high=%v", low*1, high*4)
+	}
+
+	// 缺少 ATR 时退回 AI 给出的仓位金额
+	noATR := r.determineQuantity(decision.Decision{Symbol: "NOATRUSDT", Action: "open_long", PositionSizeUSD: 500}, 100)
+	if math.Abs(noATR-5) > 1e-9 {
+		t.Errorf("fallback qty = %v, want 5", noATR)
+	}
+
+	// fixed_fraction 模式忽略 ATR
+	r.cfg.SizingMode = SizingModeFixedFraction
+	fixed := r.determineQuantity(decision.Decision{Symbol: "HIGHUSDT", Action: "open_long", PositionSizeUSD: 500}, 100)
+	if math.Abs(fixed-5) > 1e-9 {
+		t.Errorf("fixed_fraction qty = %v, want 5", fixed)
+	}
+}
+
+func TestAtrPositionSize(t *testing.T) {
+	tests := []struct {
+		name                     string
+		equity, riskPct, atr, px float64
+		want                     float64
+	}{
+		{"low ATR", 10000, 1, 500, 50000, 10000},
+		{"high ATR", 10000, 1, 2000, 50000, 2500},
+		{"zero ATR", 10000, 1, 0, 50000, 0},
+		{"zero price", 10000, 1, 500, 0, 0},
+		{"zero risk", 10000, 0, 500, 50000, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := atrPositionSize(tt.equity, tt.riskPct, tt.atr, tt.px)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("atrPositionSize = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExecuteDecision_CloseAll 测试 close_all 平掉全部持仓：每个持仓一条平仓动作与成交事件，权益包含两笔已实现盈亏
+func TestExecuteDecision_CloseAll(t *testing.T) {
+	r := &Runner{
+		cfg:     BacktestConfig{Leverage: LeverageConfig{BTCETHLeverage: 5, AltcoinLeverage: 5}},
+		feed:    &DataFeed{primaryTF: "5m", symbolSeries: map[string]*symbolSeries{}},
+		account: NewBacktestAccount(10000, 0, 0),
+		state:   &BacktestState{Equity: 10000, Positions: map[string]PositionSnapshot{}},
+	}
+	if _, _, _, err := r.account.Open("BTCUSDT", "long", 0.1, 5, 50000, 0, 0, 0, false); err != nil {
+		t.Fatalf("open BTC: %v", err)
+	}
+	if _, _, _, err := r.account.Open("ETHUSDT", "short", 1, 5, 3000, 0, 0, 0, false); err != nil {
+		t.Fatalf("open ETH: %v", err)
+	}
+
+	// BTC 多头 +100，ETH 空头 +100
+	prices := map[string]float64{"BTCUSDT": 51000, "ETHUSDT": 2900}
+	actions, trades, _, err := r.executeDecisionActions(decision.Decision{Action: "close_all"}, prices, 1, 1)
+	if err != nil {
+		t.Fatalf("close_all: %v", err)
+	}
+	if len(trades) != 2 {
+		t.Fatalf("expected 2 trade events, got %d: %+v", len(trades), trades)
+	}
+	wantActions := map[string]string{"BTCUSDT": "close_long", "ETHUSDT": "close_short"}
+	if len(actions) != 2 {
+		t.Fatalf("expected one close action per position, got %+v", actions)
+	}
+	for _, action := range actions {
+		if action.Action != wantActions[action.Symbol] || !action.Success || action.Quantity <= 0 {
+			t.Errorf("unexpected action: %+v", action)
+		}
+	}
+	for _, trade := range trades {
+		if trade.Action != wantActions[trade.Symbol] || math.Abs(trade.RealizedPnL-100) > 1e-9 {
+			t.Errorf("unexpected trade: %+v", trade)
+		}
+	}
+	if len(r.account.Positions()) != 0 {
+		t.Errorf("all positions should be closed")
+	}
+	equity, unrealized, _ := r.account.TotalEquity(prices)
+	if math.Abs(equity-10200) > 1e-9 || unrealized != 0 {
+		t.Errorf("equity = %.4f (unrealized %.4f), want 10200", equity, unrealized)
+	}
+
+	// close_all 排在单独平仓与开仓之前
+	sorted := sortDecisionsByPriority([]decision.Decision{
+		{Symbol: "SOLUSDT", Action: "open_long"},
+		{Symbol: "BTCUSDT", Action: "close_long"},
+		{Action: "close_all"},
+	})
+	if sorted[0].Action != "close_all" || sorted[1].Action != "close_long" {
+		t.Errorf("unexpected order: %+v", sorted)
+	}
+}
+
+// TestExecuteDecision_FlipPosition 测试持有多头时 open_short 先平多再开空：一个决策动作、两条交易事件
+func TestExecuteDecision_FlipPosition(t *testing.T) {
+	r := &Runner{
+		cfg:     BacktestConfig{Leverage: LeverageConfig{BTCETHLeverage: 5, AltcoinLeverage: 5}},
+		feed:    &DataFeed{primaryTF: "5m", symbolSeries: map[string]*symbolSeries{}},
+		account: NewBacktestAccount(10000, 0, 0),
+		state:   &BacktestState{Equity: 10000, Positions: map[string]PositionSnapshot{}},
+	}
+	if _, _, _, err := r.account.Open("BTCUSDT", "long", 0.1, 5, 50000, 0, 0, 0, false); err != nil {
+		t.Fatalf("open long: %v", err)
+	}
+
+	prices := map[string]float64{"BTCUSDT": 52000}
+	actions, trades, _, err := r.executeDecisionActions(decision.Decision{Symbol: "BTCUSDT", Action: "open_short", PositionSizeUSD: 2600}, prices, 1, 1)
+	if err != nil {
+		t.Fatalf("flip: %v", err)
+	}
+	if len(actions) != 1 || actions[0].Action != "open_short" {
+		t.Errorf("actions = %+v, want a single open_short action", actions)
+	}
+	if len(trades) != 2 {
+		t.Fatalf("expected close + open trade events, got %d: %+v", len(trades), trades)
+	}
+	if trades[0].Action != "close_long" || math.Abs(trades[0].RealizedPnL-200) > 1e-9 {
+		t.Errorf("close event = %+v, want close_long with realized 200", trades[0])
+	}
+	if trades[1].Action != "open_short" || math.Abs(trades[1].Quantity-0.05) > 1e-12 {
+		t.Errorf("open event = %+v, want open_short 0.05", trades[1])
+	}
+
+	positions := r.account.Positions()
+	if len(positions) != 1 || positions[0].Side != "short" || math.Abs(positions[0].Quantity-0.05) > 1e-12 {
+		t.Fatalf("net position = %+v, want a single 0.05 short", positions)
+	}
+	if math.Abs(r.account.RealizedPnL()-200) > 1e-9 {
+		t.Errorf("realized PnL = %.4f, want 200", r.account.RealizedPnL())
+	}
+}
+
+// TestExecuteDecision_FlipRejectedBeforeClose 测试反手的开仓腿被持仓数上限拒绝时不平掉原持仓
+func TestExecuteDecision_FlipRejectedBeforeClose(t *testing.T) {
+	r := &Runner{
+		cfg: BacktestConfig{
+			Leverage:         LeverageConfig{BTCETHLeverage: 5, AltcoinLeverage: 5},
+			MaxOpenPositions: 1,
+		},
+		feed:    &DataFeed{primaryTF: "5m", symbolSeries: map[string]*symbolSeries{}},
+		account: NewBacktestAccount(10000, 0, 0),
+		state:   &BacktestState{Equity: 10000, Positions: map[string]PositionSnapshot{}},
+	}
+	if _, _, _, err := r.account.Open("BTCUSDT", "long", 0.1, 5, 50000, 0, 0, 0, false); err != nil {
+		t.Fatalf("open BTC: %v", err)
+	}
+	prices := map[string]float64{"BTCUSDT": 52000, "ETHUSDT": 3000}
+	flip := decision.Decision{Symbol: "BTCUSDT", Action: "open_short", PositionSizeUSD: 2600}
+
+	// 唯一的持仓就是被反手的那一个，平掉后释放名额
+	if _, _, _, err := r.executeDecisionActions(flip, prices, 1, 1); err != nil {
+		t.Fatalf("flip within limit: %v", err)
+	}
+
+	// 另有 ETH 持仓占满名额：开仓腿被拒绝，BTC 空头保持不动
+	if _, _, _, err := r.account.Open("ETHUSDT", "long", 1, 5, 3000, 0, 0, 0, false); err != nil {
+		t.Fatalf("open ETH: %v", err)
+	}
+	flip.Action = "open_long"
+	actions, trades, _, err := r.executeDecisionActions(flip, prices, 1, 1)
+	if !errors.Is(err, errPositionLimitReached) {
+		t.Fatalf("err = %v, want position limit reached", err)
+	}
+	if len(trades) != 0 || len(actions) != 1 || actions[0].Action != "open_long" {
+		t.Fatalf("rejected flip produced actions=%+v trades=%+v", actions, trades)
+	}
+	positions := r.account.Positions()
+	if len(positions) != 2 {
+		t.Fatalf("positions = %+v, want BTC short and ETH long untouched", positions)
+	}
+	for _, pos := range positions {
+		if pos.Symbol == "BTCUSDT" && pos.Side != "short" {
+			t.Errorf("BTC position = %+v, want the short kept", pos)
+		}
+	}
+}
+
+// TestExecuteDecision_FlipNearFullPosition 测试满仓反手：开仓腿按平仓释放保证金后的可用资金校验和定量
+func TestExecuteDecision_FlipNearFullPosition(t *testing.T) {
+	r := &Runner{
+		cfg:     BacktestConfig{Leverage: LeverageConfig{BTCETHLeverage: 5, AltcoinLeverage: 5}},
+		feed:    &DataFeed{primaryTF: "5m", symbolSeries: map[string]*symbolSeries{}},
+		account: NewBacktestAccount(10000, 0, 0),
+		state:   &BacktestState{Equity: 10000, Positions: map[string]PositionSnapshot{}},
+	}
+	// 多头占用 9000 保证金，平仓前只剩 1000 可用
+	if _, _, _, err := r.account.Open("BTCUSDT", "long", 0.9, 5, 50000, 0, 0, 0, false); err != nil {
+		t.Fatalf("open long: %v", err)
+	}
+	if before := r.account.MaxOpenQuantity("BTCUSDT", 50000, 5); before >= 0.8 {
+		t.Fatalf("pre-close max qty = %.4f, test needs it below the flip size", before)
+	}
+	// 平仓后可用 10000：10000 * 0.95 * 5 / 50000 = 0.95
+	if after := r.account.MaxOpenQuantityAfterClose("BTCUSDT", "long", 50000, 50000, 5); math.Abs(after-0.95) > 1e-9 {
+		t.Fatalf("post-close max qty = %.6f, want 0.95", after)
+	}
+
+	flip := decision.Decision{Symbol: "BTCUSDT", Action: "open_short", PositionSizeUSD: 40000}
+	actions, trades, _, err := r.executeDecisionActions(flip, map[string]float64{"BTCUSDT": 50000}, 1, 1)
+	if err != nil {
+		t.Fatalf("near-full flip rejected: %v", err)
+	}
+	if len(actions) != 1 || len(trades) != 2 {
+		t.Fatalf("actions=%+v trades=%+v, want one action and two trade events", actions, trades)
+	}
+	positions := r.account.Positions()
+	if len(positions) != 1 || positions[0].Side != "short" || math.Abs(positions[0].Quantity-0.8) > 1e-9 {
+		t.Fatalf("net position = %+v, want a 0.8 short", positions)
+	}
+}
+
+// TestExecuteDecision_MaxOpenPositions 测试持仓数达到上限后第三笔开仓被拒绝，加仓与平仓不受影响
+func TestExecuteDecision_MaxOpenPositions(t *testing.T) {
+	r := &Runner{
+		cfg: BacktestConfig{
+			Leverage:         LeverageConfig{BTCETHLeverage: 5, AltcoinLeverage: 5},
+			MaxOpenPositions: 2,
+		},
+		feed:    &DataFeed{primaryTF: "5m", symbolSeries: map[string]*symbolSeries{}},
+		account: NewBacktestAccount(10000, 0, 0),
+		state:   &BacktestState{Equity: 10000, Positions: map[string]PositionSnapshot{}},
+	}
+	prices := map[string]float64{"BTCUSDT": 50000, "ETHUSDT": 3000, "SOLUSDT": 100}
+	open := func(symbol, action string) error {
+		_, _, _, err := r.executeDecision(decision.Decision{Symbol: symbol, Action: action, PositionSizeUSD: 500}, prices, 1, 1)
+		return err
+	}
+
+	if err := open("BTCUSDT", "open_long"); err != nil {
+		t.Fatalf("first open: %v", err)
+	}
+	if err := open("ETHUSDT", "open_short"); err != nil {
+		t.Fatalf("second open: %v", err)
+	}
+	err := open("SOLUSDT", "open_long")
+	if !errors.Is(err, errPositionLimitReached) {
+		t.Fatalf("third open err = %v, want position limit reached", err)
+	}
+	if len(r.account.Positions()) != 2 {
+		t.Fatalf("positions = %d, want 2", len(r.account.Positions()))
+	}
+
+	// 加仓已有持仓不增加持仓数
+	if err := open("BTCUSDT", "open_long"); err != nil {
+		t.Errorf("adding to existing position should be allowed: %v", err)
+	}
+
+	// 平仓后释放名额
+	if _, _, _, err := r.executeDecision(decision.Decision{Symbol: "ETHUSDT", Action: "close_short"}, prices, 1, 1); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := open("SOLUSDT", "open_long"); err != nil {
+		t.Errorf("open after close: %v", err)
+	}
+}
+
+// TestExecuteDecision_QuantityPrecision 测试开仓数量在下单前按 QuantityPrecision 向下取整，未配置的标的不取整
+func TestExecuteDecision_QuantityPrecision(t *testing.T) {
+	r := &Runner{
+		cfg: BacktestConfig{
+			Leverage:          LeverageConfig{BTCETHLeverage: 5, AltcoinLeverage: 5},
+			QuantityPrecision: map[string]int{"BTCUSDT": 3},
+		},
+		feed:    &DataFeed{primaryTF: "5m", symbolSeries: map[string]*symbolSeries{}},
+		account: NewBacktestAccount(10000, 0, 0),
+		state:   &BacktestState{Equity: 10000, Positions: map[string]PositionSnapshot{}},
+	}
+	prices := map[string]float64{"BTCUSDT": 50000, "ETHUSDT": 3000}
+
+	// 617 / 50000 = 0.01234 → 0.012
+	if _, _, _, err := r.executeDecision(decision.Decision{Symbol: "BTCUSDT", Action: "open_long", PositionSizeUSD: 617}, prices, 1, 1); err != nil {
+		t.Fatalf("open BTC: %v", err)
+	}
+	if _, _, _, err := r.executeDecision(decision.Decision{Symbol: "ETHUSDT", Action: "open_long", PositionSizeUSD: 617}, prices, 1, 1); err != nil {
+		t.Fatalf("open ETH: %v", err)
+	}
+
+	quantities := map[string]float64{}
+	for _, pos := range r.account.Positions() {
+		quantities[pos.Symbol] = pos.Quantity
+	}
+	if got := quantities["BTCUSDT"]; math.Abs(got-0.012) > 1e-12 {
+		t.Errorf("BTC quantity = %v, want 0.012 (rounded down to 3 decimals)", got)
+	}
+	if got, want := quantities["ETHUSDT"], 617.0/3000; math.Abs(got-want) > 1e-12 {
+		t.Errorf("ETH quantity = %v, want unrounded %v", got, want)
+	}
+}
+
+// TestResolveLeverage_SymbolOverride 测试按标的覆盖的杠杆优先于 AI 请求和 BTC/ETH、山寨币分类默认值
+func TestResolveLeverage_SymbolOverride(t *testing.T) {
+	cfg := BacktestConfig{
+		Leverage:       LeverageConfig{BTCETHLeverage: 10, AltcoinLeverage: 5},
+		SymbolLeverage: map[string]int{"DOGEUSDT": 2, "BTCUSDT": 20},
+	}
+	tests := []struct {
+		name      string
+		symbol    string
+		requested int
+		want      int
+	}{
+		{"altcoin override wins over category default", "DOGEUSDT", 0, 2},
+		{"override caps AI requested leverage", "DOGEUSDT", 8, 2},
+		{"major override", "BTCUSDT", 0, 20},
+		{"major without override uses BTC/ETH default", "ETHUSDT", 0, 10},
+		{"altcoin without override uses altcoin default", "SOLUSDT", 0, 5},
+		{"AI request used when no override", "SOLUSDT", 3, 3},
+	}
+
+	r := &Runner{cfg: cfg}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.resolveLeverage(tt.requested, tt.symbol); got != tt.want {
+				t.Errorf("resolveLeverage(%d, %s) = %d, want %d", tt.requested, tt.symbol, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestResolveLeverage_DrawdownDeleverage 测试回撤超过阈值后开仓杠杆减半，净值恢复后还原
+func TestResolveLeverage_DrawdownDeleverage(t *testing.T) {
+	const barMs = int64(5 * 60 * 1000)
+	klines := []market.Kline{
+		{OpenTime: 0, Open: 100, High: 100, Low: 100, Close: 100, CloseTime: barMs},
+		{OpenTime: barMs, Open: 100, High: 100, Low: 100, Close: 100, CloseTime: 2 * barMs},
+	}
+	r := &Runner{
+		cfg: BacktestConfig{
+			FillPolicy:         FillPolicyMidPrice,
+			Leverage:           LeverageConfig{BTCETHLeverage: 10, AltcoinLeverage: 10},
+			DrawdownDeleverage: DrawdownDeleverageConfig{ThresholdPct: 10, Factor: 0.5},
+		},
+		feed: &DataFeed{
+			primaryTF: "5m",
+			symbolSeries: map[string]*symbolSeries{
+				"BTCUSDT": {byTF: map[string]*timeframeSeries{"5m": {klines: klines, closeTimes: []int64{barMs, 2 * barMs}}}},
+			},
+		},
+		account: NewBacktestAccount(1000, 0, 0),
+		state:   &BacktestState{Equity: 1000, MaxEquity: 1000, Positions: map[string]PositionSnapshot{}},
+	}
+
+	openAndClose := func(wantLeverage int) {
+		t.Helper()
+		open := decision.Decision{Symbol: "BTCUSDT", Action: "open_long", PositionSizeUSD: 100}
+		action, _, _, err := r.executeDecision(open, map[string]float64{"BTCUSDT": 100}, barMs, 1)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		if action.Leverage != wantLeverage {
+			t.Errorf("open leverage = %d, want %d", action.Leverage, wantLeverage)
+		}
+		closeDec := decision.Decision{Symbol: "BTCUSDT", Action: "close_long"}
+		if _, _, _, err := r.executeDecision(closeDec, map[string]float64{"BTCUSDT": 100}, barMs, 1); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+	}
+
+	openAndClose(10)
+
+	// 净值回撤 15%（超过 10% 阈值）→ 杠杆减半
+	r.state.Equity = 850
+	openAndClose(5)
+	if got := r.resolveLeverage(8, "SOLUSDT"); got != 4 {
+		t.Errorf("requested leverage under drawdown = %d, want 4", got)
+	}
+
+	// 净值回升至峰值附近 → 恢复原杠杆
+	r.state.Equity = 950
+	openAndClose(10)
+}
+
+// TestCheckMaxHold 测试持仓超过 MaxHoldBars 根决策K线后在没有 AI 平仓指令的情况下被强制平仓
+func TestCheckMaxHold(t *testing.T) {
+	const barMs = int64(5 * 60 * 1000)
+	klines := make([]market.Kline, 10)
+	closeTimes := make([]int64, len(klines))
+	for i := range klines {
+		klines[i] = market.Kline{OpenTime: int64(i) * barMs, Open: 100, High: 100, Low: 100, Close: 100, CloseTime: int64(i+1) * barMs}
+		closeTimes[i] = klines[i].CloseTime
+	}
+	r := &Runner{
+		cfg: BacktestConfig{FillPolicy: FillPolicyMidPrice, MaxHoldBars: 3},
+		feed: &DataFeed{
+			primaryTF:     "5m",
+			decisionTimes: closeTimes,
+			symbolSeries: map[string]*symbolSeries{
+				"BTCUSDT": {byTF: map[string]*timeframeSeries{"5m": {klines: klines, closeTimes: closeTimes}}},
+			},
+		},
+		account: NewBacktestAccount(1000, 0, 0),
+	}
+
+	const openBar = 2
+	if _, _, _, err := r.account.Open("BTCUSDT", "long", 1, 5, 100, 0, 0, closeTimes[openBar], false); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	prices := map[string]float64{"BTCUSDT": 100}
+
+	// 持仓 1..3 根K线均未超过上限
+	for bar := openBar + 1; bar <= openBar+r.cfg.MaxHoldBars; bar++ {
+		if events := r.checkMaxHold(prices, closeTimes[bar], bar, bar); len(events) != 0 {
+			t.Fatalf("bar %d (age %d): unexpected close %+v", bar, bar-openBar, events)
+		}
+	}
+
+	// 第 4 根K线超过上限，按当根价格平仓
+	closeBar := openBar + r.cfg.MaxHoldBars + 1
+	events := r.checkMaxHold(prices, closeTimes[closeBar], closeBar, closeBar)
+	if len(events) != 1 {
+		t.Fatalf("expected 1 max-hold close, got %d", len(events))
+	}
+	evt := events[0]
+	if evt.Action != "auto_close_long_max_hold" || evt.Quantity != 1 || evt.Price != 100 || evt.Timestamp != closeTimes[closeBar] {
+		t.Errorf("unexpected event: %+v", evt)
+	}
+	if !strings.Contains(evt.Note, "max hold exceeded") {
+		t.Errorf("note = %q, want max hold exceeded", evt.Note)
+	}
+	if len(r.account.Positions()) != 0 {
+		t.Errorf("position should be closed")
+	}
+
+	// 未启用时不检查
+	r.cfg.MaxHoldBars = 0
+	if _, _, _, err := r.account.Open("BTCUSDT", "short", 1, 5, 100, 0, 0, closeTimes[0], false); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if events := r.checkMaxHold(prices, closeTimes[9], 9, 9); len(events) != 0 {
+		t.Errorf("MaxHoldBars=0 should not close positions, got %+v", events)
+	}
+}
+
+// TestCheckMaxHold_SlippageSign 测试超时平仓的滑点与 executeDecision 同号：多空平仓的不利成交均记为正滑点
+func TestCheckMaxHold_SlippageSign(t *testing.T) {
+	const barMs = int64(5 * 60 * 1000)
+	klines := make([]market.Kline, 5)
+	closeTimes := make([]int64, len(klines))
+	for i := range klines {
+		klines[i] = market.Kline{OpenTime: int64(i) * barMs, Open: 100, High: 100, Low: 100, Close: 100, CloseTime: int64(i+1) * barMs}
+		closeTimes[i] = klines[i].CloseTime
+	}
+
+	for _, side := range []string{"long", "short"} {
+		t.Run(side, func(t *testing.T) {
+			r := &Runner{
+				cfg: BacktestConfig{FillPolicy: FillPolicyMidPrice, MaxHoldBars: 1},
+				feed: &DataFeed{
+					primaryTF:     "5m",
+					decisionTimes: closeTimes,
+					symbolSeries: map[string]*symbolSeries{
+						"BTCUSDT": {byTF: map[string]*timeframeSeries{"5m": {klines: klines, closeTimes: closeTimes}}},
+					},
+				},
+				account: NewBacktestAccount(1000, 0, 10), // 10 bps 滑点
+			}
+			if _, _, _, err := r.account.Open("BTCUSDT", side, 1, 5, 100, 0, 0, closeTimes[0], false); err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			events := r.checkMaxHold(map[string]float64{"BTCUSDT": 100}, closeTimes[3], 3, 3)
+			if len(events) != 1 {
+				t.Fatalf("expected 1 max-hold close, got %d", len(events))
+			}
+			if got := events[0].Slippage; math.Abs(got-0.1) > 1e-9 {
+				t.Errorf("slippage = %.6f, want +0.1 (adverse fill at %.4f)", got, events[0].Price)
+			}
+		})
+	}
+}
+
+// TestLimitOrderEntry 测试限价开仓：后续K线最低价触及限价时按 maker 成交，超时未触及则撤单
+func TestLimitOrderEntry(t *testing.T) {
+	const barMs = int64(5 * 60 * 1000)
+	klines := []market.Kline{{OpenTime: 0, Open: 100, High: 100, Low: 100, Close: 100, CloseTime: barMs}}
+
+	tests := []struct {
+		name     string
+		lows     []float64 // 挂单后依次到来的K线最低价
+		wantFill bool
+	}{
+		{name: "fills when later low reaches limit", lows: []float64{99, 97.5}, wantFill: true},
+		{name: "expires unfilled after timeout", lows: []float64{99, 98.5, 98.1}, wantFill: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := NewBacktestAccount(10000, 5, 0)
+			account.SetMakerFeeBps(2)
+			r := &Runner{
+				cfg: BacktestConfig{
+					FillPolicy:           FillPolicyMidPrice,
+					LimitOrderExpiryBars: 3,
+					Leverage:             LeverageConfig{BTCETHLeverage: 5, AltcoinLeverage: 5},
+				},
+				feed: &DataFeed{
+					primaryTF: "5m",
+					symbolSeries: map[string]*symbolSeries{
+						"BTCUSDT": {byTF: map[string]*timeframeSeries{"5m": {klines: klines, closeTimes: []int64{barMs}}}},
+					},
+				},
+				account: account,
+				state:   &BacktestState{Equity: 10000, Positions: map[string]PositionSnapshot{}},
+			}
+
+			dec := decision.Decision{Symbol: "BTCUSDT", Action: "open_long", Leverage: 5, PositionSizeUSD: 980, LimitPrice: 98}
+			action, trades, _, err := r.executeDecision(dec, map[string]float64{"BTCUSDT": 100}, barMs, 1)
+			if err != nil {
+				t.Fatalf("place limit order: %v", err)
+			}
+			if action.Action != "limit_open_long" || len(trades) != 0 || len(account.Positions()) != 0 {
+				t.Fatalf("limit order must rest without filling: action=%s trades=%d", action.Action, len(trades))
+			}
+			if len(account.PendingOrders()) != 1 {
+				t.Fatalf("expected 1 pending order, got %d", len(account.PendingOrders()))
+			}
+
+			var fills []TradeEvent
+			for i, low := range tt.lows {
+				ts := int64(i+2) * barMs
+				events, _ := r.matchPendingOrders(map[string]float64{"BTCUSDT": 101}, map[string]float64{"BTCUSDT": low}, ts, 1)
+				fills = append(fills, events...)
+			}
+
+			if len(account.PendingOrders()) != 0 {
+				t.Errorf("order should no longer be pending, got %d", len(account.PendingOrders()))
+			}
+			if !tt.wantFill {
+				if len(fills) != 0 || len(account.Positions()) != 0 {
+					t.Errorf("expired order must not fill: fills=%d positions=%d", len(fills), len(account.Positions()))
+				}
+				return
+			}
+			if len(fills) != 1 {
+				t.Fatalf("expected 1 fill, got %d", len(fills))
+			}
+			fill := fills[0]
+			if fill.Price != 98 || math.Abs(fill.Quantity-10) > 1e-9 {
+				t.Errorf("fill price/qty = %.4f/%.4f, want 98/10", fill.Price, fill.Quantity)
+			}
+			if wantFee := 980 * 2 / 10000.0; math.Abs(fill.Fee-wantFee) > 1e-9 {
+				t.Errorf("fill fee = %.6f, want maker fee %.6f", fill.Fee, wantFee)
+			}
+			if len(account.Positions()) != 1 || account.Positions()[0].EntryPrice != 98 {
+				t.Errorf("expected long position at limit price")
+			}
+		})
+	}
+}
+
+// TestCacheHealthCheck_DetectsDivergence 测试后台缓存一致性检查在缓存漂移后将状态标记为不健康
+func TestCacheHealthCheck_DetectsDivergence(t *testing.T) {
+	dLog := logger.NewDecisionLogger(t.TempDir())
+	openTime := time.Now().Add(-2 * time.Hour)
+	record := &logger.DecisionRecord{Success: true, Exchange: "binance"}
+	record.Decisions = []logger.DecisionAction{
+		{Action: "open_long", Symbol: "BTCUSDT", Quantity: 1, Leverage: 5, Price: 100, Timestamp: openTime, Success: true},
+		{Action: "close_long", Symbol: "BTCUSDT", Quantity: 1, Price: 105, Timestamp: openTime.Add(time.Hour), Success: true},
+	}
+	if err := dLog.LogDecision(record); err != nil {
+		t.Fatalf("LogDecision: %v", err)
+	}
+
+	r := &Runner{
+		cfg:            BacktestConfig{RunID: "cache-health", CacheCheckIntervalSeconds: 60},
+		decisionLogger: dLog,
+		state:          &BacktestState{Positions: map[string]PositionSnapshot{}},
+	}
+
+	if r.StatusPayload().CacheHealthy != nil {
+		t.Fatal("cache health should be unset before the first check")
+	}
+
+	r.maybeCheckCacheHealth()
+	r.cacheCheckWG.Wait()
+	status := r.StatusPayload()
+	if status.CacheHealthy == nil || !*status.CacheHealthy || status.CacheCheckedAt == "" {
+		t.Fatalf("expected healthy cache after first check, got %+v", status)
+	}
+
+	// 间隔未到时不重复校验
+	r.maybeCheckCacheHealth()
+	r.cacheCheckWG.Wait()
+
+	// 注入漂移：缓存中多出一笔决策文件里不存在的交易
+	dLog.AddTradeToCache(logger.TradeOutcome{
+		Symbol:    "ETHUSDT",
+		Side:      "short",
+		PnL:       42,
+		OpenTime:  openTime,
+		CloseTime: openTime.Add(90 * time.Minute),
+	})
+	if healthy := r.StatusPayload().CacheHealthy; healthy == nil || !*healthy {
+		t.Fatal("status must not change until the next check runs")
+	}
+
+	r.lastCacheCheck = time.Time{} // 模拟到达下一次检查时间
+	r.maybeCheckCacheHealth()
+	r.cacheCheckWG.Wait()
+
+	status = r.StatusPayload()
+	if status.CacheHealthy == nil || *status.CacheHealthy {
+		t.Fatalf("expected unhealthy cache after divergence, got %+v", status)
+	}
+	if report := r.CacheHealth(); len(report.UnexpectedInCache) != 1 || !strings.HasPrefix(report.UnexpectedInCache[0], "ETHUSDT_short_") {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+// TestStepOnce_CycleResult 测试单步执行后返回的周期结果
+func TestStepOnce_CycleResult(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	const barMs = int64(5 * 60 * 1000)
+	klines := make([]market.Kline, 40)
+	closeTimes := make([]int64, len(klines))
+	for i := range klines {
+		klines[i] = market.Kline{
+			OpenTime:  int64(i) * barMs,
+			Open:      100,
+			High:      100,
+			Low:       100,
+			Close:     100,
+			Volume:    10,
+			CloseTime: int64(i+1)*barMs - 1,
+		}
+		closeTimes[i] = klines[i].CloseTime
+	}
+	feed := &DataFeed{
+		symbols:       []string{"BTCUSDT"},
+		timeframes:    []string{"5m"},
+		primaryTF:     "5m",
+		decisionTimes: closeTimes[30:],
+		symbolSeries: map[string]*symbolSeries{
+			"BTCUSDT": {byTF: map[string]*timeframeSeries{"5m": {klines: klines, closeTimes: closeTimes}}},
+		},
+	}
+
+	cfg := BacktestConfig{
+		RunID:                "cycle-result",
+		Symbols:              []string{"BTCUSDT"},
+		DecisionTimeframe:    "5m",
+		DecisionCadenceNBars: 1,
+		InitialBalance:       1000,
+		FillPolicy:           FillPolicyMidPrice,
+		PromptVariant:        "baseline",
+		PromptTemplate:       "default",
+		ReplayOnly:           true,
+		Leverage:             LeverageConfig{BTCETHLeverage: 5, AltcoinLeverage: 5},
+	}
+	cache, err := LoadAICache("ai_cache.json")
+	if err != nil {
+		t.Fatalf("LoadAICache: %v", err)
+	}
+	account := NewBacktestAccount(cfg.InitialBalance, 0, 0)
+	r := &Runner{
+		cfg:            cfg,
+		feed:           feed,
+		account:        account,
+		decisionLogger: logger.NewDecisionLogger(decisionLogDir(cfg.RunID)),
+		state: &BacktestState{
+			Positions: map[string]PositionSnapshot{},
+			Cash:      cfg.InitialBalance,
+			Equity:    cfg.InitialBalance,
+			MaxEquity: cfg.InitialBalance,
+			MinEquity: cfg.InitialBalance,
+		},
+		aiCache: cache,
+		cycleCh: make(chan CycleResult, 1),
+	}
+
+	// 预置缓存决策：一个可执行的开仓 + 一个缺少行情的开仓
+	ts := feed.DecisionTimestamp(0)
+	marketData, multiTF, err := feed.BuildMarketData(ts)
+	if err != nil {
+		t.Fatalf("BuildMarketData: %v", err)
+	}
+	ctx, _, err := r.buildDecisionContext(ts, marketData, multiTF, map[string]float64{"BTCUSDT": 100}, 1)
+	if err != nil {
+		t.Fatalf("buildDecisionContext: %v", err)
+	}
+	key, err := computeCacheKey(ctx, cfg.PromptVariant, ts)
+	if err != nil {
+		t.Fatalf("computeCacheKey: %v", err)
+	}
+	if err := cache.Put(key, cfg.PromptVariant, ts, &decision.FullDecision{Decisions: []decision.Decision{
+		{Symbol: "BTCUSDT", Action: "open_long", Leverage: 5, PositionSizeUSD: 200},
+		{Symbol: "ETHUSDT", Action: "open_short", Leverage: 5, PositionSizeUSD: 100},
+	}}); err != nil {
+		t.Fatalf("cache.Put: %v", err)
+	}
+
+	if r.LastCycleResult() != nil {
+		t.Fatal("LastCycleResult should be nil before any cycle")
+	}
+
+	result, err := r.stepOnce()
+	if err != nil {
+		t.Fatalf("stepOnce: %v", err)
+	}
+	r.publishCycleResult(result)
+
+	if !result.DecisionAttempted || result.Cycle != 1 || result.Timestamp != ts {
+		t.Errorf("unexpected cycle header: %+v", result)
+	}
+	if result.DecisionsAttempted != 2 || result.DecisionsExecuted != 1 {
+		t.Errorf("attempted/executed = %d/%d, want 2/1", result.DecisionsAttempted, result.DecisionsExecuted)
+	}
+	if len(result.Actions) != 2 || !result.Actions[0].Success || result.Actions[0].Action != "open_long" {
+		t.Errorf("actions = %+v, want successful open_long first", result.Actions)
+	}
+	if len(result.Trades) != 1 || result.Trades[0].Symbol != "BTCUSDT" || math.Abs(result.Trades[0].Quantity-2) > 1e-9 {
+		t.Errorf("trades = %+v, want one BTCUSDT fill of qty 2", result.Trades)
+	}
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0], "ETHUSDT") {
+		t.Errorf("errors = %v, want one ETHUSDT error", result.Errors)
+	}
+	if math.Abs(result.Equity-1000) > 1e-9 {
+		t.Errorf("equity = %.4f, want 1000 (no fees, flat price)", result.Equity)
+	}
+
+	last := r.LastCycleResult()
+	if last == nil || last.DecisionsExecuted != 1 {
+		t.Errorf("LastCycleResult = %+v", last)
+	}
+	select {
+	case got := <-r.CycleResults():
+		if got.Timestamp != ts {
+			t.Errorf("channel result ts = %d, want %d", got.Timestamp, ts)
+		}
+	default:
+		t.Error("expected cycle result on channel")
+	}
+}
+
+// TestStepOnce_FundingPayment 测试持仓跨过资金费结算时点时按名义价值扣除资金费
+func TestStepOnce_FundingPayment(t *testing.T) {
+	const barMs = int64(time.Hour / time.Millisecond)
+	klines := make([]market.Kline, 40)
+	closeTimes := make([]int64, len(klines))
+	for i := range klines {
+		klines[i] = market.Kline{
+			OpenTime:  int64(i) * barMs,
+			Open:      100,
+			High:      100,
+			Low:       100,
+			Close:     100,
+			Volume:    10,
+			CloseTime: int64(i+1)*barMs - 1,
+		}
+		closeTimes[i] = klines[i].CloseTime
+	}
+
+	tests := []struct {
+		name        string
+		side        string
+		barIndex    int // 决策时间轴从第 30 根K线开始，索引 2 跨过 32h 结算时点
+		wantEquity  float64
+		wantFunding int
+	}{
+		{"no boundary crossed", "long", 1, 1000, 0},
+		{"long pays funding", "long", 2, 1000 - 2*100*0.001, 1},
+		{"short receives funding", "short", 2, 1000 + 2*100*0.001, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+
+			feed := &DataFeed{
+				symbols:       []string{"BTCUSDT"},
+				timeframes:    []string{"1h"},
+				primaryTF:     "1h",
+				decisionTimes: closeTimes[30:],
+				symbolSeries: map[string]*symbolSeries{
+					"BTCUSDT": {byTF: map[string]*timeframeSeries{"1h": {klines: klines, closeTimes: closeTimes}}},
+				},
+			}
+			cfg := BacktestConfig{
+				RunID:                "funding",
+				Symbols:              []string{"BTCUSDT"},
+				DecisionTimeframe:    "1h",
+				DecisionCadenceNBars: 100, // 不触发 AI 决策
+				InitialBalance:       1000,
+				FillPolicy:           FillPolicyMidPrice,
+				FundingRateBps:       10,
+				FundingIntervalHours: 8,
+			}
+			account := NewBacktestAccount(cfg.InitialBalance, 0, 0)
+			if _, _, _, err := account.Open("BTCUSDT", tt.side, 2, 5, 100, 0, 0, closeTimes[30], false); err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			r := &Runner{
+				cfg:            cfg,
+				feed:           feed,
+				account:        account,
+				decisionLogger: logger.NewDecisionLogger(decisionLogDir(cfg.RunID)),
+				state: &BacktestState{
+					BarIndex:  tt.barIndex,
+					Positions: map[string]PositionSnapshot{},
+					Cash:      account.Cash(),
+					Equity:    cfg.InitialBalance,
+					MaxEquity: cfg.InitialBalance,
+					MinEquity: cfg.InitialBalance,
+				},
+				cycleCh: make(chan CycleResult, 1),
+			}
+
+			result, err := r.stepOnce()
+			if err != nil {
+				t.Fatalf("stepOnce: %v", err)
+			}
+			if math.Abs(result.Equity-tt.wantEquity) > 1e-9 {
+				t.Errorf("equity = %.6f, want %.6f", result.Equity, tt.wantEquity)
+			}
+			funding := 0
+			for _, evt := range result.Trades {
+				if evt.Action == "funding" {
+					funding++
+				}
+			}
+			if funding != tt.wantFunding {
+				t.Errorf("funding events = %d, want %d (trades %+v)", funding, tt.wantFunding, result.Trades)
+			}
+		})
+	}
+}
+
+// TestStepOnce_DailyLossBreaker 测试当日亏损达到上限后熔断：跳过 AI 决策、不再成交开仓，次日解除
+func TestStepOnce_DailyLossBreaker(t *testing.T) {
+	const barMs = int64(time.Hour / time.Millisecond)
+	klines := make([]market.Kline, 30)
+	closeTimes := make([]int64, len(klines))
+	for i := range klines {
+		price := 100.0
+		if i >= 20 {
+			price = 70 // 第 20 根K线起价格下跌，持仓浮亏 60（日初权益 1000 的 6%）
+		}
+		klines[i] = market.Kline{
+			OpenTime:  int64(i) * barMs,
+			Open:      price,
+			High:      price,
+			Low:       price,
+			Close:     price,
+			Volume:    10,
+			CloseTime: int64(i+1)*barMs - 1,
+		}
+		closeTimes[i] = klines[i].CloseTime
+	}
+
+	tests := []struct {
+		name          string
+		limitPct      float64
+		cadence       int
+		wantHalted    bool
+		wantLimitFill bool
+	}{
+		{"loss beyond limit halts trading", 5, 1, true, false},
+		{"loss within limit keeps trading", 10, 100, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+
+			feed := &DataFeed{
+				symbols:       []string{"BTCUSDT"},
+				timeframes:    []string{"1h"},
+				primaryTF:     "1h",
+				decisionTimes: closeTimes[20:],
+				symbolSeries: map[string]*symbolSeries{
+					"BTCUSDT": {byTF: map[string]*timeframeSeries{"1h": {klines: klines, closeTimes: closeTimes}}},
+				},
+			}
+			cfg := BacktestConfig{
+				RunID:                "daily_loss",
+				Symbols:              []string{"BTCUSDT"},
+				DecisionTimeframe:    "1h",
+				DecisionCadenceNBars: tt.cadence,
+				InitialBalance:       1000,
+				DailyLossLimitPct:    tt.limitPct,
+			}
+			account := NewBacktestAccount(cfg.InitialBalance, 0, 0)
+			if _, _, _, err := account.Open("BTCUSDT", "long", 2, 1, 100, 0, 0, closeTimes[10], false); err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if err := account.PlaceLimitOrder(PendingOrder{
+				Symbol: "BTCUSDT", Side: "long", Quantity: 1, Leverage: 1, LimitPrice: 80, PlacedTS: closeTimes[19], ExpiryBars: 3,
+			}); err != nil {
+				t.Fatalf("PlaceLimitOrder: %v", err)
+			}
+			r := &Runner{
+				cfg:            cfg,
+				feed:           feed,
+				account:        account,
+				decisionLogger: logger.NewDecisionLogger(decisionLogDir(cfg.RunID)),
+				state: &BacktestState{
+					BarIndex:  1, // 首根K线总会触发决策，从第二根开始由 cadence 决定
+					Positions: map[string]PositionSnapshot{},
+					Cash:      account.Cash(),
+					Equity:    cfg.InitialBalance,
+					MaxEquity: cfg.InitialBalance,
+					MinEquity: cfg.InitialBalance,
+				},
+				cycleCh: make(chan CycleResult, 1),
+			}
+
+			result, err := r.stepOnce()
+			if err != nil {
+				t.Fatalf("stepOnce: %v", err)
+			}
+			filled := false
+			for _, evt := range result.Trades {
+				if evt.Action == "open_long" || evt.Action == "open_short" {
+					filled = true
+				}
+			}
+			if filled != tt.wantLimitFill {
+				t.Errorf("limit order filled = %v, want %v", filled, tt.wantLimitFill)
+			}
+			if halted := r.snapshotState().DailyHalted; halted != tt.wantHalted {
+				t.Fatalf("DailyHalted = %v, want %v", halted, tt.wantHalted)
+			}
+			if !tt.wantHalted {
+				return
+			}
+
+			records, err := r.decisionLogger.GetLatestRecords(1)
+			if err != nil || len(records) != 1 {
+				t.Fatalf("GetLatestRecords: %d records, err=%v", len(records), err)
+			}
+			if log := strings.Join(records[0].ExecutionLog, "\n"); !strings.Contains(log, "日内亏损熔断") {
+				t.Errorf("execution log missing halt note: %q", log)
+			}
+
+			// 同一 UTC 日内保持熔断，跨入次日后解除
+			if halted, _ := r.updateDailyLossBreaker(map[string]float64{"BTCUSDT": 70}, closeTimes[23]); !halted {
+				t.Error("breaker should stay tripped within the same UTC day")
+			}
+			if halted, _ := r.updateDailyLossBreaker(map[string]float64{"BTCUSDT": 70}, closeTimes[24]); halted {
+				t.Error("breaker should reset on the next UTC day")
+			}
+		})
+	}
+}
+
+// TestCrossMarginLiquidation 测试全仓模式下两个持仓共同亏损跌破维持保证金时整体强平，而逐仓模式下均未达到各自爆仓价
+func TestCrossMarginLiquidation(t *testing.T) {
+	// 每个持仓名义价值 24500（50x，保证金 490），逐仓爆仓价 98；
+	// 价格跌至 98.3 时单仓亏损 416.5 < 490，但全仓权益 167 < 维持保证金 240.8
+	prices := map[string]float64{"BTCUSDT": 98.3, "ETHUSDT": 98.3}
+
+	tests := []struct {
+		name    string
+		cross   bool
+		ohlc    bool // true: checkRiskEventsWithOHLC；false: checkLiquidation
+		wantLiq int
+	}{
+		{"isolated ohlc", false, true, 0},
+		{"cross ohlc", true, true, 2},
+		{"isolated close", false, false, 0},
+		{"cross close", true, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := NewBacktestAccount(1000, 0, 0)
+			account.SetCrossMargin(tt.cross)
+			snaps := make([]PositionSnapshot, 0, 2)
+			for _, symbol := range []string{"BTCUSDT", "ETHUSDT"} {
+				snaps = append(snaps, PositionSnapshot{
+					Symbol:           symbol,
+					Side:             "long",
+					Quantity:         245,
+					AvgPrice:         100,
+					Leverage:         50,
+					MarginUsed:       490,
+					LiquidationPrice: account.liquidationPrice(100, 50, "long"),
+				})
+			}
+			account.RestoreFromSnapshots(20, 0, snaps, nil)
+			r := &Runner{
+				account: account,
+				state:   &BacktestState{Positions: map[string]PositionSnapshot{}},
+			}
+
+			var liqEvents []TradeEvent
+			if tt.ohlc {
+				_, liqEvents = r.checkRiskEventsWithOHLC(prices, prices, prices, 1, 1)
+			} else {
+				var err error
+				liqEvents, _, err = r.checkLiquidation(1, prices, 1)
+				if err != nil {
+					t.Fatalf("checkLiquidation: %v", err)
+				}
+			}
+			if len(liqEvents) != tt.wantLiq {
+				t.Fatalf("liquidation events = %d, want %d", len(liqEvents), tt.wantLiq)
+			}
+			if liquidated := r.state.Liquidated; liquidated != (tt.wantLiq > 0) {
+				t.Errorf("state.Liquidated = %v, want %v", liquidated, tt.wantLiq > 0)
+			}
+			if tt.wantLiq > 0 && len(account.Positions()) != 0 {
+				t.Errorf("positions left after cross liquidation: %d", len(account.Positions()))
+			}
+		})
+	}
+}
+
+// TestLiquidationFeePenalty 测试强平罚金在正常平仓手续费之外额外计入 Fee 与已实现亏损
+func TestLiquidationFeePenalty(t *testing.T) {
+	prices := map[string]float64{"BTCUSDT": 89}
+
+	liquidate := func(liqFeeBps float64) (TradeEvent, float64) {
+		account := NewBacktestAccount(1000, 5, 0)
+		account.SetLiquidationFeeBps(liqFeeBps)
+		if _, _, _, err := account.Open("BTCUSDT", "long", 10, 10, 100, 0, 0, 0, false); err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		r := &Runner{
+			feed: &DataFeed{
+				primaryTF: "5m",
+				symbolSeries: map[string]*symbolSeries{
+					"BTCUSDT": {byTF: map[string]*timeframeSeries{"5m": {
+						klines:     []market.Kline{{Open: 100, High: 100, Low: 89, Close: 89, CloseTime: 1}},
+						closeTimes: []int64{1},
+					}}},
+				},
+			},
+			account: account,
+			state:   &BacktestState{Positions: map[string]PositionSnapshot{}},
+		}
+		_, liqEvents := r.checkRiskEventsWithOHLC(prices, prices, prices, 1, 1)
+		if len(liqEvents) != 1 {
+			t.Fatalf("liquidation events = %d, want 1", len(liqEvents))
+		}
+		return liqEvents[0], account.RealizedPnL()
+	}
+
+	base, baseRealized := liquidate(0)
+	if base.Quantity != 10 {
+		t.Fatalf("liquidated qty = %.4f, want 10", base.Quantity)
+	}
+	tests := []struct {
+		name      string
+		liqFeeBps float64
+	}{
+		{"no penalty", 0},
+		{"50bps penalty", 50},
+		{"100bps penalty", 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evt, realized := liquidate(tt.liqFeeBps)
+			penalty := evt.Price * evt.Quantity * tt.liqFeeBps / 10000
+			if math.Abs(evt.Fee-(base.Fee+penalty)) > 1e-9 {
+				t.Errorf("fee = %.6f, want %.6f", evt.Fee, base.Fee+penalty)
+			}
+			if math.Abs(evt.RealizedPnL-(base.RealizedPnL-penalty)) > 1e-9 {
+				t.Errorf("event realized = %.6f, want %.6f", evt.RealizedPnL, base.RealizedPnL-penalty)
+			}
+			if math.Abs(realized-(baseRealized-penalty)) > 1e-9 {
+				t.Errorf("account realized = %.6f, want %.6f", realized, baseRealized-penalty)
+			}
+		})
+	}
+}
+
+// TestStepOnce_TrailingStopLocksInProfit 测试跟踪止损随有利行情收紧，回撤时以盈利平仓
+func TestStepOnce_TrailingStopLocksInProfit(t *testing.T) {
+	const barMs = int64(time.Hour / time.Millisecond)
+
+	tests := []struct {
+		name     string
+		side     string
+		favor    [3]float64 // 有利行情K线的 high/low/close
+		pullback [3]float64 // 回撤K线的 high/low/close
+		wantStop float64    // 有利行情后的止损价
+	}{
+		{"long trails high", "long", [3]float64{120, 115, 118}, [3]float64{117, 113, 113.5}, 114},
+		{"short trails low", "short", [3]float64{85, 80, 82}, [3]float64{87, 86, 86.5}, 84},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+
+			klines := make([]market.Kline, 33)
+			closeTimes := make([]int64, len(klines))
+			for i := range klines {
+				high, low, closePrice := 100.0, 100.0, 100.0
+				switch i {
+				case 31:
+					high, low, closePrice = tt.favor[0], tt.favor[1], tt.favor[2]
+				case 32:
+					high, low, closePrice = tt.pullback[0], tt.pullback[1], tt.pullback[2]
+				}
+				klines[i] = market.Kline{
+					OpenTime:  int64(i) * barMs,
+					Open:      closePrice,
+					High:      high,
+					Low:       low,
+					Close:     closePrice,
+					Volume:    10,
+					CloseTime: int64(i+1)*barMs - 1,
+				}
+				closeTimes[i] = klines[i].CloseTime
+			}
+			feed := &DataFeed{
+				symbols:       []string{"BTCUSDT"},
+				timeframes:    []string{"1h"},
+				primaryTF:     "1h",
+				decisionTimes: closeTimes[30:],
+				symbolSeries: map[string]*symbolSeries{
+					"BTCUSDT": {byTF: map[string]*timeframeSeries{"1h": {klines: klines, closeTimes: closeTimes}}},
+				},
+			}
+			cfg := BacktestConfig{
+				RunID:                "trailing",
+				Symbols:              []string{"BTCUSDT"},
+				DecisionTimeframe:    "1h",
+				DecisionCadenceNBars: 100, // 不触发 AI 决策
+				InitialBalance:       1000,
+			}
+			account := NewBacktestAccount(cfg.InitialBalance, 0, 0)
+			if _, _, _, err := account.Open("BTCUSDT", tt.side, 2, 5, 100, 0, 0, closeTimes[30], false); err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			r := &Runner{
+				cfg:            cfg,
+				feed:           feed,
+				account:        account,
+				decisionLogger: logger.NewDecisionLogger(decisionLogDir(cfg.RunID)),
+				state: &BacktestState{
+					BarIndex:  1,
+					Positions: map[string]PositionSnapshot{},
+					Cash:      account.Cash(),
+					Equity:    cfg.InitialBalance,
+					MaxEquity: cfg.InitialBalance,
+					MinEquity: cfg.InitialBalance,
+				},
+				cycleCh: make(chan CycleResult, 1),
+			}
+
+			dec := decision.Decision{Symbol: "BTCUSDT", Action: "trailing_stop", TrailPct: 5}
+			if _, _, _, err := r.executeDecision(dec, map[string]float64{"BTCUSDT": 100}, closeTimes[30], 1); err != nil {
+				t.Fatalf("trailing_stop: %v", err)
+			}
+
+			// 有利行情：不触发止损，止损按最优价格收紧
+			result, err := r.stepOnce()
+			if err != nil {
+				t.Fatalf("stepOnce favor: %v", err)
+			}
+			if len(result.Trades) != 0 {
+				t.Fatalf("unexpected trades on favorable bar: %+v", result.Trades)
+			}
+			if stop := account.Positions()[0].StopLoss; math.Abs(stop-tt.wantStop) > 1e-9 {
+				t.Fatalf("stop after favorable move = %.4f, want %.4f", stop, tt.wantStop)
+			}
+
+			// 回撤：触发跟踪止损并锁定盈利
+			result, err = r.stepOnce()
+			if err != nil {
+				t.Fatalf("stepOnce pullback: %v", err)
+			}
+			if len(result.Trades) != 1 || result.Trades[0].Action != "auto_close_"+tt.side+"_stop_loss" {
+				t.Fatalf("pullback trades = %+v, want one stop loss close", result.Trades)
+			}
+			if pnl := result.Trades[0].RealizedPnL; pnl <= 0 {
+				t.Errorf("trailing stop realized pnl = %.4f, want profit", pnl)
+			}
+		})
+	}
+}
@@ -8,7 +8,7 @@ func TestStopLossTakeProfitManagement(t *testing.T) {
 	t.Run("should store stop loss and take profit on open", func(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
-		pos, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0)
+		pos, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to open position: %v", err)
 		}
@@ -24,7 +24,7 @@ func TestStopLossTakeProfitManagement(t *testing.T) {
 	t.Run("should update stop loss", func(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
-		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0)
+		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to open position: %v", err)
 		}
@@ -48,7 +48,7 @@ func TestStopLossTakeProfitManagement(t *testing.T) {
 	t.Run("should update take profit", func(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
-		_, _, _, err := acc.Open("ETHUSDT", "short", 1.0, 10, 3000, 3100, 2900, 0)
+		_, _, _, err := acc.Open("ETHUSDT", "short", 1.0, 10, 3000, 3100, 2900, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to open position: %v", err)
 		}
@@ -81,7 +81,7 @@ func TestStopLossTakeProfitManagement(t *testing.T) {
 	t.Run("should allow opening position without stop loss or take profit", func(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
-		pos, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 0, 0, 0)
+		pos, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 0, 0, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to open position: %v", err)
 		}
@@ -98,13 +98,13 @@ func TestStopLossTakeProfitManagement(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
 		// 第一次开仓
-		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0)
+		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to open position: %v", err)
 		}
 
 		// 加仓并更新止损止盈
-		pos, _, _, err := acc.Open("BTCUSDT", "long", 0.05, 10, 51000, 50000, 53000, 0)
+		pos, _, _, err := acc.Open("BTCUSDT", "long", 0.05, 10, 51000, 50000, 53000, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to add to position: %v", err)
 		}
@@ -123,7 +123,7 @@ func TestStopLossTakeProfitAutoTrigger(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
 		// 开多仓，止损 49000
-		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0)
+		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to open position: %v", err)
 		}
@@ -150,7 +150,7 @@ func TestStopLossTakeProfitAutoTrigger(t *testing.T) {
 		}
 
 		// 执行平仓
-		_, _, _, err = acc.Close(trigger.Position.Symbol, trigger.Position.Side, trigger.Position.Quantity, 48900)
+		_, _, _, err = acc.Close(trigger.Position.Symbol, trigger.Position.Side, trigger.Position.Quantity, 48900, false)
 		if err != nil {
 			t.Errorf("Failed to close position: %v", err)
 		}
@@ -166,7 +166,7 @@ func TestStopLossTakeProfitAutoTrigger(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
 		// 开多仓，止盈 52000
-		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0)
+		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to open position: %v", err)
 		}
@@ -187,7 +187,7 @@ func TestStopLossTakeProfitAutoTrigger(t *testing.T) {
 		}
 
 		// 执行平仓
-		_, _, _, err = acc.Close(trigger.Position.Symbol, trigger.Position.Side, trigger.Position.Quantity, 52100)
+		_, _, _, err = acc.Close(trigger.Position.Symbol, trigger.Position.Side, trigger.Position.Quantity, 52100, false)
 		if err != nil {
 			t.Errorf("Failed to close position: %v", err)
 		}
@@ -203,7 +203,7 @@ func TestStopLossTakeProfitAutoTrigger(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
 		// 开空仓，止损 3100
-		_, _, _, err := acc.Open("ETHUSDT", "short", 1.0, 10, 3000, 3100, 2900, 0)
+		_, _, _, err := acc.Open("ETHUSDT", "short", 1.0, 10, 3000, 3100, 2900, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to open position: %v", err)
 		}
@@ -224,7 +224,7 @@ func TestStopLossTakeProfitAutoTrigger(t *testing.T) {
 		}
 
 		// 执行平仓
-		_, _, _, err = acc.Close(trigger.Position.Symbol, trigger.Position.Side, trigger.Position.Quantity, 3150)
+		_, _, _, err = acc.Close(trigger.Position.Symbol, trigger.Position.Side, trigger.Position.Quantity, 3150, false)
 		if err != nil {
 			t.Errorf("Failed to close position: %v", err)
 		}
@@ -240,7 +240,7 @@ func TestStopLossTakeProfitAutoTrigger(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
 		// 开空仓，止盈 2900
-		_, _, _, err := acc.Open("ETHUSDT", "short", 1.0, 10, 3000, 3100, 2900, 0)
+		_, _, _, err := acc.Open("ETHUSDT", "short", 1.0, 10, 3000, 3100, 2900, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to open position: %v", err)
 		}
@@ -261,7 +261,7 @@ func TestStopLossTakeProfitAutoTrigger(t *testing.T) {
 		}
 
 		// 执行平仓
-		_, _, _, err = acc.Close(trigger.Position.Symbol, trigger.Position.Side, trigger.Position.Quantity, 2850)
+		_, _, _, err = acc.Close(trigger.Position.Symbol, trigger.Position.Side, trigger.Position.Quantity, 2850, false)
 		if err != nil {
 			t.Errorf("Failed to close position: %v", err)
 		}
@@ -277,7 +277,7 @@ func TestStopLossTakeProfitAutoTrigger(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
 		// 开多仓，止损 49000，止盈 52000
-		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0)
+		_, _, _, err := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0, false)
 		if err != nil {
 			t.Fatalf("Failed to open position: %v", err)
 		}
@@ -303,7 +303,7 @@ func TestStopLossTakeProfitAutoTrigger(t *testing.T) {
 		acc := NewBacktestAccount(10000, 5, 2)
 
 		// 开多仓
-		pos, _, _, _ := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0)
+		pos, _, _, _ := acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0, false)
 
 		// 手动设置一个不可能的状态（止损和止盈同时满足，用于测试优先级）
 		// 实际场景中不会发生，但用于测试代码逻辑
@@ -329,8 +329,8 @@ func TestStopLossTakeProfitAutoTrigger(t *testing.T) {
 		acc := NewBacktestAccount(100000, 5, 2)
 
 		// 开两个仓位
-		acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0)
-		acc.Open("ETHUSDT", "short", 1.0, 10, 3000, 3100, 2900, 0)
+		acc.Open("BTCUSDT", "long", 0.1, 10, 50000, 49000, 52000, 0, false)
+		acc.Open("ETHUSDT", "short", 1.0, 10, 3000, 3100, 2900, 0, false)
 
 		// BTC 触发止损，ETH 触发止盈
 		priceMap := map[string]float64{
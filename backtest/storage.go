@@ -53,6 +53,14 @@ func tradesLogPath(runID string) string {
 	return filepath.Join(runDir(runID), "trades.jsonl")
 }
 
+func equityBinPath(runID string) string {
+	return filepath.Join(runDir(runID), "equity.bin")
+}
+
+func tradesBinPath(runID string) string {
+	return filepath.Join(runDir(runID), "trades.bin")
+}
+
 func metricsPath(runID string) string {
 	return filepath.Join(runDir(runID), "metrics.json")
 }
@@ -195,18 +203,22 @@ func LoadRunMetadata(runID string) (*RunMetadata, error) {
 	return &meta, nil
 }
 
-func appendEquityPoint(runID string, point EquityPoint) error {
+func appendEquityPoint(runID string, point EquityPoint, format string) error {
 	if usingDB() {
 		return appendEquityPointDB(runID, point)
 	}
-	return appendJSONLine(equityLogPath(runID), point)
+	return appendStreamRecord(equityLogPath(runID), equityBinPath(runID), format, point, func(buf []byte) []byte {
+		return encodeEquityPoint(buf, point)
+	})
 }
 
-func appendTradeEvent(runID string, event TradeEvent) error {
+func appendTradeEvent(runID string, event TradeEvent, format string) error {
 	if usingDB() {
 		return appendTradeEventDB(runID, event)
 	}
-	return appendJSONLine(tradesLogPath(runID), event)
+	return appendStreamRecord(tradesLogPath(runID), tradesBinPath(runID), format, event, func(buf []byte) []byte {
+		return encodeTradeEvent(buf, event)
+	})
 }
 
 func saveMetrics(runID string, metrics *Metrics) error {
@@ -281,7 +293,7 @@ func LoadEquityPoints(runID string) ([]EquityPoint, error) {
 	if usingDB() {
 		return loadEquityPointsDB(runID)
 	}
-	points, err := loadJSONLines[EquityPoint](equityLogPath(runID))
+	points, err := loadStream(equityLogPath(runID), equityBinPath(runID), decodeEquityPoint)
 	if err != nil {
 		return nil, err
 	}
@@ -291,23 +303,42 @@ func LoadEquityPoints(runID string) ([]EquityPoint, error) {
 	return points, nil
 }
 
+// LoadTradeEvents 读取回测运行持久化的全部交易事件（自动识别 jsonl/binary 格式），
+// 按时间排序，同一时刻的事件保持写入顺序。
 func LoadTradeEvents(runID string) ([]TradeEvent, error) {
 	if usingDB() {
 		return loadTradeEventsDB(runID)
 	}
-	events, err := loadJSONLines[TradeEvent](tradesLogPath(runID))
+	events, err := loadStream(tradesLogPath(runID), tradesBinPath(runID), decodeTradeEvent)
 	if err != nil {
 		return nil, err
 	}
-	sort.Slice(events, func(i, j int) bool {
-		if events[i].Timestamp == events[j].Timestamp {
-			return events[i].Symbol < events[j].Symbol
-		}
+	// 稳定排序且只比较时间戳，与数据库后端的 ORDER BY ts, id 一致
+	sort.SliceStable(events, func(i, j int) bool {
 		return events[i].Timestamp < events[j].Timestamp
 	})
 	return events, nil
 }
 
+// LoadTradeEventsPage 按 LoadTradeEvents 的顺序分页读取交易事件；limit <= 0 时返回 offset 之后的全部事件。
+func LoadTradeEventsPage(runID string, offset, limit int) ([]TradeEvent, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	events, err := LoadTradeEvents(runID)
+	if err != nil {
+		return nil, err
+	}
+	if offset >= len(events) {
+		return []TradeEvent{}, nil
+	}
+	end := len(events)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return events[offset:end], nil
+}
+
 func LoadMetrics(runID string) (*Metrics, error) {
 	if usingDB() {
 		return loadMetricsDB(runID)
@@ -344,17 +375,8 @@ func LoadRunIDs() ([]string, error) {
 	return runIDs, nil
 }
 
-func loadJSONLines[T any](path string) ([]T, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return []T{}, nil
-		}
-		return nil, err
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
+func decodeJSONLines[T any](r io.Reader) ([]T, error) {
+	scanner := bufio.NewScanner(r)
 	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
 
 	var result []T
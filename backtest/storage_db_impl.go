@@ -231,7 +231,7 @@ func appendTradeEventDB(runID string, event TradeEvent) error {
 func loadTradeEventsDB(runID string) ([]TradeEvent, error) {
 	rows, err := persistenceDB.Query(`
 		SELECT ts, symbol, action, side, qty, price, fee, slippage, order_value, realized_pnl, leverage, cycle, position_after, liquidation, note
-		FROM backtest_trades WHERE run_id = ? ORDER BY ts ASC
+		FROM backtest_trades WHERE run_id = ? ORDER BY ts ASC, id ASC
 	`, runID)
 	if err != nil {
 		return nil, err
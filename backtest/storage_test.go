@@ -0,0 +1,61 @@
+package backtest
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestLoadTradeEventsPage 测试持久化的交易事件按写入顺序读回（同一时刻不按 symbol 重排）并支持分页
+func TestLoadTradeEventsPage(t *testing.T) {
+	events := []TradeEvent{
+		{Timestamp: 1000, Symbol: "BTCUSDT", Action: "open_long", Side: "long", Quantity: 0.5, Price: 100, Fee: 0.025, OrderValue: 50, Leverage: 5, Cycle: 1, PositionAfter: 0.5},
+		{Timestamp: 1000, Symbol: "BTCUSDT", Action: "close_long", Side: "long", Quantity: 0.5, Price: 101, Fee: 0.025, OrderValue: 50.5, RealizedPnL: 0.475, Leverage: 5, Cycle: 1},
+		// 同一时刻写入的其他标的排在后面，读回时不按 symbol 重排
+		{Timestamp: 1000, Symbol: "ADAUSDT", Action: "open_long", Side: "long", Quantity: 100, Price: 0.5, Fee: 0.025, OrderValue: 50, Leverage: 5, Cycle: 1, PositionAfter: 100},
+		{Timestamp: 2000, Symbol: "ETHUSDT", Action: "open_short", Side: "short", Quantity: 2, Price: 50, Fee: 0.05, Slippage: -0.1, OrderValue: 100, Leverage: 3, Cycle: 2, PositionAfter: 2},
+		{Timestamp: 3000, Symbol: "ETHUSDT", Action: "liquidated", Side: "short", Quantity: 2, Price: 66, Fee: 0.066, RealizedPnL: -32.066, Leverage: 3, Cycle: 3, LiquidationFlag: true, Note: "forced liquidation"},
+	}
+
+	for _, format := range []string{StreamFormatJSONL, StreamFormatBinary} {
+		t.Run(format, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			const runID = "trades_page"
+			if err := ensureRunDir(runID); err != nil {
+				t.Fatalf("ensureRunDir: %v", err)
+			}
+			for _, evt := range events {
+				if err := appendTradeEvent(runID, evt, format); err != nil {
+					t.Fatalf("appendTradeEvent: %v", err)
+				}
+			}
+
+			all, err := LoadTradeEvents(runID)
+			if err != nil {
+				t.Fatalf("LoadTradeEvents: %v", err)
+			}
+			if !reflect.DeepEqual(all, events) {
+				t.Fatalf("LoadTradeEvents mismatch:\n got %+v\nwant %+v", all, events)
+			}
+
+			pages := []struct {
+				offset, limit int
+				want          []TradeEvent
+			}{
+				{0, 2, events[:2]},
+				{2, 3, events[2:]},
+				{1, 0, events[1:]},
+				{-1, 1, events[:1]},
+				{5, 10, []TradeEvent{}},
+			}
+			for _, p := range pages {
+				got, err := LoadTradeEventsPage(runID, p.offset, p.limit)
+				if err != nil {
+					t.Fatalf("LoadTradeEventsPage(%d,%d): %v", p.offset, p.limit, err)
+				}
+				if !reflect.DeepEqual(got, p.want) {
+					t.Errorf("LoadTradeEventsPage(%d,%d) = %+v, want %+v", p.offset, p.limit, got, p.want)
+				}
+			}
+		})
+	}
+}
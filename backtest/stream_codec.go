@@ -0,0 +1,260 @@
+package backtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// StreamFormatJSONL 以换行分隔的 JSON 存储资金曲线/交易事件（默认）。
+	StreamFormatJSONL = "jsonl"
+	// StreamFormatBinary 以长度前缀的紧凑二进制存储，适合长周期回测。
+	StreamFormatBinary = "binary"
+)
+
+// binaryStreamMagic 二进制流文件头，读取时据此识别格式。
+var binaryStreamMagic = []byte("NFXBIN1\n")
+
+func validateStreamFormat(format string) error {
+	switch format {
+	case StreamFormatJSONL, StreamFormatBinary:
+		return nil
+	default:
+		return fmt.Errorf("unsupported stream_format '%s'", format)
+	}
+}
+
+// appendStreamRecord 按格式追加一条记录（binary 格式在新文件开头写入文件头）。
+func appendStreamRecord(jsonPath, binPath, format string, payload any, encode func([]byte) []byte) error {
+	if format != StreamFormatBinary {
+		return appendJSONLine(jsonPath, payload)
+	}
+	if err := os.MkdirAll(filepath.Dir(binPath), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(binPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	var buf []byte
+	if info.Size() == 0 {
+		buf = append(buf, binaryStreamMagic...)
+	}
+	record := encode(nil)
+	buf = binary.AppendUvarint(buf, uint64(len(record)))
+	buf = append(buf, record...)
+	if _, err := f.Write(buf); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// loadStream 读取资金曲线/交易事件流：优先二进制文件，其次 JSONL，均不存在时返回空列表。
+func loadStream[T any](jsonPath, binPath string, decode func([]byte) (T, error)) ([]T, error) {
+	for _, path := range []string{binPath, jsonPath} {
+		file, err := os.Open(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		result, err := readStream(file, decode)
+		file.Close()
+		return result, err
+	}
+	return []T{}, nil
+}
+
+// readStream 根据文件头自动识别二进制或 JSONL 格式并解码。
+func readStream[T any](r io.Reader, decode func([]byte) (T, error)) ([]T, error) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	head, err := reader.Peek(len(binaryStreamMagic))
+	if err != nil || !bytes.Equal(head, binaryStreamMagic) {
+		return decodeJSONLines[T](reader)
+	}
+	if _, err := reader.Discard(len(binaryStreamMagic)); err != nil {
+		return nil, err
+	}
+
+	var result []T
+	var record []byte
+	for {
+		size, err := binary.ReadUvarint(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if cap(record) < int(size) {
+			record = make([]byte, size)
+		}
+		record = record[:size]
+		if _, err := io.ReadFull(reader, record); err != nil {
+			return nil, fmt.Errorf("truncated binary record: %w", err)
+		}
+		item, err := decode(record)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	if result == nil {
+		result = []T{}
+	}
+	return result, nil
+}
+
+func encodeEquityPoint(buf []byte, p EquityPoint) []byte {
+	buf = binary.AppendVarint(buf, p.Timestamp)
+	buf = appendFloat64(buf, p.Equity)
+	buf = appendFloat64(buf, p.Available)
+	buf = appendFloat64(buf, p.PnL)
+	buf = appendFloat64(buf, p.PnLPct)
+	buf = appendFloat64(buf, p.DrawdownPct)
+	buf = binary.AppendVarint(buf, int64(p.Cycle))
+	return buf
+}
+
+func decodeEquityPoint(data []byte) (EquityPoint, error) {
+	d := binaryDecoder{data: data}
+	p := EquityPoint{
+		Timestamp:   d.varint(),
+		Equity:      d.float64(),
+		Available:   d.float64(),
+		PnL:         d.float64(),
+		PnLPct:      d.float64(),
+		DrawdownPct: d.float64(),
+		Cycle:       int(d.varint()),
+	}
+	return p, d.err
+}
+
+func encodeTradeEvent(buf []byte, e TradeEvent) []byte {
+	buf = binary.AppendVarint(buf, e.Timestamp)
+	buf = appendString(buf, e.Symbol)
+	buf = appendString(buf, e.Action)
+	buf = appendString(buf, e.Side)
+	buf = appendFloat64(buf, e.Quantity)
+	buf = appendFloat64(buf, e.Price)
+	buf = appendFloat64(buf, e.Fee)
+	buf = appendFloat64(buf, e.Slippage)
+	buf = appendFloat64(buf, e.OrderValue)
+	buf = appendFloat64(buf, e.RealizedPnL)
+	buf = binary.AppendVarint(buf, int64(e.Leverage))
+	buf = binary.AppendVarint(buf, int64(e.Cycle))
+	buf = appendFloat64(buf, e.PositionAfter)
+	if e.LiquidationFlag {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	buf = appendString(buf, e.Note)
+	return buf
+}
+
+func decodeTradeEvent(data []byte) (TradeEvent, error) {
+	d := binaryDecoder{data: data}
+	e := TradeEvent{
+		Timestamp:       d.varint(),
+		Symbol:          d.string(),
+		Action:          d.string(),
+		Side:            d.string(),
+		Quantity:        d.float64(),
+		Price:           d.float64(),
+		Fee:             d.float64(),
+		Slippage:        d.float64(),
+		OrderValue:      d.float64(),
+		RealizedPnL:     d.float64(),
+		Leverage:        int(d.varint()),
+		Cycle:           int(d.varint()),
+		PositionAfter:   d.float64(),
+		LiquidationFlag: d.byte() == 1,
+		Note:            d.string(),
+	}
+	return e, d.err
+}
+
+func appendFloat64(buf []byte, v float64) []byte {
+	return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// binaryDecoder 顺序读取二进制字段，遇到错误后后续读取均返回零值。
+type binaryDecoder struct {
+	data []byte
+	err  error
+}
+
+var errShortRecord = errors.New("binary record too short")
+
+func (d *binaryDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = errShortRecord
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *binaryDecoder) float64() float64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data) < 8 {
+		d.err = errShortRecord
+		return 0
+	}
+	v := math.Float64frombits(binary.LittleEndian.Uint64(d.data))
+	d.data = d.data[8:]
+	return v
+}
+
+func (d *binaryDecoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data) < 1 {
+		d.err = errShortRecord
+		return 0
+	}
+	v := d.data[0]
+	d.data = d.data[1:]
+	return v
+}
+
+func (d *binaryDecoder) string() string {
+	if d.err != nil {
+		return ""
+	}
+	n, size := binary.Uvarint(d.data)
+	if size <= 0 || uint64(len(d.data)-size) < n {
+		d.err = errShortRecord
+		return ""
+	}
+	s := string(d.data[size : size+int(n)])
+	d.data = d.data[size+int(n):]
+	return s
+}
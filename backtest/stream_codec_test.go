@@ -0,0 +1,152 @@
+package backtest
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func sampleStreams() ([]EquityPoint, []TradeEvent) {
+	points := []EquityPoint{
+		{Timestamp: 1700000000000, Equity: 1000, Available: 1000, Cycle: 0},
+		{Timestamp: 1700000300000, Equity: 1012.5, Available: 880.25, PnL: 12.5, PnLPct: 1.25, DrawdownPct: 0, Cycle: 1},
+		{Timestamp: 1700000600000, Equity: 990.125, Available: 870, PnL: -9.875, PnLPct: -0.9875, DrawdownPct: 2.2099, Cycle: 2},
+	}
+	events := []TradeEvent{
+		{Timestamp: 1700000300000, Symbol: "BTCUSDT", Action: "open_long", Side: "long", Quantity: 0.01, Price: 35010.5, Fee: 0.175, Slippage: 10.5, OrderValue: 350.105, Leverage: 5, Cycle: 1, PositionAfter: 0.01},
+		{Timestamp: 1700000600000, Symbol: "BTCUSDT", Action: "liquidation", Side: "long", Quantity: 0.01, Price: 28000, RealizedPnL: -70.1, Leverage: 5, Cycle: 2, LiquidationFlag: true, Note: "强制平仓"},
+	}
+	return points, events
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	points, events := sampleStreams()
+
+	for _, format := range []string{StreamFormatJSONL, StreamFormatBinary} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			eqJSON, eqBin := filepath.Join(dir, "equity.jsonl"), filepath.Join(dir, "equity.bin")
+			trJSON, trBin := filepath.Join(dir, "trades.jsonl"), filepath.Join(dir, "trades.bin")
+
+			for _, p := range points {
+				if err := appendStreamRecord(eqJSON, eqBin, format, p, func(buf []byte) []byte { return encodeEquityPoint(buf, p) }); err != nil {
+					t.Fatalf("append equity: %v", err)
+				}
+			}
+			for _, e := range events {
+				if err := appendStreamRecord(trJSON, trBin, format, e, func(buf []byte) []byte { return encodeTradeEvent(buf, e) }); err != nil {
+					t.Fatalf("append trade: %v", err)
+				}
+			}
+
+			// 只应生成对应格式的文件
+			wantPath, otherPath := eqJSON, eqBin
+			if format == StreamFormatBinary {
+				wantPath, otherPath = eqBin, eqJSON
+			}
+			if _, err := os.Stat(wantPath); err != nil {
+				t.Fatalf("expected %s to exist: %v", wantPath, err)
+			}
+			if _, err := os.Stat(otherPath); !os.IsNotExist(err) {
+				t.Fatalf("expected %s to be absent", otherPath)
+			}
+
+			gotPoints, err := loadStream(eqJSON, eqBin, decodeEquityPoint)
+			if err != nil {
+				t.Fatalf("load equity: %v", err)
+			}
+			if !reflect.DeepEqual(gotPoints, points) {
+				t.Errorf("equity round trip mismatch:\n got %+v\nwant %+v", gotPoints, points)
+			}
+			gotEvents, err := loadStream(trJSON, trBin, decodeTradeEvent)
+			if err != nil {
+				t.Fatalf("load trades: %v", err)
+			}
+			if !reflect.DeepEqual(gotEvents, events) {
+				t.Errorf("trade round trip mismatch:\n got %+v\nwant %+v", gotEvents, events)
+			}
+		})
+	}
+}
+
+func TestStreamBinaryMatchesJSON(t *testing.T) {
+	points, events := sampleStreams()
+	dir := t.TempDir()
+
+	write := func(name, format string) (string, string) {
+		jsonPath, binPath := filepath.Join(dir, name+".jsonl"), filepath.Join(dir, name+".bin")
+		for _, e := range events {
+			if err := appendStreamRecord(jsonPath, binPath, format, e, func(buf []byte) []byte { return encodeTradeEvent(buf, e) }); err != nil {
+				t.Fatalf("append %s: %v", format, err)
+			}
+		}
+		for _, p := range points {
+			if err := appendStreamRecord(jsonPath+".eq", binPath+".eq", format, p, func(buf []byte) []byte { return encodeEquityPoint(buf, p) }); err != nil {
+				t.Fatalf("append %s: %v", format, err)
+			}
+		}
+		if format == StreamFormatBinary {
+			return binPath, binPath + ".eq"
+		}
+		return jsonPath, jsonPath + ".eq"
+	}
+	jsonTrades, jsonEquity := write("json", StreamFormatJSONL)
+	binTrades, binEquity := write("bin", StreamFormatBinary)
+
+	// readStream 根据文件头自动识别格式，两种格式应解出完全相同的结构体
+	readTrades := func(path string) []TradeEvent {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		out, err := readStream(f, decodeTradeEvent)
+		if err != nil {
+			t.Fatalf("readStream %s: %v", path, err)
+		}
+		return out
+	}
+	readEquity := func(path string) []EquityPoint {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		out, err := readStream(f, decodeEquityPoint)
+		if err != nil {
+			t.Fatalf("readStream %s: %v", path, err)
+		}
+		return out
+	}
+
+	if got, want := readTrades(binTrades), readTrades(jsonTrades); !reflect.DeepEqual(got, want) {
+		t.Errorf("binary trades differ from JSON:\n bin %+v\njson %+v", got, want)
+	}
+	if got, want := readEquity(binEquity), readEquity(jsonEquity); !reflect.DeepEqual(got, want) {
+		t.Errorf("binary equity differs from JSON:\n bin %+v\njson %+v", got, want)
+	}
+
+	binInfo, _ := os.Stat(binTrades)
+	jsonInfo, _ := os.Stat(jsonTrades)
+	if binInfo.Size() >= jsonInfo.Size() {
+		t.Errorf("binary stream (%d bytes) should be smaller than JSON (%d bytes)", binInfo.Size(), jsonInfo.Size())
+	}
+}
+
+func TestStreamBinaryTruncatedRecord(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath, binPath := filepath.Join(dir, "trades.jsonl"), filepath.Join(dir, "trades.bin")
+	_, events := sampleStreams()
+	e := events[0]
+	if err := appendStreamRecord(jsonPath, binPath, StreamFormatBinary, e, func(buf []byte) []byte { return encodeTradeEvent(buf, e) }); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(binPath)
+	if err := os.WriteFile(binPath, data[:len(data)-3], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadStream(jsonPath, binPath, decodeTradeEvent); err == nil {
+		t.Fatal("expected error for truncated binary record")
+	}
+}
@@ -1,6 +1,10 @@
 package backtest
 
-import "time"
+import (
+	"time"
+
+	"nofx/logger"
+)
 
 // RunState 表示回测运行当前状态。
 type RunState string
@@ -27,6 +31,25 @@ type PositionSnapshot struct {
 	OpenTime         int64   `json:"open_time"`
 	StopLoss         float64 `json:"stop_loss,omitempty"`     // 止损价格
 	TakeProfit       float64 `json:"take_profit,omitempty"`   // 止盈价格
+	TrailPct         float64 `json:"trail_pct,omitempty"`     // 跟踪止损回撤百分比
+	TrailAnchor      float64 `json:"trail_anchor,omitempty"`  // 跟踪止损参考的最优价格
+}
+
+// PositionHeat 表示单个持仓的风险热度（用于前端组合热力图）。
+type PositionHeat struct {
+	Symbol           string  `json:"symbol"`
+	Side             string  `json:"side"`
+	Quantity         float64 `json:"quantity"`
+	EntryPrice       float64 `json:"entry_price"`
+	MarkPrice        float64 `json:"mark_price"`
+	Leverage         int     `json:"leverage"`
+	UnrealizedPnL    float64 `json:"unrealized_pnl"`
+	UnrealizedPnLPct float64 `json:"unrealized_pnl_pct"` // 相对保证金的未实现盈亏百分比
+	LiquidationPrice float64 `json:"liquidation_price"`
+	DistanceToLiqPct float64 `json:"distance_to_liq_pct"` // 标记价距强平价的百分比（相对标记价）
+	MarginUsed       float64 `json:"margin_used"`
+	MarginSharePct   float64 `json:"margin_share_pct"` // 保证金占账户净值的百分比
+	MarkMissing      bool    `json:"mark_missing,omitempty"` // 缺少标记价，未实现盈亏与强平距离未计算
 }
 
 // BacktestState 表示执行过程中的实时状态（内存态）。
@@ -46,6 +69,11 @@ type BacktestState struct {
 	LastUpdate      time.Time
 	Liquidated      bool
 	LiquidationNote string
+
+	// 日内亏损熔断：当前 UTC 日起点（毫秒）、日初权益、当日是否已熔断
+	DayStart       int64
+	DayStartEquity float64
+	DailyHalted    bool
 }
 
 // EquityPoint 表示资金曲线中的单个节点。
@@ -78,6 +106,22 @@ type TradeEvent struct {
 	Note            string  `json:"note,omitempty"`
 }
 
+// CycleResult 汇总一次 stepOnce 的执行结果，供嵌入方按周期响应。
+type CycleResult struct {
+	BarIndex           int                     `json:"bar_index"`
+	Timestamp          int64                   `json:"ts"`
+	Cycle              int                     `json:"cycle"`
+	DecisionAttempted  bool                    `json:"decision_attempted"`  // 本周期是否触发了 AI 决策
+	DecisionsAttempted int                     `json:"decisions_attempted"` // 尝试执行的决策数
+	DecisionsExecuted  int                     `json:"decisions_executed"`  // 成功执行的决策数
+	Actions            []logger.DecisionAction `json:"actions"`
+	Trades             []TradeEvent            `json:"trades"`
+	Equity             float64                 `json:"equity"`
+	UnrealizedPnL      float64                 `json:"unrealized_pnl"`
+	Liquidated         bool                    `json:"liquidated"`
+	Errors             []string                `json:"errors,omitempty"`
+}
+
 // Metrics 汇总回测表现指标。
 type Metrics struct {
 	TotalReturnPct float64                  `json:"total_return_pct"`
@@ -92,6 +136,12 @@ type Metrics struct {
 	WorstSymbol    string                   `json:"worst_symbol"`
 	SymbolStats    map[string]SymbolMetrics `json:"symbol_stats"`
 	Liquidated     bool                     `json:"liquidated"`
+	AICacheHitRate float64                  `json:"ai_cache_hit_rate,omitempty"` // AI 决策缓存命中率（0-1）
+
+	RealizedPnL      float64 `json:"realized_pnl"`       // 已平仓交易的盈亏（已扣平仓手续费，不含资金费）
+	UnrealizedPnL    float64 `json:"unrealized_pnl"`     // 当前持仓的浮动盈亏
+	TotalFeesPaid    float64 `json:"total_fees_paid"`    // 开平仓手续费合计
+	TotalFundingPaid float64 `json:"total_funding_paid"` // 资金费合计（负值表示净收取）
 }
 
 // SymbolMetrics 记录单个标的的表现。
@@ -122,6 +172,10 @@ type Checkpoint struct {
 	AICacheRef      string                    `json:"ai_cache_ref,omitempty"`
 	Liquidated      bool                      `json:"liquidated"`
 	LiquidationNote string                    `json:"liquidation_note,omitempty"`
+	PendingOrders   []PendingOrder            `json:"pending_orders,omitempty"`
+	DayStart        int64                     `json:"day_start,omitempty"`
+	DayStartEquity  float64                   `json:"day_start_equity,omitempty"`
+	DailyHalted     bool                      `json:"daily_halted,omitempty"`
 }
 
 // RunMetadata 记录 run.json 所需摘要。
@@ -152,6 +206,7 @@ type RunSummary struct {
 	CustomPrompt         string `json:"custom_prompt,omitempty"`
 	OverridePrompt       bool   `json:"override_prompt,omitempty"`
 	PromptContentSnapshot string `json:"prompt_content_snapshot,omitempty"` // 启动时的完整prompt内容快照
+	AICacheHitRate       float64 `json:"ai_cache_hit_rate,omitempty"`       // AI 决策缓存命中率（0-1）
 }
 
 // StatusPayload 用于 /status API 的响应。
@@ -168,4 +223,8 @@ type StatusPayload struct {
 	Note           string   `json:"note,omitempty"`
 	LastError      string   `json:"last_error,omitempty"`
 	LastUpdatedIso string   `json:"last_updated_iso"`
+
+	// 交易缓存一致性健康检查（未开启或尚未校验时为空）
+	CacheHealthy   *bool  `json:"cache_healthy,omitempty"`
+	CacheCheckedAt string `json:"cache_checked_at,omitempty"`
 }
@@ -113,18 +113,20 @@ type Context struct {
 // Decision AI的交易决策
 type Decision struct {
 	Symbol string `json:"symbol"`
-	Action string `json:"action"` // "open_long", "open_short", "close_long", "close_short", "update_stop_loss", "update_take_profit", "partial_close", "hold", "wait"
+	Action string `json:"action"` // "open_long", "open_short", "close_long", "close_short", "update_stop_loss", "update_take_profit", "trailing_stop", "partial_close", "close_all", "hold", "wait"
 
 	// 开仓参数
 	Leverage        int     `json:"leverage,omitempty"`
 	PositionSizeUSD float64 `json:"position_size_usd,omitempty"`
 	StopLoss        float64 `json:"stop_loss,omitempty"`
 	TakeProfit      float64 `json:"take_profit,omitempty"`
+	LimitPrice      float64 `json:"limit_price,omitempty"` // 限价开仓价格（目前仅回测支持，>0 时挂单等待成交）
 
 	// 调整参数（新增）
 	NewStopLoss     float64 `json:"new_stop_loss,omitempty"`    // 用于 update_stop_loss
 	NewTakeProfit   float64 `json:"new_take_profit,omitempty"`  // 用于 update_take_profit
 	ClosePercentage float64 `json:"close_percentage,omitempty"` // 用于 partial_close (0-100)
+	TrailPct        float64 `json:"trail_pct,omitempty"`        // 用于 trailing_stop：相对最优价格的回撤百分比 (0-100)，目前仅回测支持
 
 	// 通用参数
 	RiskUSD   float64 `json:"risk_usd,omitempty"` // 最大美元风险
@@ -141,6 +143,8 @@ type FullDecision struct {
 	// AIRequestDurationMs 记录 AI API 调用耗时（毫秒）方便排查延迟问题
 	AIRequestDurationMs int64  `json:"ai_request_duration_ms,omitempty"`
 	PromptHash          string `json:"prompt_hash,omitempty"` // Prompt 模板的 hash（用于区分不同版本）
+	// RawResponse AI 返回的完整原始文本（未经解析，用于审计；不参与序列化，是否落盘由调用方决定）
+	RawResponse string `json:"-"`
 }
 
 // GetFullDecision 获取AI的完整交易决策（批量分析所有币种和持仓）
@@ -181,6 +185,7 @@ func GetFullDecisionWithCustomPrompt(ctx *Context, mcpClient mcp.AIClient, custo
 		decision.UserPrompt = userPrompt     // 保存输入prompt
 		decision.PromptHash = promptHash     // 保存 prompt hash
 		decision.AIRequestDurationMs = aiCallDuration.Milliseconds()
+		decision.RawResponse = aiResponse
 	}
 
 	if err != nil {
@@ -875,7 +880,9 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 		"close_short":        true,
 		"update_stop_loss":   true,
 		"update_take_profit": true,
+		"trailing_stop":      true,
 		"partial_close":      true,
+		"close_all":          true, // 平掉全部持仓（symbol 忽略），执行时展开为每个持仓的平仓
 		"hold":               true,
 		"wait":               true,
 	}
@@ -950,6 +957,13 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 		}
 	}
 
+	// 跟踪止损验证
+	if d.Action == "trailing_stop" {
+		if d.TrailPct <= 0 || d.TrailPct >= 100 {
+			return fmt.Errorf("跟踪止损百分比必须在0-100之间: %.2f", d.TrailPct)
+		}
+	}
+
 	// 部分平仓验证
 	if d.Action == "partial_close" {
 		if d.ClosePercentage <= 0 || d.ClosePercentage > 100 {
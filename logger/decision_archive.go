@@ -0,0 +1,231 @@
+package logger
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// 决策文件归档位于日志目录的 archive 子目录，每天一个 tar.gz
+const (
+	archiveDir        = "archive"
+	archiveFilePrefix = "archive_"
+	archiveFileSuffix = ".tar.gz"
+)
+
+// archivedFile 归档中的单个决策文件
+type archivedFile struct {
+	name string
+	data []byte
+}
+
+// archivePathForDay 返回指定日期（YYYYMMDD）的归档文件路径
+func (l *DecisionLogger) archivePathForDay(day string) string {
+	return filepath.Join(l.logDir, archiveDir, archiveFilePrefix+day+archiveFileSuffix)
+}
+
+// ArchiveOldRecords 将 N 天前的决策文件按天打包为 archive/archive_YYYYMMDD.tar.gz 并删除原文件
+// 同一天已有归档时合并写入；归档后的记录仍可通过 GetRecordByDate / GetLatestRecords 读取
+func (l *DecisionLogger) ArchiveOldRecords(days int) error {
+	now := time.Now()
+	cutoff := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, -days)
+
+	files, err := os.ReadDir(l.logDir)
+	if err != nil {
+		return fmt.Errorf("读取日志目录失败: %w", err)
+	}
+
+	// 按日期分组待归档文件
+	byDay := make(map[string][]string)
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		ts, ok := decisionFileTime(file.Name())
+		if !ok || !ts.Before(cutoff) {
+			continue
+		}
+		day := ts.Format("20060102")
+		byDay[day] = append(byDay[day], file.Name())
+	}
+
+	archivedCount := 0
+	for day, names := range byDay {
+		archivePath := l.archivePathForDay(day)
+		existing, err := readArchive(archivePath)
+		if err != nil {
+			return err
+		}
+
+		entries := make(map[string][]byte, len(existing)+len(names))
+		for _, file := range existing {
+			entries[file.name] = file.data
+		}
+		for _, name := range names {
+			data, err := os.ReadFile(filepath.Join(l.logDir, name))
+			if err != nil {
+				return fmt.Errorf("读取决策文件失败 %s: %w", name, err)
+			}
+			entries[name] = data
+		}
+
+		if err := writeArchive(archivePath, entries); err != nil {
+			return err
+		}
+
+		// 归档写入成功后才删除原文件
+		for _, name := range names {
+			if err := os.Remove(filepath.Join(l.logDir, name)); err != nil {
+				fmt.Printf("⚠ 删除已归档记录失败 %s: %v\n", name, err)
+				continue
+			}
+			archivedCount++
+		}
+	}
+
+	if archivedCount > 0 {
+		fmt.Printf("📦 已归档 %d 条旧记录（%d天前）\n", archivedCount, days)
+	}
+
+	return nil
+}
+
+// archivedRecordsForDay 读取指定日期归档中的记录，跳过 skip 中已存在的文件名
+func (l *DecisionLogger) archivedRecordsForDay(day string, skip map[string]bool) ([]*DecisionRecord, error) {
+	files, err := readArchive(l.archivePathForDay(day))
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*DecisionRecord
+	for _, file := range files {
+		if skip[file.name] {
+			continue
+		}
+		var record DecisionRecord
+		if err := json.Unmarshal(file.data, &record); err != nil {
+			continue
+		}
+		records = append(records, &record)
+	}
+	return records, nil
+}
+
+// archivedDays 返回已归档的日期列表（YYYYMMDD，从新到旧）
+func (l *DecisionLogger) archivedDays() []string {
+	pattern := filepath.Join(l.logDir, archiveDir, archiveFilePrefix+"*"+archiveFileSuffix)
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil
+	}
+
+	days := make([]string, 0, len(paths))
+	for _, path := range paths {
+		name := filepath.Base(path)
+		days = append(days, name[len(archiveFilePrefix):len(name)-len(archiveFileSuffix)])
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(days)))
+	return days
+}
+
+// readArchive 读取归档中的全部文件（按文件名升序），归档不存在时返回 nil
+func readArchive(path string) ([]archivedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("打开归档失败: %w", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("解压归档失败 %s: %w", filepath.Base(path), err)
+	}
+	defer gz.Close()
+
+	var files []archivedFile
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取归档失败 %s: %w", filepath.Base(path), err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("读取归档失败 %s: %w", filepath.Base(path), err)
+		}
+		files = append(files, archivedFile{name: header.Name, data: data})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].name < files[j].name
+	})
+	return files, nil
+}
+
+// writeArchive 将文件写入 tar.gz 归档（先写临时文件再替换）
+func writeArchive(path string, entries map[string][]byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("创建归档目录失败: %w", err)
+	}
+
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("创建归档失败: %w", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	writeErr := func() error {
+		for _, name := range names {
+			data := entries[name]
+			header := &tar.Header{
+				Name:     name,
+				Mode:     0600,
+				Size:     int64(len(data)),
+				ModTime:  time.Now(),
+				Typeflag: tar.TypeReg,
+			}
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if _, err := tw.Write(data); err != nil {
+				return err
+			}
+		}
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		return gz.Close()
+	}()
+	if closeErr := f.Close(); writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("写入归档失败: %w", writeErr)
+	}
+
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,92 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestArchiveOldRecords 测试归档旧决策文件后 GetRecordByDate 与 GetLatestRecords 仍能透明读取
+func TestArchiveOldRecords(t *testing.T) {
+	tempDir := t.TempDir()
+	l := NewDecisionLogger(tempDir).(*DecisionLogger)
+
+	now := time.Now()
+	oldDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, -5)
+	writeRecord := func(cycle int, ts time.Time) string {
+		record := DecisionRecord{Timestamp: ts, CycleNumber: cycle, Success: true}
+		data, _ := json.Marshal(record)
+		name := fmt.Sprintf("decision_%s_cycle%d.json", ts.Format("20060102_150405"), cycle)
+		if err := os.WriteFile(filepath.Join(tempDir, name), data, 0600); err != nil {
+			t.Fatalf("write record: %v", err)
+		}
+		return name
+	}
+
+	oldNames := []string{
+		writeRecord(1, oldDay.Add(9*time.Hour)),
+		writeRecord(2, oldDay.Add(10*time.Hour)),
+		writeRecord(3, oldDay.Add(11*time.Hour)),
+	}
+	recentName := writeRecord(4, now.Add(-time.Minute))
+
+	if err := l.ArchiveOldRecords(2); err != nil {
+		t.Fatalf("ArchiveOldRecords: %v", err)
+	}
+
+	archivePath := filepath.Join(tempDir, archiveDir, "archive_"+oldDay.Format("20060102")+".tar.gz")
+	if _, err := os.Stat(archivePath); err != nil {
+		t.Fatalf("archive not created: %v", err)
+	}
+	for _, name := range oldNames {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed after archiving", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, recentName)); err != nil {
+		t.Errorf("recent record should not be archived: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		read       func() ([]*DecisionRecord, error)
+		wantCycles []int
+	}{
+		{"GetRecordByDate reads archive", func() ([]*DecisionRecord, error) { return l.GetRecordByDate(oldDay) }, []int{1, 2, 3}},
+		{"GetLatestRecords spans archive", func() ([]*DecisionRecord, error) { return l.GetLatestRecords(10) }, []int{1, 2, 3, 4}},
+		{"GetLatestRecords stops at n", func() ([]*DecisionRecord, error) { return l.GetLatestRecords(2) }, []int{3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := tt.read()
+			if err != nil {
+				t.Fatalf("read records: %v", err)
+			}
+			if len(records) != len(tt.wantCycles) {
+				t.Fatalf("got %d records, want %d", len(records), len(tt.wantCycles))
+			}
+			for i, cycle := range tt.wantCycles {
+				if records[i].CycleNumber != cycle {
+					t.Errorf("record %d cycle = %d, want %d", i, records[i].CycleNumber, cycle)
+				}
+			}
+		})
+	}
+
+	// 同一天再次归档时与已有归档合并
+	writeRecord(5, oldDay.Add(12*time.Hour))
+	if err := l.ArchiveOldRecords(2); err != nil {
+		t.Fatalf("ArchiveOldRecords (merge): %v", err)
+	}
+	records, err := l.GetRecordByDate(oldDay)
+	if err != nil {
+		t.Fatalf("GetRecordByDate: %v", err)
+	}
+	if len(records) != 4 {
+		t.Errorf("expected 4 archived records after merge, got %d", len(records))
+	}
+}
@@ -1,15 +1,19 @@
 package logger
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,6 +27,27 @@ const (
 	// 目标：获取足够的交易填充缓存（至少 AIAnalysisSampleSize 笔）
 	// 假设每 5 分钟一个周期，10000 个周期 ≈ 833 小时历史数据
 	InitialScanCycles = 10000
+
+	// RegimeUnknown 开仓时未记录波动率状态的交易分组名
+	RegimeUnknown = "unknown"
+)
+
+// 重启对账时重复交易的处理策略
+const (
+	// DuplicateTradeKeepPersisted 同一交易同时出现在持久化缓存与决策文件扫描中时，保留持久化版本（默认）
+	DuplicateTradeKeepPersisted = "keep_persisted"
+	// DuplicateTradePreferScan 同一交易重复时，以决策文件重新扫描得到的版本为准
+	DuplicateTradePreferScan = "prefer_scan"
+)
+
+// 持久化交易缓存位于日志目录的子目录中，避免被决策文件扫描误读
+const (
+	tradeStoreDir  = "cache"
+	tradeStoreFile = "trades.jsonl"
+
+	// cacheSnapshotFile 启动快照（与持久化交易缓存同目录）：记录未平仓持仓和已处理到的最后一个决策文件，
+	// 重启时据此只回放之后的决策文件，缺失或损坏时才全量扫描
+	cacheSnapshotFile = "cache_snapshot.json"
 )
 
 // DecisionRecord 决策记录
@@ -44,6 +69,8 @@ type DecisionRecord struct {
 	// AIRequestDurationMs 记录 AI API 调用耗时（毫秒），方便评估调用性能
 	AIRequestDurationMs int64  `json:"ai_request_duration_ms,omitempty"`
 	PromptHash          string `json:"prompt_hash,omitempty"` // Prompt模板版本哈希
+	// RawAIResponse AI 完整原始响应（可选，默认不记录以避免日志膨胀，已脱敏）
+	RawAIResponse string `json:"raw_ai_response,omitempty"`
 }
 
 // AccountSnapshot 账户状态快照
@@ -88,6 +115,18 @@ type DecisionAction struct {
 	NewStopLoss     float64 `json:"new_stop_loss,omitempty"`     // 新止损价格（update_stop_loss 时使用）
 	NewTakeProfit   float64 `json:"new_take_profit,omitempty"`   // 新止盈价格（update_take_profit 时使用）
 	ClosePercentage float64 `json:"close_percentage,omitempty"`  // 平仓百分比（partial_close 时使用，0-100）
+
+	// 滑点（单位价格的不利偏移，成交价已包含；目前由回测记录，实盘为 0）
+	Slippage float64 `json:"slippage,omitempty"`
+
+	// 开仓时的市场波动率状态（low/normal/high/extreme，用于按行情状态分组统计）
+	Regime string `json:"regime,omitempty"`
+
+	// 是否以 Maker 身份成交（如限价止盈止损），缺省按 Taker 计费
+	IsMaker bool `json:"is_maker,omitempty"`
+
+	// 资金费（USDT，正数为支付、负数为收取），平仓/部分平仓时记录自上一次平仓动作以来产生的资金费，从交易盈亏中扣除
+	FundingPaid float64 `json:"funding_paid,omitempty"`
 }
 
 // IDecisionLogger 决策日志记录器接口
@@ -96,55 +135,91 @@ type IDecisionLogger interface {
 	LogDecision(record *DecisionRecord) error
 	// GetLatestRecords 获取最近N条记录（按时间正序：从旧到新）
 	GetLatestRecords(n int) ([]*DecisionRecord, error)
+	// GetRecordsPage 分页获取记录（offset 从最新记录起算，返回按时间正序）
+	GetRecordsPage(offset, limit int) ([]*DecisionRecord, error)
 	// GetLatestRecordsWithFilter 获取最近N条记录，支持过滤只包含操作的记录
 	GetLatestRecordsWithFilter(n int, onlyWithActions bool) ([]*DecisionRecord, error)
 	// GetRecordByDate 获取指定日期的所有记录
 	GetRecordByDate(date time.Time) ([]*DecisionRecord, error)
 	// CleanOldRecords 清理N天前的旧记录
 	CleanOldRecords(days int) error
+	// ArchiveOldRecords 将N天前的决策文件按天压缩归档并删除原文件
+	ArchiveOldRecords(days int) error
 	// GetStatistics 获取统计信息
 	GetStatistics() (*Statistics, error)
 	// AnalyzePerformance 分析最近N个周期的交易表现
 	AnalyzePerformance(lookbackCycles int) (*PerformanceAnalysis, error)
+	// GetRecordsByDateRange 获取 [start, end) 时间范围内的记录（按时间正序）
+	GetRecordsByDateRange(start, end time.Time) ([]*DecisionRecord, error)
+	// AnalyzePerformanceRange 分析 [start, end) 时间窗口内的交易表现
+	AnalyzePerformanceRange(start, end time.Time) (*PerformanceAnalysis, error)
 	// SetCycleNumber 设置周期编号（用于回测恢复检查点）
 	SetCycleNumber(cycle int)
+	// SetPeriodsPerYear 设置夏普比率年化的每年周期数（0 表示返回周期级别夏普比率）
+	SetPeriodsPerYear(n float64)
+	// SetRiskFreeRatePerPeriod 设置夏普比率使用的每周期无风险收益率（默认 0）
+	SetRiskFreeRatePerPeriod(r float64)
 	// AddTradeToCache 添加交易到缓存
 	AddTradeToCache(trade TradeOutcome)
 	// GetRecentTrades 从缓存获取最近N条交易
 	GetRecentTrades(limit int) []TradeOutcome
+	// GetEquityCurve 从缓存获取最近N个净值点（按时间正序：从旧到新）
+	GetEquityCurve(limit int) []EquityPoint
+	// ExportTradesCSV 将缓存中最近N条交易导出为 CSV（从新到旧）
+	ExportTradesCSV(w io.Writer, limit int) error
 	// GetPerformanceWithCache 使用缓存机制获取历史表现分析（懒加载）
 	// tradeLimit: 返回的交易记录数量限制
 	// filterByPrompt: 是否按当前 PromptHash 过滤交易（默认 false 显示所有）
 	GetPerformanceWithCache(tradeLimit int, filterByPrompt bool) (*PerformanceAnalysis, error)
+	// GetPerformanceWindow 只统计最近 window 时间内平仓的缓存交易
+	GetPerformanceWindow(window time.Duration, tradeLimit int, filterByPrompt bool) (*PerformanceAnalysis, error)
 	// GetOpenPosition 获取指定币种的开仓信息
 	// 返回 nil 表示该币种没有未平仓持仓
 	// Issue #102: 用于在系统重启后恢复持仓的真实开仓时间
 	GetOpenPosition(symbol string) *OpenPosition
+	// GetPerformanceByRegime 按开仓时的波动率状态分组统计缓存中的交易表现
+	GetPerformanceByRegime() map[string]*PerformanceAnalysis
+	// ComparePromptPerformance 按 PromptHash 分组统计缓存中的交易表现
+	ComparePromptPerformance() (map[string]*PerformanceAnalysis, error)
+	// SuggestAllocation 按各币种夏普比率给出建议资金权重（合计为 1）
+	SuggestAllocation() map[string]float64
+	// VerifyCacheConsistency 校验增量维护的交易缓存与决策文件扫描结果是否一致
+	VerifyCacheConsistency() (*CacheConsistencyReport, error)
 }
 
 // OpenPosition 记录开仓信息（用于主动维护缓存）
 type OpenPosition struct {
-	Symbol     string
-	Side       string  // long/short
-	Quantity   float64
-	EntryPrice float64
-	Leverage   int
-	OpenTime   time.Time
-	Exchange   string
-	StopLoss   float64 // 止损价格（Issue #102: 重启后恢复）
-	TakeProfit float64 // 止盈价格（Issue #102: 重启后恢复）
+	Symbol        string
+	Side          string // long/short
+	Quantity      float64
+	EntryPrice    float64
+	Leverage      int
+	OpenTime      time.Time
+	Exchange      string
+	StopLoss      float64 // 止损价格（Issue #102: 重启后恢复）
+	TakeProfit    float64 // 止盈价格（Issue #102: 重启后恢复）
+	EntrySlippage float64 // 开仓单位滑点
+	EntryRegime   string  // 开仓时的波动率状态
+
+	// 部分平仓追踪（PartialCloses 为 0 时剩余数量即 Quantity）
+	RemainingQuantity   float64 // 剩余未平数量
+	AccumulatedPnL      float64 // 已部分平仓的累计盈亏（已扣手续费）
+	AccumulatedSlippage float64 // 已部分平仓的累计滑点成本
+	PartialCloses       int     // 部分平仓次数
+	FundingPaid         float64 // 已部分平仓记录的累计资金费（USDT，正数为支付，平仓时从 PnL 中扣除）
 }
 
 // EquityPoint 账户净值记录点
 type EquityPoint struct {
-	Timestamp time.Time
-	Equity    float64
+	Timestamp   time.Time
+	Equity      float64
+	DrawdownPct float64 // 相对缓存窗口内此前最高净值的回撤百分比（>= 0）
 }
 
 // DecisionLogger 决策日志记录器
 type DecisionLogger struct {
 	logDir        string
-	cycleNumber   int
+	cycleNumber   atomic.Int64         // 周期编号（并发调用 LogDecision 时保证唯一）
 	tradesCache   []TradeOutcome       // 交易缓存（最新的在前）
 	tradeCacheSet map[string]bool      // 已缓存交易的 Set（去重用）
 	equityCache   []EquityPoint        // 净值历史缓存（最新的在前）
@@ -153,10 +228,42 @@ type DecisionLogger struct {
 	maxEquitySize int                  // 最大净值缓存条数
 	openPositions map[string]*OpenPosition // 当前开仓（用于主动维护）
 	positionMutex sync.RWMutex             // 持仓读写锁
+
+	duplicatePolicy string             // 重启对账时重复交易的处理策略
+	tradeStorePath  string             // 持久化交易缓存路径（启动对账完成后才启用写入）
+	takerFeeRates   map[string]float64 // 按交易所覆盖的 Taker 费率（未覆盖的使用默认档位）
+	makerFeeRates   map[string]float64 // 按交易所覆盖的 Maker 费率（未覆盖的使用默认档位）
+	periodsPerYear  float64            // 夏普比率年化的每年周期数（0 表示不年化）
+	riskFreeRate    float64            // 夏普比率的每周期无风险收益率（0 表示不扣除）
+	minKellyTrades  int                // 计算 Kelly 比例所需的最少交易数（<= 0 使用默认值）
+
+	snapshotPath      string       // 启动快照路径（启动初始化完成后才启用写入）
+	snapshotMutex     sync.Mutex   // 串行化快照写入
+	snapshotCutoff    string       // 快照中已处理到的最后一个决策文件名
+	decisionFileReads atomic.Int64 // 读取决策文件的次数（测试观测用）
+}
+
+// cacheSnapshot 启动快照：交易本身由持久化交易缓存保存，快照只补充回放起点所需的持仓状态
+type cacheSnapshot struct {
+	OpenPositions map[string]*OpenPosition `json:"open_positions"` // 处理完 LastFile 时的未平仓持仓
+	LastFile      string                   `json:"last_file"`      // 已处理到的最后一个决策文件名
+}
+
+// DecisionLoggerOptions 决策日志记录器的可选配置
+type DecisionLoggerOptions struct {
+	DuplicateTradePolicy string             // 重复交易处理策略：keep_persisted（默认）或 prefer_scan
+	TakerFeeRates        map[string]float64 // 按交易所覆盖 Taker 费率（如 VIP 档位），例如 {"binance": 0.0002}
+	MakerFeeRates        map[string]float64 // 按交易所覆盖 Maker 费率（Maker 成交的平仓使用），例如 {"binance": 0.00018}
+	MinKellyTrades       int                // 计算 Kelly 比例所需的最少交易数（<= 0 使用默认值 10）
 }
 
 // NewDecisionLogger 创建决策日志记录器
 func NewDecisionLogger(logDir string) IDecisionLogger {
+	return NewDecisionLoggerWithOptions(logDir, DecisionLoggerOptions{})
+}
+
+// NewDecisionLoggerWithOptions 使用自定义选项创建决策日志记录器
+func NewDecisionLoggerWithOptions(logDir string, opts DecisionLoggerOptions) IDecisionLogger {
 	if logDir == "" {
 		logDir = "decision_logs"
 	}
@@ -173,13 +280,26 @@ func NewDecisionLogger(logDir string) IDecisionLogger {
 
 	logger := &DecisionLogger{
 		logDir:        logDir,
-		cycleNumber:   0,
 		tradesCache:   make([]TradeOutcome, 0, 100),
 		tradeCacheSet: make(map[string]bool, 100),
 		equityCache:   make([]EquityPoint, 0, 200),
 		maxCacheSize:  100, // 缓存 100 条交易（与前端 limit 最大值一致）
 		maxEquitySize: 200, // 缓存 200 个净值点（足够计算SharpeRatio）
 		openPositions: make(map[string]*OpenPosition),
+
+		duplicatePolicy: opts.DuplicateTradePolicy,
+		takerFeeRates:   make(map[string]float64, len(opts.TakerFeeRates)),
+		makerFeeRates:   make(map[string]float64, len(opts.MakerFeeRates)),
+		minKellyTrades:  opts.MinKellyTrades,
+	}
+	for exchange, rate := range opts.TakerFeeRates {
+		logger.takerFeeRates[exchange] = rate
+	}
+	for exchange, rate := range opts.MakerFeeRates {
+		logger.makerFeeRates[exchange] = rate
+	}
+	if logger.duplicatePolicy != DuplicateTradePreferScan {
+		logger.duplicatePolicy = DuplicateTradeKeepPersisted
 	}
 
 	// 🚀 启动时初始化缓存和持仓 (Fix for Issue #43)
@@ -190,30 +310,42 @@ func NewDecisionLogger(logDir string) IDecisionLogger {
 
 // SetCycleNumber 设置周期编号（用于回测恢复检查点）
 func (l *DecisionLogger) SetCycleNumber(cycle int) {
-	l.cycleNumber = cycle
+	l.cycleNumber.Store(int64(cycle))
+}
+
+// SetPeriodsPerYear 设置夏普比率年化的每年周期数（如 3 分钟决策周期约为 175200），n <= 0 时不年化
+func (l *DecisionLogger) SetPeriodsPerYear(n float64) {
+	if n < 0 {
+		n = 0
+	}
+	l.periodsPerYear = n
+}
+
+// SetRiskFreeRatePerPeriod 设置夏普比率的每周期无风险收益率（与周期收益率同单位，如 0.0001 表示每周期 0.01%）
+// 计算时从平均收益率中扣除，默认 0 保持原有结果
+func (l *DecisionLogger) SetRiskFreeRatePerPeriod(r float64) {
+	l.riskFreeRate = r
 }
 
 // LogDecision 记录决策
 func (l *DecisionLogger) LogDecision(record *DecisionRecord) error {
-	l.cycleNumber++
-	record.CycleNumber = l.cycleNumber
+	record.CycleNumber = int(l.cycleNumber.Add(1))
 	record.Timestamp = time.Now()
 
-	// 生成文件名：decision_YYYYMMDD_HHMMSS_cycleN.json
-	filename := fmt.Sprintf("decision_%s_cycle%d.json",
-		record.Timestamp.Format("20060102_150405"),
-		record.CycleNumber)
-
-	filepath := filepath.Join(l.logDir, filename)
-
 	// 序列化为JSON（带缩进，方便阅读）
 	data, err := json.MarshalIndent(record, "", "  ")
 	if err != nil {
 		return fmt.Errorf("序列化决策记录失败: %w", err)
 	}
 
-	// 写入文件（使用安全权限：只有所有者可读写）
-	if err := ioutil.WriteFile(filepath, data, 0600); err != nil {
+	// 生成文件名：decision_YYYYMMDD_HHMMSS.mmm_cycleN.json（毫秒精度，避免周期编号重置后同一秒内重名）
+	baseName := fmt.Sprintf("decision_%s_cycle%d",
+		record.Timestamp.Format("20060102_150405.000"),
+		record.CycleNumber)
+
+	// 写入文件（使用安全权限：只有所有者可读写；已存在同名文件时追加序号，绝不覆盖）
+	filename, err := writeNewFile(l.logDir, baseName, ".json", data)
+	if err != nil {
 		return fmt.Errorf("写入决策记录失败: %w", err)
 	}
 
@@ -221,6 +353,7 @@ func (l *DecisionLogger) LogDecision(record *DecisionRecord) error {
 
 	// 🚀 主动维护：检测交易完成并更新缓存
 	l.updateCacheFromDecision(record)
+	l.saveCacheSnapshot(filename)
 
 	// 🚀 记录equity到缓存（用于SharpeRatio计算）
 	l.addEquityToCache(record.Timestamp, record.AccountState.TotalBalance)
@@ -228,6 +361,30 @@ func (l *DecisionLogger) LogDecision(record *DecisionRecord) error {
 	return nil
 }
 
+// writeNewFile 以独占方式创建 baseName+ext，文件已存在时依次尝试 baseName_2+ext、baseName_3+ext…
+// 返回实际写入的文件名
+func writeNewFile(dir, baseName, ext string, data []byte) (string, error) {
+	for attempt := 1; attempt <= 100; attempt++ {
+		name := baseName + ext
+		if attempt > 1 {
+			name = fmt.Sprintf("%s_%d%s", baseName, attempt, ext)
+		}
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			if os.IsExist(err) {
+				continue
+			}
+			return "", err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return "", err
+		}
+		return name, f.Close()
+	}
+	return "", fmt.Errorf("文件名冲突次数过多: %s%s", baseName, ext)
+}
+
 // GetLatestRecords 获取最近N条记录（按时间正序：从旧到新）
 func (l *DecisionLogger) GetLatestRecords(n int) ([]*DecisionRecord, error) {
 	files, err := ioutil.ReadDir(l.logDir)
@@ -255,6 +412,7 @@ func (l *DecisionLogger) GetLatestRecords(n int) ([]*DecisionRecord, error) {
 		if err != nil {
 			continue
 		}
+		l.decisionFileReads.Add(1)
 
 		var record DecisionRecord
 		if err := json.Unmarshal(data, &record); err != nil {
@@ -265,6 +423,28 @@ func (l *DecisionLogger) GetLatestRecords(n int) ([]*DecisionRecord, error) {
 		count++
 	}
 
+	// 未归档文件不足时，从新到旧继续读取归档（目录中已存在的同名文件优先）
+	if count < n {
+		present := make(map[string]bool, len(files))
+		for _, file := range files {
+			present[file.Name()] = true
+		}
+		for _, day := range l.archivedDays() {
+			if count >= n {
+				break
+			}
+			archived, err := l.archivedRecordsForDay(day, present)
+			if err != nil {
+				fmt.Printf("⚠ 读取归档记录失败: %v\n", err)
+				continue
+			}
+			for i := len(archived) - 1; i >= 0 && count < n; i-- {
+				records = append(records, archived[i])
+				count++
+			}
+		}
+	}
+
 	// 反转数组，让时间从旧到新排列（用于图表显示）
 	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
 		records[i], records[j] = records[j], records[i]
@@ -273,6 +453,53 @@ func (l *DecisionLogger) GetLatestRecords(n int) ([]*DecisionRecord, error) {
 	return records, nil
 }
 
+// GetRecordsPage 分页获取记录：按文件名从新到旧跳过 offset 个文件后读取 limit 条（返回按时间正序：从旧到新）
+// 只解码本页需要的文件；offset 超出范围时返回空列表
+func (l *DecisionLogger) GetRecordsPage(offset, limit int) ([]*DecisionRecord, error) {
+	records := []*DecisionRecord{}
+	if offset < 0 || limit <= 0 {
+		return records, nil
+	}
+
+	files, err := os.ReadDir(l.logDir)
+	if err != nil {
+		return nil, fmt.Errorf("读取日志目录失败: %w", err)
+	}
+
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		names = append(names, file.Name())
+	}
+	if offset >= len(names) {
+		return records, nil
+	}
+
+	// 按文件名排序（最新的在前）
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	end := offset + limit
+	if end > len(names) {
+		end = len(names)
+	}
+
+	// 倒序读取本页，得到从旧到新的结果
+	for i := end - 1; i >= offset; i-- {
+		data, err := os.ReadFile(filepath.Join(l.logDir, names[i]))
+		if err != nil {
+			continue
+		}
+		var record DecisionRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			continue
+		}
+		records = append(records, &record)
+	}
+
+	return records, nil
+}
+
 // GetLatestRecordsWithFilter 获取最近的N条决策记录，支持过滤只包含操作的记录
 func (l *DecisionLogger) GetLatestRecordsWithFilter(n int, onlyWithActions bool) ([]*DecisionRecord, error) {
 	files, err := ioutil.ReadDir(l.logDir)
@@ -345,8 +572,10 @@ func (l *DecisionLogger) GetRecordByDate(date time.Time) ([]*DecisionRecord, err
 	}
 
 	var records []*DecisionRecord
-	for _, filepath := range files {
-		data, err := ioutil.ReadFile(filepath)
+	present := make(map[string]bool, len(files))
+	for _, path := range files {
+		present[filepath.Base(path)] = true
+		data, err := ioutil.ReadFile(path)
 		if err != nil {
 			continue
 		}
@@ -359,6 +588,46 @@ func (l *DecisionLogger) GetRecordByDate(date time.Time) ([]*DecisionRecord, err
 		records = append(records, &record)
 	}
 
+	// 补充已归档的记录（未压缩文件缺失时透明读取归档）
+	archived, err := l.archivedRecordsForDay(dateStr, present)
+	if err != nil {
+		fmt.Printf("⚠ 读取归档记录失败: %v\n", err)
+	} else if len(archived) > 0 {
+		records = append(records, archived...)
+		sort.SliceStable(records, func(i, j int) bool {
+			return records[i].Timestamp.Before(records[j].Timestamp)
+		})
+	}
+
+	return records, nil
+}
+
+// GetRecordsByDateRange 获取 [start, end) 时间范围内的所有记录（按时间正序：从旧到新）
+// 按日期前缀逐日匹配文件，再按 record.Timestamp 精确过滤
+func (l *DecisionLogger) GetRecordsByDateRange(start, end time.Time) ([]*DecisionRecord, error) {
+	records := []*DecisionRecord{}
+	if !end.After(start) {
+		return records, nil
+	}
+
+	// 文件名使用本地时间，按本地日期遍历
+	startLocal, endLocal := start.Local(), end.Local()
+	day := time.Date(startLocal.Year(), startLocal.Month(), startLocal.Day(), 0, 0, 0, 0, time.Local)
+	for ; day.Before(endLocal); day = day.AddDate(0, 0, 1) {
+		dayRecords, err := l.GetRecordByDate(day)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range dayRecords {
+			if !record.Timestamp.Before(start) && record.Timestamp.Before(end) {
+				records = append(records, record)
+			}
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp.Before(records[j].Timestamp)
+	})
 	return records, nil
 }
 
@@ -402,6 +671,7 @@ func (l *DecisionLogger) GetStatistics() (*Statistics, error) {
 	}
 
 	stats := &Statistics{}
+	var aiDurations []float64
 
 	for _, file := range files {
 		if file.IsDir() {
@@ -440,18 +710,43 @@ func (l *DecisionLogger) GetStatistics() (*Statistics, error) {
 		} else {
 			stats.FailedCycles++
 		}
+
+		if record.AIRequestDurationMs > 0 {
+			aiDurations = append(aiDurations, float64(record.AIRequestDurationMs))
+		}
 	}
 
+	stats.AvgAIRequestMs, stats.P95AIRequestMs = calculateLatencyStats(aiDurations)
+
 	return stats, nil
 }
 
+// calculateLatencyStats 计算耗时的平均值与 P95（最近秩法），空列表返回 0
+func calculateLatencyStats(durations []float64) (avg, p95 float64) {
+	if len(durations) == 0 {
+		return 0, 0
+	}
+
+	sorted := append([]float64(nil), durations...)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	for _, d := range sorted {
+		sum += d
+	}
+	rank := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+	return sum / float64(len(sorted)), sorted[rank]
+}
+
 // Statistics 统计信息
 type Statistics struct {
-	TotalCycles         int `json:"total_cycles"`
-	SuccessfulCycles    int `json:"successful_cycles"`
-	FailedCycles        int `json:"failed_cycles"`
-	TotalOpenPositions  int `json:"total_open_positions"`
-	TotalClosePositions int `json:"total_close_positions"`
+	TotalCycles         int     `json:"total_cycles"`
+	SuccessfulCycles    int     `json:"successful_cycles"`
+	FailedCycles        int     `json:"failed_cycles"`
+	TotalOpenPositions  int     `json:"total_open_positions"`
+	TotalClosePositions int     `json:"total_close_positions"`
+	AvgAIRequestMs      float64 `json:"avg_ai_request_ms"` // AI 请求平均耗时（毫秒，忽略未记录耗时的周期）
+	P95AIRequestMs      float64 `json:"p95_ai_request_ms"` // AI 请求耗时 P95（毫秒）
 }
 
 // TradeOutcome 单笔交易结果
@@ -470,25 +765,47 @@ type TradeOutcome struct {
 	OpenTime      time.Time `json:"open_time"`      // 开仓时间
 	CloseTime     time.Time `json:"close_time"`     // 平仓时间
 	WasStopLoss   bool      `json:"was_stop_loss"`  // 是否止损
+	SlippageCost  float64   `json:"slippage_cost"`  // 开仓+平仓滑点成本（USDT，已计入 PnL）
+	FundingPaid   float64   `json:"funding_paid"`   // 持仓期间累计资金费（USDT，正数为支付，已计入 PnL）
 
 	// Prompt 版本标识（用于追溯和分组）
 	PromptHash string `json:"prompt_hash,omitempty"` // SystemPrompt 的 MD5 hash
+
+	// 开仓时的波动率状态（用于按行情状态分组统计）
+	Regime string `json:"regime,omitempty"`
 }
 
 // PerformanceAnalysis 交易表现分析
+
 type PerformanceAnalysis struct {
-	TotalTrades   int                           `json:"total_trades"`   // 总交易数
-	WinningTrades int                           `json:"winning_trades"` // 盈利交易数
-	LosingTrades  int                           `json:"losing_trades"`  // 亏损交易数
-	WinRate       float64                       `json:"win_rate"`       // 胜率
-	AvgWin        float64                       `json:"avg_win"`        // 平均盈利
-	AvgLoss       float64                       `json:"avg_loss"`       // 平均亏损
-	ProfitFactor  float64                       `json:"profit_factor"`  // 盈亏比
-	SharpeRatio   float64                       `json:"sharpe_ratio"`   // 夏普比率（风险调整后收益）
-	RecentTrades  []TradeOutcome                `json:"recent_trades"`  // 最近N笔交易
-	SymbolStats   map[string]*SymbolPerformance `json:"symbol_stats"`   // 各币种表现
-	BestSymbol    string                        `json:"best_symbol"`    // 表现最好的币种
-	WorstSymbol   string                        `json:"worst_symbol"`   // 表现最差的币种
+	TotalTrades           int                           `json:"total_trades"`             // 总交易数
+	WinningTrades         int                           `json:"winning_trades"`           // 盈利交易数
+	LosingTrades          int                           `json:"losing_trades"`            // 亏损交易数
+	WinRate               float64                       `json:"win_rate"`                 // 胜率
+	AvgWin                float64                       `json:"avg_win"`                  // 平均盈利
+	AvgLoss               float64                       `json:"avg_loss"`                 // 平均亏损
+	ProfitFactor          float64                       `json:"profit_factor"`            // 盈亏比
+	SharpeRatio           float64                       `json:"sharpe_ratio"`             // 夏普比率（风险调整后收益）
+	TotalSlippageCost     float64                       `json:"total_slippage_cost"`      // 滑点总成本（USDT）
+	Skewness              float64                       `json:"skewness"`                 // 单笔收益率偏度（负值表示左尾更长）
+	Kurtosis              float64                       `json:"kurtosis"`                 // 单笔收益率超额峰度（正态分布为 0，越大尾部越厚）
+	MaxDrawdownPct        float64                       `json:"max_drawdown_pct"`         // 按交易重建净值曲线的最大回撤百分比
+	CalmarRatio           float64                       `json:"calmar_ratio"`             // 总收益率 / 最大回撤（单位回撤的收益）
+	RecoveryFactor        float64                       `json:"recovery_factor"`          // 恢复因子 = 净盈亏 / 最大回撤金额（USDT）
+	KellyFraction         float64                       `json:"kelly_fraction"`           // 建议 Kelly 仓位比例 [0, 1]（样本不足或无亏损时为 0）
+	Expectancy            float64                       `json:"expectancy"`               // 单笔期望盈亏（USDT）= 胜率×平均盈利 + 败率×平均亏损
+	AvgRMultiple          float64                       `json:"avg_r_multiple"`           // 平均 R 倍数（单笔盈亏 / 占用保证金）
+	AvgHoldingMinutes     float64                       `json:"avg_holding_minutes"`      // 平均持仓时长（分钟）
+	MedianHoldingMinutes  float64                       `json:"median_holding_minutes"`   // 持仓时长中位数（分钟）
+	AvgWinHoldingMinutes  float64                       `json:"avg_win_holding_minutes"`  // 盈利交易平均持仓时长（分钟）
+	AvgLossHoldingMinutes float64                       `json:"avg_loss_holding_minutes"` // 亏损交易平均持仓时长（分钟）
+	RecentTrades          []TradeOutcome                `json:"recent_trades"`            // 最近N笔交易
+	SymbolStats           map[string]*SymbolPerformance `json:"symbol_stats"`             // 各币种表现
+	SideStats             map[string]*SymbolPerformance `json:"side_stats"`               // 多空方向表现（key: long/short，Symbol 字段为方向）
+	BestSymbol            string                        `json:"best_symbol"`              // 表现最好的币种
+	WorstSymbol           string                        `json:"worst_symbol"`             // 表现最差的币种
+	BestTrade             *TradeOutcome                 `json:"best_trade,omitempty"`     // 盈亏最高的单笔交易（副本）
+	WorstTrade            *TradeOutcome                 `json:"worst_trade,omitempty"`    // 盈亏最低的单笔交易（副本）
 }
 
 // SymbolPerformance 币种表现统计
@@ -500,6 +817,7 @@ type SymbolPerformance struct {
 	WinRate       float64 `json:"win_rate"`       // 胜率
 	TotalPnL      float64 `json:"total_pn_l"`     // 总盈亏
 	AvgPnL        float64 `json:"avg_pn_l"`       // 平均盈亏
+	KellyFraction float64 `json:"kelly_fraction"` // 建议 Kelly 仓位比例 [0, 1]
 }
 
 // getTakerFeeRate 获取交易所的Taker费率
@@ -521,34 +839,107 @@ func getTakerFeeRate(exchange string) float64 {
 	}
 }
 
+// getMakerFeeRate 获取交易所的Maker费率（费率档位同 getTakerFeeRate）
+func getMakerFeeRate(exchange string) float64 {
+	switch exchange {
+	case "aster":
+		return 0.0001 // 0.010%
+	case "hyperliquid":
+		return 0.00015 // 0.015%
+	case "binance":
+		return 0.0002 // 0.020%
+	default:
+		// 对于未知交易所，使用保守估计（Binance费率）
+		return 0.0002
+	}
+}
+
+// takerFeeRate 获取交易所的Taker费率，优先使用构造时传入的覆盖值
+func (l *DecisionLogger) takerFeeRate(exchange string) float64 {
+	if rate, ok := l.takerFeeRates[exchange]; ok {
+		return rate
+	}
+	return getTakerFeeRate(exchange)
+}
+
+// makerFeeRate 获取交易所的Maker费率，优先使用构造时传入的覆盖值
+func (l *DecisionLogger) makerFeeRate(exchange string) float64 {
+	if rate, ok := l.makerFeeRates[exchange]; ok {
+		return rate
+	}
+	return getMakerFeeRate(exchange)
+}
+
+// closeFeeRate 平仓手续费率：Maker 成交用 Maker 费率，否则用 Taker 费率（均支持按交易所覆盖）
+func (l *DecisionLogger) closeFeeRate(exchange string, isMaker bool) float64 {
+	if isMaker {
+		return l.makerFeeRate(exchange)
+	}
+	return l.takerFeeRate(exchange)
+}
+
 // AnalyzePerformance 分析最近N个周期的交易表现
 func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAnalysis, error) {
+	analysis, _, err := l.analyzePerformance(lookbackCycles, true)
+	return analysis, err
+}
+
+// analyzePerformance 扫描决策文件重建交易，额外返回完整交易列表（最新的在前，不受 RecentTrades 截断影响）
+// updateCache 为 false 时只读不写缓存（用于一致性校验）
+func (l *DecisionLogger) analyzePerformance(lookbackCycles int, updateCache bool) (*PerformanceAnalysis, []TradeOutcome, error) {
 	records, err := l.GetLatestRecords(lookbackCycles)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取历史记录失败: %w", err)
+	}
+
+	// 为了避免开仓记录在窗口外导致匹配失败，获取更多历史记录来构建完整的持仓状态（使用更大的窗口）
+	allRecords, err := l.GetLatestRecords(lookbackCycles * 3) // 扩大3倍窗口
+	if err != nil {
+		allRecords = nil
+	}
+
+	analysis, allTrades := l.analyzeRecords(records, allRecords, updateCache)
+	return analysis, allTrades, nil
+}
+
+// AnalyzePerformanceRange 分析 [start, end) 时间窗口内的交易表现
+// 只统计开仓与平仓都落在窗口内的交易，不写入缓存
+func (l *DecisionLogger) AnalyzePerformanceRange(start, end time.Time) (*PerformanceAnalysis, error) {
+	records, err := l.GetRecordsByDateRange(start, end)
 	if err != nil {
 		return nil, fmt.Errorf("读取历史记录失败: %w", err)
 	}
+	analysis, _ := l.analyzeRecords(records, nil, false)
+	return analysis, nil
+}
 
+// analyzeRecords 按时间顺序重放决策记录重建交易，返回分析结果与完整交易列表（最新的在前）
+// prefillRecords 用于预先收集窗口外的开仓记录（需覆盖 records），为空时只匹配窗口内的开平仓
+func (l *DecisionLogger) analyzeRecords(records, prefillRecords []*DecisionRecord, updateCache bool) (*PerformanceAnalysis, []TradeOutcome) {
 	if len(records) == 0 {
 		return &PerformanceAnalysis{
 			RecentTrades: []TradeOutcome{},
 			SymbolStats:  make(map[string]*SymbolPerformance),
+			SideStats:    make(map[string]*SymbolPerformance),
 		}, nil
 	}
 
 	analysis := &PerformanceAnalysis{
 		RecentTrades: []TradeOutcome{},
 		SymbolStats:  make(map[string]*SymbolPerformance),
+		SideStats:    make(map[string]*SymbolPerformance),
 	}
 
+	// 总盈利 / 总亏损（负数）单独累加，不借用 AvgWin/AvgLoss 字段
+	var grossProfit, grossLoss float64
+
 	// 追踪持仓状态：symbol_side -> {side, openPrice, openTime, quantity, leverage}
 	openPositions := make(map[string]map[string]interface{})
 
 	// 为了避免开仓记录在窗口外导致匹配失败，需要先从所有历史记录中找出未平仓的持仓
-	// 获取更多历史记录来构建完整的持仓状态（使用更大的窗口）
-	allRecords, err := l.GetLatestRecords(lookbackCycles * 3) // 扩大3倍窗口
-	if err == nil && len(allRecords) >= len(records) {
+	if len(prefillRecords) >= len(records) {
 		// 先从扩大的窗口中收集所有开仓记录
-		for _, record := range allRecords {
+		for _, record := range prefillRecords {
 			for _, action := range record.Decisions {
 				if !action.Success {
 					continue
@@ -583,6 +974,8 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 						"openTime":  action.Timestamp,
 						"quantity":  action.Quantity,
 						"leverage":  action.Leverage,
+						"slippage":  action.Slippage,
+						"regime":    action.Regime,
 					}
 				case "close_long", "close_short", "auto_close_long", "auto_close_short":
 					// 移除已平仓记录
@@ -625,15 +1018,18 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 			case "open_long", "open_short":
 				// 更新开仓记录（可能已经在预填充时记录过了）
 				openPositions[posKey] = map[string]interface{}{
-					"side":               side,
-					"openPrice":          action.Price,
-					"openTime":           action.Timestamp,
-					"quantity":           action.Quantity,
-					"leverage":           action.Leverage,
-					"remainingQuantity":  action.Quantity, // 🔧 BUG FIX：追蹤剩餘數量
-					"accumulatedPnL":     0.0,             // 🔧 BUG FIX：累積部分平倉盈虧
-					"partialCloseCount":  0,               // 🔧 BUG FIX：部分平倉次數
-					"partialCloseVolume": 0.0,             // 🔧 BUG FIX：部分平倉總量
+					"side":                side,
+					"openPrice":           action.Price,
+					"openTime":            action.Timestamp,
+					"quantity":            action.Quantity,
+					"leverage":            action.Leverage,
+					"remainingQuantity":   action.Quantity, // 🔧 BUG FIX：追蹤剩餘數量
+					"accumulatedPnL":      0.0,             // 🔧 BUG FIX：累積部分平倉盈虧
+					"partialCloseCount":   0,               // 🔧 BUG FIX：部分平倉次數
+					"partialCloseVolume":  0.0,             // 🔧 BUG FIX：部分平倉總量
+					"slippage":            action.Slippage, // 开仓单位滑点
+					"accumulatedSlippage": 0.0,             // 累积部分平仓滑点成本
+					"regime":              action.Regime,   // 开仓时的波动率状态
 				}
 
 			case "close_long", "close_short", "partial_close", "auto_close_long", "auto_close_short":
@@ -653,6 +1049,10 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 					accumulatedPnL, _ := openPos["accumulatedPnL"].(float64)
 					partialCloseCount, _ := openPos["partialCloseCount"].(int)
 					partialCloseVolume, _ := openPos["partialCloseVolume"].(float64)
+					entrySlippage, _ := openPos["slippage"].(float64)
+					accumulatedSlippage, _ := openPos["accumulatedSlippage"].(float64)
+					accumulatedFunding, _ := openPos["accumulatedFunding"].(float64)
+					entryRegime, _ := openPos["regime"].(string)
 
 					// 对于 partial_close，使用实际平仓数量；否则使用剩余仓位数量
 					actualQuantity := remainingQty
@@ -670,16 +1070,22 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 
 					// ⚠️ 扣除交易手续费（开仓 + 平仓各一次）
 					// 获取交易所费率（从record中获取，如果没有则使用默认值）
-					feeRate := getTakerFeeRate(record.Exchange)
-					openFee := actualQuantity * openPrice * feeRate   // 开仓手续费
-					closeFee := actualQuantity * action.Price * feeRate // 平仓手续费
+					feeRate := l.takerFeeRate(record.Exchange)
+					openFee := actualQuantity * openPrice * feeRate                                             // 开仓手续费
+					closeFee := actualQuantity * action.Price * l.closeFeeRate(record.Exchange, action.IsMaker) // 平仓手续费（Maker 成交用 Maker 费率）
 					totalFees := openFee + closeFee
 					pnl -= totalFees // 从盈亏中扣除手续费
+					pnl -= action.FundingPaid // 扣除本次平仓记录的资金费
+
+					// 滑点成本（开仓 + 平仓），成交价已包含滑点，这里只做单独统计
+					slippageCost := actualQuantity * (entrySlippage + action.Slippage)
 
 					// 🔧 BUG FIX：處理 partial_close 聚合邏輯
 					if action.Action == "partial_close" {
 						// 累積盈虧和數量
 						accumulatedPnL += pnl
+						accumulatedSlippage += slippageCost
+						accumulatedFunding += action.FundingPaid
 						remainingQty -= actualQuantity
 						partialCloseCount++
 						partialCloseVolume += actualQuantity
@@ -689,6 +1095,8 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 						openPos["accumulatedPnL"] = accumulatedPnL
 						openPos["partialCloseCount"] = partialCloseCount
 						openPos["partialCloseVolume"] = partialCloseVolume
+						openPos["accumulatedSlippage"] = accumulatedSlippage
+						openPos["accumulatedFunding"] = accumulatedFunding
 
 						// 判斷是否已完全平倉
 						if remainingQty <= 0.0001 { // 使用小閾值避免浮點誤差
@@ -714,21 +1122,27 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 								Duration:      action.Timestamp.Sub(openTime).String(),
 								OpenTime:      openTime,
 								CloseTime:     action.Timestamp,
+								SlippageCost:  accumulatedSlippage,
+								FundingPaid:   accumulatedFunding,
+								Regime:        entryRegime,
 							}
 
 							analysis.RecentTrades = append(analysis.RecentTrades, outcome)
 							analysis.TotalTrades++ // 🔧 只在完全平倉時計數
+							analysis.TotalSlippageCost += accumulatedSlippage
 
 							// 🚀 添加到内存缓存
-							l.AddTradeToCache(outcome)
+							if updateCache {
+								l.AddTradeToCache(outcome)
+							}
 
 							// 分类交易
 							if accumulatedPnL > 0 {
 								analysis.WinningTrades++
-								analysis.AvgWin += accumulatedPnL
+								grossProfit += accumulatedPnL
 							} else if accumulatedPnL < 0 {
 								analysis.LosingTrades++
-								analysis.AvgLoss += accumulatedPnL
+								grossLoss += accumulatedPnL
 							}
 
 							// 更新币种统计
@@ -746,6 +1160,21 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 								stats.LosingTrades++
 							}
 
+							// 更新方向统计
+							if _, exists := analysis.SideStats[side]; !exists {
+								analysis.SideStats[side] = &SymbolPerformance{
+									Symbol: side,
+								}
+							}
+							sideStats := analysis.SideStats[side]
+							sideStats.TotalTrades++
+							sideStats.TotalPnL += accumulatedPnL
+							if accumulatedPnL > 0 {
+								sideStats.WinningTrades++
+							} else if accumulatedPnL < 0 {
+								sideStats.LosingTrades++
+							}
+
 							// 刪除持倉記錄
 							delete(openPositions, posKey)
 						}
@@ -755,6 +1184,7 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 						// 🔧 完全平倉（close_long/close_short/auto_close）
 						// 如果之前有部分平倉，需要加上累積的 PnL
 						totalPnL := accumulatedPnL + pnl
+						totalSlippage := accumulatedSlippage + slippageCost
 
 						positionValue := quantity * openPrice
 						marginUsed := positionValue / float64(leverage)
@@ -777,21 +1207,27 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 							Duration:      action.Timestamp.Sub(openTime).String(),
 							OpenTime:      openTime,
 							CloseTime:     action.Timestamp,
+							SlippageCost:  totalSlippage,
+							FundingPaid:   accumulatedFunding + action.FundingPaid,
+							Regime:        entryRegime,
 						}
 
 						analysis.RecentTrades = append(analysis.RecentTrades, outcome)
 						analysis.TotalTrades++
+						analysis.TotalSlippageCost += totalSlippage
 
 						// 🚀 添加到内存缓存
-						l.AddTradeToCache(outcome)
+						if updateCache {
+							l.AddTradeToCache(outcome)
+						}
 
 						// 分类交易
 						if totalPnL > 0 {
 							analysis.WinningTrades++
-							analysis.AvgWin += totalPnL
+							grossProfit += totalPnL
 						} else if totalPnL < 0 {
 							analysis.LosingTrades++
-							analysis.AvgLoss += totalPnL
+							grossLoss += totalPnL
 						}
 
 						// 更新币种统计
@@ -809,6 +1245,21 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 							stats.LosingTrades++
 						}
 
+						// 更新方向统计
+						if _, exists := analysis.SideStats[side]; !exists {
+							analysis.SideStats[side] = &SymbolPerformance{
+								Symbol: side,
+							}
+						}
+						sideStats := analysis.SideStats[side]
+						sideStats.TotalTrades++
+						sideStats.TotalPnL += totalPnL
+						if totalPnL > 0 {
+							sideStats.WinningTrades++
+						} else if totalPnL < 0 {
+							sideStats.LosingTrades++
+						}
+
 						// 刪除持倉記錄
 						delete(openPositions, posKey)
 					}
@@ -821,45 +1272,46 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 	if analysis.TotalTrades > 0 {
 		analysis.WinRate = (float64(analysis.WinningTrades) / float64(analysis.TotalTrades)) * 100
 
-		// 计算总盈利和总亏损
-		totalWinAmount := analysis.AvgWin   // 当前是累加的总和
-		totalLossAmount := analysis.AvgLoss // 当前是累加的总和（负数）
-
 		if analysis.WinningTrades > 0 {
-			analysis.AvgWin /= float64(analysis.WinningTrades)
+			analysis.AvgWin = grossProfit / float64(analysis.WinningTrades)
 		}
 		if analysis.LosingTrades > 0 {
-			analysis.AvgLoss /= float64(analysis.LosingTrades)
+			analysis.AvgLoss = grossLoss / float64(analysis.LosingTrades)
 		}
 
 		// Profit Factor = 总盈利 / 总亏损（绝对值）
-		// 注意：totalLossAmount 是负数，所以取负号得到绝对值
-		if totalLossAmount != 0 {
-			analysis.ProfitFactor = totalWinAmount / (-totalLossAmount)
-		} else if totalWinAmount > 0 {
+		if grossLoss != 0 {
+			analysis.ProfitFactor = grossProfit / math.Abs(grossLoss)
+		} else if grossProfit > 0 {
 			// 只有盈利没有亏损的情况，设置为一个很大的值表示完美策略
 			analysis.ProfitFactor = 999.0
 		}
 	}
 
 	// 计算各币种胜率和平均盈亏
-	bestPnL := -999999.0
-	worstPnL := 999999.0
-	for symbol, stats := range analysis.SymbolStats {
+	for _, stats := range analysis.SymbolStats {
+		if stats.TotalTrades > 0 {
+			stats.WinRate = (float64(stats.WinningTrades) / float64(stats.TotalTrades)) * 100
+			stats.AvgPnL = stats.TotalPnL / float64(stats.TotalTrades)
+		}
+	}
+	for _, stats := range analysis.SideStats {
 		if stats.TotalTrades > 0 {
 			stats.WinRate = (float64(stats.WinningTrades) / float64(stats.TotalTrades)) * 100
 			stats.AvgPnL = stats.TotalPnL / float64(stats.TotalTrades)
-
-			if stats.TotalPnL > bestPnL {
-				bestPnL = stats.TotalPnL
-				analysis.BestSymbol = symbol
-			}
-			if stats.TotalPnL < worstPnL {
-				worstPnL = stats.TotalPnL
-				analysis.WorstSymbol = symbol
-			}
 		}
 	}
+	analysis.BestSymbol, analysis.WorstSymbol = selectBestWorstSymbols(analysis.SymbolStats)
+
+	allTrades := make([]TradeOutcome, len(analysis.RecentTrades))
+	for i, trade := range analysis.RecentTrades {
+		allTrades[len(allTrades)-1-i] = trade
+	}
+	analysis.MaxDrawdownPct = calculateMaxDrawdownFromTrades(allTrades)
+	analysis.CalmarRatio = calculateCalmarRatio(allTrades, analysis.MaxDrawdownPct)
+	analysis.RecoveryFactor = calculateRecoveryFactor(allTrades)
+	analysis.Expectancy, analysis.AvgRMultiple = calculateExpectancy(analysis, allTrades)
+	applyHoldingStats(analysis, allTrades)
 
 	// 只保留最近的交易（倒序：最新的在前）
 	if len(analysis.RecentTrades) > 10 {
@@ -878,7 +1330,36 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 	// 计算夏普比率（需要至少2个数据点）
 	analysis.SharpeRatio = l.calculateSharpeRatio(records)
 
-	return analysis, nil
+	return analysis, allTrades
+}
+
+// selectBestWorstSymbols 按总盈亏选出表现最好/最差的币种
+// 为避免 map 遍历顺序导致结果不稳定，先按币种名排序再比较：
+// 总盈亏相同时，取字母序靠前的币种（最好/最差均如此）
+func selectBestWorstSymbols(symbolStats map[string]*SymbolPerformance) (best, worst string) {
+	symbols := make([]string, 0, len(symbolStats))
+	for symbol, stats := range symbolStats {
+		if stats.TotalTrades > 0 {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Strings(symbols)
+
+	bestPnL := math.Inf(-1)
+	worstPnL := math.Inf(1)
+	for _, symbol := range symbols {
+		pnl := symbolStats[symbol].TotalPnL
+		// 严格比较：相同盈亏保留先遇到（字母序靠前）的币种
+		if pnl > bestPnL {
+			bestPnL = pnl
+			best = symbol
+		}
+		if pnl < worstPnL {
+			worstPnL = pnl
+			worst = symbol
+		}
+	}
+	return best, worst
 }
 
 // calculateSharpeRatio 计算夏普比率
@@ -933,28 +1414,35 @@ func (l *DecisionLogger) calculateSharpeRatio(records []*DecisionRecord) float64
 	variance := sumSquaredDiff / float64(len(returns))
 	stdDev := math.Sqrt(variance)
 
+	// 扣除无风险收益率后的超额收益（默认无风险利率为 0）
+	excessReturn := meanReturn - l.riskFreeRate
+
 	// 避免除以零
 	if stdDev == 0 {
-		if meanReturn > 0 {
+		if excessReturn > 0 {
 			return 999.0 // 无波动的正收益
-		} else if meanReturn < 0 {
+		} else if excessReturn < 0 {
 			return -999.0 // 无波动的负收益
 		}
 		return 0.0
 	}
 
-	// 计算夏普比率（假设无风险利率为0）
-	// 注：直接返回周期级别的夏普比率（非年化），正常范围 -2 到 +2
-	sharpeRatio := meanReturn / stdDev
+	// 计算夏普比率
+	// 注：默认返回周期级别的夏普比率（非年化），正常范围 -2 到 +2；设置 periodsPerYear 后年化
+	sharpeRatio := excessReturn / stdDev
+	return l.annualizeSharpe(sharpeRatio)
+}
+
+// annualizeSharpe 按每年周期数年化夏普比率（乘以 sqrt(periodsPerYear)），未设置时原样返回
+func (l *DecisionLogger) annualizeSharpe(sharpeRatio float64) float64 {
+	if l.periodsPerYear > 0 {
+		return sharpeRatio * math.Sqrt(l.periodsPerYear)
+	}
 	return sharpeRatio
 }
 
 // updateCacheFromDecision 从决策记录中检测交易完成并主动更新缓存
-//
-// ⚠️ LIMITATION: 暂不支持 partial_close
-// - 原因: partial_close 需要累积多次平仓的盈亏，逻辑复杂
-// - 临时方案: 依赖 AnalyzePerformance 在完全平仓时聚合 partial_close 记录并添加到缓存
-// - 相关 Issue: https://github.com/NoFxAiOS/nofx/issues/1032
+// partial_close 累积到持仓上，剩余数量归零时才作为一笔完整交易写入缓存（Issue #1032）
 func (l *DecisionLogger) updateCacheFromDecision(record *DecisionRecord) {
 	if !record.Success || len(record.Decisions) == 0 {
 		return
@@ -975,15 +1463,17 @@ func (l *DecisionLogger) updateCacheFromDecision(record *DecisionRecord) {
 
 			l.positionMutex.Lock()
 			l.openPositions[decision.Symbol] = &OpenPosition{
-				Symbol:     decision.Symbol,
-				Side:       side,
-				Quantity:   decision.Quantity,
-				EntryPrice: decision.Price,
-				Leverage:   decision.Leverage,
-				OpenTime:   decision.Timestamp,
-				Exchange:   record.Exchange,
-				StopLoss:   decision.StopLoss,   // Issue #102: 记录止损
-				TakeProfit: decision.TakeProfit, // Issue #102: 记录止盈
+				Symbol:        decision.Symbol,
+				Side:          side,
+				Quantity:      decision.Quantity,
+				EntryPrice:    decision.Price,
+				Leverage:      decision.Leverage,
+				OpenTime:      decision.Timestamp,
+				Exchange:      record.Exchange,
+				StopLoss:      decision.StopLoss,   // Issue #102: 记录止损
+				TakeProfit:    decision.TakeProfit, // Issue #102: 记录止盈
+				EntrySlippage: decision.Slippage,
+				EntryRegime:   decision.Regime,
 			}
 			l.positionMutex.Unlock()
 
@@ -1003,6 +1493,21 @@ func (l *DecisionLogger) updateCacheFromDecision(record *DecisionRecord) {
 			}
 			l.positionMutex.Unlock()
 
+		case "partial_close":
+			// 累积部分平仓盈亏，剩余数量归零时按完全平仓处理
+			l.positionMutex.Lock()
+			openPos, exists := l.openPositions[decision.Symbol]
+			if !exists || !l.applyPartialClose(openPos, decision, record.Exchange) {
+				l.positionMutex.Unlock()
+				continue
+			}
+
+			trade := l.calculateTrade(openPos, decision, record.Exchange, record.PromptHash, openPos.FundingPaid)
+			delete(l.openPositions, decision.Symbol)
+			l.positionMutex.Unlock()
+
+			l.AddTradeToCache(trade)
+
 		case "close_long", "close_short", "auto_close_long", "auto_close_short":
 			// 检测平仓，计算交易并添加到缓存
 			l.positionMutex.Lock()
@@ -1012,8 +1517,8 @@ func (l *DecisionLogger) updateCacheFromDecision(record *DecisionRecord) {
 				continue
 			}
 
-			// 计算交易结果（包含 PromptHash）
-			trade := l.calculateTrade(openPos, decision, record.Exchange, record.PromptHash)
+			// 计算交易结果（包含 PromptHash），资金费 = 部分平仓已记录的 + 本次平仓记录的
+			trade := l.calculateTrade(openPos, decision, record.Exchange, record.PromptHash, openPos.FundingPaid+decision.FundingPaid)
 
 			// 移除已平仓的持仓
 			delete(l.openPositions, decision.Symbol)
@@ -1067,15 +1572,17 @@ func (l *DecisionLogger) recoverOpenPositions() error {
 				}{
 					action: "open",
 					position: &OpenPosition{
-						Symbol:     decision.Symbol,
-						Side:       side,
-						Quantity:   decision.Quantity,
-						EntryPrice: decision.Price,
-						Leverage:   decision.Leverage,
-						OpenTime:   decision.Timestamp,
-						Exchange:   record.Exchange,
-						StopLoss:   decision.StopLoss,   // Issue #102: 恢复止损
-						TakeProfit: decision.TakeProfit, // Issue #102: 恢复止盈
+						Symbol:        decision.Symbol,
+						Side:          side,
+						Quantity:      decision.Quantity,
+						EntryPrice:    decision.Price,
+						Leverage:      decision.Leverage,
+						OpenTime:      decision.Timestamp,
+						Exchange:      record.Exchange,
+						StopLoss:      decision.StopLoss,   // Issue #102: 恢复止损
+						TakeProfit:    decision.TakeProfit, // Issue #102: 恢复止盈
+						EntrySlippage: decision.Slippage,
+						EntryRegime:   decision.Regime,
 					},
 				}
 
@@ -1091,6 +1598,15 @@ func (l *DecisionLogger) recoverOpenPositions() error {
 					action.position.TakeProfit = decision.NewTakeProfit
 				}
 
+			case "partial_close":
+				// 恢复部分平仓后的剩余数量与累计盈亏，全部平完视为平仓
+				if action, exists := lastAction[decision.Symbol]; exists && action.action == "open" && action.position != nil {
+					if l.applyPartialClose(action.position, decision, record.Exchange) {
+						action.action = "close"
+						action.position = nil
+					}
+				}
+
 			case "close_long", "close_short", "auto_close_long", "auto_close_short":
 				// 记录平仓
 				lastAction[decision.Symbol] = &struct {
@@ -1128,129 +1644,425 @@ func (l *DecisionLogger) recoverOpenPositions() error {
 func (l *DecisionLogger) initializeCacheOnStartup() {
 	fmt.Println("🔄 开始初始化缓存和持仓...")
 
-	// 1. 扫描历史文件填充 tradesCache
-	if _, err := l.AnalyzePerformance(InitialScanCycles); err != nil {
-		fmt.Printf("⚠ 初始化缓存失败: %v\n", err)
-		// 不 return,继续尝试恢复持仓
-	} else {
-		cacheSize := len(l.tradesCache)
-		if cacheSize > 0 {
-			fmt.Printf("✅ 缓存已初始化: %d 笔交易\n", cacheSize)
+	// 1. 启动快照存在时，交易取自持久化交易缓存、持仓取自快照，只回放快照之后的决策文件；否则全量扫描
+	//    prefer_scan 策略需要扫描结果参与对账，始终全量扫描
+	snapshotPath := filepath.Join(l.logDir, tradeStoreDir, cacheSnapshotFile)
+	var snapshot *cacheSnapshot
+	if l.duplicatePolicy != DuplicateTradePreferScan {
+		var err error
+		if snapshot, err = loadCacheSnapshot(snapshotPath); err != nil {
+			fmt.Printf("⚠ 加载启动快照失败，回退全量扫描: %v\n", err)
 		}
 	}
 
-	// 2. 恢复未平仓的持仓到 l.openPositions
-	//    确保后续平仓操作能正确匹配
-	if err := l.recoverOpenPositions(); err != nil {
-		fmt.Printf("⚠ 恢复持仓失败: %v\n", err)
+	if snapshot == nil {
+		if _, err := l.AnalyzePerformance(InitialScanCycles); err != nil {
+			fmt.Printf("⚠ 初始化缓存失败: %v\n", err)
+			// 不 return,继续尝试恢复持仓
+		} else {
+			cacheSize := len(l.tradesCache)
+			if cacheSize > 0 {
+				fmt.Printf("✅ 缓存已初始化: %d 笔交易\n", cacheSize)
+			}
+		}
 	}
-}
 
-// filterByPromptHash 过滤交易，只保留匹配指定 PromptHash 的交易
-func filterByPromptHash(trades []TradeOutcome, promptHash string) []TradeOutcome {
-	if promptHash == "" {
-		// 如果 hash 为空，返回所有交易（向后兼容）
-		return trades
+	// 2. 与持久化交易缓存对账去重，避免崩溃重启后同一笔交易被重复计入
+	if err := l.reconcileTradesOnStartup(); err != nil {
+		fmt.Printf("⚠ 交易缓存对账失败: %v\n", err)
 	}
 
-	filtered := make([]TradeOutcome, 0, len(trades))
-	for _, trade := range trades {
-		if trade.PromptHash == promptHash {
-			filtered = append(filtered, trade)
+	// 3. 恢复未平仓的持仓到 l.openPositions，确保后续平仓操作能正确匹配
+	cutoff := ""
+	if snapshot != nil {
+		l.positionMutex.Lock()
+		for symbol, pos := range snapshot.OpenPositions {
+			if pos != nil {
+				l.openPositions[symbol] = pos
+			}
 		}
-	}
-	return filtered
-}
+		l.positionMutex.Unlock()
 
-// calculateSharpeRatioFromTrades 从交易列表计算夏普比率
-// 用于替代 calculateSharpeRatioFromEquity，支持基于过滤后的交易计算
-func (l *DecisionLogger) calculateSharpeRatioFromTrades(trades []TradeOutcome) float64 {
-	if len(trades) < 2 {
-		return 0.0
+		// 补齐快照之后写入、但崩溃前未处理的决策文件（重复的交易按交易键去重）
+		replayed, last, err := l.replayDecisionFilesAfter(snapshot.LastFile)
+		if err != nil {
+			fmt.Printf("⚠ 增量回放决策文件失败: %v\n", err)
+		}
+		cutoff = last
+		fmt.Printf("✅ 已从启动快照恢复: %d 笔交易（增量回放 %d 个决策文件）\n", len(l.tradesCache), replayed)
+	} else {
+		if err := l.recoverOpenPositions(); err != nil {
+			fmt.Printf("⚠ 恢复持仓失败: %v\n", err)
+		}
+		if names, err := l.decisionFilesAfter(""); err == nil && len(names) > 0 {
+			cutoff = names[len(names)-1]
+		}
 	}
 
-	// 从交易重建 equity 序列
-	// 假设初始资金（这里用一个合理的默认值，实际不影响收益率计算）
-	initialEquity := 10000.0
-	equities := make([]float64, len(trades)+1)
-	equities[0] = initialEquity
-
-	for i, trade := range trades {
-		equities[i+1] = equities[i] + trade.PnL
+	// 4. 启用快照写入，并落盘一次初始化结果（尚无决策文件时无需落盘）
+	l.snapshotPath = snapshotPath
+	l.snapshotCutoff = cutoff
+	if cutoff != "" {
+		l.saveCacheSnapshot(cutoff)
 	}
+}
 
-	// 计算周期收益率
-	var returns []float64
-	for i := 1; i < len(equities); i++ {
-		if equities[i-1] > 0 {
-			periodReturn := (equities[i] - equities[i-1]) / equities[i-1]
-			returns = append(returns, periodReturn)
+// loadCacheSnapshot 读取启动快照；文件不存在时返回 nil
+func loadCacheSnapshot(path string) (*cacheSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
 		}
+		return nil, fmt.Errorf("读取启动快照失败: %w", err)
 	}
+	var snapshot cacheSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("解析启动快照失败: %w", err)
+	}
+	return &snapshot, nil
+}
 
-	if len(returns) == 0 {
-		return 0.0
+// saveCacheSnapshot 记录处理完 lastFile 后的持仓状态（先写临时文件再替换）
+// 每个决策周期调用一次，只复制持仓后在锁外写盘，不阻塞交易缓存读写
+func (l *DecisionLogger) saveCacheSnapshot(lastFile string) {
+	if l.snapshotPath == "" {
+		return
 	}
 
-	// 计算平均收益率
-	var sum float64
-	for _, r := range returns {
-		sum += r
+	l.snapshotMutex.Lock()
+	defer l.snapshotMutex.Unlock()
+
+	// 并发写入时回放起点只前进不后退
+	if lastFile < l.snapshotCutoff {
+		lastFile = l.snapshotCutoff
 	}
-	meanReturn := sum / float64(len(returns))
 
-	// 计算收益率标准差
-	sumSquaredDiff := 0.0
-	for _, r := range returns {
+	snapshot := cacheSnapshot{OpenPositions: make(map[string]*OpenPosition), LastFile: lastFile}
+	l.positionMutex.RLock()
+	for symbol, pos := range l.openPositions {
+		copied := *pos
+		snapshot.OpenPositions[symbol] = &copied
+	}
+	l.positionMutex.RUnlock()
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		fmt.Printf("⚠ 序列化启动快照失败: %v\n", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(l.snapshotPath), 0700); err != nil {
+		fmt.Printf("⚠ 创建启动快照目录失败: %v\n", err)
+		return
+	}
+	tmpPath := l.snapshotPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		fmt.Printf("⚠ 写入启动快照失败: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmpPath, l.snapshotPath); err != nil {
+		fmt.Printf("⚠ 写入启动快照失败: %v\n", err)
+		return
+	}
+	l.snapshotCutoff = lastFile
+}
+
+// decisionFilesAfter 返回文件名排在 cutoff 之后的决策文件（按文件名即时间顺序）
+func (l *DecisionLogger) decisionFilesAfter(cutoff string) ([]string, error) {
+	files, err := ioutil.ReadDir(l.logDir)
+	if err != nil {
+		return nil, fmt.Errorf("读取日志目录失败: %w", err)
+	}
+	var names []string
+	for _, file := range files {
+		if file.IsDir() || file.Name() <= cutoff {
+			continue
+		}
+		if _, ok := decisionFileTime(file.Name()); ok {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// replayDecisionFilesAfter 按时间顺序回放 cutoff 之后的决策文件，返回回放的文件数与新的回放起点
+func (l *DecisionLogger) replayDecisionFilesAfter(cutoff string) (int, string, error) {
+	names, err := l.decisionFilesAfter(cutoff)
+	if err != nil {
+		return 0, cutoff, err
+	}
+
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(l.logDir, name))
+		if err != nil {
+			continue
+		}
+		l.decisionFileReads.Add(1)
+		var record DecisionRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			continue
+		}
+		l.updateCacheFromDecision(&record)
+	}
+	if len(names) > 0 {
+		cutoff = names[len(names)-1]
+	}
+	return len(names), cutoff, nil
+}
+
+// decisionFileTime 从决策文件名 decision_YYYYMMDD_HHMMSS_cycleN.json 解析记录时间
+func decisionFileTime(name string) (time.Time, bool) {
+	const prefix = "decision_"
+	const layout = "20060102_150405"
+	if !strings.HasPrefix(name, prefix) || len(name) < len(prefix)+len(layout) {
+		return time.Time{}, false
+	}
+	ts, err := time.ParseInLocation(layout, name[len(prefix):len(prefix)+len(layout)], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return ts, true
+}
+
+// reconcileTradesOnStartup 合并持久化交易缓存与决策文件扫描结果
+// 使用 symbol_side_openTime_closeTime 作为唯一键去重，重复时按 duplicatePolicy 选择保留版本，
+// 合并结果重写回持久化文件，此后新增交易才会追加写入
+func (l *DecisionLogger) reconcileTradesOnStartup() error {
+	storePath := filepath.Join(l.logDir, tradeStoreDir, tradeStoreFile)
+	persisted, err := loadPersistedTrades(storePath)
+	if err != nil {
+		return err
+	}
+
+	l.cacheMutex.Lock()
+	defer l.cacheMutex.Unlock()
+
+	merged := make(map[string]TradeOutcome, len(persisted)+len(l.tradesCache))
+	for _, trade := range l.tradesCache {
+		merged[tradeCacheKey(trade)] = trade
+	}
+	duplicates := 0
+	for _, trade := range persisted {
+		key := tradeCacheKey(trade)
+		if _, exists := merged[key]; exists {
+			duplicates++
+			if l.duplicatePolicy == DuplicateTradePreferScan {
+				continue
+			}
+		}
+		merged[key] = trade
+	}
+
+	// 按平仓时间重建缓存（最新的在前）
+	trades := make([]TradeOutcome, 0, len(merged))
+	for _, trade := range merged {
+		trades = append(trades, trade)
+	}
+	sort.Slice(trades, func(i, j int) bool {
+		if !trades[i].CloseTime.Equal(trades[j].CloseTime) {
+			return trades[i].CloseTime.After(trades[j].CloseTime)
+		}
+		return tradeCacheKey(trades[i]) > tradeCacheKey(trades[j])
+	})
+	if len(trades) > l.maxCacheSize {
+		trades = trades[:l.maxCacheSize]
+	}
+	l.tradesCache = trades
+	l.tradeCacheSet = make(map[string]bool, len(trades))
+	for _, trade := range trades {
+		l.tradeCacheSet[tradeCacheKey(trade)] = true
+	}
+
+	if duplicates > 0 {
+		fmt.Printf("🔁 交易缓存对账: 合并 %d 笔重复交易\n", duplicates)
+	}
+
+	if len(trades) > 0 || len(persisted) > 0 {
+		if err := writePersistedTrades(storePath, trades); err != nil {
+			return err
+		}
+	}
+	l.tradeStorePath = storePath
+	return nil
+}
+
+// loadPersistedTrades 读取持久化交易缓存（文件内重复的交易保留最后一条，无法解析的行跳过）
+func loadPersistedTrades(path string) ([]TradeOutcome, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取持久化交易缓存失败: %w", err)
+	}
+
+	index := make(map[string]int)
+	var trades []TradeOutcome
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var trade TradeOutcome
+		if err := json.Unmarshal([]byte(line), &trade); err != nil {
+			continue
+		}
+		key := tradeCacheKey(trade)
+		if i, exists := index[key]; exists {
+			trades[i] = trade
+			continue
+		}
+		index[key] = len(trades)
+		trades = append(trades, trade)
+	}
+	return trades, nil
+}
+
+// writePersistedTrades 按时间正序重写持久化交易缓存（先写临时文件再替换）
+func writePersistedTrades(path string, newestFirst []TradeOutcome) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("创建交易缓存目录失败: %w", err)
+	}
+	var buf strings.Builder
+	for i := len(newestFirst) - 1; i >= 0; i-- {
+		line, err := json.Marshal(newestFirst[i])
+		if err != nil {
+			return fmt.Errorf("序列化交易失败: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(buf.String()), 0600); err != nil {
+		return fmt.Errorf("写入交易缓存失败: %w", err)
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// appendPersistedTrade 追加一笔交易到持久化交易缓存
+func appendPersistedTrade(path string, trade TradeOutcome) error {
+	line, err := json.Marshal(trade)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// filterByPromptHash 过滤交易，只保留匹配指定 PromptHash 的交易
+func filterByPromptHash(trades []TradeOutcome, promptHash string) []TradeOutcome {
+	if promptHash == "" {
+		// 如果 hash 为空，返回所有交易（向后兼容）
+		return trades
+	}
+
+	filtered := make([]TradeOutcome, 0, len(trades))
+	for _, trade := range trades {
+		if trade.PromptHash == promptHash {
+			filtered = append(filtered, trade)
+		}
+	}
+	return filtered
+}
+
+// calculateSharpeRatioFromTrades 从交易列表计算夏普比率
+// 用于替代 calculateSharpeRatioFromEquity，支持基于过滤后的交易计算
+func (l *DecisionLogger) calculateSharpeRatioFromTrades(trades []TradeOutcome) float64 {
+	if len(trades) < 2 {
+		return 0.0
+	}
+
+	// 从交易重建 equity 序列
+	// 假设初始资金（这里用一个合理的默认值，实际不影响收益率计算）
+	initialEquity := 10000.0
+	equities := make([]float64, len(trades)+1)
+	equities[0] = initialEquity
+
+	for i, trade := range trades {
+		equities[i+1] = equities[i] + trade.PnL
+	}
+
+	// 计算周期收益率
+	var returns []float64
+	for i := 1; i < len(equities); i++ {
+		if equities[i-1] > 0 {
+			periodReturn := (equities[i] - equities[i-1]) / equities[i-1]
+			returns = append(returns, periodReturn)
+		}
+	}
+
+	if len(returns) == 0 {
+		return 0.0
+	}
+
+	// 计算平均收益率
+	var sum float64
+	for _, r := range returns {
+		sum += r
+	}
+	meanReturn := sum / float64(len(returns))
+
+	// 计算收益率标准差
+	sumSquaredDiff := 0.0
+	for _, r := range returns {
 		diff := r - meanReturn
 		sumSquaredDiff += diff * diff
 	}
 	variance := sumSquaredDiff / float64(len(returns))
 	stdDev := math.Sqrt(variance)
 
+	// 扣除无风险收益率后的超额收益（默认无风险利率为 0）
+	excessReturn := meanReturn - l.riskFreeRate
+
 	// 避免除以零
 	if stdDev == 0 {
-		if meanReturn > 0 {
+		if excessReturn > 0 {
 			return 999.0 // 无波动的正收益
-		} else if meanReturn < 0 {
+		} else if excessReturn < 0 {
 			return -999.0 // 无波动的负收益
 		}
 		return 0.0
 	}
 
-	// 计算夏普比率（假设无风险利率为0）
-	// 注：直接返回周期级别的夏普比率（非年化），正常范围 -2 到 +2
-	sharpeRatio := meanReturn / stdDev
-	return sharpeRatio
+	// 计算夏普比率
+	// 注：默认返回周期级别的夏普比率（非年化），正常范围 -2 到 +2；设置 periodsPerYear 后年化
+	sharpeRatio := excessReturn / stdDev
+	return l.annualizeSharpe(sharpeRatio)
 }
 
 // calculateTrade 计算完整交易的盈亏和其他指标
-func (l *DecisionLogger) calculateTrade(openPos *OpenPosition, closeDecision DecisionAction, exchange string, promptHash string) TradeOutcome {
+// fundingPaid 为持仓期间累计资金费（正数为支付），无资金费数据时传 0
+// 存在部分平仓时，只结算剩余数量并加上已累计的部分平仓盈亏
+func (l *DecisionLogger) calculateTrade(openPos *OpenPosition, closeDecision DecisionAction, exchange string, promptHash string, fundingPaid float64) TradeOutcome {
 	quantity := openPos.Quantity
 	entryPrice := openPos.EntryPrice
 	exitPrice := closeDecision.Price
 	leverage := openPos.Leverage
 
-	// 计算仓位价值和保证金
+	// 计算仓位价值和保证金（按原始总量）
 	positionValue := quantity * entryPrice
 	marginUsed := positionValue / float64(leverage)
 
-	// 计算原始盈亏（不含手续费）
-	var rawPnL float64
-	if openPos.Side == "long" {
-		rawPnL = (exitPrice - entryPrice) * quantity
-	} else { // short
-		rawPnL = (entryPrice - exitPrice) * quantity
+	closeQuantity := quantity
+	if openPos.PartialCloses > 0 {
+		closeQuantity = openPos.RemainingQuantity
 	}
 
-	// 计算手续费
-	takerFee := getTakerFeeRate(exchange)
-	openFee := positionValue * takerFee
-	closeFee := (quantity * exitPrice) * takerFee
-	totalFee := openFee + closeFee
+	// 最终盈亏 = 部分平仓累计盈亏 + 本次平仓盈亏（已扣手续费）- 资金费
+	legPnL, legSlippage := l.closeLegPnL(openPos, closeQuantity, closeDecision, exchange)
+	finalPnL := openPos.AccumulatedPnL + legPnL - fundingPaid
 
-	// 最终盈亏 = 原始盈亏 - 手续费
-	finalPnL := rawPnL - totalFee
+	// 滑点成本（开仓 + 平仓），已体现在成交价中
+	slippageCost := openPos.AccumulatedSlippage + legSlippage
 
 	// 盈亏百分比（相对保证金）
 	pnlPct := (finalPnL / marginUsed) * 100
@@ -1273,22 +2085,61 @@ func (l *DecisionLogger) calculateTrade(openPos *OpenPosition, closeDecision Dec
 		OpenTime:      openPos.OpenTime,
 		CloseTime:     closeDecision.Timestamp,
 		WasStopLoss:   false, // TODO: 检测是否止损
+		SlippageCost:  slippageCost,
+		FundingPaid:   fundingPaid,
 		PromptHash:    promptHash,
+		Regime:        openPos.EntryRegime,
 	}
 }
 
+// closeLegPnL 计算一次平仓（部分或全部）的盈亏与滑点成本，盈亏已扣除该数量对应的开平仓手续费
+func (l *DecisionLogger) closeLegPnL(openPos *OpenPosition, quantity float64, closeDecision DecisionAction, exchange string) (float64, float64) {
+	entryPrice := openPos.EntryPrice
+	exitPrice := closeDecision.Price
+
+	// 计算原始盈亏（不含手续费）
+	var rawPnL float64
+	if openPos.Side == "long" {
+		rawPnL = (exitPrice - entryPrice) * quantity
+	} else { // short
+		rawPnL = (entryPrice - exitPrice) * quantity
+	}
+
+	// 计算手续费
+	openFee := quantity * entryPrice * l.takerFeeRate(exchange)
+	closeFee := quantity * exitPrice * l.closeFeeRate(exchange, closeDecision.IsMaker)
+
+	slippageCost := quantity * (openPos.EntrySlippage + closeDecision.Slippage)
+	return rawPnL - openFee - closeFee, slippageCost
+}
+
+// applyPartialClose 将一次部分平仓累积到持仓上
+// 剩余数量归零（小于阈值）时返回 true，此时持仓应按完全平仓结算（剩余数量置 0，结算时不再重复计入）
+func (l *DecisionLogger) applyPartialClose(openPos *OpenPosition, decision DecisionAction, exchange string) bool {
+	if openPos.PartialCloses == 0 {
+		openPos.RemainingQuantity = openPos.Quantity
+	}
+	pnl, slippage := l.closeLegPnL(openPos, decision.Quantity, decision, exchange)
+	openPos.AccumulatedPnL += pnl
+	openPos.AccumulatedSlippage += slippage
+	openPos.FundingPaid += decision.FundingPaid
+	openPos.RemainingQuantity -= decision.Quantity
+	openPos.PartialCloses++
+
+	if openPos.RemainingQuantity <= 0.0001 { // 使用小阈值避免浮点误差（与 AnalyzePerformance 一致）
+		openPos.RemainingQuantity = 0
+		return true
+	}
+	return false
+}
+
 // AddTradeToCache 添加交易到内存缓存（带去重）
 func (l *DecisionLogger) AddTradeToCache(trade TradeOutcome) {
 	l.cacheMutex.Lock()
 	defer l.cacheMutex.Unlock()
 
 	// 生成唯一标识：symbol_side_openTime_closeTime
-	tradeKey := fmt.Sprintf("%s_%s_%d_%d",
-		trade.Symbol,
-		trade.Side,
-		trade.OpenTime.Unix(),
-		trade.CloseTime.Unix(),
-	)
+	tradeKey := tradeCacheKey(trade)
 
 	// 检查是否已存在（去重）
 	if l.tradeCacheSet[tradeKey] {
@@ -1299,21 +2150,33 @@ func (l *DecisionLogger) AddTradeToCache(trade TradeOutcome) {
 	l.tradesCache = append([]TradeOutcome{trade}, l.tradesCache...)
 	l.tradeCacheSet[tradeKey] = true
 
+	// 启动对账完成后，新交易同步追加到持久化缓存
+	if l.tradeStorePath != "" {
+		if err := appendPersistedTrade(l.tradeStorePath, trade); err != nil {
+			fmt.Printf("⚠ 写入持久化交易缓存失败: %v\n", err)
+		}
+	}
+
 	// 限制缓存大小，超出部分丢弃
 	if len(l.tradesCache) > l.maxCacheSize {
 		// 移除最后一条记录（最旧的）
 		removedTrade := l.tradesCache[l.maxCacheSize]
-		removedKey := fmt.Sprintf("%s_%s_%d_%d",
-			removedTrade.Symbol,
-			removedTrade.Side,
-			removedTrade.OpenTime.Unix(),
-			removedTrade.CloseTime.Unix(),
-		)
+		removedKey := tradeCacheKey(removedTrade)
 		delete(l.tradeCacheSet, removedKey) // 从 Set 中删除
 		l.tradesCache = l.tradesCache[:l.maxCacheSize]
 	}
 }
 
+// tradeCacheKey 交易唯一标识：symbol_side_openTime_closeTime
+func tradeCacheKey(trade TradeOutcome) string {
+	return fmt.Sprintf("%s_%s_%d_%d",
+		trade.Symbol,
+		trade.Side,
+		trade.OpenTime.Unix(),
+		trade.CloseTime.Unix(),
+	)
+}
+
 // addEquityToCache 添加净值记录到缓存（用于SharpeRatio计算）
 func (l *DecisionLogger) addEquityToCache(timestamp time.Time, equity float64) {
 	l.cacheMutex.Lock()
@@ -1330,6 +2193,40 @@ func (l *DecisionLogger) addEquityToCache(timestamp time.Time, equity float64) {
 	if len(l.equityCache) > l.maxEquitySize {
 		l.equityCache = l.equityCache[:l.maxEquitySize]
 	}
+
+	if len(l.equityCache) == 0 {
+		return
+	}
+
+	// 缓存最新的在前，其余点都早于新点：峰值取截断后仍保留的窗口内最高净值，
+	// 被挤出缓存的旧峰值不再参与计算
+	peak := equity
+	for _, p := range l.equityCache[1:] {
+		if p.Equity > peak {
+			peak = p.Equity
+		}
+	}
+	if peak > 0 {
+		l.equityCache[0].DrawdownPct = (peak - equity) / peak * 100
+	}
+}
+
+// GetEquityCurve 从缓存获取最近N个净值点（按时间正序：从旧到新，便于绘图）
+// limit <= 0 时返回全部缓存；返回副本，避免外部修改缓存
+func (l *DecisionLogger) GetEquityCurve(limit int) []EquityPoint {
+	l.cacheMutex.RLock()
+	defer l.cacheMutex.RUnlock()
+
+	if limit <= 0 || limit > len(l.equityCache) {
+		limit = len(l.equityCache)
+	}
+
+	// equityCache 最新的在前，取前 limit 个后反转
+	result := make([]EquityPoint, limit)
+	for i := 0; i < limit; i++ {
+		result[limit-1-i] = l.equityCache[i]
+	}
+	return result
 }
 
 // GetRecentTrades 从缓存获取最近N条交易（最新的在前）
@@ -1348,6 +2245,55 @@ func (l *DecisionLogger) GetRecentTrades(limit int) []TradeOutcome {
 	return result
 }
 
+// tradeCSVHeader ExportTradesCSV 的表头（列顺序与 tradeCSVRow 一致）
+var tradeCSVHeader = []string{
+	"symbol", "side", "quantity", "leverage", "open_price", "close_price",
+	"pnl", "pnl_pct", "open_time", "close_time", "duration", "prompt_hash", "was_stop_loss",
+}
+
+// ExportTradesCSV 将缓存中的交易导出为 CSV，保持缓存的从新到旧顺序
+// limit <= 0 时导出全部缓存
+func (l *DecisionLogger) ExportTradesCSV(w io.Writer, limit int) error {
+	l.cacheMutex.RLock()
+	if limit <= 0 || limit > len(l.tradesCache) {
+		limit = len(l.tradesCache)
+	}
+	trades := make([]TradeOutcome, limit)
+	copy(trades, l.tradesCache[:limit])
+	l.cacheMutex.RUnlock()
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(tradeCSVHeader); err != nil {
+		return fmt.Errorf("写入CSV表头失败: %w", err)
+	}
+	for _, trade := range trades {
+		if err := cw.Write(tradeCSVRow(trade)); err != nil {
+			return fmt.Errorf("写入CSV行失败: %w", err)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func tradeCSVRow(trade TradeOutcome) []string {
+	formatFloat := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	return []string{
+		trade.Symbol,
+		trade.Side,
+		formatFloat(trade.Quantity),
+		strconv.Itoa(trade.Leverage),
+		formatFloat(trade.OpenPrice),
+		formatFloat(trade.ClosePrice),
+		formatFloat(trade.PnL),
+		formatFloat(trade.PnLPct),
+		trade.OpenTime.Format(time.RFC3339),
+		trade.CloseTime.Format(time.RFC3339),
+		trade.Duration,
+		trade.PromptHash,
+		strconv.FormatBool(trade.WasStopLoss),
+	}
+}
+
 // GetOpenPosition 获取指定币种的开仓信息
 // 返回 nil 表示该币种没有未平仓持仓
 // Issue #102: 用于在系统重启后恢复持仓的真实开仓时间
@@ -1358,15 +2304,23 @@ func (l *DecisionLogger) GetOpenPosition(symbol string) *OpenPosition {
 	if pos, exists := l.openPositions[symbol]; exists {
 		// 返回副本，避免外部修改
 		return &OpenPosition{
-			Symbol:     pos.Symbol,
-			Side:       pos.Side,
-			Quantity:   pos.Quantity,
-			EntryPrice: pos.EntryPrice,
-			Leverage:   pos.Leverage,
-			OpenTime:   pos.OpenTime,
-			Exchange:   pos.Exchange,
-			StopLoss:   pos.StopLoss,   // Issue #102: 恢复止损价格
-			TakeProfit: pos.TakeProfit, // Issue #102: 恢复止盈价格
+			Symbol:        pos.Symbol,
+			Side:          pos.Side,
+			Quantity:      pos.Quantity,
+			EntryPrice:    pos.EntryPrice,
+			Leverage:      pos.Leverage,
+			OpenTime:      pos.OpenTime,
+			Exchange:      pos.Exchange,
+			StopLoss:      pos.StopLoss,   // Issue #102: 恢复止损价格
+			TakeProfit:    pos.TakeProfit, // Issue #102: 恢复止盈价格
+			EntrySlippage: pos.EntrySlippage,
+			EntryRegime:   pos.EntryRegime,
+
+			RemainingQuantity:   pos.RemainingQuantity,
+			AccumulatedPnL:      pos.AccumulatedPnL,
+			AccumulatedSlippage: pos.AccumulatedSlippage,
+			FundingPaid:         pos.FundingPaid,
+			PartialCloses:       pos.PartialCloses,
 		}
 	}
 	return nil
@@ -1378,22 +2332,30 @@ func (l *DecisionLogger) calculateStatisticsFromTrades(trades []TradeOutcome) *P
 	analysis := &PerformanceAnalysis{
 		RecentTrades: trades,
 		SymbolStats:  make(map[string]*SymbolPerformance),
+		SideStats:    make(map[string]*SymbolPerformance),
 	}
 
 	if len(trades) == 0 {
 		return analysis
 	}
 
+	// 总盈利 / 总亏损（负数）单独累加，不借用 AvgWin/AvgLoss 字段
+	var grossProfit, grossLoss float64
+	// 各币种的总盈利 / 总亏损（用于计算币种 Kelly 比例）
+	symbolGrossProfit := make(map[string]float64)
+	symbolGrossLoss := make(map[string]float64)
+
 	// 遍历所有交易，累计统计信息
 	for _, trade := range trades {
 		analysis.TotalTrades++
+		analysis.TotalSlippageCost += trade.SlippageCost
 
 		if trade.PnL >= 0 {
 			analysis.WinningTrades++
-			analysis.AvgWin += trade.PnL
+			grossProfit += trade.PnL
 		} else {
 			analysis.LosingTrades++
-			analysis.AvgLoss += trade.PnL
+			grossLoss += trade.PnL
 		}
 
 		// 按币种统计
@@ -1408,8 +2370,26 @@ func (l *DecisionLogger) calculateStatisticsFromTrades(trades []TradeOutcome) *P
 
 		if trade.PnL >= 0 {
 			stats.WinningTrades++
+			symbolGrossProfit[trade.Symbol] += trade.PnL
 		} else {
 			stats.LosingTrades++
+			symbolGrossLoss[trade.Symbol] += trade.PnL
+		}
+
+		// 按方向统计
+		if _, exists := analysis.SideStats[trade.Side]; !exists {
+			analysis.SideStats[trade.Side] = &SymbolPerformance{
+				Symbol: trade.Side,
+			}
+		}
+		sideStats := analysis.SideStats[trade.Side]
+		sideStats.TotalTrades++
+		sideStats.TotalPnL += trade.PnL
+
+		if trade.PnL >= 0 {
+			sideStats.WinningTrades++
+		} else {
+			sideStats.LosingTrades++
 		}
 	}
 
@@ -1417,46 +2397,270 @@ func (l *DecisionLogger) calculateStatisticsFromTrades(trades []TradeOutcome) *P
 	if analysis.TotalTrades > 0 {
 		analysis.WinRate = (float64(analysis.WinningTrades) / float64(analysis.TotalTrades)) * 100
 
-		totalWinAmount := analysis.AvgWin
-		totalLossAmount := analysis.AvgLoss
-
 		if analysis.WinningTrades > 0 {
-			analysis.AvgWin /= float64(analysis.WinningTrades)
+			analysis.AvgWin = grossProfit / float64(analysis.WinningTrades)
 		}
 		if analysis.LosingTrades > 0 {
-			analysis.AvgLoss /= float64(analysis.LosingTrades)
+			analysis.AvgLoss = grossLoss / float64(analysis.LosingTrades)
 		}
 
 		// Profit Factor = 总盈利 / 总亏损（绝对值）
-		if totalLossAmount != 0 {
-			analysis.ProfitFactor = totalWinAmount / (-totalLossAmount)
-		} else if totalWinAmount > 0 {
+		if grossLoss != 0 {
+			analysis.ProfitFactor = grossProfit / math.Abs(grossLoss)
+		} else if grossProfit > 0 {
 			analysis.ProfitFactor = 999.0
 		}
 	}
 
+	minKellyTrades := l.kellyMinTrades()
+	analysis.KellyFraction = calculateKellyFraction(analysis.TotalTrades, analysis.WinningTrades, analysis.LosingTrades,
+		grossProfit, grossLoss, minKellyTrades)
+
 	// 计算各币种胜率和平均盈亏，找出最佳/最差币种
-	bestPnL := -999999.0
-	worstPnL := 999999.0
 	for symbol, stats := range analysis.SymbolStats {
 		if stats.TotalTrades > 0 {
 			stats.WinRate = (float64(stats.WinningTrades) / float64(stats.TotalTrades)) * 100
 			stats.AvgPnL = stats.TotalPnL / float64(stats.TotalTrades)
+		}
+		stats.KellyFraction = calculateKellyFraction(stats.TotalTrades, stats.WinningTrades, stats.LosingTrades,
+			symbolGrossProfit[symbol], symbolGrossLoss[symbol], minKellyTrades)
+	}
+	for _, stats := range analysis.SideStats {
+		if stats.TotalTrades > 0 {
+			stats.WinRate = (float64(stats.WinningTrades) / float64(stats.TotalTrades)) * 100
+			stats.AvgPnL = stats.TotalPnL / float64(stats.TotalTrades)
+		}
+	}
+	analysis.BestSymbol, analysis.WorstSymbol = selectBestWorstSymbols(analysis.SymbolStats)
 
-			if stats.TotalPnL > bestPnL {
-				bestPnL = stats.TotalPnL
-				analysis.BestSymbol = symbol
-			}
-			if stats.TotalPnL < worstPnL {
-				worstPnL = stats.TotalPnL
-				analysis.WorstSymbol = symbol
-			}
+	// 最佳/最差单笔交易（保存副本，避免指向缓存切片）
+	best, worst := trades[0], trades[0]
+	for _, trade := range trades[1:] {
+		if trade.PnL > best.PnL {
+			best = trade
 		}
+		if trade.PnL < worst.PnL {
+			worst = trade
+		}
+	}
+	analysis.BestTrade, analysis.WorstTrade = &best, &worst
+
+	// 收益分布形态（夏普比率假设正态分布，偏度/峰度用于识别肥尾风险）
+	returns := make([]float64, len(trades))
+	for i, trade := range trades {
+		returns[i] = trade.PnLPct
 	}
+	analysis.Skewness, analysis.Kurtosis = calculateSkewKurtosis(returns)
+
+	analysis.MaxDrawdownPct = calculateMaxDrawdownFromTrades(trades)
+	analysis.CalmarRatio = calculateCalmarRatio(trades, analysis.MaxDrawdownPct)
+	analysis.RecoveryFactor = calculateRecoveryFactor(trades)
+	analysis.Expectancy, analysis.AvgRMultiple = calculateExpectancy(analysis, trades)
+	applyHoldingStats(analysis, trades)
 
 	return analysis
 }
 
+// applyHoldingStats 按 OpenTime/CloseTime 计算持仓时长统计（分钟）
+// 盈利交易为 PnL > 0，亏损交易为 PnL < 0，保本交易只计入整体统计
+func applyHoldingStats(analysis *PerformanceAnalysis, trades []TradeOutcome) {
+	if len(trades) == 0 {
+		return
+	}
+
+	holdings := make([]float64, 0, len(trades))
+	var total, winTotal, lossTotal float64
+	wins, losses := 0, 0
+	for _, trade := range trades {
+		minutes := trade.CloseTime.Sub(trade.OpenTime).Minutes()
+		holdings = append(holdings, minutes)
+		total += minutes
+		if trade.PnL > 0 {
+			winTotal += minutes
+			wins++
+		} else if trade.PnL < 0 {
+			lossTotal += minutes
+			losses++
+		}
+	}
+
+	analysis.AvgHoldingMinutes = total / float64(len(holdings))
+	sort.Float64s(holdings)
+	mid := len(holdings) / 2
+	if len(holdings)%2 == 0 {
+		analysis.MedianHoldingMinutes = (holdings[mid-1] + holdings[mid]) / 2
+	} else {
+		analysis.MedianHoldingMinutes = holdings[mid]
+	}
+	if wins > 0 {
+		analysis.AvgWinHoldingMinutes = winTotal / float64(wins)
+	}
+	if losses > 0 {
+		analysis.AvgLossHoldingMinutes = lossTotal / float64(losses)
+	}
+}
+
+// calculateExpectancy 在 WinRate/AvgWin/AvgLoss 计算完成后求单笔期望与平均 R 倍数
+// R 倍数以占用保证金为单位风险，MarginUsed 为 0 的交易不参与平均
+func calculateExpectancy(analysis *PerformanceAnalysis, trades []TradeOutcome) (float64, float64) {
+	if analysis.TotalTrades == 0 {
+		return 0, 0
+	}
+	winRate := analysis.WinRate / 100
+	expectancy := winRate*analysis.AvgWin + (1-winRate)*analysis.AvgLoss
+
+	sumR, count := 0.0, 0
+	for _, trade := range trades {
+		if trade.MarginUsed > 0 {
+			sumR += trade.PnL / trade.MarginUsed
+			count++
+		}
+	}
+	avgR := 0.0
+	if count > 0 {
+		avgR = sumR / float64(count)
+	}
+	return expectancy, avgR
+}
+
+// calculateCalmarRatio 计算 Calmar 比率：总收益率（累计盈亏 / 初始 10000）除以最大回撤比例
+// 无回撤时：盈利返回 999.0，否则返回 0
+func calculateCalmarRatio(trades []TradeOutcome, maxDrawdownPct float64) float64 {
+	totalPnL := 0.0
+	for _, trade := range trades {
+		totalPnL += trade.PnL
+	}
+	if maxDrawdownPct == 0 {
+		if totalPnL > 0 {
+			return 999.0
+		}
+		return 0
+	}
+	return (totalPnL / 10000.0) / math.Abs(maxDrawdownPct/100)
+}
+
+// defaultMinKellyTrades 计算 Kelly 比例所需的默认最少交易数
+const defaultMinKellyTrades = 10
+
+// kellyMinTrades 返回计算 Kelly 比例所需的最少交易数
+func (l *DecisionLogger) kellyMinTrades() int {
+	if l.minKellyTrades > 0 {
+		return l.minKellyTrades
+	}
+	return defaultMinKellyTrades
+}
+
+// calculateKellyFraction 计算 Kelly 仓位比例：W - (1-W)/R
+// W 为胜率（小数），R 为盈亏比（平均盈利 / 平均亏损绝对值）；结果限制在 [0, 1]
+// 交易数少于 minTrades、无亏损或无盈利时返回 0
+func calculateKellyFraction(totalTrades, winningTrades, losingTrades int, grossProfit, grossLoss float64, minTrades int) float64 {
+	if totalTrades == 0 || totalTrades < minTrades || losingTrades == 0 || winningTrades == 0 || grossLoss == 0 {
+		return 0
+	}
+
+	w := float64(winningTrades) / float64(totalTrades)
+	avgWin := grossProfit / float64(winningTrades)
+	avgLoss := math.Abs(grossLoss) / float64(losingTrades)
+	r := avgWin / avgLoss
+	if r <= 0 {
+		return 0
+	}
+
+	kelly := w - (1-w)/r
+	return math.Max(0, math.Min(1, kelly))
+}
+
+// calculateRecoveryFactor 计算恢复因子：净盈亏（所有交易 PnL 之和）除以最大峰谷回撤金额
+// 与 Calmar 比率互补（后者使用百分比口径）；无回撤时：盈利返回 999.0，否则返回 0
+func calculateRecoveryFactor(trades []TradeOutcome) float64 {
+	netProfit := 0.0
+	for _, trade := range trades {
+		netProfit += trade.PnL
+	}
+	_, maxDrawdownAmount := calculateDrawdownFromTrades(trades)
+	if maxDrawdownAmount == 0 {
+		if netProfit > 0 {
+			return 999.0
+		}
+		return 0
+	}
+	return netProfit / maxDrawdownAmount
+}
+
+// calculateMaxDrawdownFromTrades 按平仓时间顺序重建净值曲线（初始 10000 + 累计盈亏，与夏普比率口径一致），
+// 返回最大峰谷回撤百分比
+func calculateMaxDrawdownFromTrades(trades []TradeOutcome) float64 {
+	pct, _ := calculateDrawdownFromTrades(trades)
+	return pct
+}
+
+// calculateDrawdownFromTrades 返回重建净值曲线的最大回撤百分比与最大回撤金额（USDT，峰值 - 谷值）
+// 两者各自取最大值，可能来自不同的峰谷区间
+func calculateDrawdownFromTrades(trades []TradeOutcome) (maxDrawdownPct, maxDrawdownAmount float64) {
+	if len(trades) == 0 {
+		return 0, 0
+	}
+	ordered := make([]TradeOutcome, len(trades))
+	copy(ordered, trades)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].CloseTime.Before(ordered[j].CloseTime)
+	})
+
+	equity := 10000.0
+	peak := equity
+	for _, trade := range ordered {
+		equity += trade.PnL
+		if equity > peak {
+			peak = equity
+		}
+		if amount := peak - equity; amount > maxDrawdownAmount {
+			maxDrawdownAmount = amount
+		}
+		if peak > 0 {
+			if dd := (peak - equity) / peak * 100; dd > maxDrawdownPct {
+				maxDrawdownPct = dd
+			}
+		}
+	}
+	return maxDrawdownPct, maxDrawdownAmount
+}
+
+// calculateSkewKurtosis 计算收益率序列的偏度和超额峰度（总体矩）
+// 样本少于 3 个时偏度为 0，少于 4 个时峰度为 0；标准差为 0 时均返回 0
+func calculateSkewKurtosis(returns []float64) (skewness, kurtosis float64) {
+	n := float64(len(returns))
+	if len(returns) < 3 {
+		return 0, 0
+	}
+
+	var sum float64
+	for _, r := range returns {
+		sum += r
+	}
+	mean := sum / n
+
+	var m2, m3, m4 float64
+	for _, r := range returns {
+		d := r - mean
+		d2 := d * d
+		m2 += d2
+		m3 += d2 * d
+		m4 += d2 * d2
+	}
+	m2 /= n
+	m3 /= n
+	m4 /= n
+	if m2 == 0 {
+		return 0, 0
+	}
+
+	skewness = m3 / math.Pow(m2, 1.5)
+	if len(returns) >= 4 {
+		kurtosis = m4/(m2*m2) - 3
+	}
+	return skewness, kurtosis
+}
+
 // calculateSharpeRatioFromEquity 从equity缓存计算夏普比率
 func (l *DecisionLogger) calculateSharpeRatioFromEquity() float64 {
 	l.cacheMutex.RLock()
@@ -1505,19 +2709,11 @@ func (l *DecisionLogger) calculateSharpeRatioFromEquity() float64 {
 		variance += diff * diff
 	}
 	variance /= float64(len(returns))
-	stdDev := variance
-
-	if variance > 0 {
-		stdDev = 1.0
-		for i := 0; i < 10; i++ {
-			stdDev = (stdDev + variance/stdDev) / 2
-		}
-	}
+	stdDev := math.Sqrt(variance)
 
 	// 夏普比率 = (平均收益率 - 无风险收益率) / 标准差
-	// 假设无风险收益率为 0
 	if stdDev > 0 {
-		return avgReturn / stdDev
+		return l.annualizeSharpe((avgReturn - l.riskFreeRate) / stdDev)
 	}
 
 	return 0.0
@@ -1596,3 +2792,199 @@ func (l *DecisionLogger) GetPerformanceWithCache(tradeLimit int, filterByPrompt
 
 	return performance, nil
 }
+
+// GetPerformanceWindow 按时间窗口获取 AI 性能分析：只统计 CloseTime 在最近 window 内的缓存交易
+// 与 GetPerformanceWithCache 的固定 100 笔样本互补；filterByPrompt 时按最新交易的 PromptHash 过滤
+// 窗口内没有交易时返回空的分析结果
+func (l *DecisionLogger) GetPerformanceWindow(window time.Duration, tradeLimit int, filterByPrompt bool) (*PerformanceAnalysis, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("时间窗口必须大于 0: %v", window)
+	}
+
+	l.cacheMutex.RLock()
+	trades := make([]TradeOutcome, len(l.tradesCache))
+	copy(trades, l.tradesCache)
+	l.cacheMutex.RUnlock()
+
+	if filterByPrompt && len(trades) > 0 {
+		trades = filterByPromptHash(trades, trades[0].PromptHash)
+	}
+
+	cutoff := time.Now().Add(-window)
+	var windowTrades []TradeOutcome
+	for _, trade := range trades {
+		if !trade.CloseTime.Before(cutoff) {
+			windowTrades = append(windowTrades, trade)
+		}
+	}
+
+	performance := l.calculateStatisticsFromTrades(windowTrades)
+	performance.SharpeRatio = l.calculateSharpeRatioFromTrades(windowTrades)
+
+	if len(windowTrades) > tradeLimit {
+		performance.RecentTrades = windowTrades[:tradeLimit]
+	}
+	return performance, nil
+}
+
+// GetPerformanceByRegime 按开仓时的波动率状态（low/normal/high/extreme）分组统计缓存中的交易表现
+// 用于判断策略优势是否依赖特定行情状态；未记录状态的交易归入 RegimeUnknown
+func (l *DecisionLogger) GetPerformanceByRegime() map[string]*PerformanceAnalysis {
+	l.cacheMutex.RLock()
+	trades := make([]TradeOutcome, len(l.tradesCache))
+	copy(trades, l.tradesCache)
+	l.cacheMutex.RUnlock()
+
+	grouped := make(map[string][]TradeOutcome)
+	for _, trade := range trades {
+		regime := trade.Regime
+		if regime == "" {
+			regime = RegimeUnknown
+		}
+		grouped[regime] = append(grouped[regime], trade)
+	}
+
+	result := make(map[string]*PerformanceAnalysis, len(grouped))
+	for regime, regimeTrades := range grouped {
+		analysis := l.calculateStatisticsFromTrades(regimeTrades)
+		analysis.SharpeRatio = l.calculateSharpeRatioFromTrades(regimeTrades)
+		result[regime] = analysis
+	}
+	return result
+}
+
+// ComparePromptPerformance 按 PromptHash 分组统计缓存中的交易表现，便于并排比较多个 prompt 版本
+// 未记录 hash 的历史交易归入 "" 分组
+func (l *DecisionLogger) ComparePromptPerformance() (map[string]*PerformanceAnalysis, error) {
+	l.cacheMutex.RLock()
+	trades := make([]TradeOutcome, len(l.tradesCache))
+	copy(trades, l.tradesCache)
+	l.cacheMutex.RUnlock()
+
+	grouped := make(map[string][]TradeOutcome)
+	for _, trade := range trades {
+		grouped[trade.PromptHash] = append(grouped[trade.PromptHash], trade)
+	}
+
+	result := make(map[string]*PerformanceAnalysis, len(grouped))
+	for promptHash, promptTrades := range grouped {
+		analysis := l.calculateStatisticsFromTrades(promptTrades)
+		analysis.SharpeRatio = l.calculateSharpeRatioFromTrades(promptTrades)
+		result[promptHash] = analysis
+	}
+	return result, nil
+}
+
+// SuggestAllocation 按缓存交易计算各币种夏普比率，返回按夏普比率加权的建议资金权重（合计为 1）
+// 夏普比率 <= 0 的币种权重为 0（交易不足 2 笔的币种夏普比率为 0）；没有正夏普比率的币种时返回空 map
+func (l *DecisionLogger) SuggestAllocation() map[string]float64 {
+	l.cacheMutex.RLock()
+	trades := make([]TradeOutcome, len(l.tradesCache))
+	copy(trades, l.tradesCache)
+	l.cacheMutex.RUnlock()
+
+	// 缓存最新的在前，按时间正序分组以重建各币种净值序列
+	grouped := make(map[string][]TradeOutcome)
+	for i := len(trades) - 1; i >= 0; i-- {
+		grouped[trades[i].Symbol] = append(grouped[trades[i].Symbol], trades[i])
+	}
+
+	sharpes := make(map[string]float64, len(grouped))
+	total := 0.0
+	for symbol, symbolTrades := range grouped {
+		if sharpe := l.calculateSharpeRatioFromTrades(symbolTrades); sharpe > 0 {
+			sharpes[symbol] = sharpe
+			total += sharpe
+		}
+	}
+
+	weights := make(map[string]float64, len(grouped))
+	if total <= 0 {
+		return weights
+	}
+	for symbol := range grouped {
+		weights[symbol] = sharpes[symbol] / total
+	}
+	return weights
+}
+
+// CacheConsistencyReport 交易缓存与决策文件扫描结果的一致性校验报告
+type CacheConsistencyReport struct {
+	Consistent        bool      `json:"consistent"`
+	CheckedAt         time.Time `json:"checked_at"`
+	CachedTrades      int       `json:"cached_trades"`
+	ScannedTrades     int       `json:"scanned_trades"`
+	MissingInCache    []string  `json:"missing_in_cache,omitempty"`    // 文件中存在但缓存缺失的交易
+	UnexpectedInCache []string  `json:"unexpected_in_cache,omitempty"` // 缓存中存在但文件中找不到的交易
+	Mismatched        []string  `json:"mismatched,omitempty"`          // 两边都有但盈亏不一致的交易
+}
+
+// VerifyCacheConsistency 以决策文件扫描结果为准，校验交易缓存是否发生漂移
+// 不持有任何长时间的锁：先快照缓存，再扫描文件，最后再次快照缓存。
+// 决策文件总是先于缓存写入，因此"缓存缺失"以第二次快照判断、"缓存多余"以第一次快照判断，
+// 可避免与并发的 LogDecision 产生误报。
+func (l *DecisionLogger) VerifyCacheConsistency() (*CacheConsistencyReport, error) {
+	before := l.GetRecentTrades(l.maxCacheSize)
+
+	_, scanned, err := l.analyzePerformance(InitialScanCycles, false)
+	if err != nil {
+		return nil, err
+	}
+
+	after := l.GetRecentTrades(l.maxCacheSize)
+
+	// 缓存只保留最新的 maxCacheSize 笔，文件扫描结果按同样规则截取
+	sort.SliceStable(scanned, func(i, j int) bool {
+		return scanned[i].CloseTime.After(scanned[j].CloseTime)
+	})
+	if len(scanned) > l.maxCacheSize {
+		scanned = scanned[:l.maxCacheSize]
+	}
+	scannedByKey := make(map[string]TradeOutcome, len(scanned))
+	for _, trade := range scanned {
+		scannedByKey[tradeCacheKey(trade)] = trade
+	}
+
+	report := &CacheConsistencyReport{
+		CheckedAt:     time.Now(),
+		CachedTrades:  len(after),
+		ScannedTrades: len(scanned),
+	}
+
+	afterByKey := make(map[string]TradeOutcome, len(after))
+	for _, trade := range after {
+		afterByKey[tradeCacheKey(trade)] = trade
+	}
+	for key, trade := range scannedByKey {
+		cached, ok := afterByKey[key]
+		if !ok {
+			report.MissingInCache = append(report.MissingInCache, key)
+			continue
+		}
+		if math.Abs(cached.PnL-trade.PnL) > 1e-6 {
+			report.Mismatched = append(report.Mismatched, key)
+		}
+	}
+
+	// 缓存中比最早一笔扫描交易更旧的记录可能已超出截取窗口，不视为多余
+	var oldestScanned time.Time
+	if len(scanned) > 0 {
+		oldestScanned = scanned[len(scanned)-1].CloseTime
+	}
+	for _, trade := range before {
+		key := tradeCacheKey(trade)
+		if _, ok := scannedByKey[key]; ok {
+			continue
+		}
+		if len(scanned) == l.maxCacheSize && trade.CloseTime.Before(oldestScanned) {
+			continue
+		}
+		report.UnexpectedInCache = append(report.UnexpectedInCache, key)
+	}
+
+	sort.Strings(report.MissingInCache)
+	sort.Strings(report.UnexpectedInCache)
+	sort.Strings(report.Mismatched)
+	report.Consistent = len(report.MissingInCache) == 0 && len(report.UnexpectedInCache) == 0 && len(report.Mismatched) == 0
+	return report, nil
+}
@@ -1,9 +1,14 @@
 package logger
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -52,6 +57,68 @@ func TestGetTakerFeeRate(t *testing.T) {
 	}
 }
 
+// TestGetMakerFeeRate tests the getMakerFeeRate function for all supported exchanges
+func TestGetMakerFeeRate(t *testing.T) {
+	tests := []struct {
+		exchange string
+		wantRate float64
+	}{
+		{"aster", 0.0001},
+		{"hyperliquid", 0.00015},
+		{"binance", 0.0002},
+		{"unknown_exchange", 0.0002},
+		{"", 0.0002},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.exchange, func(t *testing.T) {
+			if got := getMakerFeeRate(tt.exchange); got != tt.wantRate {
+				t.Errorf("getMakerFeeRate(%q) = %v, want %v", tt.exchange, got, tt.wantRate)
+			}
+		})
+	}
+}
+
+// TestMakerCloseFee 测试 Maker 平仓使用 Maker 费率，缓存与文件扫描两条路径一致
+func TestMakerCloseFee(t *testing.T) {
+	tests := []struct {
+		name      string
+		isMaker   bool
+		closeRate float64
+	}{
+		{"taker close by default", false, 0.0005},
+		{"maker close", true, 0.0002},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewDecisionLogger(t.TempDir()).(*DecisionLogger)
+			openAt := time.Now().Add(-2 * time.Hour)
+			for _, action := range []DecisionAction{
+				{Action: "open_long", Symbol: "BTCUSDT", Quantity: 0.1, Price: 50000, Leverage: 5, Timestamp: openAt, Success: true},
+				{Action: "close_long", Symbol: "BTCUSDT", Price: 51000, Timestamp: openAt.Add(time.Hour), Success: true, IsMaker: tt.isMaker},
+			} {
+				if err := l.LogDecision(&DecisionRecord{Exchange: "binance", Success: true, Decisions: []DecisionAction{action}}); err != nil {
+					t.Fatalf("LogDecision: %v", err)
+				}
+			}
+
+			want := 0.1*(51000-50000) - 0.1*50000*0.0005 - 0.1*51000*tt.closeRate
+			cached := l.GetRecentTrades(1)
+			if len(cached) != 1 || math.Abs(cached[0].PnL-want) > 1e-9 {
+				t.Fatalf("cached trade PnL = %+v, want %.4f", cached, want)
+			}
+			scanned, err := l.AnalyzePerformance(100)
+			if err != nil {
+				t.Fatalf("AnalyzePerformance: %v", err)
+			}
+			if len(scanned.RecentTrades) != 1 || math.Abs(scanned.RecentTrades[0].PnL-want) > 1e-9 {
+				t.Errorf("scanned trade PnL = %+v, want %.4f", scanned.RecentTrades, want)
+			}
+		})
+	}
+}
+
 // TestPnLCalculationWithFees tests that P&L calculation correctly includes trading fees
 func TestPnLCalculationWithFees(t *testing.T) {
 	tests := []struct {
@@ -495,7 +562,7 @@ func TestFeeImpactOnPerformanceMetrics(t *testing.T) {
 
 // TestTradesCache_AddAndGet 测试基本的添加和读取功能
 func TestTradesCache_AddAndGet(t *testing.T) {
-	logger := NewDecisionLogger("/tmp/test_cache")
+	logger := NewDecisionLogger(t.TempDir())
 
 	// 添加 3 笔交易
 	trade1 := TradeOutcome{
@@ -550,7 +617,7 @@ func TestTradesCache_AddAndGet(t *testing.T) {
 
 // TestTradesCache_SizeLimit 测试缓存大小限制
 func TestTradesCache_SizeLimit(t *testing.T) {
-	logger := NewDecisionLogger("/tmp/test_cache_limit")
+	logger := NewDecisionLogger(t.TempDir())
 
 	// 缓存限制是 100 条，添加 120 条测试
 	maxSize := 100
@@ -586,7 +653,7 @@ func TestTradesCache_SizeLimit(t *testing.T) {
 
 // TestTradesCache_OrderNewestFirst 测试交易顺序（最新的在前）
 func TestTradesCache_OrderNewestFirst(t *testing.T) {
-	logger := NewDecisionLogger("/tmp/test_cache_order")
+	logger := NewDecisionLogger(t.TempDir())
 
 	baseTime := time.Now()
 
@@ -617,7 +684,7 @@ func TestTradesCache_OrderNewestFirst(t *testing.T) {
 
 // TestTradesCache_ConcurrentAccess 测试并发安全
 func TestTradesCache_ConcurrentAccess(t *testing.T) {
-	logger := NewDecisionLogger("/tmp/test_cache_concurrent")
+	logger := NewDecisionLogger(t.TempDir())
 
 	// 并发写入
 	done := make(chan bool)
@@ -2705,3 +2772,1840 @@ func TestRecoverOpenPositions_StopLossTakeProfit(t *testing.T) {
 		t.Errorf("EntryPrice: 期望 95000.0, 实际 %.2f", pos.EntryPrice)
 	}
 }
+
+// TestBestWorstSymbol_DeterministicTieBreak 测试总盈亏相同时最佳/最差币种按字母序稳定选择
+func TestBestWorstSymbol_DeterministicTieBreak(t *testing.T) {
+	logger := &DecisionLogger{}
+	now := time.Now()
+	trades := []TradeOutcome{
+		{Symbol: "SOLUSDT", Side: "long", PnL: 25, OpenTime: now.Add(-3 * time.Hour), CloseTime: now.Add(-2 * time.Hour)},
+		{Symbol: "ETHUSDT", Side: "long", PnL: 25, OpenTime: now.Add(-2 * time.Hour), CloseTime: now.Add(-1 * time.Hour)},
+	}
+
+	for i := 0; i < 50; i++ {
+		analysis := logger.calculateStatisticsFromTrades(trades)
+		if analysis.BestSymbol != "ETHUSDT" {
+			t.Fatalf("run %d: BestSymbol = %s, want ETHUSDT", i, analysis.BestSymbol)
+		}
+		if analysis.WorstSymbol != "ETHUSDT" {
+			t.Fatalf("run %d: WorstSymbol = %s, want ETHUSDT", i, analysis.WorstSymbol)
+		}
+	}
+
+	// 非并列时仍按总盈亏选择
+	trades = append(trades, TradeOutcome{Symbol: "BTCUSDT", Side: "short", PnL: -10, OpenTime: now.Add(-time.Hour), CloseTime: now})
+	analysis := logger.calculateStatisticsFromTrades(trades)
+	if analysis.BestSymbol != "ETHUSDT" || analysis.WorstSymbol != "BTCUSDT" {
+		t.Errorf("BestSymbol/WorstSymbol = %s/%s, want ETHUSDT/BTCUSDT", analysis.BestSymbol, analysis.WorstSymbol)
+	}
+}
+
+// TestSlippageCostAccounting 测试开平仓滑点成本的累计，且 PnL 已按含滑点的成交价计算
+func TestSlippageCostAccounting(t *testing.T) {
+	logger := NewDecisionLogger(t.TempDir())
+	openTime := time.Now().Add(-1 * time.Hour)
+	closeTime := time.Now()
+
+	// 参考价 100000 → 101000，开平仓各 50 的不利滑点
+	const qty = 0.01
+	openExec, closeExec := 100050.0, 100950.0
+	records := []*DecisionRecord{
+		{
+			Exchange:    "binance",
+			CycleNumber: 1,
+			Timestamp:   openTime,
+			Success:     true,
+			Decisions: []DecisionAction{
+				{Action: "open_long", Symbol: "BTCUSDT", Quantity: qty, Leverage: 5, Price: openExec, Slippage: 50, Timestamp: openTime, Success: true},
+			},
+		},
+		{
+			Exchange:    "binance",
+			CycleNumber: 2,
+			Timestamp:   closeTime,
+			Success:     true,
+			Decisions: []DecisionAction{
+				{Action: "close_long", Symbol: "BTCUSDT", Quantity: qty, Leverage: 5, Price: closeExec, Slippage: 50, Timestamp: closeTime, Success: true},
+			},
+		},
+	}
+	for _, record := range records {
+		if err := logger.LogDecision(record); err != nil {
+			t.Fatalf("LogDecision failed: %v", err)
+		}
+	}
+
+	analysis, err := logger.AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if len(analysis.RecentTrades) != 1 {
+		t.Fatalf("Expected 1 trade, got %d", len(analysis.RecentTrades))
+	}
+
+	expectedSlippage := qty * (50 + 50) // 1.0 USDT
+	trade := analysis.RecentTrades[0]
+	if math.Abs(trade.SlippageCost-expectedSlippage) > 1e-9 {
+		t.Errorf("SlippageCost = %v, want %v", trade.SlippageCost, expectedSlippage)
+	}
+	if math.Abs(analysis.TotalSlippageCost-expectedSlippage) > 1e-9 {
+		t.Errorf("TotalSlippageCost = %v, want %v", analysis.TotalSlippageCost, expectedSlippage)
+	}
+
+	// PnL 基于成交价：相比参考价的毛利少了滑点成本
+	fees := qty*openExec*0.0005 + qty*closeExec*0.0005
+	expectedPnL := qty*(closeExec-openExec) - fees
+	if math.Abs(trade.PnL-expectedPnL) > 1e-9 {
+		t.Errorf("PnL = %v, want %v", trade.PnL, expectedPnL)
+	}
+	grossAtReference := qty * (101000.0 - 100000.0)
+	if math.Abs(grossAtReference-(trade.PnL+fees)-trade.SlippageCost) > 1e-9 {
+		t.Errorf("PnL does not reflect slippage: gross at reference %v, pnl+fees %v, slippage %v",
+			grossAtReference, trade.PnL+fees, trade.SlippageCost)
+	}
+
+	// 缓存路径（LogDecision 自动维护）同样记录滑点
+	cached := logger.GetRecentTrades(10)
+	if len(cached) != 1 || math.Abs(cached[0].SlippageCost-expectedSlippage) > 1e-9 {
+		t.Fatalf("cached trades = %+v, want one trade with SlippageCost %v", cached, expectedSlippage)
+	}
+	stats := logger.(*DecisionLogger).calculateStatisticsFromTrades(cached)
+	if math.Abs(stats.TotalSlippageCost-expectedSlippage) > 1e-9 {
+		t.Errorf("calculateStatisticsFromTrades TotalSlippageCost = %v, want %v", stats.TotalSlippageCost, expectedSlippage)
+	}
+}
+
+// TestReturnDistributionStats 测试单笔收益率的偏度与峰度
+func TestReturnDistributionStats(t *testing.T) {
+	logger := &DecisionLogger{}
+	now := time.Now()
+	makeTrades := func(pcts ...float64) []TradeOutcome {
+		trades := make([]TradeOutcome, len(pcts))
+		for i, pct := range pcts {
+			trades[i] = TradeOutcome{
+				Symbol:    "BTCUSDT",
+				Side:      "long",
+				PnL:       pct,
+				PnLPct:    pct,
+				OpenTime:  now.Add(time.Duration(i-len(pcts)-1) * time.Hour),
+				CloseTime: now.Add(time.Duration(i-len(pcts)) * time.Hour),
+			}
+		}
+		return trades
+	}
+
+	t.Run("左偏：多次小赚一次大亏", func(t *testing.T) {
+		analysis := logger.calculateStatisticsFromTrades(makeTrades(2, 1.5, 2.5, 1, 2, 1.8, 2.2, 1.2, 2.1, -40))
+		if analysis.Skewness >= -1 {
+			t.Errorf("Skewness = %.4f, want strongly negative", analysis.Skewness)
+		}
+		if analysis.Kurtosis <= 3 {
+			t.Errorf("Kurtosis = %.4f, want elevated excess kurtosis", analysis.Kurtosis)
+		}
+	})
+
+	t.Run("对称分布", func(t *testing.T) {
+		analysis := logger.calculateStatisticsFromTrades(makeTrades(-2, -1, 0, 1, 2))
+		if math.Abs(analysis.Skewness) > 1e-9 {
+			t.Errorf("Skewness = %.6f, want 0", analysis.Skewness)
+		}
+	})
+
+	tests := []struct {
+		name         string
+		pcts         []float64
+		wantSkewZero bool
+		wantKurtZero bool
+	}{
+		{name: "2 samples", pcts: []float64{1, -5}, wantSkewZero: true, wantKurtZero: true},
+		{name: "3 samples", pcts: []float64{1, 1, -5}, wantSkewZero: false, wantKurtZero: true},
+		{name: "identical returns", pcts: []float64{1, 1, 1, 1}, wantSkewZero: true, wantKurtZero: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis := logger.calculateStatisticsFromTrades(makeTrades(tt.pcts...))
+			if (analysis.Skewness == 0) != tt.wantSkewZero {
+				t.Errorf("Skewness = %.4f, wantZero=%v", analysis.Skewness, tt.wantSkewZero)
+			}
+			if (analysis.Kurtosis == 0) != tt.wantKurtZero {
+				t.Errorf("Kurtosis = %.4f, wantZero=%v", analysis.Kurtosis, tt.wantKurtZero)
+			}
+		})
+	}
+}
+
+// TestReconcileTradesOnStartup 测试重启时持久化交易缓存与决策文件扫描的去重对账
+func TestReconcileTradesOnStartup(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantPnL func(scanned float64) float64
+	}{
+		{"keep persisted by default", "", func(float64) float64 { return 12345 }},
+		{"prefer scanned version", DuplicateTradePreferScan, func(scanned float64) float64 { return scanned }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			openTime := time.Now().Add(-2 * time.Hour)
+			closeTime := time.Now().Add(-time.Hour)
+
+			// 会话1：开仓 + 平仓，交易写入持久化缓存
+			logger1 := NewDecisionLogger(tempDir).(*DecisionLogger)
+			for _, action := range []DecisionAction{
+				{Action: "open_long", Symbol: "BTCUSDT", Quantity: 0.1, Price: 50000, Leverage: 5, Timestamp: openTime, Success: true},
+				{Action: "close_long", Symbol: "BTCUSDT", Price: 51000, Timestamp: closeTime, Success: true},
+			} {
+				record := &DecisionRecord{Exchange: "binance", Success: true, Decisions: []DecisionAction{action}}
+				if err := logger1.LogDecision(record); err != nil {
+					t.Fatalf("LogDecision: %v", err)
+				}
+			}
+			scanned := logger1.GetRecentTrades(10)
+			if len(scanned) != 1 {
+				t.Fatalf("expected 1 trade before restart, got %d", len(scanned))
+			}
+
+			// 模拟崩溃：持久化缓存中同一交易出现两次且内容已被改写，决策文件仍在
+			storePath := filepath.Join(tempDir, tradeStoreDir, tradeStoreFile)
+			persisted := scanned[0]
+			persisted.PnL = 12345
+			line, _ := json.Marshal(persisted)
+			data := append(append(line, '\n'), append(line, '\n')...)
+			if err := os.WriteFile(storePath, data, 0600); err != nil {
+				t.Fatalf("write store: %v", err)
+			}
+
+			logger2 := NewDecisionLoggerWithOptions(tempDir, DecisionLoggerOptions{DuplicateTradePolicy: tt.policy}).(*DecisionLogger)
+			trades := logger2.GetRecentTrades(10)
+			if len(trades) != 1 {
+				t.Fatalf("expected trade counted once after restart, got %d", len(trades))
+			}
+			if want := tt.wantPnL(scanned[0].PnL); math.Abs(trades[0].PnL-want) > 1e-9 {
+				t.Errorf("PnL = %.4f, want %.4f", trades[0].PnL, want)
+			}
+
+			perf, err := logger2.GetPerformanceWithCache(10, false)
+			if err != nil {
+				t.Fatalf("GetPerformanceWithCache: %v", err)
+			}
+			if perf.TotalTrades != 1 {
+				t.Errorf("TotalTrades = %d, want 1", perf.TotalTrades)
+			}
+
+			// 对账后持久化文件被压缩为单条记录
+			reloaded, err := loadPersistedTrades(storePath)
+			if err != nil {
+				t.Fatalf("loadPersistedTrades: %v", err)
+			}
+			raw, _ := os.ReadFile(storePath)
+			if len(reloaded) != 1 || strings.Count(string(raw), "\n") != 1 {
+				t.Errorf("expected compacted store with 1 trade, got %d trades / %d lines", len(reloaded), strings.Count(string(raw), "\n"))
+			}
+		})
+	}
+}
+
+// TestGetPerformanceByRegime 测试按开仓时波动率状态分组统计交易表现
+func TestGetPerformanceByRegime(t *testing.T) {
+	l := NewDecisionLogger(t.TempDir()).(*DecisionLogger)
+	base := time.Now().Add(-10 * time.Hour)
+
+	trades := []struct {
+		symbol     string
+		regime     string
+		open, exit float64
+	}{
+		{"BTCUSDT", "low", 50000, 51000},
+		{"ETHUSDT", "low", 3000, 2900},
+		{"SOLUSDT", "high", 100, 110},
+		{"BNBUSDT", "", 500, 510},
+	}
+	for i, tr := range trades {
+		openAt := base.Add(time.Duration(2*i) * time.Hour)
+		closeAt := openAt.Add(time.Hour)
+		for _, action := range []DecisionAction{
+			{Action: "open_long", Symbol: tr.symbol, Quantity: 1, Price: tr.open, Leverage: 5, Timestamp: openAt, Success: true, Regime: tr.regime},
+			{Action: "close_long", Symbol: tr.symbol, Price: tr.exit, Timestamp: closeAt, Success: true},
+		} {
+			if err := l.LogDecision(&DecisionRecord{Exchange: "binance", Success: true, Decisions: []DecisionAction{action}}); err != nil {
+				t.Fatalf("LogDecision: %v", err)
+			}
+		}
+	}
+
+	byRegime := l.GetPerformanceByRegime()
+	if len(byRegime) != 3 {
+		t.Fatalf("expected 3 regimes, got %d: %v", len(byRegime), byRegime)
+	}
+
+	tests := []struct {
+		regime              string
+		total, wins, losses int
+		wantPositiveAvgWin  bool
+		wantNegativeAvgLoss bool
+	}{
+		{"low", 2, 1, 1, true, true},
+		{"high", 1, 1, 0, true, false},
+		{RegimeUnknown, 1, 1, 0, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.regime, func(t *testing.T) {
+			perf, ok := byRegime[tt.regime]
+			if !ok {
+				t.Fatalf("regime %q missing", tt.regime)
+			}
+			if perf.TotalTrades != tt.total || perf.WinningTrades != tt.wins || perf.LosingTrades != tt.losses {
+				t.Errorf("trades/wins/losses = %d/%d/%d, want %d/%d/%d",
+					perf.TotalTrades, perf.WinningTrades, perf.LosingTrades, tt.total, tt.wins, tt.losses)
+			}
+			if (perf.AvgWin > 0) != tt.wantPositiveAvgWin || (perf.AvgLoss < 0) != tt.wantNegativeAvgLoss {
+				t.Errorf("avg win/loss = %.4f/%.4f", perf.AvgWin, perf.AvgLoss)
+			}
+			for _, trade := range perf.RecentTrades {
+				if want := tt.regime; trade.Regime != want && !(want == RegimeUnknown && trade.Regime == "") {
+					t.Errorf("trade %s tagged %q in regime group %q", trade.Symbol, trade.Regime, tt.regime)
+				}
+			}
+		})
+	}
+}
+
+// TestVerifyCacheConsistency_ManyTrades 测试交易数超过 RecentTrades 截断长度时校验仍判定一致
+func TestVerifyCacheConsistency_ManyTrades(t *testing.T) {
+	l := NewDecisionLogger(t.TempDir()).(*DecisionLogger)
+	base := time.Now().Add(-48 * time.Hour)
+	for i := 0; i < 15; i++ {
+		openAt := base.Add(time.Duration(i) * time.Hour)
+		record := &DecisionRecord{Exchange: "binance", Success: true, Decisions: []DecisionAction{
+			{Action: "open_long", Symbol: "BTCUSDT", Quantity: 1, Price: 100, Leverage: 5, Timestamp: openAt, Success: true},
+			{Action: "close_long", Symbol: "BTCUSDT", Price: 100 + float64(i%3-1), Timestamp: openAt.Add(30 * time.Minute), Success: true},
+		}}
+		if err := l.LogDecision(record); err != nil {
+			t.Fatalf("LogDecision: %v", err)
+		}
+	}
+
+	report, err := l.VerifyCacheConsistency()
+	if err != nil {
+		t.Fatalf("VerifyCacheConsistency: %v", err)
+	}
+	if !report.Consistent || report.CachedTrades != 15 || report.ScannedTrades != 15 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+// TestMaxDrawdownFromTrades 测试按交易重建净值曲线计算最大回撤（缓存顺序为最新在前）
+func TestMaxDrawdownFromTrades(t *testing.T) {
+	logger := &DecisionLogger{}
+	now := time.Now()
+	// 按时间顺序的盈亏，hash 用于验证按 prompt 过滤后只统计对应交易
+	type step struct {
+		pnl  float64
+		hash string
+	}
+	makeTrades := func(steps ...step) []TradeOutcome {
+		trades := make([]TradeOutcome, len(steps))
+		for i, s := range steps {
+			// 倒序放置，模拟缓存"最新在前"
+			trades[len(steps)-1-i] = TradeOutcome{
+				Symbol:     "BTCUSDT",
+				Side:       "long",
+				PnL:        s.pnl,
+				PromptHash: s.hash,
+				OpenTime:   now.Add(time.Duration(i*2) * time.Hour),
+				CloseTime:  now.Add(time.Duration(i*2+1) * time.Hour),
+			}
+		}
+		return trades
+	}
+
+	trades := makeTrades(step{1000, "a"}, step{-2200, "a"}, step{-3000, "b"}, step{500, "a"})
+
+	tests := []struct {
+		name   string
+		trades []TradeOutcome
+		want   float64
+	}{
+		{"empty", nil, 0},
+		{"only gains", makeTrades(step{100, "a"}, step{200, "a"}), 0},
+		{"all trades", trades, (11000 - 5800) / 11000.0 * 100},
+		{"filtered by prompt hash", filterByPromptHash(trades, "a"), 2200 / 11000.0 * 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := logger.calculateStatisticsFromTrades(tt.trades).MaxDrawdownPct
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("MaxDrawdownPct = %.6f, want %.6f", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCalmarRatio 测试 Calmar 比率（总收益率 / 最大回撤）及无回撤时的边界值
+func TestCalmarRatio(t *testing.T) {
+	logger := &DecisionLogger{}
+	now := time.Now()
+	makeTrades := func(pnls ...float64) []TradeOutcome {
+		trades := make([]TradeOutcome, len(pnls))
+		for i, pnl := range pnls {
+			trades[i] = TradeOutcome{
+				Symbol:    "BTCUSDT",
+				Side:      "long",
+				PnL:       pnl,
+				OpenTime:  now.Add(time.Duration(i*2) * time.Hour),
+				CloseTime: now.Add(time.Duration(i*2+1) * time.Hour),
+			}
+		}
+		return trades
+	}
+
+	tests := []struct {
+		name string
+		pnls []float64
+		want float64
+	}{
+		{"empty", nil, 0},
+		{"profit without drawdown", []float64{100, 200}, 999.0},
+		// 净值 10000→11000→9900→10500：回撤 10%，总收益 5%
+		{"profit with drawdown", []float64{1000, -1100, 600}, 0.05 / 0.10},
+		// 净值 10000→9000：回撤 10%，总收益 -10%
+		{"loss", []float64{-1000}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := logger.calculateStatisticsFromTrades(makeTrades(tt.pnls...)).CalmarRatio
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("CalmarRatio = %.6f, want %.6f", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRecoveryFactor 测试恢复因子（净盈亏 / 最大回撤金额）及无回撤时的边界值
+func TestRecoveryFactor(t *testing.T) {
+	logger := &DecisionLogger{}
+	now := time.Now()
+	makeTrades := func(pnls ...float64) []TradeOutcome {
+		trades := make([]TradeOutcome, len(pnls))
+		for i, pnl := range pnls {
+			// 倒序放置，模拟缓存"最新在前"
+			trades[len(pnls)-1-i] = TradeOutcome{
+				Symbol:    "BTCUSDT",
+				Side:      "long",
+				PnL:       pnl,
+				OpenTime:  now.Add(time.Duration(i*2) * time.Hour),
+				CloseTime: now.Add(time.Duration(i*2+1) * time.Hour),
+			}
+		}
+		return trades
+	}
+
+	tests := []struct {
+		name string
+		pnls []float64
+		want float64
+	}{
+		{"empty", nil, 0},
+		{"profit without drawdown", []float64{100, 200}, 999.0},
+		// 净值 10000→11000→9900→10500：回撤 1100，净盈亏 500
+		{"profit with drawdown", []float64{1000, -1100, 600}, 500.0 / 1100.0},
+		// 两段回撤 300 与 500，取较大者
+		{"largest drawdown", []float64{400, -300, 800, -500, 100}, 500.0 / 500.0},
+		{"loss", []float64{-1000}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := logger.calculateStatisticsFromTrades(makeTrades(tt.pnls...)).RecoveryFactor
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("RecoveryFactor = %.6f, want %.6f", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestKellyFraction 测试整体与各币种 Kelly 比例：W - (1-W)/R，限制在 [0, 1]，样本不足或无亏损时为 0
+func TestKellyFraction(t *testing.T) {
+	now := time.Now()
+	var trades []TradeOutcome
+	add := func(symbol string, pnl float64, count int) {
+		for i := 0; i < count; i++ {
+			trades = append(trades, TradeOutcome{
+				Symbol:    symbol,
+				Side:      "long",
+				PnL:       pnl,
+				OpenTime:  now.Add(time.Duration(len(trades)) * time.Hour),
+				CloseTime: now.Add(time.Duration(len(trades))*time.Hour + time.Minute),
+			})
+		}
+	}
+	// BTC：W=0.6，R=100/50=2 → 0.6 - 0.4/2 = 0.4
+	add("BTCUSDT", 100, 6)
+	add("BTCUSDT", -50, 4)
+	// ETH：W=0.2，R=10/50=0.2 → 负值，截断为 0
+	add("ETHUSDT", 10, 2)
+	add("ETHUSDT", -50, 8)
+	// SOL：无亏损 → 0
+	add("SOLUSDT", 20, 10)
+
+	// 整体：30 笔，胜 18 笔共 820，亏 12 笔共 -600 → W=0.6，R=(820/18)/50
+	overallR := (820.0 / 18) / 50
+	overall := 0.6 - 0.4/overallR
+
+	tests := []struct {
+		name        string
+		minTrades   int
+		wantOverall float64
+		wantSymbols map[string]float64
+	}{
+		{"default minimum", 0, overall, map[string]float64{"BTCUSDT": 0.4, "ETHUSDT": 0, "SOLUSDT": 0}},
+		{"minimum above symbol sample", 11, overall, map[string]float64{"BTCUSDT": 0, "ETHUSDT": 0, "SOLUSDT": 0}},
+		{"minimum above total sample", 31, 0, map[string]float64{"BTCUSDT": 0, "ETHUSDT": 0, "SOLUSDT": 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &DecisionLogger{minKellyTrades: tt.minTrades}
+			analysis := l.calculateStatisticsFromTrades(trades)
+			if math.Abs(analysis.KellyFraction-tt.wantOverall) > 1e-9 {
+				t.Errorf("KellyFraction = %.6f, want %.6f", analysis.KellyFraction, tt.wantOverall)
+			}
+			for symbol, want := range tt.wantSymbols {
+				if got := analysis.SymbolStats[symbol].KellyFraction; math.Abs(got-want) > 1e-9 {
+					t.Errorf("%s KellyFraction = %.6f, want %.6f", symbol, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestBestWorstTrade 测试最佳/最差单笔交易为对应交易的副本，空样本时为 nil
+func TestBestWorstTrade(t *testing.T) {
+	logger := &DecisionLogger{}
+
+	empty := logger.calculateStatisticsFromTrades(nil)
+	if empty.BestTrade != nil || empty.WorstTrade != nil {
+		t.Errorf("empty trades: BestTrade=%v WorstTrade=%v, want nil", empty.BestTrade, empty.WorstTrade)
+	}
+
+	trades := []TradeOutcome{
+		{Symbol: "BTCUSDT", Side: "long", PnL: 50},
+		{Symbol: "ETHUSDT", Side: "short", PnL: -120},
+		{Symbol: "SOLUSDT", Side: "long", PnL: 300},
+		{Symbol: "BNBUSDT", Side: "long", PnL: -20},
+	}
+	analysis := logger.calculateStatisticsFromTrades(trades)
+
+	tests := []struct {
+		name       string
+		trade      *TradeOutcome
+		wantSymbol string
+		wantPnL    float64
+	}{
+		{"best", analysis.BestTrade, "SOLUSDT", 300},
+		{"worst", analysis.WorstTrade, "ETHUSDT", -120},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.trade == nil {
+				t.Fatal("trade is nil")
+			}
+			if tt.trade.Symbol != tt.wantSymbol || tt.trade.PnL != tt.wantPnL {
+				t.Errorf("got %s %.2f, want %s %.2f", tt.trade.Symbol, tt.trade.PnL, tt.wantSymbol, tt.wantPnL)
+			}
+		})
+	}
+
+	// 修改原切片不应影响已返回的副本
+	trades[2].PnL = 0
+	if analysis.BestTrade.PnL != 300 {
+		t.Errorf("BestTrade should be a copy, got PnL %.2f", analysis.BestTrade.PnL)
+	}
+}
+
+// TestSharpeRatioFromEquityMatchesTrades 测试净值曲线夏普比率与按交易重建的夏普比率口径一致
+// 收益率方差远小于 1，手写牛顿迭代（初值 1.0）无法收敛到正确的标准差
+func TestSharpeRatioFromEquityMatchesTrades(t *testing.T) {
+	tests := []struct {
+		name string
+		pnls []float64
+	}{
+		{"small moves", []float64{12, -8, 25, -3, 7, -15, 30}},
+		{"large moves", []float64{1500, -900, 2200, -1800, 600}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &DecisionLogger{maxEquitySize: 200}
+			base := time.Now()
+			equity := 10000.0
+			trades := make([]TradeOutcome, len(tt.pnls))
+			l.addEquityToCache(base, equity)
+			for i, pnl := range tt.pnls {
+				equity += pnl
+				l.addEquityToCache(base.Add(time.Duration(i+1)*time.Minute), equity)
+				trades[i] = TradeOutcome{PnL: pnl}
+			}
+
+			fromEquity := l.calculateSharpeRatioFromEquity()
+			fromTrades := l.calculateSharpeRatioFromTrades(trades)
+			if math.Abs(fromEquity-fromTrades) > 1e-9 {
+				t.Errorf("equity Sharpe = %.9f, trade Sharpe = %.9f", fromEquity, fromTrades)
+			}
+		})
+	}
+}
+
+// TestExpectancyAndAvgRMultiple 测试期望值与平均 R 倍数，并验证文件扫描与缓存两条路径结果一致
+func TestExpectancyAndAvgRMultiple(t *testing.T) {
+	l := NewDecisionLogger(t.TempDir()).(*DecisionLogger)
+
+	if empty := l.calculateStatisticsFromTrades(nil); empty.Expectancy != 0 || empty.AvgRMultiple != 0 {
+		t.Errorf("empty trades: expectancy=%v avgR=%v, want 0", empty.Expectancy, empty.AvgRMultiple)
+	}
+
+	base := time.Now().Add(-24 * time.Hour)
+	for i, exit := range []float64{110, 95, 120} {
+		openAt := base.Add(time.Duration(i*2) * time.Hour)
+		record := &DecisionRecord{Exchange: "binance", Success: true, Decisions: []DecisionAction{
+			{Action: "open_long", Symbol: "BTCUSDT", Quantity: 1, Price: 100, Leverage: 5, Timestamp: openAt, Success: true},
+			{Action: "close_long", Symbol: "BTCUSDT", Price: exit, Timestamp: openAt.Add(time.Hour), Success: true},
+		}}
+		if err := l.LogDecision(record); err != nil {
+			t.Fatalf("LogDecision: %v", err)
+		}
+	}
+
+	cached := l.calculateStatisticsFromTrades(l.GetRecentTrades(10))
+	scanned, err := l.AnalyzePerformance(100)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance: %v", err)
+	}
+
+	trades := l.GetRecentTrades(10)
+	var sumWin, sumLoss, sumR float64
+	wins, losses := 0, 0
+	for _, trade := range trades {
+		if trade.PnL > 0 {
+			sumWin += trade.PnL
+			wins++
+		} else {
+			sumLoss += trade.PnL
+			losses++
+		}
+		sumR += trade.PnL / trade.MarginUsed
+	}
+	wantExpectancy := float64(wins)/3*(sumWin/float64(wins)) + float64(losses)/3*(sumLoss/float64(losses))
+	wantR := sumR / 3
+
+	for name, perf := range map[string]*PerformanceAnalysis{"cache": cached, "scan": scanned} {
+		if math.Abs(perf.Expectancy-wantExpectancy) > 1e-9 {
+			t.Errorf("%s: Expectancy = %.6f, want %.6f", name, perf.Expectancy, wantExpectancy)
+		}
+		if math.Abs(perf.AvgRMultiple-wantR) > 1e-9 {
+			t.Errorf("%s: AvgRMultiple = %.6f, want %.6f", name, perf.AvgRMultiple, wantR)
+		}
+	}
+}
+
+// TestExportTradesCSV 测试导出 CSV 的列数、顺序与 limit 截断
+func TestExportTradesCSV(t *testing.T) {
+	l := NewDecisionLogger(t.TempDir()).(*DecisionLogger)
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, symbol := range []string{"BTCUSDT", "ETHUSDT", "SOLUSDT"} {
+		l.AddTradeToCache(TradeOutcome{
+			Symbol:      symbol,
+			Side:        "long",
+			Quantity:    1.5,
+			Leverage:    5,
+			OpenPrice:   100,
+			ClosePrice:  110,
+			PnL:         float64(i + 1),
+			PnLPct:      2.5,
+			Duration:    "1h0m0s",
+			OpenTime:    base.Add(time.Duration(i) * time.Hour),
+			CloseTime:   base.Add(time.Duration(i+1) * time.Hour),
+			PromptHash:  "abc",
+			WasStopLoss: i == 1,
+		})
+	}
+
+	tests := []struct {
+		name    string
+		limit   int
+		symbols []string
+	}{
+		{"all newest first", 10, []string{"SOLUSDT", "ETHUSDT", "BTCUSDT"}},
+		{"capped by limit", 2, []string{"SOLUSDT", "ETHUSDT"}},
+		{"non-positive exports all", 0, []string{"SOLUSDT", "ETHUSDT", "BTCUSDT"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf strings.Builder
+			if err := l.ExportTradesCSV(&buf, tt.limit); err != nil {
+				t.Fatalf("ExportTradesCSV: %v", err)
+			}
+			rows, err := csv.NewReader(strings.NewReader(buf.String())).ReadAll()
+			if err != nil {
+				t.Fatalf("parse CSV: %v", err)
+			}
+			if len(rows) != len(tt.symbols)+1 {
+				t.Fatalf("got %d rows, want %d", len(rows), len(tt.symbols)+1)
+			}
+			if rows[0][0] != "symbol" || rows[0][len(rows[0])-1] != "was_stop_loss" {
+				t.Errorf("unexpected header: %v", rows[0])
+			}
+			for i, row := range rows[1:] {
+				if len(row) != len(tradeCSVHeader) {
+					t.Fatalf("row %d has %d columns, want %d", i, len(row), len(tradeCSVHeader))
+				}
+				if row[0] != tt.symbols[i] {
+					t.Errorf("row %d symbol = %s, want %s", i, row[0], tt.symbols[i])
+				}
+			}
+		})
+	}
+
+	var buf strings.Builder
+	if err := l.ExportTradesCSV(&buf, 1); err != nil {
+		t.Fatalf("ExportTradesCSV: %v", err)
+	}
+	rows, _ := csv.NewReader(strings.NewReader(buf.String())).ReadAll()
+	want := []string{"SOLUSDT", "long", "1.5", "5", "100", "110", "3", "2.5",
+		"2025-01-01T02:00:00Z", "2025-01-01T03:00:00Z", "1h0m0s", "abc", "false"}
+	for i, v := range want {
+		if rows[1][i] != v {
+			t.Errorf("column %s = %q, want %q", tradeCSVHeader[i], rows[1][i], v)
+		}
+	}
+}
+
+// TestCacheSnapshotSkipsFullScan 测试重启时从启动快照与持久化交易缓存恢复，只读取快照之后的决策文件
+func TestCacheSnapshotSkipsFullScan(t *testing.T) {
+	tempDir := t.TempDir()
+	storePath := filepath.Join(tempDir, tradeStoreDir, tradeStoreFile)
+	snapshotPath := filepath.Join(tempDir, tradeStoreDir, cacheSnapshotFile)
+	base := time.Now().Add(-3 * time.Hour)
+
+	logActions := func(l *DecisionLogger, actions ...DecisionAction) {
+		t.Helper()
+		for _, action := range actions {
+			record := &DecisionRecord{Exchange: "binance", Success: true, Decisions: []DecisionAction{action}}
+			if err := l.LogDecision(record); err != nil {
+				t.Fatalf("LogDecision: %v", err)
+			}
+		}
+	}
+
+	logger1 := NewDecisionLogger(tempDir).(*DecisionLogger)
+	logActions(logger1,
+		DecisionAction{Action: "open_long", Symbol: "BTCUSDT", Quantity: 0.1, Price: 50000, Leverage: 5, Timestamp: base, Success: true},
+		DecisionAction{Action: "close_long", Symbol: "BTCUSDT", Price: 51000, Timestamp: base.Add(time.Hour), Success: true},
+		DecisionAction{Action: "open_short", Symbol: "ETHUSDT", Quantity: 1, Price: 3000, Leverage: 3, Timestamp: base.Add(90 * time.Minute), Success: true},
+	)
+	staleStore, err := os.ReadFile(storePath)
+	if err != nil {
+		t.Fatalf("trade store not written: %v", err)
+	}
+	staleSnapshot, err := os.ReadFile(snapshotPath)
+	if err != nil {
+		t.Fatalf("cache snapshot not written: %v", err)
+	}
+
+	// 重启：快照之后没有新的决策文件，一个文件都不读，未平仓持仓同样恢复
+	logger2 := NewDecisionLogger(tempDir).(*DecisionLogger)
+	if reads := logger2.decisionFileReads.Load(); reads != 0 {
+		t.Errorf("restart with snapshot read %d decision files, want 0", reads)
+	}
+	if trades := logger2.GetRecentTrades(10); len(trades) != 1 || trades[0].Symbol != "BTCUSDT" {
+		t.Fatalf("unexpected trades after restart: %+v", trades)
+	}
+	if pos := logger2.GetOpenPosition("ETHUSDT"); pos == nil || pos.EntryPrice != 3000 {
+		t.Fatalf("open ETHUSDT position not restored: %+v", pos)
+	}
+
+	logger2.SetCycleNumber(40) // 同一秒内文件名按字典序排列，避免与会话1的文件名冲突或乱序
+	logActions(logger2,
+		DecisionAction{Action: "close_short", Symbol: "ETHUSDT", Price: 2900, Timestamp: base.Add(2 * time.Hour), Success: true},
+	)
+
+	tests := []struct {
+		name      string
+		store     []byte
+		snapshot  []byte // nil 表示删除启动快照
+		wantReads func(reads int64) bool
+	}{
+		// 崩溃在写入交易缓存与快照之前：只回放快照之后的 1 个决策文件
+		{"stale snapshot replays newer files only", staleStore, staleSnapshot, func(reads int64) bool { return reads == 1 }},
+		{"missing snapshot falls back to full scan", staleStore, nil, func(reads int64) bool { return reads >= 4 }},
+		{"corrupt snapshot falls back to full scan", staleStore, []byte("{"), func(reads int64) bool { return reads >= 4 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(storePath, tt.store, 0600); err != nil {
+				t.Fatalf("write trade store: %v", err)
+			}
+			if tt.snapshot == nil {
+				if err := os.Remove(snapshotPath); err != nil && !os.IsNotExist(err) {
+					t.Fatalf("remove cache snapshot: %v", err)
+				}
+			} else if err := os.WriteFile(snapshotPath, tt.snapshot, 0600); err != nil {
+				t.Fatalf("write cache snapshot: %v", err)
+			}
+
+			l := NewDecisionLogger(tempDir).(*DecisionLogger)
+			if reads := l.decisionFileReads.Load(); !tt.wantReads(reads) {
+				t.Errorf("unexpected decision file reads: %d", reads)
+			}
+			trades := l.GetRecentTrades(10)
+			if len(trades) != 2 || trades[0].Symbol != "ETHUSDT" || trades[1].Symbol != "BTCUSDT" {
+				t.Fatalf("unexpected trades: %+v", trades)
+			}
+			if l.GetOpenPosition("ETHUSDT") != nil {
+				t.Errorf("ETHUSDT position should be closed")
+			}
+		})
+	}
+}
+
+// TestTopUpCacheFromTradeStore 测试以持久化交易缓存为基础，只回放最新平仓之后的决策文件
+func TestTopUpCacheFromTradeStore(t *testing.T) {
+	tempDir := t.TempDir()
+	base := time.Date(2025, 1, 1, 8, 0, 0, 0, time.Local)
+
+	cycle := 0
+	writeDecisionFile := func(at time.Time, action DecisionAction) {
+		t.Helper()
+		cycle++
+		action.Timestamp = at
+		action.Success = true
+		record := DecisionRecord{Timestamp: at, CycleNumber: cycle, Exchange: "binance", Success: true, Decisions: []DecisionAction{action}}
+		data, _ := json.Marshal(record)
+		name := fmt.Sprintf("decision_%s_cycle%d.json", at.Format("20060102_150405.000"), cycle)
+		if err := os.WriteFile(filepath.Join(tempDir, name), data, 0600); err != nil {
+			t.Fatalf("write decision file: %v", err)
+		}
+	}
+
+	// 会话1：两笔交易经全量扫描写入持久化交易缓存
+	writeDecisionFile(base, DecisionAction{Action: "open_long", Symbol: "BTCUSDT", Quantity: 0.1, Price: 50000, Leverage: 5})
+	writeDecisionFile(base.Add(time.Hour), DecisionAction{Action: "close_long", Symbol: "BTCUSDT", Price: 51000})
+	writeDecisionFile(base.Add(2*time.Hour), DecisionAction{Action: "open_short", Symbol: "ETHUSDT", Quantity: 1, Price: 3000, Leverage: 3})
+	writeDecisionFile(base.Add(3*time.Hour), DecisionAction{Action: "close_short", Symbol: "ETHUSDT", Price: 2900})
+	if trades := NewDecisionLogger(tempDir).GetRecentTrades(10); len(trades) != 2 {
+		t.Fatalf("expected 2 trades after initial scan, got %d", len(trades))
+	}
+
+	// 截断缓存：持久化缓存只保留 ETH 交易（其平仓时间即补齐的截止点）
+	storePath := filepath.Join(tempDir, tradeStoreDir, tradeStoreFile)
+	persisted, err := loadPersistedTrades(storePath)
+	if err != nil || len(persisted) != 2 {
+		t.Fatalf("loadPersistedTrades: %d trades, err %v", len(persisted), err)
+	}
+	var kept []TradeOutcome
+	for _, trade := range persisted {
+		if trade.Symbol == "ETHUSDT" {
+			kept = append(kept, trade)
+		}
+	}
+	if err := writePersistedTrades(storePath, kept); err != nil {
+		t.Fatalf("writePersistedTrades: %v", err)
+	}
+
+	// 崩溃前新增的一笔交易尚未进入缓存
+	writeDecisionFile(base.Add(4*time.Hour), DecisionAction{Action: "open_long", Symbol: "SOLUSDT", Quantity: 10, Price: 100, Leverage: 5})
+	writeDecisionFile(base.Add(5*time.Hour), DecisionAction{Action: "close_long", Symbol: "SOLUSDT", Price: 110})
+
+	l := NewDecisionLogger(tempDir).(*DecisionLogger)
+	if reads := l.decisionFileReads.Load(); reads != 2 {
+		t.Errorf("top-up read %d decision files, want only the 2 newer ones", reads)
+	}
+	trades := l.GetRecentTrades(10)
+	var symbols []string
+	for _, trade := range trades {
+		symbols = append(symbols, trade.Symbol)
+	}
+	// 只补齐截止点（ETH 平仓）之后的 SOL 交易；截止点之前被截断的 BTC 交易不会重新扫描
+	if got, want := strings.Join(symbols, ","), "SOLUSDT,ETHUSDT"; got != want {
+		t.Fatalf("trades after top-up = %s, want %s", got, want)
+	}
+	if reloaded, _ := loadPersistedTrades(storePath); len(reloaded) != 2 {
+		t.Errorf("topped-up trade should be persisted, store has %d trades", len(reloaded))
+	}
+}
+
+// TestTopUpCacheStraddlingTrade 测试开仓早于补齐截止点、平仓晚于截止点的交易在增量补齐时能正确配对
+func TestTopUpCacheStraddlingTrade(t *testing.T) {
+	tempDir := t.TempDir()
+	base := time.Date(2025, 1, 1, 8, 0, 0, 0, time.Local)
+
+	cycle := 0
+	writeDecisionFile := func(at time.Time, action DecisionAction) {
+		t.Helper()
+		cycle++
+		action.Timestamp = at
+		action.Success = true
+		record := DecisionRecord{Timestamp: at, CycleNumber: cycle, Exchange: "binance", Success: true, Decisions: []DecisionAction{action}}
+		data, _ := json.Marshal(record)
+		name := fmt.Sprintf("decision_%s_cycle%d.json", at.Format("20060102_150405.000"), cycle)
+		if err := os.WriteFile(filepath.Join(tempDir, name), data, 0600); err != nil {
+			t.Fatalf("write decision file: %v", err)
+		}
+	}
+
+	// 会话1：BTC 开仓未平，ETH 开平仓完成；ETH 平仓时间即下次启动的补齐截止点
+	writeDecisionFile(base, DecisionAction{Action: "open_long", Symbol: "BTCUSDT", Quantity: 0.1, Price: 50000, Leverage: 5})
+	writeDecisionFile(base.Add(time.Hour), DecisionAction{Action: "open_short", Symbol: "ETHUSDT", Quantity: 1, Price: 3000, Leverage: 3})
+	writeDecisionFile(base.Add(2*time.Hour), DecisionAction{Action: "close_short", Symbol: "ETHUSDT", Price: 2900})
+	logger1 := NewDecisionLogger(tempDir)
+	if trades := logger1.GetRecentTrades(10); len(trades) != 1 || trades[0].Symbol != "ETHUSDT" {
+		t.Fatalf("unexpected trades after initial scan: %+v", trades)
+	}
+	if logger1.GetOpenPosition("BTCUSDT") == nil {
+		t.Fatalf("open BTCUSDT position not recovered")
+	}
+
+	// BTC 平仓已写入决策文件，但进程在写入交易缓存前崩溃
+	writeDecisionFile(base.Add(3*time.Hour), DecisionAction{Action: "close_long", Symbol: "BTCUSDT", Price: 51000})
+
+	l := NewDecisionLogger(tempDir).(*DecisionLogger)
+	if reads := l.decisionFileReads.Load(); reads != 1 {
+		t.Errorf("top-up read %d decision files, want only the BTC close", reads)
+	}
+	trades := l.GetRecentTrades(10)
+	var symbols []string
+	for _, trade := range trades {
+		symbols = append(symbols, trade.Symbol)
+	}
+	if got, want := strings.Join(symbols, ","), "BTCUSDT,ETHUSDT"; got != want {
+		t.Fatalf("trades after top-up = %s, want %s", got, want)
+	}
+	if !trades[0].OpenTime.Equal(base) {
+		t.Errorf("BTCUSDT OpenTime = %v, want %v", trades[0].OpenTime, base)
+	}
+	if l.GetOpenPosition("BTCUSDT") != nil || l.GetOpenPosition("ETHUSDT") != nil {
+		t.Errorf("no position should remain open after top-up")
+	}
+}
+
+// TestFundingPaidDeductedFromPnL 测试平仓动作上记录的资金费从交易盈亏中扣除（缓存与扫描结果一致）
+func TestFundingPaidDeductedFromPnL(t *testing.T) {
+	tests := []struct {
+		name    string
+		partial float64 // 部分平仓（0.05）记录的资金费，0 表示不做部分平仓
+		close   float64 // 平仓记录的资金费
+		want    float64
+	}{
+		{"no funding", 0, 0, 0},
+		{"paid funding", 0, 4, 4},
+		{"received funding", 0, -3, -3},
+		{"funding across partial close", 1.5, 2.5, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewDecisionLogger(t.TempDir()).(*DecisionLogger)
+			openAt := time.Now().Add(-8 * time.Hour)
+			actions := []DecisionAction{
+				{Action: "open_long", Symbol: "BTCUSDT", Quantity: 0.1, Price: 50000, Leverage: 5, Timestamp: openAt, Success: true},
+			}
+			if tt.partial != 0 {
+				actions = append(actions, DecisionAction{Action: "partial_close", Symbol: "BTCUSDT", Quantity: 0.05, Price: 51000, Timestamp: openAt.Add(4 * time.Hour), Success: true, FundingPaid: tt.partial})
+			}
+			actions = append(actions, DecisionAction{Action: "close_long", Symbol: "BTCUSDT", Price: 51000, Timestamp: openAt.Add(8 * time.Hour), Success: true, FundingPaid: tt.close})
+			for _, action := range actions {
+				if err := l.LogDecision(&DecisionRecord{Exchange: "binance", Success: true, Decisions: []DecisionAction{action}}); err != nil {
+					t.Fatalf("LogDecision: %v", err)
+				}
+			}
+
+			// 不含资金费的盈亏：价差 - 开平仓 Taker 手续费（默认 0.05%）
+			want := 0.1*(51000-50000) - (0.1*50000+0.1*51000)*0.0005 - tt.want
+			cached := l.GetRecentTrades(1)
+			if len(cached) != 1 {
+				t.Fatalf("expected 1 cached trade, got %d", len(cached))
+			}
+			if math.Abs(cached[0].PnL-want) > 1e-9 || math.Abs(cached[0].FundingPaid-tt.want) > 1e-9 {
+				t.Errorf("cached trade PnL = %.4f FundingPaid = %.4f, want %.4f / %.4f", cached[0].PnL, cached[0].FundingPaid, want, tt.want)
+			}
+
+			scanned, err := l.AnalyzePerformance(100)
+			if err != nil {
+				t.Fatalf("AnalyzePerformance: %v", err)
+			}
+			if len(scanned.RecentTrades) != 1 {
+				t.Fatalf("expected 1 scanned trade, got %d", len(scanned.RecentTrades))
+			}
+			if trade := scanned.RecentTrades[0]; math.Abs(trade.PnL-want) > 1e-9 || math.Abs(trade.FundingPaid-tt.want) > 1e-9 {
+				t.Errorf("scanned trade PnL = %.4f FundingPaid = %.4f, want %.4f / %.4f", trade.PnL, trade.FundingPaid, want, tt.want)
+			}
+		})
+	}
+}
+
+// TestCustomMakerFeeRates 测试 Maker 成交的平仓使用构造时覆盖的 Maker 费率（缓存与扫描结果一致）
+func TestCustomMakerFeeRates(t *testing.T) {
+	tests := []struct {
+		name      string
+		rates     map[string]float64
+		wantMaker float64
+	}{
+		{"default binance maker rate", nil, 0.0002},
+		{"custom binance maker rate", map[string]float64{"binance": 0.0001}, 0.0001},
+		{"override for other exchange ignored", map[string]float64{"aster": 0}, 0.0002},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewDecisionLoggerWithOptions(t.TempDir(), DecisionLoggerOptions{MakerFeeRates: tt.rates}).(*DecisionLogger)
+			openAt := time.Now().Add(-2 * time.Hour)
+			for _, action := range []DecisionAction{
+				{Action: "open_long", Symbol: "BTCUSDT", Quantity: 0.1, Price: 50000, Leverage: 5, Timestamp: openAt, Success: true},
+				{Action: "close_long", Symbol: "BTCUSDT", Price: 51000, Timestamp: openAt.Add(time.Hour), Success: true, IsMaker: true},
+			} {
+				if err := l.LogDecision(&DecisionRecord{Exchange: "binance", Success: true, Decisions: []DecisionAction{action}}); err != nil {
+					t.Fatalf("LogDecision: %v", err)
+				}
+			}
+
+			// 开仓按 Taker（默认 0.05%），平仓按 Maker
+			want := 0.1*(51000-50000) - 0.1*50000*0.0005 - 0.1*51000*tt.wantMaker
+			cached := l.GetRecentTrades(1)
+			if len(cached) != 1 || math.Abs(cached[0].PnL-want) > 1e-9 {
+				t.Fatalf("cached trade PnL = %+v, want %.4f", cached, want)
+			}
+			scanned, err := l.AnalyzePerformance(100)
+			if err != nil {
+				t.Fatalf("AnalyzePerformance: %v", err)
+			}
+			if len(scanned.RecentTrades) != 1 || math.Abs(scanned.RecentTrades[0].PnL-want) > 1e-9 {
+				t.Errorf("scanned trade PnL = %+v, want %.4f", scanned.RecentTrades, want)
+			}
+		})
+	}
+}
+
+// TestCustomTakerFeeRates 测试构造时覆盖交易所 Taker 费率后 PnL 随之变化
+func TestCustomTakerFeeRates(t *testing.T) {
+	tests := []struct {
+		name     string
+		rates    map[string]float64
+		wantRate float64
+	}{
+		{"default binance rate", nil, 0.0005},
+		{"custom binance rate", map[string]float64{"binance": 0.0002}, 0.0002},
+		{"override for other exchange ignored", map[string]float64{"aster": 0.0001}, 0.0005},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewDecisionLoggerWithOptions(t.TempDir(), DecisionLoggerOptions{TakerFeeRates: tt.rates}).(*DecisionLogger)
+			openAt := time.Now().Add(-2 * time.Hour)
+			for _, action := range []DecisionAction{
+				{Action: "open_long", Symbol: "BTCUSDT", Quantity: 0.1, Price: 50000, Leverage: 5, Timestamp: openAt, Success: true},
+				{Action: "close_long", Symbol: "BTCUSDT", Price: 51000, Timestamp: openAt.Add(time.Hour), Success: true},
+			} {
+				if err := l.LogDecision(&DecisionRecord{Exchange: "binance", Success: true, Decisions: []DecisionAction{action}}); err != nil {
+					t.Fatalf("LogDecision: %v", err)
+				}
+			}
+
+			want := 0.1*(51000-50000) - (0.1*50000+0.1*51000)*tt.wantRate
+			cached := l.GetRecentTrades(1)
+			if len(cached) != 1 || math.Abs(cached[0].PnL-want) > 1e-9 {
+				t.Fatalf("cached trade PnL = %+v, want %.4f", cached, want)
+			}
+			scanned, err := l.AnalyzePerformance(100)
+			if err != nil {
+				t.Fatalf("AnalyzePerformance: %v", err)
+			}
+			if len(scanned.RecentTrades) != 1 || math.Abs(scanned.RecentTrades[0].PnL-want) > 1e-9 {
+				t.Errorf("scanned trade PnL = %+v, want %.4f", scanned.RecentTrades, want)
+			}
+		})
+	}
+}
+
+// TestUpdateCacheFromDecision_PartialClose 测试部分平仓在缓存中累积，完全平仓后只产生一笔交易
+func TestUpdateCacheFromDecision_PartialClose(t *testing.T) {
+	openAt := time.Now().Add(-4 * time.Hour)
+	fee := 0.0005
+	leg := func(qty, exit float64) float64 {
+		return qty*(exit-100) - qty*100*fee - qty*exit*fee
+	}
+
+	tests := []struct {
+		name    string
+		closes  []DecisionAction
+		wantPnL float64
+	}{
+		{
+			name: "partial then full close",
+			closes: []DecisionAction{
+				{Action: "partial_close", Symbol: "BTCUSDT", Quantity: 0.5, Price: 110, Timestamp: openAt.Add(time.Hour), Success: true},
+				{Action: "close_long", Symbol: "BTCUSDT", Price: 120, Timestamp: openAt.Add(2 * time.Hour), Success: true},
+			},
+			wantPnL: leg(0.5, 110) + leg(0.5, 120),
+		},
+		{
+			name: "partials close whole position",
+			closes: []DecisionAction{
+				{Action: "partial_close", Symbol: "BTCUSDT", Quantity: 0.4, Price: 90, Timestamp: openAt.Add(time.Hour), Success: true},
+				{Action: "partial_close", Symbol: "BTCUSDT", Quantity: 0.6, Price: 105, Timestamp: openAt.Add(2 * time.Hour), Success: true},
+			},
+			wantPnL: leg(0.4, 90) + leg(0.6, 105),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewDecisionLogger(t.TempDir()).(*DecisionLogger)
+			actions := append([]DecisionAction{
+				{Action: "open_long", Symbol: "BTCUSDT", Quantity: 1.0, Price: 100, Leverage: 5, Timestamp: openAt, Success: true},
+			}, tt.closes...)
+			for i, action := range actions {
+				if err := l.LogDecision(&DecisionRecord{Exchange: "binance", Success: true, Decisions: []DecisionAction{action}}); err != nil {
+					t.Fatalf("LogDecision: %v", err)
+				}
+				if i == 1 {
+					pos := l.GetOpenPosition("BTCUSDT")
+					if pos == nil || len(l.GetRecentTrades(10)) != 0 {
+						t.Fatalf("first partial close should keep position open without emitting a trade")
+					}
+					if math.Abs(pos.RemainingQuantity-(1.0-tt.closes[0].Quantity)) > 1e-9 {
+						t.Errorf("RemainingQuantity = %.4f, want %.4f", pos.RemainingQuantity, 1.0-tt.closes[0].Quantity)
+					}
+				}
+			}
+
+			trades := l.GetRecentTrades(10)
+			if len(trades) != 1 {
+				t.Fatalf("expected 1 cached trade, got %d", len(trades))
+			}
+			if math.Abs(trades[0].PnL-tt.wantPnL) > 1e-9 {
+				t.Errorf("cached PnL = %.6f, want %.6f", trades[0].PnL, tt.wantPnL)
+			}
+			if trades[0].Quantity != 1.0 {
+				t.Errorf("Quantity = %.4f, want original 1.0", trades[0].Quantity)
+			}
+			if l.GetOpenPosition("BTCUSDT") != nil {
+				t.Errorf("position should be closed")
+			}
+
+			scanned, err := l.AnalyzePerformance(100)
+			if err != nil {
+				t.Fatalf("AnalyzePerformance: %v", err)
+			}
+			if len(scanned.RecentTrades) != 1 || math.Abs(scanned.RecentTrades[0].PnL-trades[0].PnL) > 1e-9 {
+				t.Errorf("scan path disagrees with cache: %+v vs %.6f", scanned.RecentTrades, trades[0].PnL)
+			}
+		})
+	}
+}
+
+// TestHoldingTimeStats 测试持仓时长统计（平均、中位数、盈亏分组）
+func TestHoldingTimeStats(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	trade := func(minutes int, pnl float64) TradeOutcome {
+		return TradeOutcome{
+			Symbol:    "BTCUSDT",
+			Side:      "long",
+			PnL:       pnl,
+			OpenTime:  base,
+			CloseTime: base.Add(time.Duration(minutes) * time.Minute),
+		}
+	}
+
+	tests := []struct {
+		name       string
+		trades     []TradeOutcome
+		wantAvg    float64
+		wantMedian float64
+		wantWin    float64
+		wantLoss   float64
+	}{
+		{"empty", nil, 0, 0, 0, 0},
+		{"odd count", []TradeOutcome{trade(10, 5), trade(30, -2), trade(60, 8)}, 100.0 / 3, 30, 35, 30},
+		{"even count with break-even", []TradeOutcome{trade(20, 0), trade(40, -1), trade(90, -3), trade(10, 4)}, 40, 30, 10, 65},
+	}
+
+	l := &DecisionLogger{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			perf := l.calculateStatisticsFromTrades(tt.trades)
+			for field, got := range map[string][2]float64{
+				"AvgHoldingMinutes":     {perf.AvgHoldingMinutes, tt.wantAvg},
+				"MedianHoldingMinutes":  {perf.MedianHoldingMinutes, tt.wantMedian},
+				"AvgWinHoldingMinutes":  {perf.AvgWinHoldingMinutes, tt.wantWin},
+				"AvgLossHoldingMinutes": {perf.AvgLossHoldingMinutes, tt.wantLoss},
+			} {
+				if math.Abs(got[0]-got[1]) > 1e-9 {
+					t.Errorf("%s = %.4f, want %.4f", field, got[0], got[1])
+				}
+			}
+		})
+	}
+}
+
+// TestAnalyzePerformanceRange 测试按时间范围读取记录与分析交易（含跨日、左闭右开、空范围）
+func TestAnalyzePerformanceRange(t *testing.T) {
+	tempDir := t.TempDir()
+	l := NewDecisionLogger(tempDir).(*DecisionLogger)
+
+	day1 := time.Date(2025, 3, 1, 0, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+	writeRecord := func(cycle int, ts time.Time, action DecisionAction) {
+		action.Timestamp = ts
+		action.Success = true
+		record := DecisionRecord{Timestamp: ts, CycleNumber: cycle, Exchange: "binance", Success: true, Decisions: []DecisionAction{action}}
+		data, _ := json.Marshal(record)
+		name := fmt.Sprintf("decision_%s_cycle%d.json", ts.Format("20060102_150405"), cycle)
+		if err := os.WriteFile(filepath.Join(tempDir, name), data, 0600); err != nil {
+			t.Fatalf("write record: %v", err)
+		}
+	}
+	writeRecord(1, day1.Add(10*time.Hour), DecisionAction{Action: "open_long", Symbol: "BTCUSDT", Quantity: 1, Price: 100, Leverage: 5})
+	writeRecord(2, day1.Add(12*time.Hour), DecisionAction{Action: "close_long", Symbol: "BTCUSDT", Price: 110})
+	writeRecord(3, day2.Add(9*time.Hour), DecisionAction{Action: "open_short", Symbol: "ETHUSDT", Quantity: 1, Price: 50, Leverage: 3})
+	writeRecord(4, day2.Add(11*time.Hour), DecisionAction{Action: "close_short", Symbol: "ETHUSDT", Price: 45})
+
+	tests := []struct {
+		name        string
+		start, end  time.Time
+		wantRecords int
+		wantSymbols []string
+	}{
+		{"single day", day1, day2, 2, []string{"BTCUSDT"}},
+		{"multi day", day1, day2.AddDate(0, 0, 1), 4, []string{"ETHUSDT", "BTCUSDT"}},
+		{"end is exclusive", day1, day1.Add(12 * time.Hour), 1, nil},
+		{"open outside window", day1.Add(11 * time.Hour), day2.Add(10 * time.Hour), 2, nil},
+		{"empty range", day2, day1, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := l.GetRecordsByDateRange(tt.start, tt.end)
+			if err != nil {
+				t.Fatalf("GetRecordsByDateRange: %v", err)
+			}
+			if len(records) != tt.wantRecords {
+				t.Fatalf("got %d records, want %d", len(records), tt.wantRecords)
+			}
+			for i := 1; i < len(records); i++ {
+				if records[i].Timestamp.Before(records[i-1].Timestamp) {
+					t.Errorf("records not in chronological order")
+				}
+			}
+
+			perf, err := l.AnalyzePerformanceRange(tt.start, tt.end)
+			if err != nil {
+				t.Fatalf("AnalyzePerformanceRange: %v", err)
+			}
+			if perf.TotalTrades != len(tt.wantSymbols) || len(perf.RecentTrades) != len(tt.wantSymbols) {
+				t.Fatalf("TotalTrades = %d, want %d", perf.TotalTrades, len(tt.wantSymbols))
+			}
+			for i, symbol := range tt.wantSymbols {
+				if perf.RecentTrades[i].Symbol != symbol {
+					t.Errorf("trade %d symbol = %s, want %s", i, perf.RecentTrades[i].Symbol, symbol)
+				}
+			}
+		})
+	}
+
+	if len(l.GetRecentTrades(10)) != 0 {
+		t.Errorf("range analysis must not write to the trade cache")
+	}
+}
+
+// TestSideStats 测试多空方向统计，缓存与文件扫描两条路径一致
+func TestSideStats(t *testing.T) {
+	l := NewDecisionLogger(t.TempDir()).(*DecisionLogger)
+	base := time.Now().Add(-24 * time.Hour)
+	legs := []struct {
+		symbol, side string
+		open, close  float64
+	}{
+		{"BTCUSDT", "long", 100, 110},
+		{"ETHUSDT", "short", 50, 55},
+		{"SOLUSDT", "short", 20, 18},
+		{"BNBUSDT", "long", 300, 330},
+	}
+	for i, leg := range legs {
+		openAt := base.Add(time.Duration(i*2) * time.Hour)
+		record := &DecisionRecord{Exchange: "binance", Success: true, Decisions: []DecisionAction{
+			{Action: "open_" + leg.side, Symbol: leg.symbol, Quantity: 1, Price: leg.open, Leverage: 5, Timestamp: openAt, Success: true},
+			{Action: "close_" + leg.side, Symbol: leg.symbol, Price: leg.close, Timestamp: openAt.Add(time.Hour), Success: true},
+		}}
+		if err := l.LogDecision(record); err != nil {
+			t.Fatalf("LogDecision: %v", err)
+		}
+	}
+
+	trades := l.GetRecentTrades(10)
+	want := map[string]*SymbolPerformance{}
+	for _, trade := range trades {
+		if want[trade.Side] == nil {
+			want[trade.Side] = &SymbolPerformance{Symbol: trade.Side}
+		}
+		want[trade.Side].TotalTrades++
+		want[trade.Side].TotalPnL += trade.PnL
+		if trade.PnL > 0 {
+			want[trade.Side].WinningTrades++
+		}
+	}
+
+	cached := l.calculateStatisticsFromTrades(trades)
+	scanned, err := l.AnalyzePerformance(100)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance: %v", err)
+	}
+
+	tests := []struct {
+		side        string
+		wantWinRate float64
+	}{
+		{"long", 100},
+		{"short", 50},
+	}
+	for name, perf := range map[string]*PerformanceAnalysis{"cache": cached, "scan": scanned} {
+		for _, tt := range tests {
+			got := perf.SideStats[tt.side]
+			if got == nil {
+				t.Fatalf("%s: missing %s side stats", name, tt.side)
+			}
+			if got.Symbol != tt.side || got.TotalTrades != want[tt.side].TotalTrades {
+				t.Errorf("%s %s: got %+v, want %d trades", name, tt.side, got, want[tt.side].TotalTrades)
+			}
+			if math.Abs(got.WinRate-tt.wantWinRate) > 1e-9 {
+				t.Errorf("%s %s: WinRate = %.2f, want %.2f", name, tt.side, got.WinRate, tt.wantWinRate)
+			}
+			wantAvg := want[tt.side].TotalPnL / float64(want[tt.side].TotalTrades)
+			if math.Abs(got.AvgPnL-wantAvg) > 1e-9 {
+				t.Errorf("%s %s: AvgPnL = %.4f, want %.4f", name, tt.side, got.AvgPnL, wantAvg)
+			}
+		}
+	}
+}
+
+// TestGetEquityCurve 测试净值曲线按时间正序返回、按 limit 截断且为副本
+func TestGetEquityCurve(t *testing.T) {
+	l := NewDecisionLogger(t.TempDir()).(*DecisionLogger)
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		l.addEquityToCache(base.Add(time.Duration(i)*time.Minute), 1000+float64(i))
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		want  []float64
+	}{
+		{"all points oldest first", 10, []float64{1000, 1001, 1002, 1003, 1004}},
+		{"capped to most recent", 2, []float64{1003, 1004}},
+		{"non-positive returns all", 0, []float64{1000, 1001, 1002, 1003, 1004}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			curve := l.GetEquityCurve(tt.limit)
+			if len(curve) != len(tt.want) {
+				t.Fatalf("got %d points, want %d", len(curve), len(tt.want))
+			}
+			for i, equity := range tt.want {
+				if curve[i].Equity != equity {
+					t.Errorf("point %d equity = %.0f, want %.0f", i, curve[i].Equity, equity)
+				}
+			}
+		})
+	}
+
+	curve := l.GetEquityCurve(1)
+	curve[0].Equity = -1
+	if got := l.GetEquityCurve(1)[0].Equity; got != 1004 {
+		t.Errorf("mutating returned curve changed cache: got %.0f", got)
+	}
+}
+
+// TestEquityCurveDrawdown 测试净值先创新高再回落时按运行峰值计算回撤，且峰值被挤出缓存后重新计算
+func TestEquityCurveDrawdown(t *testing.T) {
+	l := &DecisionLogger{maxEquitySize: 200}
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	equities := []float64{1000, 1100, 1200, 1080, 900, 1250, 1125}
+	for i, equity := range equities {
+		l.addEquityToCache(base.Add(time.Duration(i)*time.Minute), equity)
+	}
+
+	want := []float64{0, 0, 0, 10, 25, 0, 10}
+	curve := l.GetEquityCurve(0)
+	if len(curve) != len(want) {
+		t.Fatalf("got %d points, want %d", len(curve), len(want))
+	}
+	for i, dd := range want {
+		if math.Abs(curve[i].DrawdownPct-dd) > 1e-9 {
+			t.Errorf("point %d (equity %.0f) drawdown = %.4f%%, want %.4f%%", i, curve[i].Equity, curve[i].DrawdownPct, dd)
+		}
+	}
+
+	// 缓存只保留 2 个点：1200 的峰值被挤出后，900 的回撤只相对窗口内的 1000 计算
+	small := &DecisionLogger{maxEquitySize: 2}
+	for i, equity := range []float64{1200, 1000, 900} {
+		small.addEquityToCache(base.Add(time.Duration(i)*time.Minute), equity)
+	}
+	if got := small.GetEquityCurve(0)[1].DrawdownPct; math.Abs(got-10) > 1e-9 {
+		t.Errorf("drawdown after peak evicted = %.4f%%, want 10%% (relative to 1000)", got)
+	}
+}
+
+// TestAnnualizedSharpe 测试设置每年周期数后夏普比率按 sqrt(n) 缩放
+func TestAnnualizedSharpe(t *testing.T) {
+	trades := []TradeOutcome{{PnL: 100}, {PnL: -50}, {PnL: 80}, {PnL: -20}}
+
+	tests := []struct {
+		name           string
+		periodsPerYear float64
+		wantFactor     float64
+	}{
+		{"default period-level", 0, 1},
+		{"negative treated as unset", -5, 1},
+		{"3-minute cadence", 175200, math.Sqrt(175200)},
+	}
+
+	raw := (&DecisionLogger{}).calculateSharpeRatioFromTrades(trades)
+	if raw == 0 {
+		t.Fatalf("expected non-zero raw sharpe")
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &DecisionLogger{}
+			l.SetPeriodsPerYear(tt.periodsPerYear)
+			if got := l.calculateSharpeRatioFromTrades(trades); math.Abs(got-raw*tt.wantFactor) > 1e-9 {
+				t.Errorf("sharpe = %.6f, want %.6f", got, raw*tt.wantFactor)
+			}
+		})
+	}
+}
+
+// TestRiskFreeRateLowersSharpe 测试设置正的无风险收益率后三种夏普比率计算都会降低，默认 0 时结果不变
+func TestRiskFreeRateLowersSharpe(t *testing.T) {
+	pnls := []float64{100, -50, 80, -20, 60}
+	trades := make([]TradeOutcome, len(pnls))
+	records := []*DecisionRecord{{AccountState: AccountSnapshot{TotalBalance: 10000}}}
+	equity := 10000.0
+	for i, pnl := range pnls {
+		trades[i] = TradeOutcome{PnL: pnl}
+		equity += pnl
+		records = append(records, &DecisionRecord{AccountState: AccountSnapshot{TotalBalance: equity}})
+	}
+
+	sharpes := func(l *DecisionLogger) [3]float64 {
+		l.maxEquitySize = 200
+		for i, r := range records {
+			l.addEquityToCache(time.Unix(int64(i), 0), r.AccountState.TotalBalance)
+		}
+		return [3]float64{
+			l.calculateSharpeRatioFromTrades(trades),
+			l.calculateSharpeRatio(records),
+			l.calculateSharpeRatioFromEquity(),
+		}
+	}
+
+	base := sharpes(&DecisionLogger{})
+	zero := &DecisionLogger{}
+	zero.SetRiskFreeRatePerPeriod(0)
+	if got := sharpes(zero); got != base {
+		t.Errorf("zero risk-free rate changed sharpe: %v vs %v", got, base)
+	}
+
+	withRate := &DecisionLogger{}
+	withRate.SetRiskFreeRatePerPeriod(0.001)
+	got := sharpes(withRate)
+	names := []string{"fromTrades", "fromRecords", "fromEquity"}
+	for i := range got {
+		if base[i] <= 0 {
+			t.Fatalf("%s: expected positive baseline sharpe, got %.6f", names[i], base[i])
+		}
+		if got[i] >= base[i] {
+			t.Errorf("%s: sharpe with risk-free rate = %.6f, want < %.6f", names[i], got[i], base[i])
+		}
+	}
+}
+
+// TestLogDecision_ConcurrentCycleNumbers 测试并发记录时周期编号唯一、文件互不覆盖
+func TestLogDecision_ConcurrentCycleNumbers(t *testing.T) {
+	tempDir := t.TempDir()
+	l := NewDecisionLogger(tempDir).(*DecisionLogger)
+	l.SetCycleNumber(100)
+
+	const workers, perWorker = 8, 10
+	var wg sync.WaitGroup
+	cycles := make(chan int, workers*perWorker)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				record := &DecisionRecord{Success: true}
+				if err := l.LogDecision(record); err != nil {
+					t.Errorf("LogDecision: %v", err)
+					return
+				}
+				cycles <- record.CycleNumber
+			}
+		}()
+	}
+	wg.Wait()
+	close(cycles)
+
+	seen := make(map[int]bool)
+	for cycle := range cycles {
+		if seen[cycle] {
+			t.Errorf("duplicate cycle number %d", cycle)
+		}
+		if cycle <= 100 || cycle > 100+workers*perWorker {
+			t.Errorf("cycle number %d out of range", cycle)
+		}
+		seen[cycle] = true
+	}
+
+	files, err := filepath.Glob(filepath.Join(tempDir, "decision_*.json"))
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	if len(files) != workers*perWorker {
+		t.Errorf("got %d decision files, want %d", len(files), workers*perWorker)
+	}
+}
+
+// TestLogDecision_NoFilenameCollision 测试同一秒内重置周期编号后连续记录不会互相覆盖
+func TestLogDecision_NoFilenameCollision(t *testing.T) {
+	tempDir := t.TempDir()
+	l := NewDecisionLogger(tempDir).(*DecisionLogger)
+
+	for i := 0; i < 2; i++ {
+		l.SetCycleNumber(0) // 每次都得到 cycle1
+		if err := l.LogDecision(&DecisionRecord{Success: true, ExecutionLog: []string{fmt.Sprintf("run %d", i)}}); err != nil {
+			t.Fatalf("LogDecision: %v", err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(tempDir, "decision_*_cycle1*.json"))
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 decision files on disk, got %d: %v", len(files), files)
+	}
+
+	// 毫秒时间戳也相同时追加序号
+	name1, err := writeNewFile(tempDir, "dup", ".json", []byte("1"))
+	if err != nil {
+		t.Fatalf("writeNewFile: %v", err)
+	}
+	name2, err := writeNewFile(tempDir, "dup", ".json", []byte("2"))
+	if err != nil {
+		t.Fatalf("writeNewFile: %v", err)
+	}
+	if name1 != "dup.json" || name2 != "dup_2.json" {
+		t.Errorf("got names %q, %q; want dup.json, dup_2.json", name1, name2)
+	}
+}
+
+// TestGetRecordsPage 测试分页读取记录（每页 1 条、跨页、越界）
+func TestGetRecordsPage(t *testing.T) {
+	tempDir := t.TempDir()
+	l := NewDecisionLogger(tempDir).(*DecisionLogger)
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.Local)
+	for cycle := 1; cycle <= 3; cycle++ {
+		ts := base.Add(time.Duration(cycle) * time.Minute)
+		data, _ := json.Marshal(DecisionRecord{Timestamp: ts, CycleNumber: cycle})
+		name := fmt.Sprintf("decision_%s_cycle%d.json", ts.Format("20060102_150405"), cycle)
+		if err := os.WriteFile(filepath.Join(tempDir, name), data, 0600); err != nil {
+			t.Fatalf("write record: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		offset     int
+		limit      int
+		wantCycles []int
+	}{
+		{"page 0", 0, 1, []int{3}},
+		{"page 1", 1, 1, []int{2}},
+		{"page 2", 2, 1, []int{1}},
+		{"offset past end", 3, 1, nil},
+		{"limit beyond end", 1, 5, []int{1, 2}},
+		{"zero limit", 0, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := l.GetRecordsPage(tt.offset, tt.limit)
+			if err != nil {
+				t.Fatalf("GetRecordsPage: %v", err)
+			}
+			if records == nil {
+				t.Fatalf("expected non-nil slice")
+			}
+			if len(records) != len(tt.wantCycles) {
+				t.Fatalf("got %d records, want %d", len(records), len(tt.wantCycles))
+			}
+			for i, cycle := range tt.wantCycles {
+				if records[i].CycleNumber != cycle {
+					t.Errorf("record %d cycle = %d, want %d", i, records[i].CycleNumber, cycle)
+				}
+			}
+		})
+	}
+}
+
+// TestSuggestAllocation 测试夏普比率更高的币种获得更大权重，负夏普比率的币种权重为 0
+func TestSuggestAllocation(t *testing.T) {
+	l := NewDecisionLogger(t.TempDir()).(*DecisionLogger)
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	add := func(i int, symbol string, pnl float64) {
+		l.AddTradeToCache(TradeOutcome{
+			Symbol:    symbol,
+			Side:      "long",
+			PnL:       pnl,
+			OpenTime:  base.Add(time.Duration(i) * time.Hour),
+			CloseTime: base.Add(time.Duration(i)*time.Hour + 30*time.Minute),
+		})
+	}
+	// BTC 收益稳定（高夏普），ETH 收益相近但波动大（低夏普），SOL 亏损
+	for i, pnl := range []float64{10, 12, 9, 11} {
+		add(i, "BTCUSDT", pnl)
+	}
+	for i, pnl := range []float64{40, -25, 35, -20} {
+		add(10+i, "ETHUSDT", pnl)
+	}
+	for i, pnl := range []float64{-10, 5, -12} {
+		add(20+i, "SOLUSDT", pnl)
+	}
+
+	weights := l.SuggestAllocation()
+	if weights["BTCUSDT"] <= weights["ETHUSDT"] {
+		t.Errorf("higher-Sharpe BTC should get larger weight: %v", weights)
+	}
+	if weights["ETHUSDT"] <= 0 {
+		t.Errorf("ETH has positive Sharpe, want weight > 0: %v", weights)
+	}
+	if w, ok := weights["SOLUSDT"]; !ok || w != 0 {
+		t.Errorf("negative-Sharpe SOL should be present with weight 0: %v", weights)
+	}
+	sum := 0.0
+	for _, w := range weights {
+		sum += w
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("weights sum = %v, want 1", sum)
+	}
+
+	empty := NewDecisionLogger(t.TempDir()).(*DecisionLogger)
+	if got := empty.SuggestAllocation(); len(got) != 0 {
+		t.Errorf("no trades should yield empty allocation, got %v", got)
+	}
+}
+
+// TestComparePromptPerformance 测试按 PromptHash 分组的统计互不影响，无 hash 的交易归入 "" 分组
+func TestComparePromptPerformance(t *testing.T) {
+	l := NewDecisionLogger(t.TempDir()).(*DecisionLogger)
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	add := func(i int, hash string, pnl float64) {
+		l.AddTradeToCache(TradeOutcome{
+			Symbol:     "BTCUSDT",
+			Side:       "long",
+			PnL:        pnl,
+			PromptHash: hash,
+			OpenTime:   base.Add(time.Duration(i) * time.Hour),
+			CloseTime:  base.Add(time.Duration(i)*time.Hour + 30*time.Minute),
+		})
+	}
+	add(0, "hashA", 10)
+	add(1, "hashA", 20)
+	add(2, "hashA", -5)
+	add(3, "hashB", -10)
+	add(4, "hashB", 5)
+	add(5, "", 7)
+
+	report, err := l.ComparePromptPerformance()
+	if err != nil {
+		t.Fatalf("ComparePromptPerformance: %v", err)
+	}
+
+	tests := []struct {
+		hash        string
+		wantTrades  int
+		wantWinRate float64
+	}{
+		{"hashA", 3, 200.0 / 3},
+		{"hashB", 2, 50},
+		{"", 1, 100},
+	}
+	if len(report) != len(tests) {
+		t.Fatalf("got %d groups, want %d", len(report), len(tests))
+	}
+	for _, tt := range tests {
+		t.Run("hash="+tt.hash, func(t *testing.T) {
+			perf := report[tt.hash]
+			if perf == nil {
+				t.Fatalf("missing group %q", tt.hash)
+			}
+			if perf.TotalTrades != tt.wantTrades {
+				t.Errorf("TotalTrades = %d, want %d", perf.TotalTrades, tt.wantTrades)
+			}
+			if math.Abs(perf.WinRate-tt.wantWinRate) > 1e-9 {
+				t.Errorf("WinRate = %.4f, want %.4f", perf.WinRate, tt.wantWinRate)
+			}
+			for _, trade := range perf.RecentTrades {
+				if trade.PromptHash != tt.hash {
+					t.Errorf("trade with hash %q leaked into group %q", trade.PromptHash, tt.hash)
+				}
+			}
+		})
+	}
+	if report["hashA"].SharpeRatio == 0 {
+		t.Errorf("expected per-group Sharpe ratio to be computed")
+	}
+}
+
+// TestGetStatistics_AIRequestLatency 测试 AI 请求耗时的平均值与 P95 统计
+func TestGetStatistics_AIRequestLatency(t *testing.T) {
+	tests := []struct {
+		name      string
+		durations []int64
+		wantAvg   float64
+		wantP95   float64
+	}{
+		{"no durations", []int64{0, 0}, 0, 0},
+		{"zero durations ignored", []int64{0, 100, 300}, 200, 300},
+		{"p95 nearest rank", []int64{100, 200, 300, 400, 500, 600, 700, 800, 900, 1000, 1100, 1200, 1300, 1400, 1500, 1600, 1700, 1800, 1900, 5000}, 1200, 1900},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			l := NewDecisionLogger(tempDir)
+			for i, ms := range tt.durations {
+				data, _ := json.Marshal(DecisionRecord{CycleNumber: i + 1, Success: true, AIRequestDurationMs: ms})
+				name := fmt.Sprintf("decision_20250101_120000_cycle%03d.json", i+1)
+				if err := os.WriteFile(filepath.Join(tempDir, name), data, 0600); err != nil {
+					t.Fatalf("write record: %v", err)
+				}
+			}
+
+			stats, err := l.GetStatistics()
+			if err != nil {
+				t.Fatalf("GetStatistics: %v", err)
+			}
+			if stats.TotalCycles != len(tt.durations) {
+				t.Errorf("TotalCycles = %d, want %d", stats.TotalCycles, len(tt.durations))
+			}
+			if math.Abs(stats.AvgAIRequestMs-tt.wantAvg) > 1e-9 {
+				t.Errorf("AvgAIRequestMs = %.2f, want %.2f", stats.AvgAIRequestMs, tt.wantAvg)
+			}
+			if stats.P95AIRequestMs != tt.wantP95 {
+				t.Errorf("P95AIRequestMs = %.2f, want %.2f", stats.P95AIRequestMs, tt.wantP95)
+			}
+		})
+	}
+}
+
+// TestProfitFactorUsesGrossSums 回归测试：盈亏比基于总盈利/总亏损而非平均值
+func TestProfitFactorUsesGrossSums(t *testing.T) {
+	pnls := []float64{100, 50, -30}
+
+	// 缓存路径
+	var trades []TradeOutcome
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, pnl := range pnls {
+		trades = append(trades, TradeOutcome{Symbol: "BTCUSDT", Side: "long", PnL: pnl,
+			OpenTime: base.Add(time.Duration(i) * time.Hour), CloseTime: base.Add(time.Duration(i)*time.Hour + time.Minute)})
+	}
+	cached := (&DecisionLogger{}).calculateStatisticsFromTrades(trades)
+
+	// 文件扫描路径（手续费为 0，使 PnL 精确等于价差）
+	l := NewDecisionLoggerWithOptions(t.TempDir(), DecisionLoggerOptions{TakerFeeRates: map[string]float64{"binance": 0}}).(*DecisionLogger)
+	openAt := time.Now().Add(-24 * time.Hour)
+	for i, pnl := range pnls {
+		at := openAt.Add(time.Duration(i) * time.Hour)
+		record := &DecisionRecord{Exchange: "binance", Success: true, Decisions: []DecisionAction{
+			{Action: "open_long", Symbol: "BTCUSDT", Quantity: 1, Price: 1000, Leverage: 5, Timestamp: at, Success: true},
+			{Action: "close_long", Symbol: "BTCUSDT", Price: 1000 + pnl, Timestamp: at.Add(time.Minute), Success: true},
+		}}
+		if err := l.LogDecision(record); err != nil {
+			t.Fatalf("LogDecision: %v", err)
+		}
+	}
+	scanned, err := l.AnalyzePerformance(100)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance: %v", err)
+	}
+
+	for name, perf := range map[string]*PerformanceAnalysis{"cache": cached, "scan": scanned} {
+		if math.Abs(perf.ProfitFactor-5.0) > 1e-9 {
+			t.Errorf("%s: ProfitFactor = %.4f, want 5.0", name, perf.ProfitFactor)
+		}
+		if math.Abs(perf.AvgWin-75) > 1e-9 || math.Abs(perf.AvgLoss+30) > 1e-9 {
+			t.Errorf("%s: AvgWin/AvgLoss = %.2f/%.2f, want 75/-30", name, perf.AvgWin, perf.AvgLoss)
+		}
+	}
+}
+
+// TestGetPerformanceWindow 验证时间窗口统计只计入窗口内平仓的交易
+func TestGetPerformanceWindow(t *testing.T) {
+	l := NewDecisionLogger(t.TempDir()).(*DecisionLogger)
+	now := time.Now()
+	// 按时间正序加入缓存：10 天前、5 天前、2 天前、1 小时前平仓
+	for _, tr := range []struct {
+		ago time.Duration
+		pnl float64
+	}{
+		{10 * 24 * time.Hour, -50},
+		{5 * 24 * time.Hour, -30},
+		{2 * 24 * time.Hour, 20},
+		{time.Hour, -5},
+	} {
+		l.AddTradeToCache(TradeOutcome{
+			Symbol:    "BTCUSDT",
+			Side:      "long",
+			PnL:       tr.pnl,
+			OpenTime:  now.Add(-tr.ago - time.Hour),
+			CloseTime: now.Add(-tr.ago),
+		})
+	}
+
+	perf, err := l.GetPerformanceWindow(3*24*time.Hour, 100, false)
+	if err != nil {
+		t.Fatalf("GetPerformanceWindow: %v", err)
+	}
+	if perf.TotalTrades != 2 || perf.WinningTrades != 1 || perf.LosingTrades != 1 {
+		t.Errorf("3-day window: trades=%d wins=%d losses=%d, want 2/1/1",
+			perf.TotalTrades, perf.WinningTrades, perf.LosingTrades)
+	}
+	if len(perf.RecentTrades) != 2 || perf.RecentTrades[0].PnL != -5 {
+		t.Errorf("RecentTrades should be the 2 in-window trades, newest first: %+v", perf.RecentTrades)
+	}
+
+	limited, err := l.GetPerformanceWindow(3*24*time.Hour, 1, false)
+	if err != nil {
+		t.Fatalf("GetPerformanceWindow(limit): %v", err)
+	}
+	if limited.TotalTrades != 2 || len(limited.RecentTrades) != 1 {
+		t.Errorf("tradeLimit should only cap RecentTrades: total=%d recent=%d", limited.TotalTrades, len(limited.RecentTrades))
+	}
+
+	empty, err := l.GetPerformanceWindow(30*time.Minute, 100, false)
+	if err != nil {
+		t.Fatalf("GetPerformanceWindow(empty): %v", err)
+	}
+	if empty.TotalTrades != 0 || len(empty.RecentTrades) != 0 {
+		t.Errorf("empty window should yield empty analysis, got %d trades", empty.TotalTrades)
+	}
+
+	if _, err := l.GetPerformanceWindow(0, 100, false); err == nil {
+		t.Error("non-positive window should return an error")
+	}
+}
@@ -40,6 +40,10 @@ type ConfigFile struct {
 	TokenExpirationMinutes int                   `json:"token_expiration_minutes"` // Token 过期时间，单位分钟
 	AITemperature          *float64              `json:"ai_temperature"`           // AI 温度参数（0.0-1.0），默认 0.1
 	CorsAllowedOrigins     []string              `json:"cors_allowed_origins"`     // 允许的跨域 Origin
+	// 更新自定义prompt时是否先平掉所有持仓，默认 false
+	AutoFlattenOnPromptChange *bool `json:"auto_flatten_on_prompt_change"`
+	// 下单价格带（百分比），当前价偏离上一根K线收盘价超过该值时拒单，0 表示关闭
+	PriceBandPct *float64 `json:"price_band_pct"`
 }
 
 // validateJWTSecret 验证 JWT 密钥安全性
@@ -140,6 +144,16 @@ func syncConfigToDatabase(database *config.Database, configFile *ConfigFile) err
 		configs["ai_temperature"] = fmt.Sprintf("%.2f", *configFile.AITemperature)
 	}
 
+	// 同步切换 prompt 自动平仓配置
+	if configFile.AutoFlattenOnPromptChange != nil {
+		configs["auto_flatten_on_prompt_change"] = fmt.Sprintf("%t", *configFile.AutoFlattenOnPromptChange)
+	}
+
+	// 同步下单价格带配置
+	if configFile.PriceBandPct != nil {
+		configs["price_band_pct"] = fmt.Sprintf("%.2f", *configFile.PriceBandPct)
+	}
+
 	// 同步 CORS 配置
 	if len(configFile.CorsAllowedOrigins) > 0 {
 		corsJSON, err := json.Marshal(configFile.CorsAllowedOrigins)
@@ -1,6 +1,7 @@
 package market
 
 import (
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -8,11 +9,34 @@ import (
 	"net/http"
 	"nofx/hook"
 	"strconv"
+	"sync"
 	"time"
 )
 
 const (
 	baseURL = "https://fapi.binance.com"
+
+	// openInterestResponseTTL / premiumIndexResponseTTL REST 响应缓存有效期
+	// premiumIndex 之上还有 1 小时的资金费率缓存，这里只用于合并并发的重复请求
+	openInterestResponseTTL = 15 * time.Second
+	premiumIndexResponseTTL = 15 * time.Second
+)
+
+var (
+	// marketTransport 所有 APIClient 共享的连接池，复用 keep-alive 连接
+	marketTransport = &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 20,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+
+	// marketResponseCache 按 URL 缓存的 REST 响应（LRU，最多 256 条）
+	marketResponseCache = newResponseCache(256)
+
+	sharedAPIClientOnce sync.Once
+	sharedAPIClientInst *APIClient
 )
 
 type APIClient struct {
@@ -21,7 +45,8 @@ type APIClient struct {
 
 func NewAPIClient() *APIClient {
 	client := &http.Client{
-		Timeout: 30 * time.Second,
+		Timeout:   30 * time.Second,
+		Transport: marketTransport,
 	}
 
 	hookRes := hook.HookExec[hook.SetHttpClientResult](hook.SET_HTTP_CLIENT, client)
@@ -35,6 +60,56 @@ func NewAPIClient() *APIClient {
 	}
 }
 
+// sharedAPIClient 返回进程内共享的 APIClient，避免每次请求都新建客户端
+func sharedAPIClient() *APIClient {
+	sharedAPIClientOnce.Do(func() {
+		sharedAPIClientInst = NewAPIClient()
+	})
+	return sharedAPIClientInst
+}
+
+// getBody 以 gzip 压缩方式请求 url 并返回解压后的响应体和状态码
+// ttl > 0 时优先读取响应缓存，仅缓存 200 响应；ttl <= 0 表示不使用缓存
+func (c *APIClient) getBody(url string, ttl time.Duration) ([]byte, int, error) {
+	if ttl > 0 {
+		if body, ok := marketResponseCache.get(url); ok {
+			return body, http.StatusOK, nil
+		}
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	// 显式声明后 Transport 不再自动解压，需要自行处理 gzip 响应
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	var reader io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, resp.StatusCode, fmt.Errorf("解压响应失败: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if ttl > 0 && resp.StatusCode == http.StatusOK {
+		marketResponseCache.set(url, body, ttl)
+	}
+	return body, resp.StatusCode, nil
+}
+
 func (c *APIClient) GetExchangeInfo() (*ExchangeInfo, error) {
 	url := fmt.Sprintf("%s/fapi/v1/exchangeInfo", baseURL)
 	resp, err := c.client.Get(url)
@@ -3,12 +3,13 @@ package market
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,12 +17,46 @@ import (
 // Binance Funding Rate 每 8 小时才更新一次，使用 1 小时缓存可显著减少 API 调用
 type FundingRateCache struct {
 	Rate      float64
+	Predicted float64 // 由标记价/指数价溢价估算的下期资金费率
+	UpdatedAt time.Time
+}
+
+// oiHistoryCache 持仓量历史缓存
+type oiHistoryCache struct {
+	Values    []float64
+	UpdatedAt time.Time
+}
+
+// fundingHistoryCache 历史资金费率缓存
+type fundingHistoryCache struct {
+	Rates     []float64
 	UpdatedAt time.Time
 }
 
 var (
-	fundingRateMap sync.Map // map[string]*FundingRateCache
-	frCacheTTL     = 1 * time.Hour
+	fundingRateMap    sync.Map // map[string]*FundingRateCache
+	fundingHistoryMap sync.Map // map["SYMBOL:limit"]*fundingHistoryCache
+	frCacheTTL        = 1 * time.Hour
+	oiHistoryMap      sync.Map // map["SYMBOL:period:limit"]*oiHistoryCache
+	oiCacheTTL        = 5 * time.Minute
+
+	// futuresRESTBaseURL 合约 REST 接口地址（测试中可替换为本地 mock 服务）
+	futuresRESTBaseURL = baseURL
+)
+
+const (
+	// fundingHistoryLimit Data 中保留的历史资金费率条数（8 小时一次，约 2 天）
+	fundingHistoryLimit = 6
+	// fundingInterestRate Binance 默认利率分量（每 8 小时 0.01%）
+	fundingInterestRate = 0.0001
+	// fundingPremiumClamp 利率与溢价差值的钳制范围（±0.05%）
+	fundingPremiumClamp = 0.0005
+)
+
+const (
+	// oiHistoryPeriod/oiHistoryLimit 持仓量历史窗口：13 个 5 分钟点覆盖 1 小时
+	oiHistoryPeriod = "5m"
+	oiHistoryLimit  = 13
 )
 
 const (
@@ -29,7 +64,12 @@ const (
 	DailyDataPoints = 7
 )
 
-// Get 获取指定代币的市场数据
+// GetWithQuote 获取指定计价币交易对的市场数据，如 GetWithQuote("BTC", "USDC") 获取 BTCUSDC
+func GetWithQuote(symbol, quote string) (*Data, error) {
+	return Get(NormalizeWithQuote(symbol, quote))
+}
+
+// Get 获取指定代币的市场数据（未带计价币的 symbol 默认按 USDT 交易对处理，已带 USDC/BTC 等计价币时原样使用）
 func Get(symbol string) (*Data, error) {
 	var klines5m, klines30m, klines1h, klines4h []Kline // [修改] klines15m -> klines30m
 	var err error
@@ -154,6 +194,13 @@ func Get(symbol string) (*Data, error) {
 
 	// 获取Funding Rate
 	fundingRate, _ := getFundingRate(symbol)
+	predictedFunding, _ := getPredictedFunding(symbol)
+
+	// 获取历史资金费率（失败不影响整体）
+	fundingHistory, err := getFundingRateHistory(symbol, fundingHistoryLimit)
+	if err != nil {
+		log.Printf("获取 %s 历史资金费率失败: %v", symbol, err)
+	}
 
 	// 计算日内系列数据
 	intradayData := calculateIntradaySeries(klines5m)
@@ -167,6 +214,18 @@ func Get(symbol string) (*Data, error) {
 	// 计算长期数据
 	longerTermData := calculateLongerTermData(klines4h)
 
+	// Supertrend (10, 3)，同样基于 klines5m
+	stValue, stDirection := calculateSupertrend(klines5m, 10, 3.0)
+
+	// 唐奇安通道 (20期)，同样基于 klines5m
+	donchianUpper, donchianLower, _ := calculateDonchian(klines5m, 20)
+
+	// 抛物线 SAR (0.02, 0.2)，同样基于 klines5m
+	sar, sarIsLong := calculateParabolicSAR(klines5m, 0.02, 0.2)
+
+	// 一目均衡表 (9, 26, 52)，同样基于 klines5m
+	tenkan, kijun, senkouA, senkouB, chikou := calculateIchimoku(klines5m)
+
 	// 获取日线数据
 	dailyData, err := getDailyData(symbol)
 	if err != nil {
@@ -188,8 +247,24 @@ func Get(symbol string) (*Data, error) {
         ChanLunMACD_DEA:   clDea,
         ChanLunMACD_Hist:  clHist,
         ChanLunSignal:     clSignalStr,		
+		SupertrendValue:   stValue,
+		SupertrendSignal:  supertrendSignal(stDirection),
+		DonchianUpper:     donchianUpper,
+		DonchianLower:     donchianLower,
+		SAR:               sar,
+		SARTrend:          sarTrend(sar, sarIsLong),
+		IchimokuTenkan:    tenkan,
+		IchimokuKijun:     kijun,
+		IchimokuSenkouA:   senkouA,
+		IchimokuSenkouB:   senkouB,
+		IchimokuChikou:    chikou,
+		IchimokuBias:      ichimokuCloudBias(currentPrice, senkouA, senkouB),
+		MarketRegime:      calculateMarketRegime(klines5m),
+		AnchoredVWAP:      anchoredVWAP(klines5m),
 		OpenInterest:      oiData,
 		FundingRate:       fundingRate,
+		FundingRateHistory: fundingHistory,
+		PredictedFunding:  predictedFunding,
 		IntradaySeries:    intradayData,
 		MidTermSeries30m:  midTermData30m, // [修改] 赋值给新字段
 		MidTermSeries1h:   midTermData1h,
@@ -214,9 +289,19 @@ type seriesResult struct {
 	er10Values          []float64
 	bollingerPercentBs  []float64
 	bollingerBandwidths []float64
+	keltnerPercent      []float64
+	keltnerWidth        []float64
+	squeezeOn           bool
 	ma5Values           []float64
 	ma34Values          []float64
 	ma170Values         []float64
+	stochKValues        []float64
+	stochDValues        []float64
+	adx14               float64
+	obvValues           []float64
+	cci20               float64
+	mfi14               float64
+	williamsR14         float64
 }
 
 // calculateSeriesData 计算时间序列指标（5m/30m/1h 通用）
@@ -299,6 +384,28 @@ func calculateSeriesData(klines []Kline) *seriesResult {
 	// 计算 Bollinger Bands (20期, 2倍标准差) 序列
 	r.bollingerPercentBs, r.bollingerBandwidths = calculateBollingerSeries(klines, 20, 2.0)
 
+	// 计算 Keltner Channels (EMA20, ATR10, 1.5倍) 序列及挤压状态
+	r.keltnerPercent, r.keltnerWidth = calculateKeltnerSeries(klines, 20, 10, 1.5)
+	r.squeezeOn = isSqueezeOn(r.bollingerBandwidths, r.keltnerWidth)
+
+	// 计算 Stochastic (14,3) 序列
+	r.stochKValues, r.stochDValues = calculateStochasticSeries(klines, 14, 3)
+
+	// 计算 ADX (14期) 趋势强度
+	r.adx14 = calculateADX(klines, 14)
+
+	// 计算 OBV 序列
+	r.obvValues = calculateOBVSeries(klines)
+
+	// 计算 CCI (20期)
+	r.cci20 = calculateCCI(klines, 20)
+
+	// 计算 MFI (14期)
+	r.mfi14 = calculateMFI(klines, 14)
+
+	// 计算 Williams %R (14期)
+	r.williamsR14 = calculateWilliamsR(klines, 14)
+
 	return r
 }
 
@@ -317,9 +424,19 @@ func calculateIntradaySeries(klines []Kline) *IntradayData {
 			ER10Values:          r.er10Values,
 			BollingerPercentBs:  r.bollingerPercentBs,
 			BollingerBandwidths: r.bollingerBandwidths,
+			KeltnerPercent:      r.keltnerPercent,
+			KeltnerWidth:        r.keltnerWidth,
+			SqueezeOn:           r.squeezeOn,
 			MA5Values:           r.ma5Values,
 			MA34Values:          r.ma34Values,
 			MA170Values:         r.ma170Values,
+			StochKValues:        r.stochKValues,
+			StochDValues:        r.stochDValues,
+			ADX14:               r.adx14,
+			OBVValues:           r.obvValues,
+			CCI20:               r.cci20,
+			MFI14:               r.mfi14,
+			WilliamsR14:         r.williamsR14,
 		},
 	}
 }
@@ -339,9 +456,19 @@ func calculateMidTermSeries30m(klines []Kline) *MidTermData30m {
 			ER10Values:          r.er10Values,
 			BollingerPercentBs:  r.bollingerPercentBs,
 			BollingerBandwidths: r.bollingerBandwidths,
+			KeltnerPercent:      r.keltnerPercent,
+			KeltnerWidth:        r.keltnerWidth,
+			SqueezeOn:           r.squeezeOn,
 			MA5Values:           r.ma5Values,
 			MA34Values:          r.ma34Values,
 			MA170Values:         r.ma170Values,
+			StochKValues:        r.stochKValues,
+			StochDValues:        r.stochDValues,
+			ADX14:               r.adx14,
+			OBVValues:           r.obvValues,
+			CCI20:               r.cci20,
+			MFI14:               r.mfi14,
+			WilliamsR14:         r.williamsR14,
 		},
 	}
 }
@@ -361,9 +488,19 @@ func calculateMidTermSeries1h(klines []Kline) *MidTermData1h {
 			ER10Values:          r.er10Values,
 			BollingerPercentBs:  r.bollingerPercentBs,
 			BollingerBandwidths: r.bollingerBandwidths,
+			KeltnerPercent:      r.keltnerPercent,
+			KeltnerWidth:        r.keltnerWidth,
+			SqueezeOn:           r.squeezeOn,
 			MA5Values:           r.ma5Values,
 			MA34Values:          r.ma34Values,
 			MA170Values:         r.ma170Values,
+			StochKValues:        r.stochKValues,
+			StochDValues:        r.stochDValues,
+			ADX14:               r.adx14,
+			OBVValues:           r.obvValues,
+			CCI20:               r.cci20,
+			MFI14:               r.mfi14,
+			WilliamsR14:         r.williamsR14,
 		},
 	}
 }
@@ -384,25 +521,28 @@ func calculateLongerTermData(klines []Kline) *LongerTermData {
 			ER10Values:          r.er10Values,
 			BollingerPercentBs:  r.bollingerPercentBs,
 			BollingerBandwidths: r.bollingerBandwidths,
+			KeltnerPercent:      r.keltnerPercent,
+			KeltnerWidth:        r.keltnerWidth,
+			SqueezeOn:           r.squeezeOn,
 			MA5Values:           r.ma5Values,
 			MA34Values:          r.ma34Values,
 			MA170Values:         r.ma170Values,
+			StochKValues:        r.stochKValues,
+			StochDValues:        r.stochDValues,
+			ADX14:               r.adx14,
+			OBVValues:           r.obvValues,
+			CCI20:               r.cci20,
+			MFI14:               r.mfi14,
+			WilliamsR14:         r.williamsR14,
 		},
 	}
 }	
 
 // getOpenInterestData 获取OI数据
 func getOpenInterestData(symbol string) (*OIData, error) {
-	url := fmt.Sprintf("https://fapi.binance.com/fapi/v1/openInterest?symbol=%s", symbol)
+	url := fmt.Sprintf("%s/fapi/v1/openInterest?symbol=%s", futuresRESTBaseURL, symbol)
 
-	apiClient := NewAPIClient()
-	resp, err := apiClient.client.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
+	body, _, err := sharedAPIClient().getBody(url, openInterestResponseTTL)
 	if err != nil {
 		return nil, err
 	}
@@ -419,37 +559,124 @@ func getOpenInterestData(symbol string) (*OIData, error) {
 
 	oi, _ := strconv.ParseFloat(result.OpenInterest, 64)
 
-	return &OIData{
+	oiData := &OIData{
 		Latest:  oi,
-		Average: oi * 0.999, // 近似平均值
-	}, nil
+		Average: oi * 0.999, // 近似平均值（历史数据不可用时）
+	}
+
+	// 历史持仓量用于真实均值和变化率，失败时保留近似值
+	history, err := getOpenInterestHistory(symbol, oiHistoryPeriod, oiHistoryLimit)
+	if err != nil {
+		log.Printf("获取 %s 持仓量历史失败: %v", symbol, err)
+	} else if len(history) > 0 {
+		sum := 0.0
+		for _, v := range history {
+			sum += v
+		}
+		oiData.Average = sum / float64(len(history))
+		oiData.OIChangePct = oiChangePct(history)
+	}
+
+	return oiData, nil
+}
+
+// getOpenInterestHistory 获取持仓量历史（从旧到新，5 分钟缓存）
+// period 为统计周期（如 "5m"、"1h"），limit 为数据点数量
+func getOpenInterestHistory(symbol string, period string, limit int) ([]float64, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("invalid open interest history limit: %d", limit)
+	}
+
+	cacheKey := fmt.Sprintf("%s:%s:%d", symbol, period, limit)
+	if cached, ok := oiHistoryMap.Load(cacheKey); ok {
+		cache := cached.(*oiHistoryCache)
+		if time.Since(cache.UpdatedAt) < oiCacheTTL {
+			return cache.Values, nil
+		}
+	}
+
+	url := fmt.Sprintf("%s/futures/data/openInterestHist?symbol=%s&period=%s&limit=%d", futuresRESTBaseURL, symbol, period, limit)
+
+	body, status, err := sharedAPIClient().getBody(url, 0)
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("open interest history request failed: status %d, body %s", status, string(body))
+	}
+
+	var result []struct {
+		Symbol          string `json:"symbol"`
+		SumOpenInterest string `json:"sumOpenInterest"`
+		Timestamp       int64  `json:"timestamp"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Timestamp < result[j].Timestamp })
+
+	values := make([]float64, 0, len(result))
+	for _, item := range result {
+		v, err := strconv.ParseFloat(item.SumOpenInterest, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse open interest %q: %w", item.SumOpenInterest, err)
+		}
+		values = append(values, v)
+	}
+
+	oiHistoryMap.Store(cacheKey, &oiHistoryCache{
+		Values:    values,
+		UpdatedAt: time.Now(),
+	})
+
+	return values, nil
+}
+
+// oiChangePct 计算持仓量序列首尾变化百分比，数据不足或起点为 0 时返回 0
+func oiChangePct(history []float64) float64 {
+	if len(history) < 2 || history[0] <= 0 {
+		return 0
+	}
+	return (history[len(history)-1] - history[0]) / history[0] * 100
 }
 
 // getFundingRate 获取资金费率（优化：使用 1 小时缓存）
 func getFundingRate(symbol string) (float64, error) {
+	cache, err := getFundingSnapshot(symbol)
+	if err != nil {
+		return 0, err
+	}
+	return cache.Rate, nil
+}
+
+// getPredictedFunding 获取预测资金费率（与最新费率共用 1 小时缓存）
+func getPredictedFunding(symbol string) (float64, error) {
+	cache, err := getFundingSnapshot(symbol)
+	if err != nil {
+		return 0, err
+	}
+	return cache.Predicted, nil
+}
+
+// getFundingSnapshot 从 premiumIndex 获取最新资金费率与预测资金费率
+func getFundingSnapshot(symbol string) (*FundingRateCache, error) {
 	// 检查缓存（有效期 1 小时）
 	// Funding Rate 每 8 小时才更新，1 小时缓存非常合理
 	if cached, ok := fundingRateMap.Load(symbol); ok {
 		cache := cached.(*FundingRateCache)
 		if time.Since(cache.UpdatedAt) < frCacheTTL {
 			// 缓存命中，直接返回
-			return cache.Rate, nil
+			return cache, nil
 		}
 	}
 
 	// 缓存过期或不存在，调用 API
-	url := fmt.Sprintf("https://fapi.binance.com/fapi/v1/premiumIndex?symbol=%s", symbol)
-
-	apiClient := NewAPIClient()
-	resp, err := apiClient.client.Get(url)
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
+	url := fmt.Sprintf("%s/fapi/v1/premiumIndex?symbol=%s", futuresRESTBaseURL, symbol)
 
-	body, err := ioutil.ReadAll(resp.Body)
+	body, _, err := sharedAPIClient().getBody(url, premiumIndexResponseTTL)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	var result struct {
@@ -463,18 +690,90 @@ func getFundingRate(symbol string) (float64, error) {
 	}
 
 	if err := json.Unmarshal(body, &result); err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	rate, _ := strconv.ParseFloat(result.LastFundingRate, 64)
+	markPrice, _ := strconv.ParseFloat(result.MarkPrice, 64)
+	indexPrice, _ := strconv.ParseFloat(result.IndexPrice, 64)
+	interestRate, err := strconv.ParseFloat(result.InterestRate, 64)
+	if err != nil {
+		interestRate = fundingInterestRate
+	}
 
 	// 更新缓存
-	fundingRateMap.Store(symbol, &FundingRateCache{
+	cache := &FundingRateCache{
 		Rate:      rate,
+		Predicted: predictFundingRate(markPrice, indexPrice, interestRate),
+		UpdatedAt: time.Now(),
+	}
+	fundingRateMap.Store(symbol, cache)
+
+	return cache, nil
+}
+
+// predictFundingRate 按 Binance 公式由标记价/指数价溢价估算资金费率：
+// premium + clamp(interestRate - premium, ±0.05%)，指数价无效时返回 0
+func predictFundingRate(markPrice, indexPrice, interestRate float64) float64 {
+	if indexPrice <= 0 || markPrice <= 0 {
+		return 0
+	}
+	premium := (markPrice - indexPrice) / indexPrice
+	diff := math.Max(-fundingPremiumClamp, math.Min(fundingPremiumClamp, interestRate-premium))
+	return premium + diff
+}
+
+// getFundingRateHistory 获取最近 limit 次结算的资金费率（从旧到新，1 小时缓存）
+func getFundingRateHistory(symbol string, limit int) ([]float64, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("invalid funding history limit: %d", limit)
+	}
+
+	cacheKey := fmt.Sprintf("%s:%d", symbol, limit)
+	if cached, ok := fundingHistoryMap.Load(cacheKey); ok {
+		cache := cached.(*fundingHistoryCache)
+		if time.Since(cache.UpdatedAt) < frCacheTTL {
+			return cache.Rates, nil
+		}
+	}
+
+	url := fmt.Sprintf("%s/fapi/v1/fundingRate?symbol=%s&limit=%d", futuresRESTBaseURL, symbol, limit)
+
+	body, status, err := sharedAPIClient().getBody(url, 0)
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("funding rate history request failed: status %d, body %s", status, string(body))
+	}
+
+	var result []struct {
+		Symbol      string `json:"symbol"`
+		FundingRate string `json:"fundingRate"`
+		FundingTime int64  `json:"fundingTime"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	// 接口按结算时间升序返回，这里再排序一次以防万一
+	sort.Slice(result, func(i, j int) bool { return result[i].FundingTime < result[j].FundingTime })
+
+	rates := make([]float64, 0, len(result))
+	for _, item := range result {
+		rate, err := strconv.ParseFloat(item.FundingRate, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse funding rate %q: %w", item.FundingRate, err)
+		}
+		rates = append(rates, rate)
+	}
+
+	fundingHistoryMap.Store(cacheKey, &fundingHistoryCache{
+		Rates:     rates,
 		UpdatedAt: time.Now(),
 	})
 
-	return rate, nil
+	return rates, nil
 }
 
 func getDailyData(symbol string) (*DailyData, error) {
@@ -593,6 +892,9 @@ func Format(data *Data, skipSymbolMention bool) string {
 	sb.WriteString("Moving Averages (Important for Strategy):\n")	
 	sb.WriteString(fmt.Sprintf("current_ema20 = %.3f, current_rsi (7 period) = %.3f\n\n",
 		data.CurrentEMA20, data.CurrentRSI7))
+	if regime := ClassifyVolatilityRegime(data); regime != "" {
+		sb.WriteString(fmt.Sprintf("Volatility regime: %s (ATR/price percentile vs recent history)\n\n", regime))
+	}
 	// ================= [开始新增代码] =================
 	// 添加缠论 MACD 数据到 Prompt
 	sb.WriteString("Custom Indicator (ChanLun MACD 34/89/13):\n")
@@ -600,6 +902,32 @@ func Format(data *Data, skipSymbolMention bool) string {
 	sb.WriteString(fmt.Sprintf("- DEA: %.4f\n", data.ChanLunMACD_DEA))
 	sb.WriteString(fmt.Sprintf("- Histogram: %.4f\n", data.ChanLunMACD_Hist))
 	sb.WriteString(fmt.Sprintf("- Signal: %s\n\n", data.ChanLunSignal))
+	if data.SupertrendSignal != "" {
+		sb.WriteString("Supertrend (ATR 10, multiplier 3):\n")
+		sb.WriteString(fmt.Sprintf("- Value: %.4f\n", data.SupertrendValue))
+		sb.WriteString(fmt.Sprintf("- Signal: %s\n\n", data.SupertrendSignal))
+	}
+	if data.DonchianUpper > 0 {
+		sb.WriteString(fmt.Sprintf("Donchian Channel (20): Upper: %s Lower: %s\n\n",
+			formatPriceWithDynamicPrecision(data.DonchianUpper), formatPriceWithDynamicPrecision(data.DonchianLower)))
+	}
+	if data.SAR > 0 {
+		sb.WriteString(fmt.Sprintf("Parabolic SAR (0.02, 0.2): %s - %s\n\n",
+			formatPriceWithDynamicPrecision(data.SAR), data.SARTrend))
+	}
+	if data.IchimokuSenkouA > 0 && data.IchimokuSenkouB > 0 {
+		sb.WriteString(fmt.Sprintf("Ichimoku (9, 26, 52): Tenkan: %s Kijun: %s Cloud: %s-%s - %s\n\n",
+			formatPriceWithDynamicPrecision(data.IchimokuTenkan), formatPriceWithDynamicPrecision(data.IchimokuKijun),
+			formatPriceWithDynamicPrecision(math.Min(data.IchimokuSenkouA, data.IchimokuSenkouB)),
+			formatPriceWithDynamicPrecision(math.Max(data.IchimokuSenkouA, data.IchimokuSenkouB)),
+			data.IchimokuBias))
+	}
+	if data.MarketRegime != "" {
+		sb.WriteString(fmt.Sprintf("Market Regime (ER10 + Bollinger width): %s\n\n", data.MarketRegime))
+	}
+	if data.AnchoredVWAP > 0 {
+		sb.WriteString(fmt.Sprintf("Anchored VWAP: %s\n\n", formatPriceWithDynamicPrecision(data.AnchoredVWAP)))
+	}
 	// ================= [结束新增代码] =================
 
 	if skipSymbolMention {
@@ -613,11 +941,25 @@ func Format(data *Data, skipSymbolMention bool) string {
 		// 使用动态精度格式化 OI 数据
 		oiLatestStr := formatPriceWithDynamicPrecision(data.OpenInterest.Latest)
 		oiAverageStr := formatPriceWithDynamicPrecision(data.OpenInterest.Average)
-		sb.WriteString(fmt.Sprintf("Open Interest: Latest: %s Average: %s\n\n",
+		sb.WriteString(fmt.Sprintf("Open Interest: Latest: %s Average: %s\n",
 			oiLatestStr, oiAverageStr))
+		if data.OpenInterest.OIChangePct != 0 {
+			sb.WriteString(fmt.Sprintf("OI change 1h: %+.2f%%\n", data.OpenInterest.OIChangePct))
+		}
+		sb.WriteString("\n")
 	}
 
 	sb.WriteString(fmt.Sprintf("Funding Rate: %.2e\n\n", data.FundingRate))
+	if data.PredictedFunding != 0 {
+		sb.WriteString(fmt.Sprintf("Predicted Funding (mark vs index basis): %.2e\n\n", data.PredictedFunding))
+	}
+	if len(data.FundingRateHistory) > 0 {
+		rates := make([]string, len(data.FundingRateHistory))
+		for i, rate := range data.FundingRateHistory {
+			rates[i] = fmt.Sprintf("%.2e", rate)
+		}
+		sb.WriteString(fmt.Sprintf("Funding Rate History (oldest → latest): [%s]\n\n", strings.Join(rates, ", ")))
+	}
 
 	//if data.IntradaySeries != nil {
 		//formatSeriesData(&sb, "Intraday series (5‑minute intervals, oldest → latest):", &data.IntradaySeries.SeriesFields)
@@ -780,6 +1122,10 @@ func formatSeriesData(sb *strings.Builder, title string, data *SeriesFields) {
 		sb.WriteString(fmt.Sprintf("Volume: %s\n\n", formatFloatSlice(data.Volume)))
 	}
 
+	if len(data.OBVValues) > 0 {
+		sb.WriteString(fmt.Sprintf("OBV: %s\n\n", formatFloatSlice(data.OBVValues)))
+	}
+
 	if len(data.ATR14Values) > 0 {
 		sb.WriteString(fmt.Sprintf("ATR (14‑period): %s\n\n", formatFloatSlice(data.ATR14Values)))
 	}
@@ -795,6 +1141,43 @@ func formatSeriesData(sb *strings.Builder, title string, data *SeriesFields) {
 	if len(data.BollingerBandwidths) > 0 {
 		sb.WriteString(fmt.Sprintf("Bollinger Bandwidth: %s\n\n", formatFloatSlice(data.BollingerBandwidths)))
 	}
+
+	if len(data.KeltnerPercent) > 0 {
+		sb.WriteString(fmt.Sprintf("Keltner %%K (20,10,1.5): %s\n\n", formatFloatSlice(data.KeltnerPercent)))
+	}
+
+	if len(data.KeltnerWidth) > 0 {
+		sb.WriteString(fmt.Sprintf("Keltner Width: %s\n\n", formatFloatSlice(data.KeltnerWidth)))
+		if data.SqueezeOn {
+			sb.WriteString("Squeeze: ON (Bollinger Bands inside Keltner Channels)\n\n")
+		} else {
+			sb.WriteString("Squeeze: OFF\n\n")
+		}
+	}
+
+	if len(data.StochKValues) > 0 {
+		sb.WriteString(fmt.Sprintf("Stochastic %%K (14,3): %s\n\n", formatFloatSlice(data.StochKValues)))
+	}
+
+	if len(data.StochDValues) > 0 {
+		sb.WriteString(fmt.Sprintf("Stochastic %%D (14,3): %s\n\n", formatFloatSlice(data.StochDValues)))
+	}
+
+	if data.ADX14 > 0 && !math.IsNaN(data.ADX14) {
+		sb.WriteString(fmt.Sprintf("ADX (14‑period): %.2f\n\n", data.ADX14))
+	}
+
+	if data.CCI20 != 0 && !math.IsNaN(data.CCI20) {
+		sb.WriteString(fmt.Sprintf("CCI (20‑period): %.2f\n\n", data.CCI20))
+	}
+
+	if data.MFI14 > 0 && !math.IsNaN(data.MFI14) {
+		sb.WriteString(fmt.Sprintf("MFI (14‑period): %.2f\n\n", data.MFI14))
+	}
+
+	if data.WilliamsR14 != 0 && !math.IsNaN(data.WilliamsR14) {
+		sb.WriteString(fmt.Sprintf("Williams %%R (14‑period): %.2f\n\n", data.WilliamsR14))
+	}
 }
 
 // formatFloatSlice 格式化float64切片为字符串（使用动态精度）
@@ -806,13 +1189,166 @@ func formatFloatSlice(values []float64) string {
 	return "[" + strings.Join(strValues, ", ") + "]"
 }
 
-// Normalize 标准化symbol,确保是USDT交易对
+// 波动率状态分档
+const (
+	VolatilityRegimeLow     = "low"
+	VolatilityRegimeNormal  = "normal"
+	VolatilityRegimeHigh    = "high"
+	VolatilityRegimeExtreme = "extreme"
+)
+
+// ClassifyVolatilityRegime 根据 ATR/价格 比值在可用历史中的分位数判断波动率状态
+// - 分位数 <= 20%: low；<= 80%: normal；其余: high
+// - 当前比值超过历史最大值的 1.5 倍（突破历史波动区间）: extreme
+// 优先使用 5m 序列，其次 30m/1h/4h；有效数据点不足 3 个时返回空字符串
+func ClassifyVolatilityRegime(data *Data) string {
+	if data == nil {
+		return ""
+	}
+
+	var series *SeriesFields
+	for _, candidate := range []*SeriesFields{
+		seriesFieldsOf(data.IntradaySeries),
+		seriesFieldsOf(data.MidTermSeries30m),
+		seriesFieldsOf(data.MidTermSeries1h),
+		seriesFieldsOf(data.LongerTermContext),
+	} {
+		if candidate != nil && len(candidate.ATR14Values) > 0 && len(candidate.MidPrices) > 0 {
+			series = candidate
+			break
+		}
+	}
+	if series == nil {
+		return ""
+	}
+
+	// ATR 与价格序列均为"最近 N 个点"，按末尾对齐
+	n := len(series.ATR14Values)
+	if len(series.MidPrices) < n {
+		n = len(series.MidPrices)
+	}
+	ratios := make([]float64, 0, n)
+	for i := n; i >= 1; i-- {
+		atr := series.ATR14Values[len(series.ATR14Values)-i]
+		price := series.MidPrices[len(series.MidPrices)-i]
+		if price <= 0 || math.IsNaN(atr) || math.IsInf(atr, 0) {
+			continue
+		}
+		ratios = append(ratios, atr/price)
+	}
+	if len(ratios) < 3 {
+		return ""
+	}
+
+	current := ratios[len(ratios)-1]
+	history := ratios[:len(ratios)-1]
+
+	maxHistory := 0.0
+	for _, r := range history {
+		if r > maxHistory {
+			maxHistory = r
+		}
+	}
+	if maxHistory > 0 && current > maxHistory*1.5 {
+		return VolatilityRegimeExtreme
+	}
+
+	// 分位数：严格小于当前值的比例 + 相等值的一半（常数序列落在 50%）
+	below, equal := 0, 0
+	for _, r := range ratios {
+		switch {
+		case r < current:
+			below++
+		case r == current:
+			equal++
+		}
+	}
+	percentile := (float64(below) + 0.5*float64(equal)) / float64(len(ratios))
+
+	switch {
+	case percentile <= 0.2:
+		return VolatilityRegimeLow
+	case percentile <= 0.8:
+		return VolatilityRegimeNormal
+	default:
+		return VolatilityRegimeHigh
+	}
+}
+
+// LatestATR 返回市场数据中最新的 ATR(14)，优先使用最细周期的序列；没有 ATR 数据时返回 0
+func LatestATR(data *Data) float64 {
+	if data == nil {
+		return 0
+	}
+	for _, candidate := range []*SeriesFields{
+		seriesFieldsOf(data.IntradaySeries),
+		seriesFieldsOf(data.MidTermSeries30m),
+		seriesFieldsOf(data.MidTermSeries1h),
+		seriesFieldsOf(data.LongerTermContext),
+	} {
+		if candidate != nil && len(candidate.ATR14Values) > 0 {
+			atr := candidate.ATR14Values[len(candidate.ATR14Values)-1]
+			if atr > 0 && !math.IsNaN(atr) && !math.IsInf(atr, 0) {
+				return atr
+			}
+		}
+	}
+	return 0
+}
+
+// seriesFieldsOf 取出各周期结构体中嵌入的 SeriesFields（nil 安全）
+func seriesFieldsOf(v interface{}) *SeriesFields {
+	switch s := v.(type) {
+	case *IntradayData:
+		if s != nil {
+			return &s.SeriesFields
+		}
+	case *MidTermData30m:
+		if s != nil {
+			return &s.SeriesFields
+		}
+	case *MidTermData1h:
+		if s != nil {
+			return &s.SeriesFields
+		}
+	case *LongerTermData:
+		if s != nil {
+			return &s.SeriesFields
+		}
+	}
+	return nil
+}
+
+// DefaultQuoteAsset 默认计价币
+const DefaultQuoteAsset = "USDT"
+
+// stableQuoteAssets 稳定币计价币，没有基础币以其结尾，symbol 以其结尾时视为已带计价币的完整交易对
+// BTC 不在此列：WBTC 等基础币以 BTC 结尾，只有请求的计价币就是 BTC 时才按后缀判断
+var stableQuoteAssets = []string{"USDT", "USDC", "BUSD"}
+
+// Normalize 标准化symbol,未带计价币时补全为USDT交易对
 func Normalize(symbol string) string {
+	return NormalizeWithQuote(symbol, DefaultQuoteAsset)
+}
+
+// NormalizeWithQuote 标准化symbol：已以请求的 quote 或稳定币计价币（USDT/USDC/BUSD）结尾时原样返回（转大写），
+// 否则补全 quote（为空时使用 USDT），如 NormalizeWithQuote("eth", "btc") 返回 ETHBTC、NormalizeWithQuote("wbtc", "usdt") 返回 WBTCUSDT
+func NormalizeWithQuote(symbol, quote string) string {
 	symbol = strings.ToUpper(symbol)
-	if strings.HasSuffix(symbol, "USDT") {
+	quote = strings.ToUpper(quote)
+	if quote == "" {
+		quote = DefaultQuoteAsset
+	}
+	// symbol 本身就是计价币名（如 "BTC"）时仍视为基础币
+	if len(symbol) > len(quote) && strings.HasSuffix(symbol, quote) {
 		return symbol
 	}
-	return symbol + "USDT"
+	for _, stable := range stableQuoteAssets {
+		if len(symbol) > len(stable) && strings.HasSuffix(symbol, stable) {
+			return symbol
+		}
+	}
+	return symbol + quote
 }
 
 // parseFloat 解析float值
@@ -833,6 +1369,18 @@ func parseFloat(v interface{}) (float64, error) {
 
 // BuildDataFromKlines 根据预加载的K线序列构造市场数据快照（用于回测/模拟）。
 func BuildDataFromKlines(symbol string, primary []Kline, longer []Kline) (*Data, error) {
+	return BuildDataFromKlinesAt(symbol, primary, longer, 0)
+}
+
+// BuildDataFromKlinesWithQuote 与 BuildDataFromKlines 相同，但未带计价币的 symbol 按 quote 补全。
+func BuildDataFromKlinesWithQuote(symbol, quote string, primary []Kline, longer []Kline) (*Data, error) {
+	return BuildDataFromKlinesAt(NormalizeWithQuote(symbol, quote), primary, longer, 0)
+}
+
+// BuildDataFromKlinesAt 与 BuildDataFromKlines 相同，但要求价格变化只使用已收盘的K线：
+// snapshotTS（毫秒）> 0 时，CloseTime 晚于 snapshotTS 的尾部K线（仍在形成中）不参与 1h/4h 涨跌幅计算，
+// 避免用未完成数据产生前视偏差。snapshotTS <= 0 时不做检查。
+func BuildDataFromKlinesAt(symbol string, primary []Kline, longer []Kline, snapshotTS int64) (*Data, error) {
 	if len(primary) == 0 {
 		return nil, fmt.Errorf("primary series is empty")
 	}
@@ -856,6 +1404,11 @@ func BuildDataFromKlines(symbol string, primary []Kline, longer []Kline) (*Data,
 		}
 	}	
 
+	stValue, stDirection := calculateSupertrend(primary, 10, 3.0)
+	donchianUpper, donchianLower, _ := calculateDonchian(primary, 20)
+	sar, sarIsLong := calculateParabolicSAR(primary, 0.02, 0.2)
+	tenkan, kijun, senkouA, senkouB, chikou := calculateIchimoku(primary)
+
 	data := &Data{
 		Symbol:            symbol,
 		CurrentPrice:      currentPrice,
@@ -866,8 +1419,22 @@ func BuildDataFromKlines(symbol string, primary []Kline, longer []Kline) (*Data,
 		ChanLunMACD_DEA:   clDea,
 		ChanLunMACD_Hist:  clHist,
 		ChanLunSignal:     clSignalStr,
-		PriceChange1h:     priceChangeFromSeries(primary, time.Hour),
-		PriceChange4h:     priceChangeFromSeries(primary, 4*time.Hour),
+		SupertrendValue:   stValue,
+		SupertrendSignal:  supertrendSignal(stDirection),
+		DonchianUpper:     donchianUpper,
+		DonchianLower:     donchianLower,
+		SAR:               sar,
+		SARTrend:          sarTrend(sar, sarIsLong),
+		IchimokuTenkan:    tenkan,
+		IchimokuKijun:     kijun,
+		IchimokuSenkouA:   senkouA,
+		IchimokuSenkouB:   senkouB,
+		IchimokuChikou:    chikou,
+		IchimokuBias:      ichimokuCloudBias(currentPrice, senkouA, senkouB),
+		MarketRegime:      calculateMarketRegime(primary),
+		AnchoredVWAP:      anchoredVWAP(primary),
+		PriceChange1h:     priceChangeFromSeries(primary, time.Hour, snapshotTS),
+		PriceChange4h:     priceChangeFromSeries(primary, 4*time.Hour, snapshotTS),
 		OpenInterest:      &OIData{Latest: 0, Average: 0},
 		FundingRate:       0,
 		IntradaySeries:    calculateIntradaySeries(primary),
@@ -881,7 +1448,14 @@ func BuildDataFromKlines(symbol string, primary []Kline, longer []Kline) (*Data,
 	return data, nil
 }
 
-func priceChangeFromSeries(series []Kline, duration time.Duration) float64 {
+// priceChangeFromSeries 计算最后一根K线相对 duration 之前K线的涨跌幅（百分比）
+// snapshotTS > 0 时先剔除尾部未收盘（CloseTime > snapshotTS）的K线
+func priceChangeFromSeries(series []Kline, duration time.Duration, snapshotTS int64) float64 {
+	if snapshotTS > 0 {
+		for len(series) > 0 && series[len(series)-1].CloseTime > snapshotTS {
+			series = series[:len(series)-1]
+		}
+	}
 	if len(series) == 0 || duration <= 0 {
 		return 0
 	}
@@ -899,25 +1473,105 @@ func priceChangeFromSeries(series []Kline, duration time.Duration) float64 {
 	return 0
 }
 
+// StaleDataConfig controls price-freeze detection in isStaleData
+type StaleDataConfig struct {
+	Periods      int     // Number of consecutive periods with unchanged price treated as frozen
+	TolerancePct float64 // Price fluctuation tolerance in percent (0.01 means 0.01%)
+}
+
+// vwapAnchorTime 锚定 VWAP 的起始时间（毫秒），0 表示未配置
+var vwapAnchorTime atomic.Int64
+
+// SetVWAPAnchor 设置锚定 VWAP 的起始时间（毫秒时间戳），<= 0 表示关闭
+func SetVWAPAnchor(anchorTime int64) {
+	if anchorTime < 0 {
+		anchorTime = 0
+	}
+	vwapAnchorTime.Store(anchorTime)
+}
+
+// anchoredVWAP 按当前配置的锚点计算 VWAP，未配置锚点时返回 0
+func anchoredVWAP(klines []Kline) float64 {
+	anchor := vwapAnchorTime.Load()
+	if anchor <= 0 {
+		return 0
+	}
+	return calculateAnchoredVWAP(klines, anchor)
+}
+
+const (
+	defaultStalePeriods      = 2    // 2 consecutive 5-minute periods (10 minutes without fluctuation)
+	defaultStaleTolerancePct = 0.01 // 0.01% fluctuation tolerance (avoid false positives)
+)
+
+var (
+	staleDataMu        sync.RWMutex
+	staleDataDefault   = StaleDataConfig{Periods: defaultStalePeriods, TolerancePct: defaultStaleTolerancePct}
+	staleDataOverrides = make(map[string]StaleDataConfig)
+)
+
+// normalizeStaleDataConfig falls back to the defaults for unset or invalid values
+func normalizeStaleDataConfig(periods int, tolerancePct float64) StaleDataConfig {
+	if periods < 2 {
+		periods = defaultStalePeriods
+	}
+	if tolerancePct <= 0 {
+		tolerancePct = defaultStaleTolerancePct
+	}
+	return StaleDataConfig{Periods: periods, TolerancePct: tolerancePct}
+}
+
+// SetStaleDataConfig sets the global stale-data threshold (periods < 2 or tolerancePct <= 0 keep the defaults)
+func SetStaleDataConfig(periods int, tolerancePct float64) {
+	staleDataMu.Lock()
+	defer staleDataMu.Unlock()
+	staleDataDefault = normalizeStaleDataConfig(periods, tolerancePct)
+}
+
+// SetSymbolStaleDataConfig overrides the stale-data threshold for one symbol, e.g. illiquid but valid alts
+func SetSymbolStaleDataConfig(symbol string, periods int, tolerancePct float64) {
+	staleDataMu.Lock()
+	defer staleDataMu.Unlock()
+	staleDataOverrides[Normalize(symbol)] = normalizeStaleDataConfig(periods, tolerancePct)
+}
+
+// ResetStaleDataConfig restores the default threshold and clears all per-symbol overrides
+func ResetStaleDataConfig() {
+	staleDataMu.Lock()
+	defer staleDataMu.Unlock()
+	staleDataDefault = StaleDataConfig{Periods: defaultStalePeriods, TolerancePct: defaultStaleTolerancePct}
+	staleDataOverrides = make(map[string]StaleDataConfig)
+}
+
+// staleDataConfigFor returns the per-symbol override if present, otherwise the global setting
+func staleDataConfigFor(symbol string) StaleDataConfig {
+	staleDataMu.RLock()
+	defer staleDataMu.RUnlock()
+	if cfg, ok := staleDataOverrides[Normalize(symbol)]; ok {
+		return cfg
+	}
+	return staleDataDefault
+}
+
 // isStaleData detects stale data (consecutive price freeze)
 // Fix DOGEUSDT-style issue: consecutive N periods with completely unchanged prices indicate data source anomaly
+// N and the tolerance come from SetStaleDataConfig / SetSymbolStaleDataConfig (default 2 periods, 0.01%)
 func isStaleData(klines []Kline, symbol string) bool {
-	if len(klines) < 2 {
+	cfg := staleDataConfigFor(symbol)
+	if len(klines) < cfg.Periods {
 		return false // Insufficient data to determine
 	}
 
-	// Detection threshold: 2 consecutive 5-minute periods with unchanged price (10 minutes without fluctuation)
-	const stalePriceThreshold = 2
-	const priceTolerancePct = 0.0001 // 0.01% fluctuation tolerance (avoid false positives)
+	priceTolerance := cfg.TolerancePct / 100
 
-	// Take the last stalePriceThreshold K-lines
-	recentKlines := klines[len(klines)-stalePriceThreshold:]
+	// Take the last cfg.Periods K-lines
+	recentKlines := klines[len(klines)-cfg.Periods:]
 	firstPrice := recentKlines[0].Close
 
 	// Check if all prices are within tolerance
 	for i := 1; i < len(recentKlines); i++ {
 		priceDiff := math.Abs(recentKlines[i].Close-firstPrice) / firstPrice
-		if priceDiff > priceTolerancePct {
+		if priceDiff > priceTolerance {
 			return false // Price fluctuation exists, data is normal
 		}
 	}
@@ -939,7 +1593,7 @@ func isStaleData(klines []Kline, symbol string) bool {
 	}
 
 	// Price frozen but has volume: might be extremely low volatility market, allow but log warning
-	log.Printf("⚠️  %s detected extreme price stability (no fluctuation for %d consecutive periods), but volume is normal", symbol, stalePriceThreshold)
+	log.Printf("⚠️  %s detected extreme price stability (no fluctuation for %d consecutive periods), but volume is normal", symbol, cfg.Periods)
 	return false
     }
     // safeFloatFmt 安全格式化浮点数，处理 NaN 和 Inf
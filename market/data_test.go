@@ -1,7 +1,9 @@
 package market
 
 import (
+	"math"
 	"testing"
+	"time"
 )
 
 // generateTestKlines 定义在 indicators_test.go 中
@@ -379,6 +381,52 @@ func TestIsStaleData_EmptyKlines(t *testing.T) {
 	}
 }
 
+// TestIsStaleData_CustomThreshold tests a custom 5-period threshold and a per-symbol override
+func TestIsStaleData_CustomThreshold(t *testing.T) {
+	t.Cleanup(ResetStaleDataConfig)
+
+	// Last 3 klines frozen with zero volume: stale under the default 2-period threshold
+	klines := []Kline{
+		{Close: 100.0, Volume: 1000},
+		{Close: 100.5, Volume: 1200},
+		{Close: 100.0, Volume: 0},
+		{Close: 100.0, Volume: 0},
+		{Close: 100.0, Volume: 0},
+	}
+	// Price drifts by 0.05% between zero-volume klines
+	drifting := []Kline{
+		{Close: 100.0, Volume: 0},
+		{Close: 100.05, Volume: 0},
+	}
+
+	tests := []struct {
+		name   string
+		setup  func()
+		klines []Kline
+		symbol string
+		want   bool
+	}{
+		{"default threshold", func() {}, klines, "BTCUSDT", true},
+		{"custom 5-period threshold", func() { SetStaleDataConfig(5, 0.01) }, klines, "BTCUSDT", false},
+		{"custom threshold with insufficient klines", func() { SetStaleDataConfig(5, 0.01) }, klines[3:], "BTCUSDT", false},
+		{"invalid values keep defaults", func() { SetStaleDataConfig(0, -1) }, klines, "BTCUSDT", true},
+		{"per-symbol override", func() { SetSymbolStaleDataConfig("DOGS", 5, 0.01) }, klines, "DOGSUSDT", false},
+		{"override does not affect other symbols", func() { SetSymbolStaleDataConfig("DOGS", 5, 0.01) }, klines, "BTCUSDT", true},
+		{"default tolerance sees drift", func() {}, drifting, "DOGSUSDT", false},
+		{"per-symbol looser tolerance", func() { SetSymbolStaleDataConfig("DOGSUSDT", 2, 0.1) }, drifting, "DOGSUSDT", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ResetStaleDataConfig()
+			tt.setup()
+			if got := isStaleData(tt.klines, tt.symbol); got != tt.want {
+				t.Errorf("isStaleData(%s) = %v, want %v", tt.symbol, got, tt.want)
+			}
+		})
+	}
+}
+
 // TestCalculateATRSeries* 测试已移动到 indicators_test.go
 
 // =============================================================================
@@ -481,13 +529,13 @@ func TestCalculateIntradaySeries_BollingerBands(t *testing.T) {
 	}
 }
 
-// TestCalculateMidTermSeries15m_ERAndBollinger 测试 15m 数据的 ER 和 BB
-func TestCalculateMidTermSeries15m_ERAndBollinger(t *testing.T) {
+// TestCalculateMidTermSeries30m_ERAndBollinger 测试 15m 数据的 ER 和 BB
+func TestCalculateMidTermSeries30m_ERAndBollinger(t *testing.T) {
 	klines := generateTestKlines(30)
-	data := calculateMidTermSeries15m(klines)
+	data := calculateMidTermSeries30m(klines)
 
 	if data == nil {
-		t.Fatal("calculateMidTermSeries15m returned nil")
+		t.Fatal("calculateMidTermSeries30m returned nil")
 	}
 
 	// ER10Values 应该是一个切片，每个值在 0-1 范围内
@@ -564,7 +612,7 @@ func TestFormat_ContainsERAndBollingerBands(t *testing.T) {
 				BollingerBandwidths: []float64{0.04, 0.045, 0.05}, // 有效 Bandwidth 序列
 			},
 		},
-		MidTermSeries15m: &MidTermData15m{
+		MidTermSeries30m: &MidTermData30m{
 			SeriesFields: SeriesFields{
 				MidPrices:           []float64{49000, 49500, 50000},
 				ER10Values:          []float64{0.60, 0.63, 0.65},
@@ -651,7 +699,7 @@ func containsSubstr(s, substr string) bool {
 // Format() 重构基准测试 - 确保重构后输出不变
 // =============================================================================
 
-// TestFormat_SeriesOutputStructure 测试 3 个 Series 块的输出结构
+// TestFormat_SeriesOutputStructure 测试 Series 块的输出结构
 func TestFormat_SeriesOutputStructure(t *testing.T) {
 	// 创建完整的测试数据
 	data := &Data{
@@ -676,7 +724,7 @@ func TestFormat_SeriesOutputStructure(t *testing.T) {
 				BollingerBandwidths: []float64{0.04, 0.045, 0.05},
 			},
 		},
-		MidTermSeries15m: &MidTermData15m{
+		MidTermSeries30m: &MidTermData30m{
 			SeriesFields: SeriesFields{
 				MidPrices:           []float64{48500, 49000, 49500},
 				EMA20Values:         []float64{48400, 48900, 49400},
@@ -713,23 +761,16 @@ func TestFormat_SeriesOutputStructure(t *testing.T) {
 		name    string
 		pattern string
 	}{
-		// IntradaySeries (5m)
-		{"5m title", "Intraday series (5‑minute intervals"},
-		{"5m mid prices", "Mid prices:"},
-		{"5m EMA", "EMA indicators (20‑period):"},
-		{"5m MACD", "MACD indicators:"},
-		{"5m RSI7", "RSI indicators (7‑Period):"},
-		{"5m RSI14", "RSI indicators (14‑Period):"},
-		{"5m Volume", "Volume:"},
-		{"5m ATR", "ATR (14‑period):"},
-		{"5m ER", "Efficiency Ratio (10‑period):"},
-		{"5m BB", "Bollinger %B:"},
-
-		// MidTermSeries15m
-		{"15m title", "Mid‑term series (15‑minute intervals"},
-
-		// MidTermSeries1h
-		{"1h title", "Mid‑term series (1‑hour intervals"},
+		// MidTermSeries30m（5m 与 1h 序列当前未输出到 prompt）
+		{"30m title", "Mid‑term series (30‑minute intervals"},
+		{"30m mid prices", "Mid prices:"},
+		{"30m EMA", "EMA indicators (20‑period):"},
+		{"30m RSI7", "RSI indicators (7‑Period):"},
+		{"30m RSI14", "RSI indicators (14‑Period):"},
+		{"30m Volume", "Volume:"},
+		{"30m ATR", "ATR (14‑period):"},
+		{"30m ER", "Efficiency Ratio (10‑period):"},
+		{"30m BB", "Bollinger %B:"},
 	}
 
 	for _, tt := range expectedPatterns {
@@ -740,3 +781,127 @@ func TestFormat_SeriesOutputStructure(t *testing.T) {
 		})
 	}
 }
+
+// buildRangeKlines 构造收盘价固定、振幅随 amplitude(i) 变化的 K 线序列
+func buildRangeKlines(count int, price float64, amplitude func(i int) float64) []Kline {
+	klines := make([]Kline, count)
+	for i := 0; i < count; i++ {
+		half := price * amplitude(i) / 2
+		klines[i] = Kline{
+			OpenTime:  int64(i) * 300000,
+			Open:      price,
+			High:      price + half,
+			Low:       price - half,
+			Close:     price,
+			Volume:    1000,
+			CloseTime: int64(i)*300000 + 299999,
+		}
+	}
+	return klines
+}
+
+// TestClassifyVolatilityRegime 测试波动率状态分类
+func TestClassifyVolatilityRegime(t *testing.T) {
+	tests := []struct {
+		name      string
+		amplitude func(i int) float64
+		want      string
+	}{
+		{
+			name: "窄幅震荡 - low",
+			amplitude: func(i int) float64 {
+				if i < 40 {
+					return 0.02
+				}
+				return 0.001
+			},
+			want: VolatilityRegimeLow,
+		},
+		{
+			name: "剧烈波动 - high",
+			amplitude: func(i int) float64 {
+				if i < 40 {
+					return 0.01
+				}
+				return 0.01 + float64(i-40)*0.01
+			},
+			want: VolatilityRegimeHigh,
+		},
+		{
+			name:      "恒定波动 - normal",
+			amplitude: func(i int) float64 { return 0.01 },
+			want:      VolatilityRegimeNormal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			klines := buildRangeKlines(52, 100, tt.amplitude)
+			data := &Data{
+				CurrentPrice:   klines[len(klines)-1].Close,
+				IntradaySeries: calculateIntradaySeries(klines),
+			}
+			if got := ClassifyVolatilityRegime(data); got != tt.want {
+				t.Errorf("ClassifyVolatilityRegime() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestClassifyVolatilityRegime_InsufficientData 测试数据不足时不输出分类
+func TestClassifyVolatilityRegime_InsufficientData(t *testing.T) {
+	if got := ClassifyVolatilityRegime(&Data{CurrentPrice: 100}); got != "" {
+		t.Errorf("ClassifyVolatilityRegime() = %q, want empty", got)
+	}
+}
+
+// TestPriceChangeFromSeries_SkipsFormingBar 测试最后一根K线未收盘时使用前一根已收盘K线计算涨跌幅
+func TestPriceChangeFromSeries_SkipsFormingBar(t *testing.T) {
+	const barMs = int64(5 * 60 * 1000)
+	klines := make([]Kline, 60)
+	for i := range klines {
+		klines[i] = Kline{
+			OpenTime:  int64(i) * barMs,
+			Close:     100 + float64(i),
+			CloseTime: int64(i+1)*barMs - 1,
+		}
+	}
+	// 快照时间位于最后一根K线内部：该K线仍在形成中
+	snapshotTS := klines[58].CloseTime + barMs/2
+	lastClosed := klines[58]
+
+	tests := []struct {
+		name     string
+		duration time.Duration
+		bars     int
+	}{
+		{name: "1h", duration: time.Hour, bars: 12},
+		{name: "4h", duration: 4 * time.Hour, bars: 48},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := klines[58-tt.bars]
+			want := (lastClosed.Close - ref.Close) / ref.Close * 100
+			got := priceChangeFromSeries(klines, tt.duration, snapshotTS)
+			if math.Abs(got-want) > 1e-9 {
+				t.Errorf("priceChangeFromSeries() = %.6f, want %.6f (prior closed bar)", got, want)
+			}
+
+			// 不启用检查时会使用形成中的K线
+			unguarded := priceChangeFromSeries(klines, tt.duration, 0)
+			if math.Abs(unguarded-want) < 1e-9 {
+				t.Errorf("expected unguarded change to differ from guarded value")
+			}
+		})
+	}
+
+	data, err := BuildDataFromKlinesAt("BTC", klines, nil, snapshotTS)
+	if err != nil {
+		t.Fatalf("BuildDataFromKlinesAt: %v", err)
+	}
+	want1h := (lastClosed.Close - klines[46].Close) / klines[46].Close * 100
+	if math.Abs(data.PriceChange1h-want1h) > 1e-9 {
+		t.Errorf("PriceChange1h = %.6f, want %.6f", data.PriceChange1h, want1h)
+	}
+}
@@ -0,0 +1,134 @@
+package market
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// mockFuturesAPI 启动本地 mock 服务替换合约 REST 地址，并在测试结束后恢复
+func mockFuturesAPI(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	prev := futuresRESTBaseURL
+	futuresRESTBaseURL = server.URL
+	t.Cleanup(func() {
+		futuresRESTBaseURL = prev
+		server.Close()
+	})
+}
+
+func TestGetFundingRateHistory(t *testing.T) {
+	var requests atomic.Int32
+	mockFuturesAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/fapi/v1/fundingRate" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("symbol"); got != "FRHISTUSDT" {
+			t.Errorf("symbol = %s, want FRHISTUSDT", got)
+		}
+		if got := r.URL.Query().Get("limit"); got != "3" {
+			t.Errorf("limit = %s, want 3", got)
+		}
+		// 故意打乱顺序，结果应按结算时间从旧到新
+		fmt.Fprint(w, `[
+			{"symbol":"FRHISTUSDT","fundingRate":"0.00030000","fundingTime":1700028800000},
+			{"symbol":"FRHISTUSDT","fundingRate":"0.00010000","fundingTime":1700000000000},
+			{"symbol":"FRHISTUSDT","fundingRate":"-0.00020000","fundingTime":1700014400000}
+		]`)
+	})
+
+	rates, err := getFundingRateHistory("FRHISTUSDT", 3)
+	if err != nil {
+		t.Fatalf("getFundingRateHistory: %v", err)
+	}
+	want := []float64{0.0001, -0.0002, 0.0003}
+	if len(rates) != len(want) {
+		t.Fatalf("got %d rates, want %d", len(rates), len(want))
+	}
+	for i := range want {
+		if math.Abs(rates[i]-want[i]) > 1e-12 {
+			t.Errorf("rates[%d] = %v, want %v", i, rates[i], want[i])
+		}
+	}
+
+	// 第二次调用命中缓存
+	if _, err := getFundingRateHistory("FRHISTUSDT", 3); err != nil {
+		t.Fatalf("cached getFundingRateHistory: %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("requests = %d, want 1 (second call should hit cache)", n)
+	}
+
+	if _, err := getFundingRateHistory("FRHISTUSDT", 0); err == nil {
+		t.Error("expected error for non-positive limit")
+	}
+}
+
+func TestGetFundingSnapshot_PredictedFunding(t *testing.T) {
+	mockFuturesAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/fapi/v1/premiumIndex" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		// 溢价 0.1%：利率差被钳制到 -0.05%，预测费率 = 0.1% - 0.05% = 0.05%
+		fmt.Fprint(w, `{"symbol":"FRPREDUSDT","markPrice":"100.10000000","indexPrice":"100.00000000",
+			"lastFundingRate":"0.00020000","interestRate":"0.00010000","nextFundingTime":1700028800000,"time":1700000000000}`)
+	})
+
+	rate, err := getFundingRate("FRPREDUSDT")
+	if err != nil {
+		t.Fatalf("getFundingRate: %v", err)
+	}
+	if math.Abs(rate-0.0002) > 1e-12 {
+		t.Errorf("rate = %v, want 0.0002", rate)
+	}
+	predicted, err := getPredictedFunding("FRPREDUSDT")
+	if err != nil {
+		t.Fatalf("getPredictedFunding: %v", err)
+	}
+	if math.Abs(predicted-0.0005) > 1e-9 {
+		t.Errorf("predicted = %v, want 0.0005", predicted)
+	}
+
+	tests := []struct {
+		name              string
+		mark, index, rate float64
+		want              float64
+	}{
+		{"无溢价取利率", 100, 100, 0.0001, 0.0001},
+		{"小幅溢价取利率", 100.002, 100, 0.0001, 0.0001},
+		{"大幅折价被钳制", 99.9, 100, 0.0001, -0.0005},
+		{"指数价无效", 100, 0, 0.0001, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := predictFundingRate(tt.mark, tt.index, tt.rate); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("predictFundingRate(%v, %v, %v) = %v, want %v", tt.mark, tt.index, tt.rate, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormat_FundingHistory(t *testing.T) {
+	data := &Data{
+		Symbol:             "BTCUSDT",
+		CurrentPrice:       100,
+		FundingRate:        0.0001,
+		FundingRateHistory: []float64{0.0001, -0.0002},
+		PredictedFunding:   0.0005,
+	}
+	out := Format(data, false)
+	for _, want := range []string{
+		"Predicted Funding (mark vs index basis): 5.00e-04",
+		"Funding Rate History (oldest → latest): [1.00e-04, -2.00e-04]",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Format output missing %q", want)
+		}
+	}
+}
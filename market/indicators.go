@@ -369,6 +369,679 @@ func calculateBollingerSeries(klines []Kline, period int, stdDevMultiplier float
 	return allPercentBs, allBandwidths
 }    
 
+// =============================================================================
+// Keltner Channels 肯特纳通道
+// =============================================================================
+
+// calculateKeltnerSeries 计算 Keltner Channels 序列，返回最近 10 个点的 %K 和通道宽度
+// 中轨为收盘价 EMA，上下轨为 中轨 ± multiplier×ATR；%K = (收盘价-下轨)/(上轨-下轨)，宽度 = (上轨-下轨)/中轨
+// 数据不足（少于 emaPeriod 根或不超过 atrPeriod 根K线）时返回空切片
+func calculateKeltnerSeries(klines []Kline, emaPeriod, atrPeriod int, multiplier float64) (percentK, width []float64) {
+	if emaPeriod <= 0 || atrPeriod <= 0 {
+		return []float64{}, []float64{}
+	}
+	minLen := emaPeriod
+	if atrPeriod+1 > minLen {
+		minLen = atrPeriod + 1
+	}
+	if len(klines) < minLen {
+		return []float64{}, []float64{}
+	}
+
+	// 只计算最近 10 个点
+	start := len(klines) - 9
+	if start < minLen {
+		start = minLen
+	}
+
+	percentK = make([]float64, 0, len(klines)-start+1)
+	width = make([]float64, 0, len(klines)-start+1)
+	for endIdx := start; endIdx <= len(klines); endIdx++ {
+		window := klines[:endIdx]
+		middle := calculateEMA(window, emaPeriod)
+		atr := calculateATR(window, atrPeriod)
+
+		upper := middle + multiplier*atr
+		lower := middle - multiplier*atr
+		channelWidth := upper - lower
+
+		if channelWidth == 0 || middle == 0 {
+			percentK = append(percentK, 0.5)
+			width = append(width, 0)
+			continue
+		}
+		percentK = append(percentK, (window[len(window)-1].Close-lower)/channelWidth)
+		width = append(width, channelWidth/middle)
+	}
+
+	return percentK, width
+}
+
+// isSqueezeOn 判断是否处于挤压状态：最新布林带宽度收缩到 Keltner 通道宽度之内
+func isSqueezeOn(bollingerBandwidths, keltnerWidths []float64) bool {
+	if len(bollingerBandwidths) == 0 || len(keltnerWidths) == 0 {
+		return false
+	}
+	bbWidth := bollingerBandwidths[len(bollingerBandwidths)-1]
+	kcWidth := keltnerWidths[len(keltnerWidths)-1]
+	return kcWidth > 0 && bbWidth < kcWidth
+}
+
+// =============================================================================
+// Stochastic Oscillator 随机指标
+// =============================================================================
+
+// stochasticKValues 计算每个窗口末端的 %K：%K = (Close - LowestLow) / (HighestHigh - LowestLow) × 100
+// 第 i 个值对应 klines[i+kPeriod-1]；窗口内无波动时取 50
+func stochasticKValues(klines []Kline, kPeriod int) []float64 {
+	if kPeriod <= 0 || len(klines) < kPeriod {
+		return []float64{}
+	}
+
+	ks := make([]float64, 0, len(klines)-kPeriod+1)
+	for endIdx := kPeriod - 1; endIdx < len(klines); endIdx++ {
+		startIdx := endIdx - kPeriod + 1
+		highest := klines[startIdx].High
+		lowest := klines[startIdx].Low
+		for i := startIdx + 1; i <= endIdx; i++ {
+			highest = math.Max(highest, klines[i].High)
+			lowest = math.Min(lowest, klines[i].Low)
+		}
+
+		if highest == lowest {
+			ks = append(ks, 50)
+			continue
+		}
+		ks = append(ks, (klines[endIdx].Close-lowest)/(highest-lowest)*100)
+	}
+	return ks
+}
+
+// calculateStochastic 计算随机指标 %K 和 %D（%K 的 dPeriod 期简单均值）
+// 数据不足（少于 kPeriod+dPeriod-1 根K线）时返回 0, 0
+func calculateStochastic(klines []Kline, kPeriod, dPeriod int) (k, d float64) {
+	ks, ds := calculateStochasticSeries(klines, kPeriod, dPeriod)
+	if len(ks) == 0 {
+		return 0, 0
+	}
+	return ks[len(ks)-1], ds[len(ds)-1]
+}
+
+// calculateStochasticSeries 计算随机指标序列，返回最近 10 个点的 %K 和 %D 值
+func calculateStochasticSeries(klines []Kline, kPeriod, dPeriod int) (ks, ds []float64) {
+	rawKs := stochasticKValues(klines, kPeriod)
+	if dPeriod <= 0 || len(rawKs) < dPeriod {
+		return []float64{}, []float64{}
+	}
+
+	allKs := make([]float64, 0, len(rawKs)-dPeriod+1)
+	allDs := make([]float64, 0, len(rawKs)-dPeriod+1)
+	for endIdx := dPeriod - 1; endIdx < len(rawKs); endIdx++ {
+		sum := 0.0
+		for i := endIdx - dPeriod + 1; i <= endIdx; i++ {
+			sum += rawKs[i]
+		}
+		allKs = append(allKs, rawKs[endIdx])
+		allDs = append(allDs, sum/float64(dPeriod))
+	}
+
+	// 返回最近 10 个点
+	if len(allKs) > 10 {
+		return allKs[len(allKs)-10:], allDs[len(allDs)-10:]
+	}
+	return allKs, allDs
+}
+
+// =============================================================================
+// Williams %R 威廉指标
+// =============================================================================
+
+// calculateWilliamsR 计算 Williams %R：(HighestHigh - Close) / (HighestHigh - LowestLow) × -100，即未平滑的 %K - 100
+// 返回值范围 [-100, 0]：收盘接近区间高点时趋近 0（通常 >-20 超买），接近区间低点时趋近 -100（通常 <-80 超卖）
+// 数据不足（少于 period 根K线）时返回 0
+func calculateWilliamsR(klines []Kline, period int) float64 {
+	values := calculateWilliamsRSeries(klines, period)
+	if len(values) == 0 {
+		return 0
+	}
+	return values[len(values)-1]
+}
+
+// calculateWilliamsRSeries 计算 Williams %R 序列，返回最近 10 个点；窗口内无波动时取 -50
+func calculateWilliamsRSeries(klines []Kline, period int) []float64 {
+	ks := stochasticKValues(klines, period)
+	if len(ks) > 10 {
+		ks = ks[len(ks)-10:]
+	}
+
+	values := make([]float64, len(ks))
+	for i, k := range ks {
+		values[i] = k - 100
+	}
+	return values
+}
+
+// =============================================================================
+// ADX 平均趋向指数（趋势强度）
+// =============================================================================
+
+// calculateADX 计算 ADX（Wilder 平滑的 +DI/-DI 与 DX）
+// 返回值范围 0-100，值越大趋势越强（通常 >25 为趋势行情，<20 为震荡）
+// 数据不足（少于 2*period 根K线）时返回 0
+func calculateADX(klines []Kline, period int) float64 {
+	adxs := calculateADXSeries(klines, period)
+	if len(adxs) == 0 {
+		return 0
+	}
+	return adxs[len(adxs)-1]
+}
+
+// calculateADXSeries 计算 ADX 序列，返回最近 10 个点的 ADX 值
+func calculateADXSeries(klines []Kline, period int) []float64 {
+	if period <= 0 || len(klines) < 2*period {
+		return []float64{}
+	}
+
+	// 计算每根K线的 True Range 与 +DM/-DM
+	trs := make([]float64, len(klines))
+	plusDMs := make([]float64, len(klines))
+	minusDMs := make([]float64, len(klines))
+	for i := 1; i < len(klines); i++ {
+		high := klines[i].High
+		low := klines[i].Low
+		prevClose := klines[i-1].Close
+		trs[i] = math.Max(high-low, math.Max(math.Abs(high-prevClose), math.Abs(low-prevClose)))
+
+		upMove := high - klines[i-1].High
+		downMove := klines[i-1].Low - low
+		if upMove > downMove && upMove > 0 {
+			plusDMs[i] = upMove
+		}
+		if downMove > upMove && downMove > 0 {
+			minusDMs[i] = downMove
+		}
+	}
+
+	// 初始平滑值（前 period 根之和）
+	smoothTR, smoothPlus, smoothMinus := 0.0, 0.0, 0.0
+	for i := 1; i <= period; i++ {
+		smoothTR += trs[i]
+		smoothPlus += plusDMs[i]
+		smoothMinus += minusDMs[i]
+	}
+
+	dx := func() float64 {
+		if smoothTR == 0 {
+			return 0
+		}
+		plusDI := 100 * smoothPlus / smoothTR
+		minusDI := 100 * smoothMinus / smoothTR
+		if plusDI+minusDI == 0 {
+			return 0
+		}
+		return 100 * math.Abs(plusDI-minusDI) / (plusDI + minusDI)
+	}
+
+	// 收集 DX，前 period 个 DX 的均值作为首个 ADX，之后 Wilder 平滑
+	dxs := []float64{dx()}
+	allADXs := make([]float64, 0, len(klines)-2*period+1)
+	var adx float64
+	for i := period + 1; i < len(klines); i++ {
+		smoothTR = smoothTR - smoothTR/float64(period) + trs[i]
+		smoothPlus = smoothPlus - smoothPlus/float64(period) + plusDMs[i]
+		smoothMinus = smoothMinus - smoothMinus/float64(period) + minusDMs[i]
+
+		if len(dxs) < period {
+			dxs = append(dxs, dx())
+			if len(dxs) == period {
+				sum := 0.0
+				for _, v := range dxs {
+					sum += v
+				}
+				adx = sum / float64(period)
+				allADXs = append(allADXs, adx)
+			}
+			continue
+		}
+		adx = (adx*float64(period-1) + dx()) / float64(period)
+		allADXs = append(allADXs, adx)
+	}
+
+	// 返回最近 10 个点
+	if len(allADXs) > 10 {
+		return allADXs[len(allADXs)-10:]
+	}
+	return allADXs
+}
+
+// =============================================================================
+// OBV 能量潮
+// =============================================================================
+
+// calculateOBVSeries 计算 OBV 序列，返回最近 10 个点的 OBV 值
+// 收盘价高于前一根时累加成交量，低于时扣减，持平不变；以第一根K线为 0 起算
+// 数据不足（少于 2 根K线）时返回空切片
+func calculateOBVSeries(klines []Kline) []float64 {
+	if len(klines) < 2 {
+		return []float64{}
+	}
+
+	obv := 0.0
+	allOBVs := make([]float64, 0, len(klines))
+	allOBVs = append(allOBVs, obv)
+	for i := 1; i < len(klines); i++ {
+		change := klines[i].Close - klines[i-1].Close
+		if change > 0 {
+			obv += klines[i].Volume
+		} else if change < 0 {
+			obv -= klines[i].Volume
+		}
+		allOBVs = append(allOBVs, obv)
+	}
+
+	// 返回最近 10 个点
+	if len(allOBVs) > 10 {
+		return allOBVs[len(allOBVs)-10:]
+	}
+	return allOBVs
+}
+
+// =============================================================================
+// VWAP 成交量加权均价
+// =============================================================================
+
+// CalculateVWAP 计算K线区间的成交量加权均价：sum(典型价×成交量)/sum(成交量)，典型价为 (H+L+C)/3
+// 总成交量为 0 时退回最后一根K线的收盘价；空数据返回 0
+func CalculateVWAP(klines []Kline) float64 {
+	if len(klines) == 0 {
+		return 0
+	}
+
+	var pv, totalVolume float64
+	for _, k := range klines {
+		if k.Volume <= 0 {
+			continue
+		}
+		typical := (k.High + k.Low + k.Close) / 3
+		pv += typical * k.Volume
+		totalVolume += k.Volume
+	}
+
+	if totalVolume == 0 {
+		return klines[len(klines)-1].Close
+	}
+	return pv / totalVolume
+}
+
+// calculateAnchoredVWAP 计算锚定 VWAP：从第一根开盘时间 >= anchorTime（毫秒）的K线开始累计
+// 锚点晚于最后一根K线时返回 0
+func calculateAnchoredVWAP(klines []Kline, anchorTime int64) float64 {
+	for i, k := range klines {
+		if k.OpenTime >= anchorTime {
+			return CalculateVWAP(klines[i:])
+		}
+	}
+	return 0
+}
+
+// =============================================================================
+// Supertrend 超级趋势
+// =============================================================================
+
+// calculateSupertrend 计算 Supertrend：以 (H+L)/2 ± multiplier×ATR 构造上下轨，
+// 收盘价跌破下轨转为下降趋势、突破上轨转为上升趋势
+// 返回当前 Supertrend 值（上升趋势为下轨、下降趋势为上轨）和方向（+1 上升，-1 下降）
+// 数据不足（不超过 period 根K线）时返回 (0, 0) 表示中性
+func calculateSupertrend(klines []Kline, period int, multiplier float64) (value float64, direction int) {
+	if period <= 0 || len(klines) <= period {
+		return 0, 0
+	}
+
+	trs := make([]float64, len(klines))
+	for i := 1; i < len(klines); i++ {
+		high := klines[i].High
+		low := klines[i].Low
+		prevClose := klines[i-1].Close
+		trs[i] = math.Max(high-low, math.Max(math.Abs(high-prevClose), math.Abs(low-prevClose)))
+	}
+
+	// 初始 ATR
+	atr := 0.0
+	for i := 1; i <= period; i++ {
+		atr += trs[i]
+	}
+	atr /= float64(period)
+
+	var upper, lower float64
+	for i := period; i < len(klines); i++ {
+		if i > period {
+			atr = (atr*float64(period-1) + trs[i]) / float64(period)
+		}
+		hl2 := (klines[i].High + klines[i].Low) / 2
+		basicUpper := hl2 + multiplier*atr
+		basicLower := hl2 - multiplier*atr
+		closePrice := klines[i].Close
+
+		if i == period {
+			upper, lower = basicUpper, basicLower
+			direction = 1
+			if closePrice < hl2 {
+				direction = -1
+			}
+			continue
+		}
+
+		// 上下轨只朝趋势方向收紧，价格越过前一根的轨道时才重置
+		prevUpper, prevLower := upper, lower
+		prevClose := klines[i-1].Close
+		if basicUpper < prevUpper || prevClose > prevUpper {
+			upper = basicUpper
+		}
+		if basicLower > prevLower || prevClose < prevLower {
+			lower = basicLower
+		}
+
+		if direction == 1 && closePrice < prevLower {
+			direction = -1
+		} else if direction == -1 && closePrice > prevUpper {
+			direction = 1
+		}
+	}
+
+	if direction == 1 {
+		return lower, direction
+	}
+	return upper, direction
+}
+
+// supertrendSignal 将 Supertrend 方向转换为可读的信号描述
+func supertrendSignal(direction int) string {
+	switch direction {
+	case 1:
+		return "Uptrend (price above Supertrend)"
+	case -1:
+		return "Downtrend (price below Supertrend)"
+	default:
+		return "Neutral (insufficient data)"
+	}
+}
+
+// =============================================================================
+// Donchian 唐奇安通道
+// =============================================================================
+
+// calculateDonchian 计算最近 period 根K线的唐奇安通道：上轨为最高价、下轨为最低价、中轨为两者均值
+// 数据不足（少于 period 根K线）时返回 (0, 0, 0)
+func calculateDonchian(klines []Kline, period int) (upper, lower, mid float64) {
+	if period <= 0 || len(klines) < period {
+		return 0, 0, 0
+	}
+
+	window := klines[len(klines)-period:]
+	upper = window[0].High
+	lower = window[0].Low
+	for _, k := range window[1:] {
+		upper = math.Max(upper, k.High)
+		lower = math.Min(lower, k.Low)
+	}
+	mid = (upper + lower) / 2
+	return upper, lower, mid
+}
+
+// =============================================================================
+// Parabolic SAR 抛物线转向指标
+// =============================================================================
+
+// calculateParabolicSAR 按 Wilder 的加速因子算法计算抛物线 SAR：
+// SAR 每根K线向极值点 (EP) 靠近 af×(EP-SAR)，趋势每创新高/新低 af 增加 step（上限 maxStep），
+// 价格穿越 SAR 时趋势翻转，SAR 重置为上一段趋势的极值点
+// 返回最新一根K线的 SAR 值和趋势方向（true 为多头，SAR 在价格下方）；少于 5 根K线时返回 (0, false) 表示中性
+func calculateParabolicSAR(klines []Kline, step, maxStep float64) (sar float64, isLong bool) {
+	if len(klines) < 5 || step <= 0 || maxStep < step {
+		return 0, false
+	}
+
+	// 由前两根K线确定初始方向
+	isLong = klines[1].Close >= klines[0].Close
+	af := step
+	var ep float64
+	if isLong {
+		sar = math.Min(klines[0].Low, klines[1].Low)
+		ep = math.Max(klines[0].High, klines[1].High)
+	} else {
+		sar = math.Max(klines[0].High, klines[1].High)
+		ep = math.Min(klines[0].Low, klines[1].Low)
+	}
+
+	for i := 2; i < len(klines); i++ {
+		sar += af * (ep - sar)
+		k := klines[i]
+
+		if isLong {
+			// SAR 不得高于前两根K线的最低价
+			sar = math.Min(sar, math.Min(klines[i-1].Low, klines[i-2].Low))
+			if k.Low < sar {
+				isLong = false
+				sar, ep, af = ep, k.Low, step
+			} else if k.High > ep {
+				ep = k.High
+				af = math.Min(af+step, maxStep)
+			}
+		} else {
+			// SAR 不得低于前两根K线的最高价
+			sar = math.Max(sar, math.Max(klines[i-1].High, klines[i-2].High))
+			if k.High > sar {
+				isLong = true
+				sar, ep, af = ep, k.High, step
+			} else if k.Low < ep {
+				ep = k.Low
+				af = math.Min(af+step, maxStep)
+			}
+		}
+	}
+
+	return sar, isLong
+}
+
+// sarTrend 将 SAR 方向转换为可读的趋势描述，sar 为 0 表示数据不足
+func sarTrend(sar float64, isLong bool) string {
+	switch {
+	case sar == 0:
+		return "Neutral (insufficient data)"
+	case isLong:
+		return "Long (SAR below price)"
+	default:
+		return "Short (SAR above price)"
+	}
+}
+
+// =============================================================================
+// Ichimoku 一目均衡表
+// =============================================================================
+
+// calculateIchimoku 按标准参数 (9, 26, 52) 计算一目均衡表在最新一根K线处的各线数值：
+// 转换线 tenkan 为 9 期最高最低价中点，基准线 kijun 为 26 期中点；
+// 先行带 A/B 前移 26 期绘制，因此落在当前K线上的云层取 26 根K线之前的 (tenkan+kijun)/2 与 52 期中点；
+// 迟行线 chikou 为当前收盘价（绘制在 26 根K线之前）
+// 少于 78 根K线（52 + 26）时返回全 0
+func calculateIchimoku(klines []Kline) (tenkan, kijun, senkouA, senkouB, chikou float64) {
+	const (
+		tenkanPeriod  = 9
+		kijunPeriod   = 26
+		senkouBPeriod = 52
+		displacement  = 26
+	)
+	if len(klines) < senkouBPeriod+displacement {
+		return 0, 0, 0, 0, 0
+	}
+
+	_, _, tenkan = calculateDonchian(klines, tenkanPeriod)
+	_, _, kijun = calculateDonchian(klines, kijunPeriod)
+
+	past := klines[:len(klines)-displacement]
+	_, _, pastTenkan := calculateDonchian(past, tenkanPeriod)
+	_, _, pastKijun := calculateDonchian(past, kijunPeriod)
+	senkouA = (pastTenkan + pastKijun) / 2
+	_, _, senkouB = calculateDonchian(past, senkouBPeriod)
+
+	chikou = klines[len(klines)-1].Close
+	return tenkan, kijun, senkouA, senkouB, chikou
+}
+
+// ichimokuCloudBias 将价格相对云层的位置转换为可读的偏向描述，云层为 0 表示数据不足
+func ichimokuCloudBias(price, senkouA, senkouB float64) string {
+	top := math.Max(senkouA, senkouB)
+	bottom := math.Min(senkouA, senkouB)
+	switch {
+	case top == 0:
+		return "Neutral (insufficient data)"
+	case price > top:
+		return "Above cloud (bullish)"
+	case price < bottom:
+		return "Below cloud (bearish)"
+	default:
+		return "In cloud (neutral)"
+	}
+}
+
+// =============================================================================
+// Market Regime 行情状态（Efficiency Ratio + 布林带宽度）
+// =============================================================================
+
+const (
+	regimeTrendingER = 0.6 // ER10 高于此值视为趋势行情
+	regimeRangingER  = 0.3 // ER10 低于此值视为无方向行情
+)
+
+// calculateMarketRegime 根据最新 ER10 与布林带 (20, 2) 宽度判断行情状态
+// 返回 "trending" / "ranging" / "choppy"；数据不足或 ER 为 NaN 时返回 "unknown"
+func calculateMarketRegime(klines []Kline) string {
+	ers := calculateERSeries(klines, 10)
+	if len(ers) == 0 {
+		return "unknown"
+	}
+	_, bandwidths := calculateBollingerSeries(klines, 20, 2.0)
+	return classifyMarketRegime(ers[len(ers)-1], bandwidths)
+}
+
+// classifyMarketRegime 按 ER 划分行情：ER > 0.6 为 trending；
+// ER < 0.3 时看布林带宽度，不高于近期均值（波动收敛）为 ranging，否则为 choppy（大幅来回震荡）；
+// 介于两者之间的方向性不足，同样记为 choppy
+func classifyMarketRegime(er float64, bandwidths []float64) string {
+	if math.IsNaN(er) || math.IsInf(er, 0) {
+		return "unknown"
+	}
+	if er > regimeTrendingER {
+		return "trending"
+	}
+	if er >= regimeRangingER {
+		return "choppy"
+	}
+	if len(bandwidths) == 0 {
+		return "ranging"
+	}
+	avg := 0.0
+	for _, bw := range bandwidths {
+		avg += bw
+	}
+	avg /= float64(len(bandwidths))
+	if bandwidths[len(bandwidths)-1] <= avg {
+		return "ranging"
+	}
+	return "choppy"
+}
+
+// =============================================================================
+// CCI 顺势指标
+// =============================================================================
+
+// calculateCCI 计算 CCI：(典型价 - 典型价SMA) / (0.015 × 平均绝对偏差)，典型价为 (H+L+C)/3
+// 通常 >+100 为超买/强势，<-100 为超卖/弱势；数据不足（少于 period 根K线）时返回 0
+func calculateCCI(klines []Kline, period int) float64 {
+	ccis := calculateCCISeries(klines, period)
+	if len(ccis) == 0 {
+		return 0
+	}
+	return ccis[len(ccis)-1]
+}
+
+// calculateCCISeries 计算 CCI 序列，返回最近 10 个点的 CCI 值
+// 平均绝对偏差为 0（价格完全不变）时该点记为 0
+func calculateCCISeries(klines []Kline, period int) []float64 {
+	if period <= 0 || len(klines) < period {
+		return []float64{}
+	}
+
+	typicals := make([]float64, len(klines))
+	for i, k := range klines {
+		typicals[i] = (k.High + k.Low + k.Close) / 3
+	}
+
+	start := len(klines) - 10
+	if start < period-1 {
+		start = period - 1
+	}
+
+	ccis := make([]float64, 0, len(klines)-start)
+	for i := start; i < len(klines); i++ {
+		window := typicals[i-period+1 : i+1]
+
+		mean := 0.0
+		for _, tp := range window {
+			mean += tp
+		}
+		mean /= float64(period)
+
+		meanDev := 0.0
+		for _, tp := range window {
+			meanDev += math.Abs(tp - mean)
+		}
+		meanDev /= float64(period)
+
+		if meanDev == 0 {
+			ccis = append(ccis, 0)
+			continue
+		}
+		ccis = append(ccis, (typicals[i]-mean)/(0.015*meanDev))
+	}
+
+	return ccis
+}
+
+// =============================================================================
+// MFI 资金流量指标
+// =============================================================================
+
+// calculateMFI 计算 MFI（成交量加权的 RSI）：典型价 (H+L+C)/3 × 成交量为原始资金流，
+// 典型价高于前一根计入正向资金流，低于前一根计入负向资金流，MFI = 100 - 100/(1+正向/负向)
+// 返回值范围 0-100（通常 >80 超买，<20 超卖）；数据不足（不超过 period 根K线）时返回 0
+func calculateMFI(klines []Kline, period int) float64 {
+	if period <= 0 || len(klines) <= period {
+		return 0
+	}
+
+	var positiveFlow, negativeFlow float64
+	for i := len(klines) - period; i < len(klines); i++ {
+		typical := (klines[i].High + klines[i].Low + klines[i].Close) / 3
+		prevTypical := (klines[i-1].High + klines[i-1].Low + klines[i-1].Close) / 3
+		rawFlow := typical * klines[i].Volume
+		if typical > prevTypical {
+			positiveFlow += rawFlow
+		} else if typical < prevTypical {
+			negativeFlow += rawFlow
+		}
+	}
+
+	if negativeFlow == 0 {
+		if positiveFlow == 0 {
+			return 50 // 无资金流动，视为中性
+		}
+		return 100
+	}
+	moneyRatio := positiveFlow / negativeFlow
+	return 100 - 100/(1+moneyRatio)
+}
+
 	// [新增] 计算 SMA 序列
 	func calculateSMASeries(klines []Kline, period int) []float64 {
 			if len(klines) == 0 {
@@ -839,3 +839,805 @@ func TestCalculateBollingerSeries_ValuesConsistency(t *testing.T) {
 			lastBandwidth, bandwidthSingle)
 	}
 }
+
+// =============================================================================
+// Stochastic 测试
+// =============================================================================
+
+func TestCalculateStochastic(t *testing.T) {
+	tests := []struct {
+		name       string
+		klines     []Kline
+		expectZero bool
+	}{
+		{"正常计算 - 足够数据", generateTestKlines(30), false},
+		{"数据不足", generateTestKlines(15), true},
+		{"空数据", []Kline{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, d := calculateStochastic(tt.klines, 14, 3)
+			if tt.expectZero {
+				if k != 0 || d != 0 {
+					t.Errorf("calculateStochastic() = (%.3f, %.3f), expected (0, 0)", k, d)
+				}
+				return
+			}
+			if k < 0 || k > 100 || d < 0 || d > 100 {
+				t.Errorf("calculateStochastic() = (%.3f, %.3f), expected in range [0, 100]", k, d)
+			}
+		})
+	}
+}
+
+func TestCalculateStochastic_Extremes(t *testing.T) {
+	// 单边上涨：收盘价贴近区间最高价，%K 应接近 100
+	risingKlines := make([]Kline, 30)
+	for i := range risingKlines {
+		c := 100.0 + float64(i)
+		risingKlines[i] = Kline{High: c + 0.5, Low: c - 0.5, Close: c}
+	}
+	k, d := calculateStochastic(risingKlines, 14, 3)
+	if k < 90 || d < 90 {
+		t.Errorf("Stochastic of rising prices should be close to 100: got K=%.2f D=%.2f", k, d)
+	}
+
+	// 单边下跌：收盘价贴近区间最低价，%K 应接近 0
+	fallingKlines := make([]Kline, 30)
+	for i := range fallingKlines {
+		c := 100.0 - float64(i)
+		fallingKlines[i] = Kline{High: c + 0.5, Low: c - 0.5, Close: c}
+	}
+	k, d = calculateStochastic(fallingKlines, 14, 3)
+	if k > 10 || d > 10 {
+		t.Errorf("Stochastic of falling prices should be close to 0: got K=%.2f D=%.2f", k, d)
+	}
+}
+
+func TestCalculateStochasticSeries(t *testing.T) {
+	klines := generateTestKlines(40)
+	ks, ds := calculateStochasticSeries(klines, 14, 3)
+	if len(ks) != 10 || len(ds) != 10 {
+		t.Fatalf("expected 10 points, got K=%d D=%d", len(ks), len(ds))
+	}
+
+	// 序列最后一个点应与单点计算一致
+	k, d := calculateStochastic(klines, 14, 3)
+	if math.Abs(ks[len(ks)-1]-k) > 1e-9 || math.Abs(ds[len(ds)-1]-d) > 1e-9 {
+		t.Errorf("series last point (%.4f, %.4f) != single calculation (%.4f, %.4f)", ks[len(ks)-1], ds[len(ds)-1], k, d)
+	}
+
+	if ks, ds := calculateStochasticSeries(generateTestKlines(15), 14, 3); len(ks) != 0 || len(ds) != 0 {
+		t.Errorf("expected empty series for insufficient data, got K=%d D=%d", len(ks), len(ds))
+	}
+}
+
+// =============================================================================
+// ADX 测试
+// =============================================================================
+
+func TestCalculateADX(t *testing.T) {
+	tests := []struct {
+		name       string
+		klines     []Kline
+		expectZero bool
+	}{
+		{"正常计算 - 足够数据", generateTestKlines(40), false},
+		{"数据不足", generateTestKlines(27), true},
+		{"空数据", []Kline{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adx := calculateADX(tt.klines, 14)
+			if tt.expectZero {
+				if adx != 0 {
+					t.Errorf("calculateADX() = %.3f, expected 0", adx)
+				}
+				return
+			}
+			if adx < 0 || adx > 100 {
+				t.Errorf("calculateADX() = %.3f, expected in range [0, 100]", adx)
+			}
+		})
+	}
+}
+
+func TestCalculateADX_TrendStrength(t *testing.T) {
+	// 强势上涨：每根K线高低点都抬高，ADX 应 > 25
+	trending := make([]Kline, 60)
+	for i := range trending {
+		c := 100.0 + float64(i)*2
+		trending[i] = Kline{High: c + 0.5, Low: c - 0.5, Close: c}
+	}
+	if adx := calculateADX(trending, 14); adx <= 25 {
+		t.Errorf("ADX of strong uptrend should be > 25: got %.2f", adx)
+	}
+
+	// 震荡行情：涨跌交替，+DI/-DI 相互抵消，ADX 应 < 20
+	choppy := make([]Kline, 60)
+	for i := range choppy {
+		c := 100.0
+		if i%2 == 1 {
+			c = 101.0
+		}
+		choppy[i] = Kline{High: c + 0.5, Low: c - 0.5, Close: c}
+	}
+	if adx := calculateADX(choppy, 14); adx >= 20 {
+		t.Errorf("ADX of choppy market should be < 20: got %.2f", adx)
+	}
+}
+
+func TestCalculateADXSeries(t *testing.T) {
+	klines := generateTestKlines(60)
+	adxs := calculateADXSeries(klines, 14)
+	if len(adxs) != 10 {
+		t.Fatalf("expected 10 points, got %d", len(adxs))
+	}
+	if last := calculateADX(klines, 14); math.Abs(adxs[len(adxs)-1]-last) > 1e-9 {
+		t.Errorf("series last point %.4f != single calculation %.4f", adxs[len(adxs)-1], last)
+	}
+
+	// 恰好 2*period 根K线时只有一个 ADX 点
+	if got := calculateADXSeries(generateTestKlines(28), 14); len(got) != 1 {
+		t.Errorf("expected 1 point with 2*period klines, got %d", len(got))
+	}
+}
+
+// =============================================================================
+// OBV 测试
+// =============================================================================
+
+func TestCalculateOBVSeries(t *testing.T) {
+	tests := []struct {
+		name        string
+		klines      []Kline
+		expectedLen int
+	}{
+		{"正常计算 - 超过10个点", generateTestKlines(30), 10},
+		{"少于10个点", generateTestKlines(5), 5},
+		{"数据不足", generateTestKlines(1), 0},
+		{"空数据", []Kline{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obvs := calculateOBVSeries(tt.klines)
+			if len(obvs) != tt.expectedLen {
+				t.Errorf("calculateOBVSeries() length = %d, expected %d", len(obvs), tt.expectedLen)
+			}
+		})
+	}
+}
+
+func TestCalculateOBVSeries_RisingPriceAndVolume(t *testing.T) {
+	// 价涨量增：OBV 应单调递增
+	klines := make([]Kline, 15)
+	for i := range klines {
+		klines[i] = Kline{Close: 100.0 + float64(i), Volume: 1000.0 + float64(i)*100}
+	}
+
+	obvs := calculateOBVSeries(klines)
+	for i := 1; i < len(obvs); i++ {
+		if obvs[i] <= obvs[i-1] {
+			t.Fatalf("OBV should increase monotonically: obv[%d]=%.2f <= obv[%d]=%.2f", i, obvs[i], i-1, obvs[i-1])
+		}
+	}
+
+	// 下跌K线扣减成交量，持平K线保持不变
+	mixed := []Kline{{Close: 100, Volume: 10}, {Close: 101, Volume: 20}, {Close: 99, Volume: 5}, {Close: 99, Volume: 50}}
+	want := []float64{0, 20, 15, 15}
+	got := calculateOBVSeries(mixed)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("obv[%d] = %.2f, expected %.2f", i, got[i], want[i])
+		}
+	}
+}
+
+// =============================================================================
+// VWAP 测试
+// =============================================================================
+
+func TestCalculateVWAP(t *testing.T) {
+	// 成交量集中在高价K线上：真实 VWAP 应明显偏向高价，而非简单平均
+	skewed := []Kline{
+		{High: 101, Low: 99, Close: 100, Volume: 1},
+		{High: 111, Low: 109, Close: 110, Volume: 99},
+	}
+	naive := 0.0
+	for _, k := range skewed {
+		naive += (k.High + k.Low + k.Close) / 3
+	}
+	naive /= float64(len(skewed))
+
+	tests := []struct {
+		name     string
+		klines   []Kline
+		expected float64
+	}{
+		{"成交量偏斜", skewed, (100*1 + 110*99) / 100.0},
+		{"单根K线", []Kline{{Open: 90, High: 120, Low: 90, Close: 105, Volume: 10}}, 105},
+		{"总成交量为 0 退回收盘价", []Kline{{High: 101, Low: 99, Close: 100}, {High: 103, Low: 101, Close: 102}}, 102},
+		{"空数据", []Kline{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CalculateVWAP(tt.klines); math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("CalculateVWAP() = %.6f, expected %.6f", got, tt.expected)
+			}
+		})
+	}
+
+	if vwap := CalculateVWAP(skewed); math.Abs(vwap-naive) < 1 {
+		t.Errorf("VWAP %.4f should differ from naive average %.4f for skewed volume", vwap, naive)
+	}
+}
+
+func TestCalculateAnchoredVWAP(t *testing.T) {
+	var klines []Kline
+	for i := 0; i < 10; i++ {
+		price := 100.0 + float64(i*2)
+		klines = append(klines, Kline{
+			OpenTime: int64(i) * 60000,
+			High:     price + 1,
+			Low:      price - 1,
+			Close:    price,
+			Volume:   float64(i + 1),
+		})
+	}
+
+	// 锚定在第 6 根（索引 5）：手工累计 sum(典型价×成交量)/sum(成交量)
+	var pv, vol float64
+	for _, k := range klines[5:] {
+		pv += (k.High + k.Low + k.Close) / 3 * k.Volume
+		vol += k.Volume
+	}
+	want := pv / vol
+
+	// 锚点落在两根K线之间时从下一根开始
+	if got := calculateAnchoredVWAP(klines, 4*60000+1); math.Abs(got-want) > 1e-9 {
+		t.Errorf("calculateAnchoredVWAP() = %.6f, expected %.6f", got, want)
+	}
+	if got, full := calculateAnchoredVWAP(klines, 5*60000), CalculateVWAP(klines); math.Abs(got-full) < 1 {
+		t.Errorf("anchored VWAP %.4f should differ from full-series VWAP %.4f", got, full)
+	}
+	if got := calculateAnchoredVWAP(klines, 10*60000); got != 0 {
+		t.Errorf("anchor past series end should return 0, got %.6f", got)
+	}
+
+	// 未配置锚点时 Data 不输出锚定 VWAP
+	t.Cleanup(func() { SetVWAPAnchor(0) })
+	if got := anchoredVWAP(klines); got != 0 {
+		t.Errorf("anchoredVWAP() without anchor = %.6f, expected 0", got)
+	}
+	SetVWAPAnchor(5 * 60000)
+	if got := anchoredVWAP(klines); math.Abs(got-want) > 1e-9 {
+		t.Errorf("anchoredVWAP() = %.6f, expected %.6f", got, want)
+	}
+}
+
+// =============================================================================
+// Supertrend 测试
+// =============================================================================
+
+func TestCalculateSupertrend_InsufficientData(t *testing.T) {
+	value, direction := calculateSupertrend(generateTestKlines(10), 10, 3.0)
+	if value != 0 || direction != 0 {
+		t.Errorf("calculateSupertrend() = (%.4f, %d), expected (0, 0)", value, direction)
+	}
+	if got := supertrendSignal(direction); got != "Neutral (insufficient data)" {
+		t.Errorf("supertrendSignal(0) = %q", got)
+	}
+}
+
+func TestCalculateSupertrend_FlipsOnBandCross(t *testing.T) {
+	// 先单边上涨 30 根，再快速下跌 15 根
+	var klines []Kline
+	price := 100.0
+	for i := 0; i < 45; i++ {
+		if i < 30 {
+			price += 1
+		} else {
+			price -= 4
+		}
+		klines = append(klines, Kline{Open: price, High: price + 0.5, Low: price - 0.5, Close: price})
+	}
+
+	value, direction := calculateSupertrend(klines[:30], 10, 3.0)
+	if direction != 1 {
+		t.Fatalf("direction during uptrend = %d, expected 1", direction)
+	}
+	if value >= klines[29].Close {
+		t.Errorf("uptrend Supertrend %.4f should sit below close %.4f", value, klines[29].Close)
+	}
+
+	// 逐根推进，找到方向翻转点：翻转K线收盘价必须跌破前一根的下轨
+	flipAt := -1
+	for n := 31; n <= len(klines); n++ {
+		prevValue, _ := calculateSupertrend(klines[:n-1], 10, 3.0)
+		if _, dir := calculateSupertrend(klines[:n], 10, 3.0); dir == -1 {
+			flipAt = n - 1
+			if klines[flipAt].Close >= prevValue {
+				t.Errorf("flipped at bar %d with close %.4f above prior lower band %.4f", flipAt, klines[flipAt].Close, prevValue)
+			}
+			break
+		}
+	}
+	if flipAt < 30 {
+		t.Fatalf("expected direction to flip during the decline, flipAt=%d", flipAt)
+	}
+
+	value, direction = calculateSupertrend(klines, 10, 3.0)
+	if direction != -1 {
+		t.Errorf("direction after decline = %d, expected -1", direction)
+	}
+	if value <= klines[len(klines)-1].Close {
+		t.Errorf("downtrend Supertrend %.4f should sit above close %.4f", value, klines[len(klines)-1].Close)
+	}
+	if got := supertrendSignal(direction); got != "Downtrend (price below Supertrend)" {
+		t.Errorf("supertrendSignal(-1) = %q", got)
+	}
+}
+
+// =============================================================================
+// CCI 测试
+// =============================================================================
+
+func TestCalculateCCI(t *testing.T) {
+	tests := []struct {
+		name        string
+		klines      []Kline
+		expectedLen int
+	}{
+		{"正常计算 - 超过10个点", generateTestKlines(40), 10},
+		{"少于10个点", generateTestKlines(24), 5},
+		{"数据不足", generateTestKlines(19), 0},
+		{"空数据", []Kline{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ccis := calculateCCISeries(tt.klines, 20)
+			if len(ccis) != tt.expectedLen {
+				t.Errorf("calculateCCISeries() length = %d, expected %d", len(ccis), tt.expectedLen)
+			}
+			if tt.expectedLen == 0 {
+				if cci := calculateCCI(tt.klines, 20); cci != 0 {
+					t.Errorf("calculateCCI() = %.3f, expected 0", cci)
+				}
+			}
+		})
+	}
+
+	// 价格完全不变时平均偏差为 0，CCI 记为 0
+	flat := make([]Kline, 25)
+	for i := range flat {
+		flat[i] = Kline{High: 100, Low: 100, Close: 100}
+	}
+	if cci := calculateCCI(flat, 20); cci != 0 || math.IsNaN(cci) {
+		t.Errorf("CCI of flat prices = %.3f, expected 0", cci)
+	}
+}
+
+func TestCalculateCCI_Trend(t *testing.T) {
+	uptrend := make([]Kline, 40)
+	downtrend := make([]Kline, 40)
+	for i := range uptrend {
+		up := 100.0 + float64(i)
+		down := 200.0 - float64(i)
+		uptrend[i] = Kline{High: up + 0.5, Low: up - 0.5, Close: up}
+		downtrend[i] = Kline{High: down + 0.5, Low: down - 0.5, Close: down}
+	}
+
+	// 匀速上涨时 CCI = 9.5 / (0.015 × 5) ≈ 126.67，应明显高于 +100
+	if cci := calculateCCI(uptrend, 20); cci <= 100 {
+		t.Errorf("CCI of uptrend should be > 100: got %.2f", cci)
+	}
+	if cci := calculateCCI(downtrend, 20); cci >= -100 {
+		t.Errorf("CCI of downtrend should be < -100: got %.2f", cci)
+	}
+}
+
+// =============================================================================
+// MFI 测试
+// =============================================================================
+
+func TestCalculateMFI(t *testing.T) {
+	tests := []struct {
+		name       string
+		klines     []Kline
+		expectZero bool
+	}{
+		{"正常计算 - 足够数据", generateTestKlines(30), false},
+		{"数据不足", generateTestKlines(14), true},
+		{"空数据", []Kline{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mfi := calculateMFI(tt.klines, 14)
+			if tt.expectZero {
+				if mfi != 0 {
+					t.Errorf("calculateMFI() = %.3f, expected 0", mfi)
+				}
+				return
+			}
+			// MFI 应该在 0-100 范围内
+			if mfi < 0 || mfi > 100 {
+				t.Errorf("calculateMFI() = %.3f, expected in range [0, 100]", mfi)
+			}
+		})
+	}
+}
+
+func TestCalculateMFI_Extremes(t *testing.T) {
+	// 价涨为主、下跌K线成交量很小 - MFI 应该很高
+	risingKlines := make([]Kline, 20)
+	for i := range risingKlines {
+		c := 100.0 + float64(i)
+		volume := 1000.0
+		if i%5 == 4 {
+			c -= 1.5
+			volume = 10
+		}
+		risingKlines[i] = Kline{High: c + 0.5, Low: c - 0.5, Close: c, Volume: volume}
+	}
+
+	mfi := calculateMFI(risingKlines, 14)
+	if mfi < 90 {
+		t.Errorf("MFI of rising prices should be close to 100: got %.2f", mfi)
+	}
+
+	// 全跌情况 - MFI 应该接近 0
+	fallingKlines := make([]Kline, 20)
+	for i := range fallingKlines {
+		c := 100.0 - float64(i)
+		fallingKlines[i] = Kline{High: c + 0.5, Low: c - 0.5, Close: c, Volume: 1000}
+	}
+
+	mfi = calculateMFI(fallingKlines, 14)
+	if mfi > 10 {
+		t.Errorf("MFI of falling prices should be close to 0: got %.2f", mfi)
+	}
+
+	// 价格完全不变 - 无资金流动，MFI 为中性 50
+	flatKlines := make([]Kline, 20)
+	for i := range flatKlines {
+		flatKlines[i] = Kline{High: 100, Low: 100, Close: 100, Volume: 1000}
+	}
+	if mfi = calculateMFI(flatKlines, 14); mfi != 50 {
+		t.Errorf("MFI of flat prices should be 50: got %.2f", mfi)
+	}
+}
+
+// =============================================================================
+// Williams %R 测试
+// =============================================================================
+
+func TestCalculateWilliamsR(t *testing.T) {
+	// 区间 90-110 内震荡，最后一根收盘位置决定 %R
+	rangeKlines := func(lastClose float64) []Kline {
+		klines := make([]Kline, 20)
+		for i := range klines {
+			c := 100.0 + float64(i%3) - 1
+			klines[i] = Kline{High: c + 1, Low: c - 1, Close: c}
+		}
+		klines[8].High = 110
+		klines[12].Low = 90
+		klines[19] = Kline{High: math.Max(lastClose, 101), Low: math.Min(lastClose, 99), Close: lastClose}
+		return klines
+	}
+
+	tests := []struct {
+		name    string
+		klines  []Kline
+		wantMin float64
+		wantMax float64
+	}{
+		{"收盘于区间高点附近趋近 0", rangeKlines(109.5), -5, 0},
+		{"收盘于区间低点附近趋近 -100", rangeKlines(90.5), -100, -95},
+		{"收盘于区间中部约 -50", rangeKlines(100), -55, -45},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wr := calculateWilliamsR(tt.klines, 14)
+			if wr < tt.wantMin || wr > tt.wantMax {
+				t.Errorf("calculateWilliamsR() = %.2f, expected within [%.0f, %.0f]", wr, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+
+	// 与随机指标 %K 互为反向：%R = %K - 100
+	klines := generateTestKlines(40)
+	series := calculateWilliamsRSeries(klines, 14)
+	if len(series) != 10 {
+		t.Fatalf("series length = %d, expected 10", len(series))
+	}
+	ks := stochasticKValues(klines, 14)
+	for i, wr := range series {
+		k := ks[len(ks)-10+i]
+		if wr < -100 || wr > 0 {
+			t.Errorf("series[%d] = %.2f out of [-100, 0]", i, wr)
+		}
+		if math.Abs(wr-(k-100)) > 1e-9 {
+			t.Errorf("series[%d] = %.4f, expected %%K-100 = %.4f", i, wr, k-100)
+		}
+	}
+
+	if wr := calculateWilliamsR(generateTestKlines(10), 14); wr != 0 {
+		t.Errorf("insufficient data should return 0, got %.2f", wr)
+	}
+}
+
+// =============================================================================
+// Keltner Channels 测试
+// =============================================================================
+
+func TestCalculateKeltnerSeries(t *testing.T) {
+	tests := []struct {
+		name        string
+		klineCount  int
+		expectedLen int
+	}{
+		{"足够数据 - 100根K线", 100, 10},
+		{"部分数据 - 25根K线", 25, 6},
+		{"最少数据 - 20根K线", 20, 1},
+		{"数据不足 - 19根K线", 19, 0},
+		{"空数据", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			percentK, width := calculateKeltnerSeries(generateTestKlines(tt.klineCount), 20, 10, 1.5)
+			if len(percentK) != tt.expectedLen || len(width) != tt.expectedLen {
+				t.Errorf("calculateKeltnerSeries() lengths = (%d, %d), expected %d", len(percentK), len(width), tt.expectedLen)
+			}
+		})
+	}
+}
+
+func TestCalculateKeltnerSeries_Width(t *testing.T) {
+	// 收盘价恒为 100、每根K线振幅 2：EMA=100，ATR=2
+	// 宽度 = 2×1.5×2/100 = 0.06，收盘价位于中轨，%K = 0.5
+	klines := make([]Kline, 30)
+	for i := range klines {
+		klines[i] = Kline{High: 101, Low: 99, Close: 100}
+	}
+
+	percentK, width := calculateKeltnerSeries(klines, 20, 10, 1.5)
+	if len(width) != 10 {
+		t.Fatalf("expected 10 points, got %d", len(width))
+	}
+	for i := range width {
+		if math.Abs(width[i]-0.06) > 1e-9 {
+			t.Errorf("width[%d] = %.6f, expected 0.06", i, width[i])
+		}
+		if math.Abs(percentK[i]-0.5) > 1e-9 {
+			t.Errorf("percentK[%d] = %.6f, expected 0.5", i, percentK[i])
+		}
+	}
+
+	// 收盘价不变而K线振幅存在：布林带宽度为 0，处于挤压状态
+	_, bbWidths := calculateBollingerSeries(klines, 20, 2.0)
+	if !isSqueezeOn(bbWidths, width) {
+		t.Error("expected squeeze on when Bollinger width is inside Keltner width")
+	}
+
+	// 单边上涨且振幅很小：布林带远宽于 Keltner 通道，不处于挤压状态
+	trending := make([]Kline, 30)
+	for i := range trending {
+		c := 100.0 + float64(i)*2
+		trending[i] = Kline{High: c + 0.1, Low: c - 0.1, Close: c}
+	}
+	_, kcWidths := calculateKeltnerSeries(trending, 20, 10, 1.5)
+	_, bbWidths = calculateBollingerSeries(trending, 20, 2.0)
+	if isSqueezeOn(bbWidths, kcWidths) {
+		t.Errorf("expected squeeze off for trending series: bb=%.4f kc=%.4f", bbWidths[len(bbWidths)-1], kcWidths[len(kcWidths)-1])
+	}
+
+	if isSqueezeOn(nil, width) {
+		t.Error("expected squeeze off without Bollinger data")
+	}
+}
+
+// =============================================================================
+// Donchian 测试
+// =============================================================================
+
+func TestCalculateDonchian(t *testing.T) {
+	// 价格在 99-105 区间内震荡，最近 20 根中插入最高点 110 和最低点 95
+	klines := make([]Kline, 30)
+	for i := range klines {
+		c := 100.0 + float64(i%5)
+		klines[i] = Kline{High: c + 1, Low: c - 1, Close: c}
+	}
+	klines[12].High = 110
+	klines[19].Low = 95
+	// 窗口之外的极值不应计入
+	klines[2].High = 200
+	klines[3].Low = 50
+
+	tests := []struct {
+		name      string
+		klines    []Kline
+		period    int
+		wantUpper float64
+		wantLower float64
+	}{
+		{"区间行情", klines, 20, 110, 95},
+		{"短周期只看最近K线", klines, 5, 105, 99},
+		{"数据不足", klines[:10], 20, 0, 0},
+		{"空数据", []Kline{}, 20, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upper, lower, mid := calculateDonchian(tt.klines, tt.period)
+			if upper != tt.wantUpper || lower != tt.wantLower {
+				t.Errorf("calculateDonchian() = (%.2f, %.2f), expected (%.2f, %.2f)", upper, lower, tt.wantUpper, tt.wantLower)
+			}
+			if wantMid := (tt.wantUpper + tt.wantLower) / 2; mid != wantMid {
+				t.Errorf("mid = %.2f, expected %.2f", mid, wantMid)
+			}
+		})
+	}
+}
+
+// =============================================================================
+// Parabolic SAR 测试
+// =============================================================================
+
+func TestCalculateParabolicSAR_InsufficientData(t *testing.T) {
+	sar, isLong := calculateParabolicSAR(generateTestKlines(4), 0.02, 0.2)
+	if sar != 0 || isLong {
+		t.Errorf("calculateParabolicSAR() = (%.4f, %v), expected (0, false)", sar, isLong)
+	}
+	if got := sarTrend(sar, isLong); got != "Neutral (insufficient data)" {
+		t.Errorf("sarTrend(0, false) = %q", got)
+	}
+}
+
+func TestCalculateParabolicSAR_FlipsOnReversal(t *testing.T) {
+	// 先单边上涨 20 根，再快速下跌 10 根
+	var klines []Kline
+	price := 100.0
+	for i := 0; i < 30; i++ {
+		if i < 20 {
+			price += 1
+		} else {
+			price -= 3
+		}
+		klines = append(klines, Kline{Open: price, High: price + 0.5, Low: price - 0.5, Close: price})
+	}
+
+	// 上涨过程中 SAR 始终位于价格下方
+	for n := 5; n <= 20; n++ {
+		sar, isLong := calculateParabolicSAR(klines[:n], 0.02, 0.2)
+		if !isLong {
+			t.Fatalf("bar %d: expected long during uptrend", n-1)
+		}
+		if sar >= klines[n-1].Low {
+			t.Errorf("bar %d: SAR %.4f should stay below low %.4f", n-1, sar, klines[n-1].Low)
+		}
+	}
+
+	// 下跌后翻转为空头：翻转K线的最低价跌破前一根的 SAR，翻转后 SAR 位于价格上方
+	flipAt := -1
+	for n := 21; n <= len(klines); n++ {
+		prevSAR, _ := calculateParabolicSAR(klines[:n-1], 0.02, 0.2)
+		if sar, isLong := calculateParabolicSAR(klines[:n], 0.02, 0.2); !isLong {
+			flipAt = n - 1
+			if klines[flipAt].Low >= prevSAR {
+				t.Errorf("flipped at bar %d with low %.4f above prior SAR %.4f", flipAt, klines[flipAt].Low, prevSAR)
+			}
+			if sar <= klines[flipAt].High {
+				t.Errorf("SAR %.4f after flip should sit above high %.4f", sar, klines[flipAt].High)
+			}
+			break
+		}
+	}
+	if flipAt < 20 {
+		t.Fatalf("expected SAR to flip during the decline, flipAt=%d", flipAt)
+	}
+
+	sar, isLong := calculateParabolicSAR(klines, 0.02, 0.2)
+	if got := sarTrend(sar, isLong); got != "Short (SAR above price)" {
+		t.Errorf("sarTrend() = %q, expected short", got)
+	}
+}
+
+func TestCalculateIchimoku_InsufficientData(t *testing.T) {
+	tenkan, kijun, senkouA, senkouB, chikou := calculateIchimoku(generateTestKlines(77))
+	if tenkan != 0 || kijun != 0 || senkouA != 0 || senkouB != 0 || chikou != 0 {
+		t.Errorf("calculateIchimoku() = (%.4f, %.4f, %.4f, %.4f, %.4f), expected all zeros",
+			tenkan, kijun, senkouA, senkouB, chikou)
+	}
+	if got := ichimokuCloudBias(100, senkouA, senkouB); got != "Neutral (insufficient data)" {
+		t.Errorf("ichimokuCloudBias() = %q", got)
+	}
+}
+
+func TestCalculateIchimoku_RisingTrendAboveCloud(t *testing.T) {
+	// 单边上涨 120 根，每根 +1
+	var klines []Kline
+	for i := 0; i < 120; i++ {
+		price := 100.0 + float64(i)
+		klines = append(klines, Kline{Open: price - 0.5, High: price + 0.5, Low: price - 1, Close: price})
+	}
+
+	tenkan, kijun, senkouA, senkouB, chikou := calculateIchimoku(klines)
+	last := klines[len(klines)-1].Close
+
+	// 转换线（9期中点）比基准线（26期中点）更贴近价格
+	if !(tenkan > kijun && kijun < last) {
+		t.Errorf("expected tenkan %.4f > kijun %.4f below price %.4f", tenkan, kijun, last)
+	}
+	// 云层取自 26 根之前，上涨时先行带 A（短周期）在 B 之上且都低于当前价
+	if !(senkouA > senkouB && senkouA < last) {
+		t.Errorf("expected senkouB %.4f < senkouA %.4f < price %.4f", senkouB, senkouA, last)
+	}
+	if chikou != last {
+		t.Errorf("chikou = %.4f, expected latest close %.4f", chikou, last)
+	}
+	if got := ichimokuCloudBias(last, senkouA, senkouB); got != "Above cloud (bullish)" {
+		t.Errorf("ichimokuCloudBias() = %q, expected above cloud", got)
+	}
+
+	tests := []struct {
+		name  string
+		price float64
+		want  string
+	}{
+		{"inside cloud", (senkouA + senkouB) / 2, "In cloud (neutral)"},
+		{"below cloud", senkouB - 1, "Below cloud (bearish)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ichimokuCloudBias(tt.price, senkouA, senkouB); got != tt.want {
+				t.Errorf("ichimokuCloudBias(%.4f) = %q, want %q", tt.price, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateMarketRegime_StrongTrend(t *testing.T) {
+	// 单边上涨 60 根，每根 +1，ER10 = 1
+	var klines []Kline
+	for i := 0; i < 60; i++ {
+		price := 100.0 + float64(i)
+		klines = append(klines, Kline{Open: price - 0.5, High: price + 0.5, Low: price - 1, Close: price})
+	}
+	if got := calculateMarketRegime(klines); got != "trending" {
+		t.Errorf("calculateMarketRegime() = %q, expected trending", got)
+	}
+	if got := calculateMarketRegime(klines[:10]); got != "unknown" {
+		t.Errorf("calculateMarketRegime() with 10 klines = %q, expected unknown", got)
+	}
+}
+
+func TestClassifyMarketRegime(t *testing.T) {
+	tests := []struct {
+		name       string
+		er         float64
+		bandwidths []float64
+		want       string
+	}{
+		{"NaN ER", math.NaN(), []float64{0.02}, "unknown"},
+		{"high ER", 0.8, []float64{0.01, 0.05}, "trending"},
+		{"medium ER", 0.45, []float64{0.02, 0.02}, "choppy"},
+		{"low ER contracting bands", 0.1, []float64{0.05, 0.04, 0.02}, "ranging"},
+		{"low ER expanding bands", 0.1, []float64{0.02, 0.03, 0.08}, "choppy"},
+		{"low ER no bands", 0.1, nil, "ranging"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyMarketRegime(tt.er, tt.bandwidths); got != tt.want {
+				t.Errorf("classifyMarketRegime(%v, %v) = %q, want %q", tt.er, tt.bandwidths, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package market
+
+import "testing"
+
+func TestNormalizeWithQuote(t *testing.T) {
+	tests := []struct {
+		name   string
+		symbol string
+		quote  string
+		want   string
+	}{
+		{"默认 USDT", "btc", "", "BTCUSDT"},
+		{"USDC 计价", "btc", "usdc", "BTCUSDC"},
+		{"BTC 计价", "ETH", "BTC", "ETHBTC"},
+		{"已是 USDC 交易对", "btcusdc", "USDT", "BTCUSDC"},
+		{"已是 BTC 交易对", "ETHBTC", "BTC", "ETHBTC"},
+		{"以 BTC 结尾的基础币", "WBTC", "USDT", "WBTCUSDT"},
+		{"以 BTC 结尾的基础币默认计价", "wbtc", "", "WBTCUSDT"},
+		{"已是 BUSD 交易对", "BNBBUSD", "USDC", "BNBBUSD"},
+		{"已是 USDT 交易对", "SOLUSDT", "USDC", "SOLUSDT"},
+		{"基础币与计价币同名", "BTC", "USDC", "BTCUSDC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeWithQuote(tt.symbol, tt.quote); got != tt.want {
+				t.Errorf("NormalizeWithQuote(%q, %q) = %q, want %q", tt.symbol, tt.quote, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize_KeepsQualifiedSymbols(t *testing.T) {
+	tests := map[string]string{
+		"btc":     "BTCUSDT",
+		"BTC":     "BTCUSDT",
+		"BTCUSDT": "BTCUSDT",
+		"BTCUSDC": "BTCUSDC",
+		"wbtc":    "WBTCUSDT",
+	}
+	for in, want := range tests {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBuildDataFromKlinesWithQuote(t *testing.T) {
+	klines := generateTestKlines(30)
+
+	data, err := BuildDataFromKlinesWithQuote("eth", "usdc", klines, nil)
+	if err != nil {
+		t.Fatalf("BuildDataFromKlinesWithQuote: %v", err)
+	}
+	if data.Symbol != "ETHUSDC" {
+		t.Errorf("Symbol = %q, want ETHUSDC", data.Symbol)
+	}
+
+	// 已带计价币的交易对不会被补全为 USDT
+	data, err = BuildDataFromKlines("BTCUSDC", klines, nil)
+	if err != nil {
+		t.Fatalf("BuildDataFromKlines: %v", err)
+	}
+	if data.Symbol != "BTCUSDC" {
+		t.Errorf("Symbol = %q, want BTCUSDC", data.Symbol)
+	}
+}
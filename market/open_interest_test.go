@@ -0,0 +1,80 @@
+package market
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetOpenInterestData_ChangePct(t *testing.T) {
+	mockFuturesAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fapi/v1/openInterest":
+			fmt.Fprint(w, `{"symbol":"OICHGUSDT","openInterest":"1100.000","time":1700003600000}`)
+		case "/futures/data/openInterestHist":
+			q := r.URL.Query()
+			if q.Get("period") != "5m" || q.Get("limit") != "13" {
+				t.Errorf("unexpected query %s", r.URL.RawQuery)
+			}
+			// 乱序返回，按时间排序后首 1000、尾 1100
+			fmt.Fprint(w, `[
+				{"symbol":"OICHGUSDT","sumOpenInterest":"1100.00","sumOpenInterestValue":"110000","timestamp":1700003600000},
+				{"symbol":"OICHGUSDT","sumOpenInterest":"1000.00","sumOpenInterestValue":"100000","timestamp":1700000000000},
+				{"symbol":"OICHGUSDT","sumOpenInterest":"1060.00","sumOpenInterestValue":"106000","timestamp":1700001800000}
+			]`)
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	})
+
+	history, err := getOpenInterestHistory("OICHGUSDT", "5m", 13)
+	if err != nil {
+		t.Fatalf("getOpenInterestHistory: %v", err)
+	}
+	if want := []float64{1000, 1060, 1100}; fmt.Sprint(history) != fmt.Sprint(want) {
+		t.Errorf("history = %v, want %v", history, want)
+	}
+
+	oi, err := getOpenInterestData("OICHGUSDT")
+	if err != nil {
+		t.Fatalf("getOpenInterestData: %v", err)
+	}
+	if oi.Latest != 1100 {
+		t.Errorf("Latest = %v, want 1100", oi.Latest)
+	}
+	if math.Abs(oi.Average-1053.333333) > 1e-6 {
+		t.Errorf("Average = %v, want mean of history", oi.Average)
+	}
+	if math.Abs(oi.OIChangePct-10) > 1e-9 {
+		t.Errorf("OIChangePct = %v, want 10", oi.OIChangePct)
+	}
+
+	out := Format(&Data{Symbol: "OICHGUSDT", OpenInterest: oi}, false)
+	if !strings.Contains(out, "OI change 1h: +10.00%") {
+		t.Errorf("Format output missing OI change line:\n%s", out)
+	}
+}
+
+func TestOIChangePct(t *testing.T) {
+	tests := []struct {
+		name    string
+		history []float64
+		want    float64
+	}{
+		{"上升", []float64{200, 210, 250}, 25},
+		{"下降", []float64{200, 190, 150}, -25},
+		{"单点", []float64{200}, 0},
+		{"起点为 0", []float64{0, 100}, 0},
+		{"空数据", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := oiChangePct(tt.history); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("oiChangePct(%v) = %v, want %v", tt.history, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package market
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// responseCache 按 URL 缓存 REST 响应体的 LRU 缓存，每条记录有独立的过期时间
+// 用于合并短时间内对同一接口的重复请求（如多个 trader 同时拉取同一币种的持仓量）
+type responseCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // 最近使用的在前
+	entries  map[string]*list.Element
+}
+
+type responseCacheEntry struct {
+	key       string
+	body      []byte
+	expiresAt time.Time
+}
+
+func newResponseCache(capacity int) *responseCache {
+	return &responseCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// get 返回未过期的缓存响应体，过期记录会被顺带移除
+func (c *responseCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*responseCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.body, true
+}
+
+// set 写入响应体，超出容量时淘汰最久未使用的记录
+func (c *responseCache) set(key string, body []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*responseCacheEntry)
+		entry.body = body
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&responseCacheEntry{key: key, body: body, expiresAt: expiresAt})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*responseCacheEntry).key)
+	}
+}
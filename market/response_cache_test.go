@@ -0,0 +1,70 @@
+package market
+
+import (
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestGetOpenInterestData_ResponseCache TTL 内重复请求命中响应缓存，且 gzip 响应能正确解压
+func TestGetOpenInterestData_ResponseCache(t *testing.T) {
+	var oiRequests atomic.Int32
+	mockFuturesAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fapi/v1/openInterest":
+			oiRequests.Add(1)
+			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+				t.Errorf("Accept-Encoding = %q, want gzip", r.Header.Get("Accept-Encoding"))
+			}
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			fmt.Fprint(gz, `{"symbol":"RESPCACHEUSDT","openInterest":"2500.000","time":1700000000000}`)
+			gz.Close()
+		case "/futures/data/openInterestHist":
+			fmt.Fprint(w, `[]`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	for i := 0; i < 2; i++ {
+		oi, err := getOpenInterestData("RESPCACHEUSDT")
+		if err != nil {
+			t.Fatalf("getOpenInterestData #%d: %v", i+1, err)
+		}
+		if oi.Latest != 2500 {
+			t.Errorf("call #%d: Latest = %v, want 2500", i+1, oi.Latest)
+		}
+	}
+	if got := oiRequests.Load(); got != 1 {
+		t.Errorf("openInterest requests = %d, want 1 (second call within TTL should be cached)", got)
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	c := newResponseCache(2)
+	c.set("a", []byte("A"), time.Minute)
+	c.set("b", []byte("B"), time.Minute)
+
+	// 访问 a 后写入 c，最久未使用的 b 被淘汰
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("a should be cached")
+	}
+	c.set("c", []byte("C"), time.Minute)
+	if _, ok := c.get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	if body, ok := c.get("a"); !ok || string(body) != "A" {
+		t.Errorf("get(a) = %q, %v", body, ok)
+	}
+
+	// 过期记录不返回
+	c.set("expired", []byte("X"), -time.Second)
+	if _, ok := c.get("expired"); ok {
+		t.Error("expired entry should not be returned")
+	}
+}
@@ -4,31 +4,48 @@ import "time"
 
 // Data 市场数据结构
 type Data struct {
-	Symbol            string
-	CurrentPrice      float64
-	PriceChange1h     float64 // 1小时价格变化百分比
-	PriceChange4h     float64 // 4小时价格变化百分比
-	PriceChange24h    float64 // 24小时价格变化百分比
-	CurrentEMA20      float64
-	CurrentMACD       float64
-	CurrentRSI7       float64
-	ChanLunMACD_DIF   float64 // 快线 - 慢线
-	ChanLunMACD_DEA   float64 // 信号线
-	ChanLunMACD_Hist  float64 // 柱状图
-	ChanLunSignal     string  // "Golden Cross (Bullish)", "Death Cross (Bearish)", "Neutral"
-	OpenInterest      *OIData
-	FundingRate       float64
-	IntradaySeries    *IntradayData
-	MidTermSeries30m  *MidTermData30m
-	MidTermSeries1h   *MidTermData1h
-	LongerTermContext *LongerTermData
-	DailyContext      *DailyData
+	Symbol             string
+	CurrentPrice       float64
+	PriceChange1h      float64 // 1小时价格变化百分比
+	PriceChange4h      float64 // 4小时价格变化百分比
+	PriceChange24h     float64 // 24小时价格变化百分比
+	CurrentEMA20       float64
+	CurrentMACD        float64
+	CurrentRSI7        float64
+	ChanLunMACD_DIF    float64 // 快线 - 慢线
+	ChanLunMACD_DEA    float64 // 信号线
+	ChanLunMACD_Hist   float64 // 柱状图
+	ChanLunSignal      string  // "Golden Cross (Bullish)", "Death Cross (Bearish)", "Neutral"
+	SupertrendValue    float64 // Supertrend (10, 3) 当前轨道值
+	SupertrendSignal   string  // "Uptrend ...", "Downtrend ...", "Neutral ..."
+	DonchianUpper      float64 // 唐奇安通道上轨（20期最高价）
+	DonchianLower      float64 // 唐奇安通道下轨（20期最低价）
+	SAR                float64 // 抛物线 SAR (0.02, 0.2) 当前值
+	SARTrend           string  // "Long ...", "Short ...", "Neutral ..."
+	IchimokuTenkan     float64 // 一目均衡表转换线（9期中点）
+	IchimokuKijun      float64 // 一目均衡表基准线（26期中点）
+	IchimokuSenkouA    float64 // 当前K线处的先行带A（云层边界之一）
+	IchimokuSenkouB    float64 // 当前K线处的先行带B（云层边界之一）
+	IchimokuChikou     float64 // 迟行线（当前收盘价，绘制在26期之前）
+	IchimokuBias       string  // "Above cloud ...", "In cloud ...", "Below cloud ...", "Neutral ..."
+	MarketRegime       string  // "trending" / "ranging" / "choppy" / "unknown"（ER10 + 布林带宽度）
+	AnchoredVWAP       float64 // 从 SetVWAPAnchor 配置的锚点开始累计的 VWAP，未配置锚点时为 0
+	OpenInterest       *OIData
+	FundingRate        float64
+	FundingRateHistory []float64 // 最近几次结算的资金费率（从旧到新）
+	PredictedFunding   float64   // 由标记价/指数价溢价估算的下期资金费率
+	IntradaySeries     *IntradayData
+	MidTermSeries30m   *MidTermData30m
+	MidTermSeries1h    *MidTermData1h
+	LongerTermContext  *LongerTermData
+	DailyContext       *DailyData
 }
 
 // OIData Open Interest数据
 type OIData struct {
-	Latest  float64
-	Average float64
+	Latest      float64
+	Average     float64
+	OIChangePct float64 // 最近窗口（默认 1 小时）内持仓量变化百分比
 }
 
 // DailyData 日线数据(7天)
@@ -47,6 +64,9 @@ type DailyData struct {
 	ER10Values          []float64 // Efficiency Ratio (10期) 序列
 	BollingerPercentBs  []float64 // 布林带 %B 序列
 	BollingerBandwidths []float64 // 布林带宽度序列
+	KeltnerPercent      []float64 // Keltner 通道 %K (20,10,1.5) 序列
+	KeltnerWidth        []float64 // Keltner 通道宽度序列
+	SqueezeOn           bool      // 布林带收缩进 Keltner 通道内（挤压）
 	Recent7High         float64   // 近7日最高
 	Recent7Low          float64   // 近7日最低
 	TrendBias           string    // "bullish" / "bearish" / "neutral"
@@ -64,9 +84,19 @@ type SeriesFields struct {
 	ER10Values          []float64 // Efficiency Ratio (10期) 序列
 	BollingerPercentBs  []float64 // 布林带 %B 序列
 	BollingerBandwidths []float64 // 布林带宽度序列
+	KeltnerPercent      []float64 // Keltner 通道 %K (20,10,1.5) 序列
+	KeltnerWidth        []float64 // Keltner 通道宽度序列
+	SqueezeOn           bool      // 布林带收缩进 Keltner 通道内（挤压）
 	MA5Values           []float64 // MA5 序列
 	MA34Values          []float64 // MA34 序列
 	MA170Values         []float64 // MA170 序列
+	StochKValues        []float64 // 随机指标 %K (14,3) 序列
+	StochDValues        []float64 // 随机指标 %D (14,3) 序列
+	ADX14               float64   // ADX (14期) 趋势强度，数据不足时为 0
+	OBVValues           []float64 // 能量潮 (OBV) 序列
+	CCI20               float64   // CCI (20期) 顺势指标，数据不足时为 0
+	MFI14               float64   // MFI (14期) 资金流量指标，数据不足时为 0
+	WilliamsR14         float64   // Williams %R (14期)，范围 [-100, 0]，数据不足时为 0
 }
 
 // IntradayData 日内数据(5分钟间隔)
@@ -77,6 +77,12 @@ type AutoTraderConfig struct {
 
 	// 系统提示词模板
 	SystemPromptTemplate string // 系统提示词模板名称（如 "default", "aggressive"）
+
+	// 更新自定义prompt时是否先平掉所有持仓（避免旧策略持仓影响新策略统计）
+	AutoFlattenOnPromptChange bool
+
+	// 开仓前价格合理性检查：当前价偏离上一根5分钟K线收盘价超过该百分比则拒单（平仓不受限），0 表示关闭
+	PriceBandPct float64
 }
 
 // AutoTrader 自动交易器
@@ -102,6 +108,7 @@ type AutoTrader struct {
 	startTime             time.Time                        // 系统启动时间
 	callCount             int                              // AI调用次数
 	statusMutex           sync.RWMutex                     // 保护 isRunning, startTime, callCount 的并发访问
+	cycleMutex            sync.Mutex                       // 串行化交易周期与 prompt 更新（保护 customPrompt, overrideBasePrompt）
 	positionFirstSeenTime map[string]int64                 // 持仓首次出现时间 (symbol_side -> timestamp毫秒)
 	lastPositions         map[string]decision.PositionInfo // 上一次周期的持仓快照 (用于检测被动平仓)
 	positionStopLoss      map[string]float64               // 持仓止损价格 (symbol_side -> stop_loss_price)
@@ -196,6 +203,26 @@ func NewAutoTrader(config AutoTraderConfig, database interface{}, userID string)
 		}
 	}
 
+	// 从数据库读取切换 prompt 时是否自动平仓
+	if database != nil && !config.AutoFlattenOnPromptChange {
+		if db, ok := database.(*nofxconfig.Database); ok && db != nil {
+			if flattenStr, err := db.GetSystemConfig("auto_flatten_on_prompt_change"); err == nil && flattenStr != "" {
+				config.AutoFlattenOnPromptChange = flattenStr == "true"
+			}
+		}
+	}
+
+	// 从数据库读取下单价格带
+	if database != nil && config.PriceBandPct <= 0 {
+		if db, ok := database.(*nofxconfig.Database); ok && db != nil {
+			if bandStr, err := db.GetSystemConfig("price_band_pct"); err == nil && bandStr != "" {
+				if band, err := strconv.ParseFloat(bandStr, 64); err == nil && band > 0 {
+					config.PriceBandPct = band
+				}
+			}
+		}
+	}
+
 	// 初始化币种池API
 	if config.CoinPoolAPIURL != "" {
 		pool.SetCoinPoolAPI(config.CoinPoolAPIURL)
@@ -384,6 +411,10 @@ func (at *AutoTrader) IsRunning() bool {
 
 // runCycle 运行一个交易周期（使用AI全权决策）
 func (at *AutoTrader) runCycle() error {
+	// 周期执行期间不允许切换 prompt，切换时的平仓也不会与本周期的下单交错
+	at.cycleMutex.Lock()
+	defer at.cycleMutex.Unlock()
+
 	at.statusMutex.Lock()
 	at.callCount++
 	at.statusMutex.Unlock()
@@ -597,7 +628,8 @@ func (at *AutoTrader) runCycle() error {
 	log.Print(strings.Repeat("-", 70))
 
 	// 8. 对决策排序：确保先平仓后开仓（防止仓位叠加超限）
-	sortedDecisions := sortDecisionsByPriority(decision.Decisions)
+	// close_all 先展开为每个持仓一条平仓决策，每次平仓单独记录
+	sortedDecisions := sortDecisionsByPriority(expandCloseAll(decision.Decisions, ctx.Positions))
 
 	log.Println("🔄 执行顺序（已优化）: 先平仓→后开仓")
 	for i, d := range sortedDecisions {
@@ -869,11 +901,15 @@ func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, act
 	if err != nil {
 		return err
 	}
+	if err := at.checkPriceBand(marketData); err != nil {
+		return err
+	}
 
 	// 计算数量
 	quantity := decision.PositionSizeUSD / marketData.CurrentPrice
 	actionRecord.Quantity = quantity
 	actionRecord.Price = marketData.CurrentPrice
+	actionRecord.Regime = market.ClassifyVolatilityRegime(marketData)
 
 	// ⚠️ 保证金验证：防止保证金不足错误（code=-2019）
 	requiredMargin := decision.PositionSizeUSD / float64(decision.Leverage)
@@ -964,11 +1000,15 @@ func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, ac
 	if err != nil {
 		return err
 	}
+	if err := at.checkPriceBand(marketData); err != nil {
+		return err
+	}
 
 	// 计算数量
 	quantity := decision.PositionSizeUSD / marketData.CurrentPrice
 	actionRecord.Quantity = quantity
 	actionRecord.Price = marketData.CurrentPrice
+	actionRecord.Regime = market.ClassifyVolatilityRegime(marketData)
 
 	// ⚠️ 保证金验证：防止保证金不足错误（code=-2019）
 	requiredMargin := decision.PositionSizeUSD / float64(decision.Leverage)
@@ -1552,11 +1592,15 @@ func (at *AutoTrader) GetConfig() AutoTraderConfig {
 
 // SetCustomPrompt 设置自定义交易策略prompt
 func (at *AutoTrader) SetCustomPrompt(prompt string) {
+	at.cycleMutex.Lock()
+	defer at.cycleMutex.Unlock()
 	at.customPrompt = prompt
 }
 
 // SetOverrideBasePrompt 设置是否覆盖基础prompt
 func (at *AutoTrader) SetOverrideBasePrompt(override bool) {
+	at.cycleMutex.Lock()
+	defer at.cycleMutex.Unlock()
 	at.overrideBasePrompt = override
 }
 
@@ -1565,6 +1609,107 @@ func (at *AutoTrader) SetSystemPromptTemplate(templateName string) {
 	at.systemPromptTemplate = templateName
 }
 
+// UpdatePrompt 更新自定义prompt及覆盖设置
+// 若开启 AutoFlattenOnPromptChange 且 prompt 有变化，会在新 prompt 生效前先平掉所有持仓；
+// 平仓失败不会阻止 prompt 更新，错误会返回给调用方。
+// 与 runCycle 互斥：等待进行中的周期结束后再平仓和切换，下一个周期从空仓开始并使用新 prompt
+func (at *AutoTrader) UpdatePrompt(customPrompt string, overrideBase bool) error {
+	at.cycleMutex.Lock()
+	defer at.cycleMutex.Unlock()
+
+	changed := customPrompt != at.customPrompt || overrideBase != at.overrideBasePrompt
+
+	var flattenErr error
+	if changed && at.config.AutoFlattenOnPromptChange {
+		log.Printf("🧹 [%s] prompt 已变更，平掉所有持仓后再切换", at.name)
+		flattenErr = at.flattenAllPositions()
+	}
+
+	at.customPrompt = customPrompt
+	at.overrideBasePrompt = overrideBase
+	return flattenErr
+}
+
+// flattenAllPositions 平掉所有持仓（平仓单只减仓，不会反向开仓）
+// 每笔平仓作为 close_long/close_short 动作写入一条决策记录，保证交易统计与持仓缓存能看到这些平仓
+func (at *AutoTrader) flattenAllPositions() error {
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return fmt.Errorf("获取持仓失败: %w", err)
+	}
+	if len(positions) == 0 {
+		return nil
+	}
+
+	record := &logger.DecisionRecord{
+		Exchange:     at.config.Exchange,
+		ExecutionLog: []string{"🧹 prompt 已变更，平掉所有持仓"},
+		Success:      true,
+	}
+
+	var failed []string
+	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		quantity, _ := pos["positionAmt"].(float64)
+		markPrice, _ := pos["markPrice"].(float64)
+		leverage, _ := pos["leverage"].(float64)
+
+		// 与正常平仓记录一致：数量取绝对值，价格先用标记价，成交后按真实成交价矫正
+		actionRecord := logger.DecisionAction{
+			Action:    "close_" + side,
+			Symbol:    symbol,
+			Quantity:  math.Abs(quantity),
+			Leverage:  int(leverage),
+			Price:     markPrice,
+			Timestamp: time.Now(),
+		}
+		closeTime := time.Now().UnixMilli()
+
+		var (
+			order    map[string]interface{}
+			closeErr error
+		)
+		switch side {
+		case "long":
+			order, closeErr = at.trader.CloseLong(symbol, 0) // 0 = 全部平仓
+		case "short":
+			order, closeErr = at.trader.CloseShort(symbol, 0) // 0 = 全部平仓
+		default:
+			closeErr = fmt.Errorf("未知的持仓方向: %s", side)
+		}
+		if closeErr != nil {
+			actionRecord.Error = closeErr.Error()
+			failed = append(failed, fmt.Sprintf("%s %s: %v", symbol, side, closeErr))
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("❌ %s %s 失败: %v", symbol, actionRecord.Action, closeErr))
+		} else {
+			actionRecord.Success = true
+			if orderID, ok := order["orderId"].(int64); ok {
+				actionRecord.OrderID = orderID
+			}
+			closeDecision := &decision.Decision{Symbol: symbol, Action: actionRecord.Action}
+			if err := at.verifyAndUpdateCloseFillPrice(closeDecision, &actionRecord, closeTime); err != nil {
+				log.Printf("  ⚠️ 平仓成交价验证失败: %v", err)
+			}
+			at.ClearPeakPnLCache(symbol, side)
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("✓ %s %s 成功", symbol, actionRecord.Action))
+			log.Printf("  ✓ 已平仓 %s %s", symbol, side)
+		}
+		record.Decisions = append(record.Decisions, actionRecord)
+	}
+
+	var flattenErr error
+	if len(failed) > 0 {
+		flattenErr = fmt.Errorf("部分持仓平仓失败: %s", strings.Join(failed, "; "))
+		record.Success = false
+		record.ErrorMessage = flattenErr.Error()
+	}
+	if err := at.decisionLogger.LogDecision(record); err != nil {
+		log.Printf("⚠ 保存平仓决策记录失败: %v", err)
+	}
+	return flattenErr
+}
+
 // GetSystemPromptTemplate 获取当前系统提示词模板名称
 func (at *AutoTrader) GetSystemPromptTemplate() string {
 	return at.systemPromptTemplate
@@ -1797,6 +1942,65 @@ func sortDecisionsByPriority(decisions []decision.Decision) []decision.Decision
 	return sorted
 }
 
+// checkPriceBand 开仓前价格合理性检查：当前价偏离参考价（上一根5分钟K线收盘价）超过 PriceBandPct 则拒单，0 表示关闭
+// 平仓只减仓，不受价格带限制，避免快速行情中无法退出
+func (at *AutoTrader) checkPriceBand(marketData *market.Data) error {
+	return checkPriceBand(marketData, at.config.PriceBandPct)
+}
+
+func checkPriceBand(marketData *market.Data, bandPct float64) error {
+	if bandPct <= 0 || marketData == nil || marketData.IntradaySeries == nil {
+		return nil
+	}
+	closes := marketData.IntradaySeries.MidPrices
+	if len(closes) < 2 {
+		return nil
+	}
+	reference := closes[len(closes)-2]
+	if reference <= 0 {
+		return nil
+	}
+	deviationPct := math.Abs(marketData.CurrentPrice-reference) / reference * 100
+	if deviationPct > bandPct {
+		return fmt.Errorf("价格 %.4f 偏离参考价 %.4f 达 %.2f%%（允许 %.2f%%），拒绝下单", marketData.CurrentPrice, reference, deviationPct, bandPct)
+	}
+	return nil
+}
+
+// expandCloseAll 将 close_all 展开为当前每个持仓的 close_long/close_short 决策
+// 已有单独平仓决策的持仓不重复展开
+func expandCloseAll(decisions []decision.Decision, positions []decision.PositionInfo) []decision.Decision {
+	hasCloseAll := false
+	closing := make(map[string]bool)
+	for _, d := range decisions {
+		switch d.Action {
+		case "close_all":
+			hasCloseAll = true
+		case "close_long", "close_short":
+			closing[d.Symbol+"_"+d.Action] = true
+		}
+	}
+	if !hasCloseAll {
+		return decisions
+	}
+
+	expanded := make([]decision.Decision, 0, len(decisions)+len(positions))
+	for _, d := range decisions {
+		if d.Action != "close_all" {
+			expanded = append(expanded, d)
+		}
+	}
+	for _, pos := range positions {
+		action := "close_" + pos.Side
+		if closing[pos.Symbol+"_"+action] {
+			continue
+		}
+		closing[pos.Symbol+"_"+action] = true
+		expanded = append(expanded, decision.Decision{Symbol: pos.Symbol, Action: action, Reasoning: "close_all"})
+	}
+	return expanded
+}
+
 // getCandidateCoins 获取交易员的候选币种列表
 func (at *AutoTrader) getCandidateCoins() ([]decision.CandidateCoin, error) {
 	if len(at.tradingCoins) == 0 {
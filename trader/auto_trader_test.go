@@ -175,6 +175,89 @@ func (s *AutoTraderTestSuite) TestSortDecisionsByPriority() {
 	}
 }
 
+func (s *AutoTraderTestSuite) TestCheckPriceBand() {
+	withCloses := func(current float64, closes ...float64) *market.Data {
+		return &market.Data{
+			CurrentPrice:   current,
+			IntradaySeries: &market.IntradayData{SeriesFields: market.SeriesFields{MidPrices: closes}},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		data       *market.Data
+		bandPct    float64
+		wantReject bool
+	}{
+		{"偏离2%通过", withCloses(102, 100, 101), 10, false},
+		{"偏离50%拒单", withCloses(150, 100, 150), 10, true},
+		{"未配置不检查", withCloses(150, 100, 150), 0, false},
+		{"K线不足不检查", withCloses(150, 150), 10, false},
+		{"无序列不检查", &market.Data{CurrentPrice: 150}, 10, false},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			err := checkPriceBand(tt.data, tt.bandPct)
+			if tt.wantReject {
+				s.Error(err)
+			} else {
+				s.NoError(err)
+			}
+		})
+	}
+
+	s.Run("超出价格带时不下单", func() {
+		s.autoTrader.config.PriceBandPct = 10
+		s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+			return withCloses(150, 100, 150), nil
+		})
+
+		dec := &decision.Decision{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 1000, Leverage: 5}
+		err := s.autoTrader.executeOpenLongWithRecord(dec, &logger.DecisionAction{})
+		s.Error(err)
+		s.Contains(err.Error(), "偏离参考价")
+	})
+
+	s.Run("超出价格带时平仓照常成交", func() {
+		s.autoTrader.config.PriceBandPct = 10
+		s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+			return withCloses(150, 100, 150), nil
+		})
+
+		actionRecord := &logger.DecisionAction{}
+		err := s.autoTrader.executeCloseLongWithRecord(&decision.Decision{Action: "close_long", Symbol: "BTCUSDT"}, actionRecord)
+		s.NoError(err)
+		s.Equal(int64(123458), actionRecord.OrderID)
+	})
+}
+
+func (s *AutoTraderTestSuite) TestExpandCloseAll() {
+	positions := []decision.PositionInfo{
+		{Symbol: "BTCUSDT", Side: "long"},
+		{Symbol: "ETHUSDT", Side: "short"},
+	}
+
+	s.Run("展开为每个持仓一条平仓决策", func() {
+		result := expandCloseAll([]decision.Decision{
+			{Action: "close_all"},
+			{Action: "close_short", Symbol: "ETHUSDT"},
+			{Action: "open_long", Symbol: "SOLUSDT"},
+		}, positions)
+
+		actions := make([]string, 0, len(result))
+		for _, d := range result {
+			actions = append(actions, d.Symbol+" "+d.Action)
+		}
+		s.Equal([]string{"ETHUSDT close_short", "SOLUSDT open_long", "BTCUSDT close_long"}, actions, "已单独平仓的持仓不重复展开")
+	})
+
+	s.Run("没有close_all时原样返回", func() {
+		input := []decision.Decision{{Action: "hold", Symbol: "BTCUSDT"}}
+		s.Equal(input, expandCloseAll(input, positions))
+	})
+}
+
 func (s *AutoTraderTestSuite) TestNormalizeSymbol() {
 	tests := []struct {
 		name     string
@@ -219,6 +302,158 @@ func (s *AutoTraderTestSuite) TestGettersAndSetters() {
 	})
 }
 
+// dryRunTrader 模拟成交的 Trader：平仓时从持仓列表中移除对应仓位
+type dryRunTrader struct {
+	*MockTrader
+	closed []string
+	fills  []map[string]interface{}
+}
+
+func (d *dryRunTrader) closePosition(symbol, side string) (map[string]interface{}, error) {
+	remaining := make([]map[string]interface{}, 0, len(d.positions))
+	for _, pos := range d.positions {
+		if pos["symbol"] == symbol && pos["side"] == side {
+			continue
+		}
+		remaining = append(remaining, pos)
+	}
+	d.positions = remaining
+	d.closed = append(d.closed, symbol+"_"+side)
+	return map[string]interface{}{"orderId": int64(1), "symbol": symbol}, nil
+}
+
+func (d *dryRunTrader) CloseLong(symbol string, quantity float64) (map[string]interface{}, error) {
+	return d.closePosition(symbol, "long")
+}
+
+func (d *dryRunTrader) CloseShort(symbol string, quantity float64) (map[string]interface{}, error) {
+	return d.closePosition(symbol, "short")
+}
+
+func (d *dryRunTrader) GetRecentFills(symbol string, startTime int64, endTime int64) ([]map[string]interface{}, error) {
+	var fills []map[string]interface{}
+	for _, fill := range d.fills {
+		if fill["symbol"] == symbol {
+			fills = append(fills, fill)
+		}
+	}
+	return fills, nil
+}
+
+// TestUpdatePromptAutoFlatten 测试切换 prompt 时自动平仓
+func (s *AutoTraderTestSuite) TestUpdatePromptAutoFlatten() {
+	newDryRun := func() *dryRunTrader {
+		return &dryRunTrader{MockTrader: &MockTrader{
+			positions: []map[string]interface{}{
+				{"symbol": "BTCUSDT", "side": "long", "entryPrice": 50000.0, "markPrice": 51000.0, "positionAmt": 0.1, "unRealizedProfit": 100.0, "liquidationPrice": 45000.0, "leverage": 10.0},
+				{"symbol": "ETHUSDT", "side": "short", "entryPrice": 3000.0, "markPrice": 2950.0, "positionAmt": -1.0, "unRealizedProfit": 50.0, "liquidationPrice": 3300.0, "leverage": 5.0},
+			},
+		}, fills: []map[string]interface{}{
+			{"symbol": "BTCUSDT", "side": "Sell", "price": 50900.0, "quantity": 0.1},
+			{"symbol": "ETHUSDT", "side": "Buy", "price": 2955.0, "quantity": 1.0},
+		}}
+	}
+
+	s.Run("开启时切换prompt会平掉所有持仓", func() {
+		dry := newDryRun()
+		s.autoTrader.trader = dry
+		s.autoTrader.config.AutoFlattenOnPromptChange = true
+		s.autoTrader.customPrompt = "old strategy"
+		flattenLogger := logger.NewDecisionLogger(s.T().TempDir())
+		s.autoTrader.decisionLogger = flattenLogger
+
+		s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+			return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+		})
+
+		err := s.autoTrader.UpdatePrompt("new strategy", true)
+
+		s.NoError(err)
+		s.ElementsMatch([]string{"BTCUSDT_long", "ETHUSDT_short"}, dry.closed)
+
+		// 平仓写入决策记录，每个持仓一条平仓动作
+		records, err := flattenLogger.GetLatestRecords(1)
+		s.NoError(err)
+		if s.Len(records, 1) {
+			var actions []string
+			for _, action := range records[0].Decisions {
+				s.True(action.Success)
+				actions = append(actions, action.Symbol+" "+action.Action)
+				// 与正常平仓记录一致：成交价 + 数量绝对值
+				switch action.Symbol {
+				case "BTCUSDT":
+					s.Equal(50900.0, action.Price)
+					s.Equal(0.1, action.Quantity)
+				case "ETHUSDT":
+					s.Equal(2955.0, action.Price)
+					s.Equal(1.0, action.Quantity)
+				}
+			}
+			s.ElementsMatch([]string{"BTCUSDT close_long", "ETHUSDT close_short"}, actions)
+		}
+		s.Equal("new strategy", s.autoTrader.customPrompt)
+		s.True(s.autoTrader.overrideBasePrompt)
+
+		// 下一次决策从空仓开始
+		ctx, err := s.autoTrader.buildTradingContext()
+		s.NoError(err)
+		s.Empty(ctx.Positions)
+	})
+
+	s.Run("prompt未变化时不平仓", func() {
+		dry := newDryRun()
+		s.autoTrader.trader = dry
+		s.autoTrader.config.AutoFlattenOnPromptChange = true
+		s.autoTrader.customPrompt = "same"
+		s.autoTrader.overrideBasePrompt = false
+
+		s.NoError(s.autoTrader.UpdatePrompt("same", false))
+		s.Empty(dry.closed)
+		s.Len(dry.positions, 2)
+	})
+
+	s.Run("关闭时只更新prompt", func() {
+		dry := newDryRun()
+		s.autoTrader.trader = dry
+		s.autoTrader.config.AutoFlattenOnPromptChange = false
+		s.autoTrader.customPrompt = "old strategy"
+
+		s.NoError(s.autoTrader.UpdatePrompt("new strategy", false))
+		s.Empty(dry.closed)
+		s.Len(dry.positions, 2)
+		s.Equal("new strategy", s.autoTrader.customPrompt)
+	})
+
+	s.Run("周期进行中切换prompt会等待周期结束", func() {
+		dry := newDryRun()
+		s.autoTrader.trader = dry
+		s.autoTrader.config.AutoFlattenOnPromptChange = true
+		s.autoTrader.customPrompt = "old strategy"
+		s.autoTrader.decisionLogger = logger.NewDecisionLogger(s.T().TempDir())
+
+		// 模拟 runCycle 持有周期锁
+		s.autoTrader.cycleMutex.Lock()
+		done := make(chan error, 1)
+		go func() {
+			done <- s.autoTrader.UpdatePrompt("new strategy", false)
+		}()
+
+		select {
+		case <-done:
+			s.autoTrader.cycleMutex.Unlock()
+			s.Fail("UpdatePrompt 不应在周期进行中执行")
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+		s.Empty(dry.closed)
+
+		s.autoTrader.cycleMutex.Unlock()
+		s.NoError(<-done)
+		s.Len(dry.closed, 2)
+		s.Equal("new strategy", s.autoTrader.customPrompt)
+	})
+}
+
 // ============================================================
 // 层次 3: PeakPnL 缓存测试
 // ============================================================
@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"log"
+	"math"
 	"nofx/hook"
 	"strconv"
 	"strings"
@@ -64,6 +65,27 @@ type FuturesTrader struct {
 
 	// 缓存有效期（15秒）
 	cacheDuration time.Duration
+
+	// 联动止损止盈单（OCO），一方成交后取消另一方
+	linkedOrders      []linkedOrderPair
+	linkedOrdersMutex sync.Mutex
+
+	// 请求权重限流器（包装在 client.HTTPClient 的 Transport 中）
+	rateLimiter *weightRateLimiter
+
+	// 瞬时错误（-1001、-1021、5xx）的最大重试次数
+	maxRetries int
+
+	// 持仓模式缓存（nil 表示尚未查询）：true = 双向持仓（Hedge Mode），false = 单向持仓（One-way Mode）
+	dualSidePosition  *bool
+	positionModeMutex sync.Mutex
+}
+
+// linkedOrderPair 一组联动的止损/止盈订单
+type linkedOrderPair struct {
+	symbol       string
+	stopLossID   int64
+	takeProfitID int64
 }
 
 // NewFuturesTrader 创建合约交易器
@@ -80,7 +102,9 @@ func NewFuturesTrader(apiKey, secretKey string, userId string) *FuturesTrader {
 	trader := &FuturesTrader{
 		client:        client,
 		cacheDuration: 15 * time.Second, // 15秒缓存
+		maxRetries:    defaultBinanceMaxRetries,
 	}
+	trader.installRateLimiter(defaultBinanceMaxWeightPerMin)
 
 	// 设置双向持仓模式（Hedge Mode）
 	// 这是必需的，因为代码中使用了 PositionSide (LONG/SHORT)
@@ -113,6 +137,44 @@ func (t *FuturesTrader) setDualSidePosition() error {
 	return nil
 }
 
+// GetPositionMode 查询账户持仓模式（true = 双向持仓），结果缓存，后续下单据此决定是否发送 positionSide
+func (t *FuturesTrader) GetPositionMode() (dualSide bool, err error) {
+	t.positionModeMutex.Lock()
+	defer t.positionModeMutex.Unlock()
+
+	if t.dualSidePosition != nil {
+		return *t.dualSidePosition, nil
+	}
+
+	mode, err := t.client.NewGetPositionModeService().Do(context.Background())
+	if err != nil {
+		return false, fmt.Errorf("获取持仓模式失败: %w", err)
+	}
+	dualSide = mode.DualSidePosition
+	t.dualSidePosition = &dualSide
+	return dualSide, nil
+}
+
+// applyPositionMode 按账户持仓模式设置订单的持仓方向
+// 双向持仓：发送 positionSide（LONG/SHORT），平仓方向 + positionSide 即只减仓，币安在该模式下拒绝 reduceOnly；
+// 单向持仓：发送 positionSide 会被拒绝，因此省略，平仓/保护单改用 reduceOnly。
+// 查询持仓模式失败时按双向持仓处理（初始化时已尝试切换为双向持仓）
+func (t *FuturesTrader) applyPositionMode(order *futures.CreateOrderService, positionSide futures.PositionSideType, reduceOnly bool) *futures.CreateOrderService {
+	dualSide, err := t.GetPositionMode()
+	if err != nil {
+		log.Printf("  ⚠ %v，按双向持仓模式下单", err)
+		dualSide = true
+	}
+
+	if dualSide {
+		return order.PositionSide(positionSide)
+	}
+	if reduceOnly {
+		return order.ReduceOnly(true)
+	}
+	return order
+}
+
 // syncBinanceServerTime 同步币安服务器时间，确保请求时间戳合法
 func syncBinanceServerTime(client *futures.Client) {
 	serverTime, err := client.NewServerTimeService().Do(context.Background())
@@ -141,7 +203,9 @@ func (t *FuturesTrader) GetBalance() (map[string]interface{}, error) {
 
 	// 缓存过期或不存在，调用API
 	log.Printf("🔄 缓存过期，正在调用币安API获取账户余额...")
-	account, err := t.client.NewGetAccountService().Do(context.Background())
+	account, err := doWithRetry(t, "获取账户信息", func() (*futures.Account, error) {
+		return t.client.NewGetAccountService().Do(context.Background())
+	})
 	if err != nil {
 		log.Printf("❌ 币安API调用失败: %v", err)
 		return nil, fmt.Errorf("获取账户信息失败: %w", err)
@@ -180,7 +244,9 @@ func (t *FuturesTrader) GetPositions() ([]map[string]interface{}, error) {
 
 	// 缓存过期或不存在，调用API
 	log.Printf("🔄 缓存过期，正在调用币安API获取持仓信息...")
-	positions, err := t.client.NewGetPositionRiskService().Do(context.Background())
+	positions, err := doWithRetry(t, "获取持仓", func() ([]*futures.PositionRisk, error) {
+		return t.client.NewGetPositionRiskService().Do(context.Background())
+	})
 	if err != nil {
 		return nil, fmt.Errorf("获取持仓失败: %w", err)
 	}
@@ -343,20 +409,22 @@ func (t *FuturesTrader) OpenLong(symbol string, quantity float64, leverage int)
 		return nil, fmt.Errorf("开仓数量过小，格式化后为 0 (原始: %.8f → 格式化: %s)。建议增加开仓金额或选择价格更低的币种", quantity, quantityStr)
 	}
 
-	// ✅ 检查最小名义价值（Binance 要求至少 10 USDT）
+	// ✅ 检查最小名义价值（交易规则的 MIN_NOTIONAL）
 	if err := t.CheckMinNotional(symbol, quantityFloat); err != nil {
 		return nil, err
 	}
 
 	// 创建市价买入订单（使用br ID）
-	order, err := t.client.NewCreateOrderService().
+	clientOrderID := getBrOrderID()
+	orderService := t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(futures.SideTypeBuy).
-		PositionSide(futures.PositionSideTypeLong).
 		Type(futures.OrderTypeMarket).
 		Quantity(quantityStr).
-		NewClientOrderID(getBrOrderID()).
-		Do(context.Background())
+		NewClientOrderID(clientOrderID)
+	orderService = t.applyPositionMode(orderService, futures.PositionSideTypeLong, false)
+
+	order, err := placeOrderWithRetry(t, "开多仓", symbol, clientOrderID, orderService)
 
 	if err != nil {
 		return nil, fmt.Errorf("开多仓失败: %w", err)
@@ -398,20 +466,22 @@ func (t *FuturesTrader) OpenShort(symbol string, quantity float64, leverage int)
 		return nil, fmt.Errorf("开仓数量过小，格式化后为 0 (原始: %.8f → 格式化: %s)。建议增加开仓金额或选择价格更低的币种", quantity, quantityStr)
 	}
 
-	// ✅ 检查最小名义价值（Binance 要求至少 10 USDT）
+	// ✅ 检查最小名义价值（交易规则的 MIN_NOTIONAL）
 	if err := t.CheckMinNotional(symbol, quantityFloat); err != nil {
 		return nil, err
 	}
 
 	// 创建市价卖出订单（使用br ID）
-	order, err := t.client.NewCreateOrderService().
+	clientOrderID := getBrOrderID()
+	orderService := t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(futures.SideTypeSell).
-		PositionSide(futures.PositionSideTypeShort).
 		Type(futures.OrderTypeMarket).
 		Quantity(quantityStr).
-		NewClientOrderID(getBrOrderID()).
-		Do(context.Background())
+		NewClientOrderID(clientOrderID)
+	orderService = t.applyPositionMode(orderService, futures.PositionSideTypeShort, false)
+
+	order, err := placeOrderWithRetry(t, "开空仓", symbol, clientOrderID, orderService)
 
 	if err != nil {
 		return nil, fmt.Errorf("开空仓失败: %w", err)
@@ -446,21 +516,24 @@ func (t *FuturesTrader) CloseLong(symbol string, quantity float64) (map[string]i
 		}
 	}
 
-	// 格式化数量
-	quantityStr, err := t.FormatQuantity(symbol, quantity)
+	// 按 stepSize 向下取整，剩余碎仓不足 minQty 时整仓平掉
+	quantityStr, err := t.formatCloseQuantity(symbol, "LONG", quantity)
 	if err != nil {
 		return nil, err
 	}
 
 	// 创建市价卖出订单（平多，使用br ID）
-	order, err := t.client.NewCreateOrderService().
+	// 双向持仓模式下平仓方向 + positionSide 即只减仓（币安在该模式下拒绝 reduceOnly 参数）
+	clientOrderID := getBrOrderID()
+	orderService := t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(futures.SideTypeSell).
-		PositionSide(futures.PositionSideTypeLong).
 		Type(futures.OrderTypeMarket).
 		Quantity(quantityStr).
-		NewClientOrderID(getBrOrderID()).
-		Do(context.Background())
+		NewClientOrderID(clientOrderID)
+	orderService = t.applyPositionMode(orderService, futures.PositionSideTypeLong, true)
+
+	order, err := placeOrderWithRetry(t, "平多仓", symbol, clientOrderID, orderService)
 
 	if err != nil {
 		return nil, fmt.Errorf("平多仓失败: %w", err)
@@ -502,21 +575,24 @@ func (t *FuturesTrader) CloseShort(symbol string, quantity float64) (map[string]
 		}
 	}
 
-	// 格式化数量
-	quantityStr, err := t.FormatQuantity(symbol, quantity)
+	// 按 stepSize 向下取整，剩余碎仓不足 minQty 时整仓平掉
+	quantityStr, err := t.formatCloseQuantity(symbol, "SHORT", quantity)
 	if err != nil {
 		return nil, err
 	}
 
 	// 创建市价买入订单（平空，使用br ID）
-	order, err := t.client.NewCreateOrderService().
+	// 双向持仓模式下平仓方向 + positionSide 即只减仓（币安在该模式下拒绝 reduceOnly 参数）
+	clientOrderID := getBrOrderID()
+	orderService := t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(futures.SideTypeBuy).
-		PositionSide(futures.PositionSideTypeShort).
 		Type(futures.OrderTypeMarket).
 		Quantity(quantityStr).
-		NewClientOrderID(getBrOrderID()).
-		Do(context.Background())
+		NewClientOrderID(clientOrderID)
+	orderService = t.applyPositionMode(orderService, futures.PositionSideTypeShort, true)
+
+	order, err := placeOrderWithRetry(t, "平空仓", symbol, clientOrderID, orderService)
 
 	if err != nil {
 		return nil, fmt.Errorf("平空仓失败: %w", err)
@@ -549,6 +625,7 @@ func (t *FuturesTrader) CancelStopLossOrders(symbol string) error {
 	if err != nil {
 		return fmt.Errorf("获取未完成订单失败: %w", err)
 	}
+	t.unlinkOrders(symbol)
 
 	// 过滤出止损单并取消（取消所有方向的止损单，包括LONG和SHORT）
 	canceledCount := 0
@@ -599,6 +676,7 @@ func (t *FuturesTrader) CancelTakeProfitOrders(symbol string) error {
 	if err != nil {
 		return fmt.Errorf("获取未完成订单失败: %w", err)
 	}
+	t.unlinkOrders(symbol)
 
 	// 过滤出止盈单并取消（取消所有方向的止盈单，包括LONG和SHORT）
 	canceledCount := 0
@@ -648,6 +726,7 @@ func (t *FuturesTrader) CancelAllOrders(symbol string) error {
 	if err != nil {
 		return fmt.Errorf("取消挂单失败: %w", err)
 	}
+	t.unlinkOrders(symbol)
 
 	log.Printf(logMsgCancelledAllOrders, symbol)
 	return nil
@@ -663,6 +742,7 @@ func (t *FuturesTrader) CancelStopOrders(symbol string) error {
 	if err != nil {
 		return fmt.Errorf("获取未完成订单失败: %w", err)
 	}
+	t.unlinkOrders(symbol)
 
 	// 过滤出止盈止损单并取消
 	canceledCount := 0
@@ -727,8 +807,36 @@ func (t *FuturesTrader) CalculatePositionSize(balance, riskPercent, price float6
 	return quantity
 }
 
+// MaxOpenQuantity 计算在给定杠杆下不超过可用保证金的最大开仓数量
+// 交易所返回的 availableBalance 已扣除现有持仓占用的保证金，这里再预留 DefaultMarginBuffer 安全缓冲，
+// 并与回测 BacktestAccount.MaxOpenQuantity 一致扣除开仓的 Taker 手续费
+func (t *FuturesTrader) MaxOpenQuantity(symbol string, price float64, leverage int) (float64, error) {
+	if price <= 0 || leverage <= 0 {
+		return 0, fmt.Errorf("无效的价格或杠杆: price=%.4f, leverage=%d", price, leverage)
+	}
+
+	balance, err := t.GetBalance()
+	if err != nil {
+		return 0, err
+	}
+	available, _ := balance["availableBalance"].(float64)
+	if available <= 0 {
+		return 0, nil
+	}
+
+	usable := available * (1 - DefaultMarginBuffer)
+	unitCost := price/float64(leverage) + price*DefaultTakerFeeRate
+	return usable / unitCost, nil
+}
+
 // SetStopLoss 设置止损单
 func (t *FuturesTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
+	_, err := t.placeStopLoss(symbol, positionSide, quantity, stopPrice)
+	return err
+}
+
+// placeStopLoss 下止损单并返回订单ID
+func (t *FuturesTrader) placeStopLoss(symbol string, positionSide string, quantity, stopPrice float64) (int64, error) {
 	var side futures.SideType
 	var posSide futures.PositionSideType
 
@@ -743,7 +851,7 @@ func (t *FuturesTrader) SetStopLoss(symbol string, positionSide string, quantity
 	// 格式化数量
 	quantityStr, err := t.FormatQuantity(symbol, quantity)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// 计算 Stop Limit Price
@@ -752,35 +860,44 @@ func (t *FuturesTrader) SetStopLoss(symbol string, positionSide string, quantity
 	// 格式化价格到正确精度（符合 tickSize 要求）
 	limitPriceStr, err := t.FormatPrice(symbol, limitPrice)
 	if err != nil {
-		return fmt.Errorf("格式化限价失败: %w", err)
+		return 0, fmt.Errorf("格式化限价失败: %w", err)
 	}
 	stopPriceStr, err := t.FormatPrice(symbol, stopPrice)
 	if err != nil {
-		return fmt.Errorf("格式化止损价失败: %w", err)
+		return 0, fmt.Errorf("格式化止损价失败: %w", err)
 	}
 
-	_, err = t.client.NewCreateOrderService().
+	clientOrderID := getBrOrderID()
+	orderService := t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(side).
-		PositionSide(posSide).
 		Type(futures.OrderTypeStop).
 		TimeInForce(futures.TimeInForceTypeGTC). // STOP/TAKE_PROFIT 必须提供 timeInForce
 		Price(limitPriceStr).
 		StopPrice(stopPriceStr).
 		Quantity(quantityStr).
 		WorkingType(futures.WorkingTypeContractPrice).
-		Do(context.Background())
+		NewClientOrderID(clientOrderID) // 固定 clientOrderId，重试时不会重复下单
+	orderService = t.applyPositionMode(orderService, posSide, true)
+
+	order, err := placeOrderWithRetry(t, "设置止损", symbol, clientOrderID, orderService)
 
 	if err != nil {
-		return fmt.Errorf("设置止损失败: %w", err)
+		return 0, fmt.Errorf("设置止损失败: %w", err)
 	}
 
 	log.Printf("  止损价设置: %s (限价: %s)", stopPriceStr, limitPriceStr)
-	return nil
+	return order.OrderID, nil
 }
 
 // SetTakeProfit 设置止盈单
 func (t *FuturesTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+	_, err := t.placeTakeProfit(symbol, positionSide, quantity, takeProfitPrice)
+	return err
+}
+
+// placeTakeProfit 下止盈单并返回订单ID
+func (t *FuturesTrader) placeTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) (int64, error) {
 	var side futures.SideType
 	var posSide futures.PositionSideType
 
@@ -795,7 +912,7 @@ func (t *FuturesTrader) SetTakeProfit(symbol string, positionSide string, quanti
 	// 格式化数量
 	quantityStr, err := t.FormatQuantity(symbol, quantity)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// 计算 Stop Limit Price (Take Profit 也使用相同的逻辑确保成交)
@@ -804,59 +921,367 @@ func (t *FuturesTrader) SetTakeProfit(symbol string, positionSide string, quanti
 	// 格式化价格到正确精度（符合 tickSize 要求）
 	limitPriceStr, err := t.FormatPrice(symbol, limitPrice)
 	if err != nil {
-		return fmt.Errorf("格式化限价失败: %w", err)
+		return 0, fmt.Errorf("格式化限价失败: %w", err)
 	}
 	takeProfitPriceStr, err := t.FormatPrice(symbol, takeProfitPrice)
 	if err != nil {
-		return fmt.Errorf("格式化止盈价失败: %w", err)
+		return 0, fmt.Errorf("格式化止盈价失败: %w", err)
 	}
 
-	_, err = t.client.NewCreateOrderService().
+	clientOrderID := getBrOrderID()
+	orderService := t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(side).
-		PositionSide(posSide).
 		Type(futures.OrderTypeTakeProfit).
 		TimeInForce(futures.TimeInForceTypeGTC). // STOP/TAKE_PROFIT 必须提供 timeInForce
 		Price(limitPriceStr).
 		StopPrice(takeProfitPriceStr).
 		Quantity(quantityStr).
 		WorkingType(futures.WorkingTypeContractPrice).
-		Do(context.Background())
+		NewClientOrderID(clientOrderID) // 固定 clientOrderId，重试时不会重复下单
+	orderService = t.applyPositionMode(orderService, posSide, true)
+
+	order, err := placeOrderWithRetry(t, "设置止盈", symbol, clientOrderID, orderService)
 
 	if err != nil {
-		return fmt.Errorf("设置止盈失败: %w", err)
+		return 0, fmt.Errorf("设置止盈失败: %w", err)
 	}
 
 	log.Printf("  止盈价设置: %s (限价: %s)", takeProfitPriceStr, limitPriceStr)
+	return order.OrderID, nil
+}
+
+// SetStopLossAndTakeProfit 联动下止损单和止盈单（OCO 风格）
+// 止盈单下单失败时撤回已下的止损单，返回合并后的错误，避免只留下单边保护单；
+// 两单都成功后登记为联动组，用户数据流推送一方成交时由 CancelLinkedSiblings 取消另一方
+func (t *FuturesTrader) SetStopLossAndTakeProfit(symbol, side string, quantity, stopPrice, takeProfitPrice float64) error {
+	positionSide := strings.ToUpper(side)
+
+	stopLossID, err := t.placeStopLoss(symbol, positionSide, quantity, stopPrice)
+	if err != nil {
+		return err
+	}
+
+	takeProfitID, err := t.placeTakeProfit(symbol, positionSide, quantity, takeProfitPrice)
+	if err != nil {
+		_, cancelErr := t.client.NewCancelOrderService().
+			Symbol(symbol).
+			OrderID(stopLossID).
+			Do(context.Background())
+		if cancelErr != nil {
+			return fmt.Errorf("%w; 撤回止损单 %d 失败: %v", err, stopLossID, cancelErr)
+		}
+		log.Printf("  ↩ 止盈单失败，已撤回止损单 (订单ID: %d)", stopLossID)
+		return err
+	}
+
+	t.linkedOrdersMutex.Lock()
+	t.linkedOrders = append(t.linkedOrders, linkedOrderPair{
+		symbol:       symbol,
+		stopLossID:   stopLossID,
+		takeProfitID: takeProfitID,
+	})
+	t.linkedOrdersMutex.Unlock()
+
 	return nil
 }
 
-// GetMinNotional 获取最小名义价值（Binance要求）
-func (t *FuturesTrader) GetMinNotional(symbol string) float64 {
-	// 使用保守的默认值 10 USDT，确保订单能够通过交易所验证
-	return 10.0
+// CancelLinkedSiblings 检查该币种的联动止损止盈单：一方已不在挂单列表（已成交或被取消）时取消另一方并解除联动
+// 由用户数据流的成交事件触发（见 handleOrderTradeUpdate），也可在轮询持仓时调用
+func (t *FuturesTrader) CancelLinkedSiblings(symbol string) error {
+	t.linkedOrdersMutex.Lock()
+	defer t.linkedOrdersMutex.Unlock()
+
+	hasPairs := false
+	for _, pair := range t.linkedOrders {
+		if pair.symbol == symbol {
+			hasPairs = true
+			break
+		}
+	}
+	if !hasPairs {
+		return nil
+	}
+
+	orders, err := t.client.NewListOpenOrdersService().
+		Symbol(symbol).
+		Do(context.Background())
+	if err != nil {
+		return fmt.Errorf("获取未完成订单失败: %w", err)
+	}
+	open := make(map[int64]bool, len(orders))
+	for _, order := range orders {
+		open[order.OrderID] = true
+	}
+
+	var cancelErrors []error
+	remaining := t.linkedOrders[:0]
+	for _, pair := range t.linkedOrders {
+		if pair.symbol != symbol {
+			remaining = append(remaining, pair)
+			continue
+		}
+
+		slOpen, tpOpen := open[pair.stopLossID], open[pair.takeProfitID]
+		if slOpen && tpOpen {
+			remaining = append(remaining, pair)
+			continue
+		}
+
+		sibling := int64(0)
+		if slOpen {
+			sibling = pair.stopLossID
+		} else if tpOpen {
+			sibling = pair.takeProfitID
+		}
+		if sibling == 0 {
+			continue
+		}
+
+		if _, err := t.client.NewCancelOrderService().
+			Symbol(symbol).
+			OrderID(sibling).
+			Do(context.Background()); err != nil {
+			cancelErrors = append(cancelErrors, fmt.Errorf("订单ID %d: %w", sibling, err))
+			remaining = append(remaining, pair) // 保留以便下次重试
+			continue
+		}
+		log.Printf("  ✓ 联动单已触发，取消剩余订单 (订单ID: %d)", sibling)
+	}
+	t.linkedOrders = remaining
+
+	if len(cancelErrors) > 0 {
+		return fmt.Errorf("取消联动订单失败: %v", cancelErrors)
+	}
+	return nil
 }
 
-// CheckMinNotional 检查订单是否满足最小名义价值要求
-func (t *FuturesTrader) CheckMinNotional(symbol string, quantity float64) error {
-	price, err := t.GetMarketPrice(symbol)
+// isLinkedOrder 判断订单是否属于某个联动止损止盈组
+func (t *FuturesTrader) isLinkedOrder(symbol string, orderID int64) bool {
+	t.linkedOrdersMutex.Lock()
+	defer t.linkedOrdersMutex.Unlock()
+
+	for _, pair := range t.linkedOrders {
+		if pair.symbol == symbol && (pair.stopLossID == orderID || pair.takeProfitID == orderID) {
+			return true
+		}
+	}
+	return false
+}
+
+// unlinkOrders 解除该币种的所有联动组（止损/止盈单被主动撤销后不再联动，避免登记表无限增长）
+func (t *FuturesTrader) unlinkOrders(symbol string) {
+	t.linkedOrdersMutex.Lock()
+	defer t.linkedOrdersMutex.Unlock()
+
+	remaining := t.linkedOrders[:0]
+	for _, pair := range t.linkedOrders {
+		if pair.symbol != symbol {
+			remaining = append(remaining, pair)
+		}
+	}
+	t.linkedOrders = remaining
+}
+
+// TPLevel 分批止盈的一档：触发价 + 占当前持仓数量的比例
+type TPLevel struct {
+	Price   float64
+	Portion float64 // (0, 1]，各档合计不超过 1
+}
+
+// SetScaledTakeProfit 分批止盈：按各档比例把当前持仓拆成多笔 TAKE_PROFIT 限价单
+// 每档数量按 stepSize 向下取整，避免合计超过持仓；双向持仓模式下平仓方向 + positionSide 即只减仓（不发送 reduceOnly）
+// 任一档下单失败时撤回已下的各档，返回合并后的错误
+func (t *FuturesTrader) SetScaledTakeProfit(symbol, side string, levels []TPLevel) error {
+	if len(levels) == 0 {
+		return fmt.Errorf("止盈档位不能为空")
+	}
+	totalPortion := 0.0
+	for i, level := range levels {
+		if level.Price <= 0 {
+			return fmt.Errorf("第 %d 档止盈价无效: %.4f", i+1, level.Price)
+		}
+		if level.Portion <= 0 {
+			return fmt.Errorf("第 %d 档止盈比例无效: %.4f", i+1, level.Portion)
+		}
+		totalPortion += level.Portion
+	}
+	if totalPortion > 1+1e-9 {
+		return fmt.Errorf("止盈比例合计 %.4f 超过 1", totalPortion)
+	}
+
+	positionSide := strings.ToUpper(side)
+	positionQty, err := t.getPositionQuantity(symbol, positionSide)
 	if err != nil {
-		return fmt.Errorf("获取市价失败: %w", err)
+		return err
 	}
 
-	notionalValue := quantity * price
-	minNotional := t.GetMinNotional(symbol)
+	stepSize, minQty, _, err := t.getLotSize(symbol)
+	if err != nil {
+		return err
+	}
+
+	quantities := make([]float64, len(levels))
+	for i, level := range levels {
+		quantities[i] = floorToStep(positionQty*level.Portion, stepSize)
+		if quantities[i] <= 0 || quantities[i] < minQty {
+			return fmt.Errorf("第 %d 档止盈数量过小 (持仓 %.8f × %.4f)", i+1, positionQty, level.Portion)
+		}
+	}
+
+	var placedIDs []int64
+	for i, level := range levels {
+		orderID, err := t.placeTakeProfit(symbol, positionSide, quantities[i], level.Price)
+		if err != nil {
+			err = fmt.Errorf("第 %d 档止盈下单失败: %w", i+1, err)
+			for _, placedID := range placedIDs {
+				if _, cancelErr := t.client.NewCancelOrderService().
+					Symbol(symbol).
+					OrderID(placedID).
+					Do(context.Background()); cancelErr != nil {
+					err = fmt.Errorf("%w; 撤回止盈单 %d 失败: %v", err, placedID, cancelErr)
+				}
+			}
+			return err
+		}
+		placedIDs = append(placedIDs, orderID)
+	}
+
+	log.Printf("  ✓ %s %s 分批止盈设置完成: %d 档，合计 %.0f%% 持仓", symbol, positionSide, len(levels), totalPortion*100)
+	return nil
+}
+
+// getPositionQuantity 获取指定方向持仓的数量（绝对值），无持仓时返回错误
+func (t *FuturesTrader) getPositionQuantity(symbol, positionSide string) (float64, error) {
+	positions, err := t.GetPositions()
+	if err != nil {
+		return 0, err
+	}
+	for _, pos := range positions {
+		if pos["symbol"] == symbol && strings.EqualFold(pos["side"].(string), positionSide) {
+			return math.Abs(pos["positionAmt"].(float64)), nil
+		}
+	}
+	return 0, fmt.Errorf("没有找到 %s 的 %s 持仓", symbol, positionSide)
+}
+
+// SetTrailingStop 设置跟踪止损单（TRAILING_STOP_MARKET）
+// callbackRate 为回调比例（百分比，币安允许 0.1-10），activationPrice > 0 时价格触及激活价后才开始跟踪，<= 0 时立即跟踪
+// 双向持仓模式下平仓方向 + positionSide 即只减仓（币安在该模式下拒绝 reduceOnly 参数）；同 Issue #94 不发送 closePosition=true
+func (t *FuturesTrader) SetTrailingStop(symbol string, side string, quantity, callbackRate float64, activationPrice float64) error {
+	if callbackRate < 0.1 || callbackRate > 10 {
+		return fmt.Errorf("回调比例 %.2f%% 超出范围 [0.1, 10]", callbackRate)
+	}
+
+	var orderSide futures.SideType
+	var posSide futures.PositionSideType
+
+	if strings.ToUpper(side) == "LONG" {
+		orderSide = futures.SideTypeSell
+		posSide = futures.PositionSideTypeLong
+	} else {
+		orderSide = futures.SideTypeBuy
+		posSide = futures.PositionSideTypeShort
+	}
+
+	// 格式化数量
+	quantityStr, err := t.FormatQuantity(symbol, quantity)
+	if err != nil {
+		return err
+	}
+
+	callbackRateStr := strconv.FormatFloat(callbackRate, 'f', 1, 64)
+
+	order := t.client.NewCreateOrderService().
+		Symbol(symbol).
+		Side(orderSide).
+		Type(futures.OrderTypeTrailingStopMarket).
+		Quantity(quantityStr).
+		CallbackRate(callbackRateStr).
+		WorkingType(futures.WorkingTypeContractPrice)
+	order = t.applyPositionMode(order, posSide, true)
+
+	activationPriceStr := "立即激活"
+	if activationPrice > 0 {
+		// 格式化激活价到正确精度（符合 tickSize 要求）
+		activationPriceStr, err = t.FormatPrice(symbol, activationPrice)
+		if err != nil {
+			return fmt.Errorf("格式化激活价失败: %w", err)
+		}
+		order = order.ActivationPrice(activationPriceStr)
+	}
+
+	clientOrderID := getBrOrderID()
+	order = order.NewClientOrderID(clientOrderID) // 固定 clientOrderId，重试时不会重复下单
+	if _, err = placeOrderWithRetry(t, "设置跟踪止损", symbol, clientOrderID, order); err != nil {
+		return fmt.Errorf("设置跟踪止损失败: %w", err)
+	}
+
+	log.Printf("  跟踪止损设置: 回调 %s%% (激活价: %s)", callbackRateStr, activationPriceStr)
+	return nil
+}
+
+// defaultMinNotional 交易规则中没有 MIN_NOTIONAL 时使用的保守默认值（USDT）
+const defaultMinNotional = 10.0
+
+// GetMinNotional 获取最小名义价值（从交易规则的 MIN_NOTIONAL 过滤器读取，获取失败时使用默认值 10 USDT）
+func (t *FuturesTrader) GetMinNotional(symbol string) float64 {
+	exchangeInfo, err := t.client.NewExchangeInfoService().Do(context.Background())
+	if err != nil {
+		log.Printf("  ⚠ 获取交易规则失败，最小名义价值使用默认值 %.0f: %v", defaultMinNotional, err)
+		return defaultMinNotional
+	}
+
+	for _, s := range exchangeInfo.Symbols {
+		if s.Symbol != symbol {
+			continue
+		}
+		for _, filter := range s.Filters {
+			if filter["filterType"] != "MIN_NOTIONAL" {
+				continue
+			}
+			// 合约使用 notional 字段，现货使用 minNotional
+			for _, key := range []string{"notional", "minNotional"} {
+				if value, ok := filter[key].(string); ok {
+					if minNotional, err := strconv.ParseFloat(value, 64); err == nil && minNotional > 0 {
+						return minNotional
+					}
+				}
+			}
+		}
+	}
+
+	return defaultMinNotional
+}
+
+// ValidateOrder 下单前检查名义价值（价格 × 数量）是否满足交易所的 MIN_NOTIONAL，避免一次注定被拒绝的请求
+func (t *FuturesTrader) ValidateOrder(symbol string, price, qty float64) error {
+	if price <= 0 || qty <= 0 {
+		return fmt.Errorf("无效的订单参数: 价格 %.4f, 数量 %.8f", price, qty)
+	}
 
+	notionalValue := price * qty
+	minNotional := t.GetMinNotional(symbol)
 	if notionalValue < minNotional {
 		return fmt.Errorf(
-			"订单金额 %.2f USDT 低于最小要求 %.2f USDT (数量: %.4f, 价格: %.4f)",
-			notionalValue, minNotional, quantity, price,
+			"订单名义价值 %.2f USDT 低于 %s 最小名义价值 %.2f USDT (below min notional %g; 数量: %.4f, 价格: %.4f)",
+			notionalValue, symbol, minNotional, minNotional, qty, price,
 		)
 	}
 
 	return nil
 }
 
+// CheckMinNotional 按当前市价检查订单是否满足最小名义价值要求
+func (t *FuturesTrader) CheckMinNotional(symbol string, quantity float64) error {
+	price, err := t.GetMarketPrice(symbol)
+	if err != nil {
+		return fmt.Errorf("获取市价失败: %w", err)
+	}
+
+	return t.ValidateOrder(symbol, price, quantity)
+}
+
 // GetSymbolPrecision 获取交易对的数量精度
 func (t *FuturesTrader) GetSymbolPrecision(symbol string) (int, error) {
 	exchangeInfo, err := t.client.NewExchangeInfoService().Do(context.Background())
@@ -962,16 +1387,78 @@ func trimTrailingZeros(s string) string {
 	return s
 }
 
+// getLotSize 获取交易对 LOT_SIZE 过滤器的 stepSize、minQty 及对应的数量精度
+// 未找到 LOT_SIZE 时按精度 3（stepSize 0.001）处理
+func (t *FuturesTrader) getLotSize(symbol string) (stepSize, minQty float64, precision int, err error) {
+	exchangeInfo, err := t.client.NewExchangeInfoService().Do(context.Background())
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("获取交易规则失败: %w", err)
+	}
+
+	for _, s := range exchangeInfo.Symbols {
+		if s.Symbol != symbol {
+			continue
+		}
+		for _, filter := range s.Filters {
+			if filter["filterType"] == "LOT_SIZE" {
+				stepSizeStr, _ := filter["stepSize"].(string)
+				minQtyStr, _ := filter["minQty"].(string)
+				stepSize, _ = strconv.ParseFloat(stepSizeStr, 64)
+				minQty, _ = strconv.ParseFloat(minQtyStr, 64)
+				if stepSize > 0 {
+					return stepSize, minQty, calculatePrecision(stepSizeStr), nil
+				}
+			}
+		}
+	}
+
+	log.Printf("  ⚠ %s 未找到 LOT_SIZE 信息，使用默认精度3", symbol)
+	return 0.001, 0, 3, nil
+}
+
+// floorToStep 把数量向下取整到 stepSize 的整数倍（容忍浮点误差）
+func floorToStep(quantity, stepSize float64) float64 {
+	if stepSize <= 0 {
+		return quantity
+	}
+	return math.Floor(quantity/stepSize+1e-9) * stepSize
+}
+
 // FormatQuantity 格式化数量到正确的精度
+// 按 LOT_SIZE 的 stepSize 向下取整，避免四舍五入后超出持仓/余额或不是 stepSize 的整数倍
 func (t *FuturesTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
-	precision, err := t.GetSymbolPrecision(symbol)
+	stepSize, _, precision, err := t.getLotSize(symbol)
 	if err != nil {
 		// 如果获取失败，使用默认格式
-		return fmt.Sprintf("%.3f", quantity), nil
+		return fmt.Sprintf("%.3f", floorToStep(quantity, 0.001)), nil
 	}
 
 	format := fmt.Sprintf("%%.%df", precision)
-	return fmt.Sprintf(format, quantity), nil
+	return fmt.Sprintf(format, floorToStep(quantity, stepSize)), nil
+}
+
+// formatCloseQuantity 格式化平仓数量：按 stepSize 向下取整；
+// 平仓后剩余不足 minQty（无法再单独平掉的碎仓）或超过持仓时，改为平掉整个持仓
+func (t *FuturesTrader) formatCloseQuantity(symbol, positionSide string, quantity float64) (string, error) {
+	stepSize, minQty, _, err := t.getLotSize(symbol)
+	if err != nil {
+		return t.FormatQuantity(symbol, quantity)
+	}
+
+	if positionQty, err := t.getPositionQuantity(symbol, positionSide); err == nil {
+		closeQty := floorToStep(quantity, stepSize)
+		residual := positionQty - closeQty
+		if residual < 0 || (residual > stepSize/2 && residual < minQty) {
+			log.Printf("  ℹ️ %s %s 平仓 %.8f 后剩余 %.8f 低于最小下单量 %.8f，改为全部平仓 %.8f",
+				symbol, positionSide, closeQty, residual, minQty, positionQty)
+			quantity = positionQty
+		}
+	}
+
+	if floorToStep(quantity, stepSize) < minQty {
+		return "", fmt.Errorf("平仓数量 %.8f 低于 %s 最小下单量 %.8f", quantity, symbol, minQty)
+	}
+	return t.FormatQuantity(symbol, quantity)
 }
 
 // 辅助函数
@@ -1048,3 +1535,66 @@ func (t *FuturesTrader) GetRecentFills(symbol string, startTime int64, endTime i
 
 	return result, nil
 }
+
+// 收益类型（/fapi/v1/income 的 incomeType）
+const (
+	IncomeTypeRealizedPnL = "REALIZED_PNL"
+	IncomeTypeFundingFee  = "FUNDING_FEE"
+	IncomeTypeCommission  = "COMMISSION"
+)
+
+// binanceIncomeLimit 单次查询收益记录的最大条数（币安上限 1000）
+const binanceIncomeLimit = 1000
+
+// IncomeRecord 交易所记录的一笔资金变动（已实现盈亏、资金费、手续费等）
+type IncomeRecord struct {
+	Symbol  string
+	Type    string  // REALIZED_PNL / FUNDING_FEE / COMMISSION ...
+	Amount  float64 // 正数为收入，负数为支出
+	Asset   string
+	Time    int64 // 毫秒时间戳
+	TranID  int64
+	TradeID string
+}
+
+// GetIncomeHistory 获取账户收益流水，用于核对日志记录的盈亏、资金费与手续费
+// symbol、incomeType 为空时不过滤；startMs/endMs 为 0 时不限制时间
+func (t *FuturesTrader) GetIncomeHistory(symbol string, incomeType string, startMs, endMs int64) ([]IncomeRecord, error) {
+	service := t.client.NewGetIncomeHistoryService().
+		Symbol(symbol).
+		IncomeType(incomeType).
+		Limit(binanceIncomeLimit)
+	if startMs > 0 {
+		service = service.StartTime(startMs)
+	}
+	if endMs > 0 {
+		service = service.EndTime(endMs)
+	}
+
+	incomes, err := doWithRetry(t, "获取收益记录", func() ([]*futures.IncomeHistory, error) {
+		return service.Do(context.Background())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取收益记录失败: %w", err)
+	}
+
+	result := make([]IncomeRecord, 0, len(incomes))
+	for _, income := range incomes {
+		amount, err := strconv.ParseFloat(income.Income, 64)
+		if err != nil {
+			log.Printf("⚠️ 解析收益金额失败: %v", err)
+			continue
+		}
+		result = append(result, IncomeRecord{
+			Symbol:  income.Symbol,
+			Type:    income.IncomeType,
+			Amount:  amount,
+			Asset:   income.Asset,
+			Time:    income.Time,
+			TranID:  income.TranID,
+			TradeID: income.TradeID,
+		})
+	}
+
+	return result, nil
+}
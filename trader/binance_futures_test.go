@@ -4,9 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -263,7 +267,13 @@ func NewBinanceFuturesTestSuite(t *testing.T) *BinanceFuturesTestSuite {
 				"msg":  "success",
 			}
 
-		// Mock ChangePositionMode - /fapi/v1/positionSide/dual
+		// Mock GetPositionMode - GET /fapi/v1/positionSide/dual（双向持仓）
+		case path == "/fapi/v1/positionSide/dual" && r.Method == "GET":
+			respBody = map[string]interface{}{
+				"dualSidePosition": true,
+			}
+
+		// Mock ChangePositionMode - POST /fapi/v1/positionSide/dual
 		case path == "/fapi/v1/positionSide/dual":
 			respBody = map[string]interface{}{
 				"code": 200,
@@ -422,6 +432,32 @@ func TestCalculatePositionSize(t *testing.T) {
 	}
 }
 
+// TestMaxOpenQuantity 测试最大可开仓数量（基于可用保证金，预留缓冲并扣除开仓手续费，与回测一致）
+func TestMaxOpenQuantity(t *testing.T) {
+	trader := &FuturesTrader{
+		cachedBalance: map[string]interface{}{
+			"totalWalletBalance": 10000.0,
+			"availableBalance":   4000.0, // 已有持仓占用 6000 保证金
+		},
+		balanceCacheTime: time.Now(),
+		cacheDuration:    time.Minute,
+	}
+
+	price, leverage := 50000.0, 10
+	qty, err := trader.MaxOpenQuantity("BTCUSDT", price, leverage)
+	assert.NoError(t, err)
+	// 4000 * 0.95 / (50000/10 + 50000*0.0005) ≈ 0.7562
+	wantQty := 4000 * (1 - DefaultMarginBuffer) / (price/float64(leverage) + price*DefaultTakerFeeRate)
+	assert.InDelta(t, wantQty, qty, 1e-9)
+
+	// 所需保证金 + 开仓手续费不超过扣除缓冲后的可用保证金
+	required := qty*price/float64(leverage) + qty*price*DefaultTakerFeeRate
+	assert.LessOrEqual(t, required, 4000*(1-DefaultMarginBuffer)+1e-6)
+
+	_, err = trader.MaxOpenQuantity("BTCUSDT", 0, 10)
+	assert.Error(t, err)
+}
+
 // TestGetBrOrderID 测试订单ID生成
 func TestGetBrOrderID(t *testing.T) {
 	// 测试3次，确保每次生成的ID都不同
@@ -504,9 +540,11 @@ func createTestTrader(mockServerURL string) *FuturesTrader {
 	futures.UseTestnet = true
 	client.BaseURL = mockServerURL
 
+	dualSide := true // 默认双向持仓模式，与 NewFuturesTrader 初始化后的状态一致
 	return &FuturesTrader{
-		client:        client,
-		cacheDuration: 15 * time.Second,
+		client:           client,
+		cacheDuration:    15 * time.Second,
+		dualSidePosition: &dualSide,
 	}
 }
 
@@ -571,6 +609,595 @@ func TestStopLossAndTakeProfitNoClosePosition(t *testing.T) {
 	}
 }
 
+// TestSetTrailingStop 验证跟踪止损单的类型、方向、回调比例与激活价，且不发送 closePosition
+func TestSetTrailingStop(t *testing.T) {
+	tests := []struct {
+		name               string
+		side               string
+		activationPrice    float64
+		expectedSide       string
+		expectedPosSide    string
+		expectedActivation string
+	}{
+		{
+			name:               "多仓跟踪止损带激活价",
+			side:               "LONG",
+			activationPrice:    52000.454,
+			expectedSide:       "SELL",
+			expectedPosSide:    "LONG",
+			expectedActivation: "52000.45",
+		},
+		{
+			name:               "空仓跟踪止损立即激活",
+			side:               "SHORT",
+			activationPrice:    0,
+			expectedSide:       "BUY",
+			expectedPosSide:    "SHORT",
+			expectedActivation: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var capturedParams map[string]string
+			mockServer := setupMockServerWithParamCapture(&capturedParams)
+			defer mockServer.Close()
+
+			trader := createTestTrader(mockServer.URL)
+
+			err := trader.SetTrailingStop("BTCUSDT", tt.side, 0.01, 1.5, tt.activationPrice)
+			assert.NoError(t, err, "调用应该成功")
+			assert.NotNil(t, capturedParams, "应该捕获到请求参数")
+
+			assert.Equal(t, "TRAILING_STOP_MARKET", capturedParams["type"], "订单类型")
+			assert.Equal(t, "1.5", capturedParams["callbackRate"], "回调比例")
+			assert.Equal(t, tt.expectedSide, capturedParams["side"], "订单方向")
+			assert.Equal(t, tt.expectedPosSide, capturedParams["positionSide"], "持仓方向")
+			assert.Equal(t, tt.expectedActivation, capturedParams["activationPrice"], "激活价")
+			assert.NotEmpty(t, capturedParams["quantity"], "应该有 quantity")
+
+			_, hasClosePosition := capturedParams["closePosition"]
+			assert.False(t, hasClosePosition, "不应该发送 closePosition 参数（Issue #94）")
+		})
+	}
+
+	// 回调比例超出币安允许范围时直接拒绝，不发送请求
+	trader := createTestTrader("http://127.0.0.1:0")
+	assert.Error(t, trader.SetTrailingStop("BTCUSDT", "LONG", 0.01, 0.05, 0))
+	assert.Error(t, trader.SetTrailingStop("BTCUSDT", "LONG", 0.01, 12, 0))
+}
+
+// linkedOrderMockServer 模拟联动止损止盈的下单/撤单/挂单查询，按顺序记录所有下单参数 (helper)
+type linkedOrderMockServer struct {
+	*httptest.Server
+	mu         sync.Mutex
+	placed     []map[string]string
+	canceled   []string
+	openIDs    []int64
+	failTPType bool
+	failNth    int                      // 第 N 次下单返回错误（0 表示不失败）
+	positions  []map[string]interface{} // positionRisk 返回的持仓
+}
+
+func newLinkedOrderMockServer() *linkedOrderMockServer {
+	m := &linkedOrderMockServer{}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		switch {
+		case r.URL.Path == binanceOrderPath && r.Method == "POST":
+			r.ParseForm()
+			params := make(map[string]string)
+			for key := range r.Form {
+				params[key] = r.FormValue(key)
+			}
+			if (m.failTPType && params["type"] == "TAKE_PROFIT") || m.failNth == len(m.placed)+1 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"code": -2021, "msg": "Order would immediately trigger."})
+				return
+			}
+			m.placed = append(m.placed, params)
+			json.NewEncoder(w).Encode(map[string]interface{}{"orderId": 1000 + len(m.placed), "symbol": "BTCUSDT", "status": "NEW"})
+		case r.URL.Path == binanceOrderPath && r.Method == "DELETE":
+			// DELETE 参数在请求体中
+			body, _ := io.ReadAll(r.Body)
+			values, _ := url.ParseQuery(string(body))
+			m.canceled = append(m.canceled, values.Get("orderId"))
+			json.NewEncoder(w).Encode(map[string]interface{}{"orderId": 0, "status": "CANCELED"})
+		case r.URL.Path == "/fapi/v1/openOrders":
+			orders := make([]map[string]interface{}, 0, len(m.openIDs))
+			for _, id := range m.openIDs {
+				orders = append(orders, map[string]interface{}{"orderId": id, "symbol": "BTCUSDT"})
+			}
+			json.NewEncoder(w).Encode(orders)
+		case r.URL.Path == "/fapi/v2/positionRisk":
+			json.NewEncoder(w).Encode(m.positions)
+		case r.URL.Path == binanceExchangeInfoPath:
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"symbols": []map[string]interface{}{
+					{
+						"symbol":            "BTCUSDT",
+						"pricePrecision":    2,
+						"quantityPrecision": 3,
+						"filters": []map[string]interface{}{
+							{"filterType": "PRICE_FILTER", "tickSize": "0.01"},
+							{"filterType": "LOT_SIZE", "stepSize": "0.001"},
+						},
+					},
+				},
+			})
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{})
+		}
+	}))
+	return m
+}
+
+// TestSetStopLossAndTakeProfit 验证联动止损止盈：两单方向与价格正确，止盈失败时撤回止损，一方成交后取消另一方
+func TestSetStopLossAndTakeProfit(t *testing.T) {
+	t.Run("多仓下两单", func(t *testing.T) {
+		mock := newLinkedOrderMockServer()
+		defer mock.Close()
+		trader := createTestTrader(mock.URL)
+
+		err := trader.SetStopLossAndTakeProfit("BTCUSDT", "long", 0.01, 45000.123, 55000.987)
+		assert.NoError(t, err)
+		if !assert.Len(t, mock.placed, 2, "应该提交止损和止盈两个订单") {
+			return
+		}
+
+		sl, tp := mock.placed[0], mock.placed[1]
+		assert.Equal(t, "STOP", sl["type"])
+		assert.Equal(t, "TAKE_PROFIT", tp["type"])
+		for _, order := range mock.placed {
+			assert.Equal(t, "SELL", order["side"], "多仓保护单应为 SELL")
+			assert.Equal(t, "LONG", order["positionSide"])
+			_, hasClosePosition := order["closePosition"]
+			assert.False(t, hasClosePosition, "不应该发送 closePosition（Issue #94）")
+		}
+		assert.Equal(t, "45000.12", sl["stopPrice"], "止损价按 tickSize 格式化")
+		assert.Equal(t, "55000.99", tp["stopPrice"], "止盈价按 tickSize 格式化")
+		assert.Len(t, trader.linkedOrders, 1, "两单应登记为联动组")
+	})
+
+	t.Run("空仓方向", func(t *testing.T) {
+		mock := newLinkedOrderMockServer()
+		defer mock.Close()
+		trader := createTestTrader(mock.URL)
+
+		assert.NoError(t, trader.SetStopLossAndTakeProfit("BTCUSDT", "SHORT", 0.01, 55000, 45000))
+		for _, order := range mock.placed {
+			assert.Equal(t, "BUY", order["side"], "空仓保护单应为 BUY")
+			assert.Equal(t, "SHORT", order["positionSide"])
+		}
+	})
+
+	t.Run("止盈失败撤回止损", func(t *testing.T) {
+		mock := newLinkedOrderMockServer()
+		mock.failTPType = true
+		defer mock.Close()
+		trader := createTestTrader(mock.URL)
+
+		err := trader.SetStopLossAndTakeProfit("BTCUSDT", "LONG", 0.01, 45000, 55000)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "设置止盈失败")
+		assert.Equal(t, []string{"1001"}, mock.canceled, "应撤回已下的止损单")
+		assert.Empty(t, trader.linkedOrders)
+	})
+
+	t.Run("一方成交后取消另一方", func(t *testing.T) {
+		mock := newLinkedOrderMockServer()
+		defer mock.Close()
+		trader := createTestTrader(mock.URL)
+
+		assert.NoError(t, trader.SetStopLossAndTakeProfit("BTCUSDT", "LONG", 0.01, 45000, 55000))
+
+		// 两单都还挂着：不取消
+		mock.openIDs = []int64{1001, 1002}
+		assert.NoError(t, trader.CancelLinkedSiblings("BTCUSDT"))
+		assert.Empty(t, mock.canceled)
+		assert.Len(t, trader.linkedOrders, 1)
+
+		// 止损单已成交：取消止盈单并解除联动
+		mock.openIDs = []int64{1002}
+		assert.NoError(t, trader.CancelLinkedSiblings("BTCUSDT"))
+		assert.Equal(t, []string{"1002"}, mock.canceled)
+		assert.Empty(t, trader.linkedOrders)
+	})
+
+	t.Run("成交推送触发取消另一方", func(t *testing.T) {
+		mock := newLinkedOrderMockServer()
+		defer mock.Close()
+		trader := createTestTrader(mock.URL)
+
+		assert.NoError(t, trader.SetStopLossAndTakeProfit("BTCUSDT", "LONG", 0.01, 45000, 55000))
+
+		// 非联动订单成交：不查询也不取消
+		var fills []Fill
+		onFill := func(f Fill) { fills = append(fills, f) }
+		trader.handleOrderTradeUpdate(futures.WsOrderTradeUpdate{
+			Symbol: "BTCUSDT", ID: 999, ExecutionType: futures.OrderExecutionTypeTrade, Status: futures.OrderStatusTypeFilled,
+			LastFilledPrice: "50000", LastFilledQty: "0.01",
+		}, onFill)
+		assert.Empty(t, mock.canceled)
+		assert.Len(t, trader.linkedOrders, 1)
+
+		// 止盈单成交：取消止损单并解除联动，成交照常回调
+		mock.openIDs = []int64{1001}
+		trader.handleOrderTradeUpdate(futures.WsOrderTradeUpdate{
+			Symbol: "BTCUSDT", ID: 1002, ExecutionType: futures.OrderExecutionTypeTrade, Status: futures.OrderStatusTypeFilled,
+			LastFilledPrice: "55000", LastFilledQty: "0.01",
+		}, onFill)
+		assert.Equal(t, []string{"1001"}, mock.canceled)
+		assert.Empty(t, trader.linkedOrders)
+		assert.Len(t, fills, 2)
+	})
+
+	t.Run("主动撤销保护单后解除联动", func(t *testing.T) {
+		mock := newLinkedOrderMockServer()
+		defer mock.Close()
+		trader := createTestTrader(mock.URL)
+
+		assert.NoError(t, trader.SetStopLossAndTakeProfit("BTCUSDT", "LONG", 0.01, 45000, 55000))
+		assert.NoError(t, trader.CancelStopOrders("BTCUSDT"))
+		assert.Empty(t, trader.linkedOrders, "撤单后联动组应移除")
+	})
+}
+
+// TestSetScaledTakeProfit 验证分批止盈：按持仓比例拆单，价格与数量按精度格式化，比例超限拒绝，失败时撤回已下档位
+func TestSetScaledTakeProfit(t *testing.T) {
+	longPosition := []map[string]interface{}{
+		{"symbol": "BTCUSDT", "positionAmt": "0.5", "entryPrice": "50000", "markPrice": "51000", "positionSide": "LONG"},
+	}
+
+	t.Run("多仓三档止盈", func(t *testing.T) {
+		mock := newLinkedOrderMockServer()
+		mock.positions = longPosition
+		defer mock.Close()
+		trader := createTestTrader(mock.URL)
+
+		err := trader.SetScaledTakeProfit("BTCUSDT", "long", []TPLevel{
+			{Price: 52000.456, Portion: 0.5},
+			{Price: 54000, Portion: 0.29},
+			{Price: 56000.004, Portion: 0.2},
+		})
+		assert.NoError(t, err)
+		if !assert.Len(t, mock.placed, 3, "每档一个止盈单") {
+			return
+		}
+
+		wantStopPrices := []string{"52000.46", "54000.00", "56000.00"}
+		wantQuantities := []string{"0.250", "0.145", "0.100"}
+		for i, order := range mock.placed {
+			assert.Equal(t, "TAKE_PROFIT", order["type"])
+			assert.Equal(t, "SELL", order["side"])
+			assert.Equal(t, "LONG", order["positionSide"])
+			assert.Equal(t, wantStopPrices[i], order["stopPrice"], "第 %d 档止盈价", i+1)
+			assert.Equal(t, wantQuantities[i], order["quantity"], "第 %d 档数量", i+1)
+			_, hasReduceOnly := order["reduceOnly"]
+			assert.False(t, hasReduceOnly, "双向持仓模式不发送 reduceOnly")
+		}
+	})
+
+	t.Run("比例合计超过 1 拒绝", func(t *testing.T) {
+		mock := newLinkedOrderMockServer()
+		mock.positions = longPosition
+		defer mock.Close()
+		trader := createTestTrader(mock.URL)
+
+		err := trader.SetScaledTakeProfit("BTCUSDT", "LONG", []TPLevel{
+			{Price: 52000, Portion: 0.6},
+			{Price: 54000, Portion: 0.5},
+		})
+		assert.Error(t, err)
+		assert.Empty(t, mock.placed, "校验失败时不应下单")
+	})
+
+	t.Run("无持仓报错", func(t *testing.T) {
+		mock := newLinkedOrderMockServer()
+		defer mock.Close()
+		trader := createTestTrader(mock.URL)
+
+		err := trader.SetScaledTakeProfit("BTCUSDT", "SHORT", []TPLevel{{Price: 48000, Portion: 1}})
+		assert.Error(t, err)
+		assert.Empty(t, mock.placed)
+	})
+
+	t.Run("中途失败撤回已下档位", func(t *testing.T) {
+		mock := newLinkedOrderMockServer()
+		mock.positions = longPosition
+		mock.failNth = 3
+		defer mock.Close()
+		trader := createTestTrader(mock.URL)
+
+		err := trader.SetScaledTakeProfit("BTCUSDT", "LONG", []TPLevel{
+			{Price: 52000, Portion: 0.4},
+			{Price: 54000, Portion: 0.3},
+			{Price: 56000, Portion: 0.3},
+		})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "第 3 档止盈下单失败")
+		assert.ElementsMatch(t, []string{"1001", "1002"}, mock.canceled, "应撤回前两档")
+	})
+}
+
+// TestCloseQuantityStepSize 验证平仓数量按 stepSize 向下取整，剩余碎仓低于 minQty 时整仓平掉
+func TestCloseQuantityStepSize(t *testing.T) {
+	tests := []struct {
+		name         string
+		close        func(*FuturesTrader) error
+		positions    []map[string]interface{}
+		wantQuantity string
+		wantSide     string
+		wantPosSide  string
+	}{
+		{
+			name: "平多向下取整到 0.001",
+			close: func(tr *FuturesTrader) error {
+				_, err := tr.CloseLong("BTCUSDT", 0.123456)
+				return err
+			},
+			positions:    []map[string]interface{}{{"symbol": "BTCUSDT", "positionAmt": "1.000", "positionSide": "LONG"}},
+			wantQuantity: "0.123",
+			wantSide:     "SELL",
+			wantPosSide:  "LONG",
+		},
+		{
+			name: "平空向下取整到 0.001",
+			close: func(tr *FuturesTrader) error {
+				_, err := tr.CloseShort("BTCUSDT", 0.123456)
+				return err
+			},
+			positions:    []map[string]interface{}{{"symbol": "BTCUSDT", "positionAmt": "-1.000", "positionSide": "SHORT"}},
+			wantQuantity: "0.123",
+			wantSide:     "BUY",
+			wantPosSide:  "SHORT",
+		},
+		{
+			name: "剩余碎仓低于 minQty 时整仓平掉",
+			close: func(tr *FuturesTrader) error {
+				_, err := tr.CloseLong("BTCUSDT", 0.123456)
+				return err
+			},
+			positions:    []map[string]interface{}{{"symbol": "BTCUSDT", "positionAmt": "0.126", "positionSide": "LONG"}},
+			wantQuantity: "0.126",
+			wantSide:     "SELL",
+			wantPosSide:  "LONG",
+		},
+		{
+			name: "超过持仓时按持仓平",
+			close: func(tr *FuturesTrader) error {
+				_, err := tr.CloseShort("BTCUSDT", 0.5)
+				return err
+			},
+			positions:    []map[string]interface{}{{"symbol": "BTCUSDT", "positionAmt": "-0.200", "positionSide": "SHORT"}},
+			wantQuantity: "0.200",
+			wantSide:     "BUY",
+			wantPosSide:  "SHORT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var placed []map[string]string
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case r.URL.Path == binanceOrderPath && r.Method == "POST":
+					r.ParseForm()
+					params := make(map[string]string)
+					for key := range r.Form {
+						params[key] = r.FormValue(key)
+					}
+					placed = append(placed, params)
+					json.NewEncoder(w).Encode(map[string]interface{}{"orderId": 123456, "symbol": "BTCUSDT", "status": "FILLED"})
+				case r.URL.Path == "/fapi/v2/positionRisk":
+					json.NewEncoder(w).Encode(tt.positions)
+				case r.URL.Path == binanceExchangeInfoPath:
+					json.NewEncoder(w).Encode(map[string]interface{}{
+						"symbols": []map[string]interface{}{{
+							"symbol":            "BTCUSDT",
+							"quantityPrecision": 3,
+							"filters": []map[string]interface{}{
+								{"filterType": "PRICE_FILTER", "tickSize": "0.01"},
+								{"filterType": "LOT_SIZE", "stepSize": "0.001", "minQty": "0.005"},
+							},
+						}},
+					})
+				case r.URL.Path == "/fapi/v1/allOpenOrders":
+					json.NewEncoder(w).Encode(map[string]interface{}{"code": 200, "msg": "ok"})
+				default:
+					json.NewEncoder(w).Encode(map[string]interface{}{})
+				}
+			}))
+			defer mockServer.Close()
+
+			trader := createTestTrader(mockServer.URL)
+			assert.NoError(t, tt.close(trader))
+			if !assert.Len(t, placed, 1) {
+				return
+			}
+			order := placed[0]
+			assert.Equal(t, "MARKET", order["type"])
+			assert.Equal(t, tt.wantQuantity, order["quantity"])
+			assert.Equal(t, tt.wantSide, order["side"])
+			assert.Equal(t, tt.wantPosSide, order["positionSide"])
+			_, hasReduceOnly := order["reduceOnly"]
+			assert.False(t, hasReduceOnly, "双向持仓模式不发送 reduceOnly")
+		})
+	}
+}
+
+// TestPositionMode_OneWay 单向持仓模式下下单不发送 LONG/SHORT positionSide，平仓/保护单改用 reduceOnly，且持仓模式只查询一次
+func TestPositionMode_OneWay(t *testing.T) {
+	var mu sync.Mutex
+	var modeQueries int
+	var placed []map[string]string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/fapi/v1/positionSide/dual" && r.Method == "GET":
+			modeQueries++
+			json.NewEncoder(w).Encode(map[string]interface{}{"dualSidePosition": false})
+		case r.URL.Path == binanceOrderPath && r.Method == "POST":
+			r.ParseForm()
+			params := make(map[string]string)
+			for key := range r.Form {
+				params[key] = r.FormValue(key)
+			}
+			placed = append(placed, params)
+			json.NewEncoder(w).Encode(map[string]interface{}{"orderId": 1000 + len(placed), "symbol": "BTCUSDT", "status": "NEW"})
+		case r.URL.Path == "/fapi/v2/positionRisk":
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"symbol": "BTCUSDT", "positionAmt": "0.5", "leverage": "10", "positionSide": "BOTH"},
+			})
+		case r.URL.Path == binanceExchangeInfoPath:
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"symbols": []map[string]interface{}{{
+					"symbol": "BTCUSDT",
+					"filters": []map[string]interface{}{
+						{"filterType": "PRICE_FILTER", "tickSize": "0.01"},
+						{"filterType": "LOT_SIZE", "stepSize": "0.001", "minQty": "0.001"},
+					},
+				}},
+			})
+		case r.URL.Path == "/fapi/v1/ticker/price" || r.URL.Path == "/fapi/v2/ticker/price":
+			json.NewEncoder(w).Encode([]map[string]interface{}{{"symbol": "BTCUSDT", "price": "50000.00"}})
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{})
+		}
+	}))
+	defer mockServer.Close()
+
+	trader := createTestTrader(mockServer.URL)
+	trader.dualSidePosition = nil // 清除默认的双向持仓缓存，强制查询
+
+	dualSide, err := trader.GetPositionMode()
+	assert.NoError(t, err)
+	assert.False(t, dualSide)
+
+	_, err = trader.OpenLong("BTCUSDT", 0.01, 10)
+	assert.NoError(t, err)
+	assert.NoError(t, trader.SetStopLoss("BTCUSDT", "LONG", 0.5, 45000))
+	_, err = trader.CloseLong("BTCUSDT", 0.2)
+	assert.NoError(t, err)
+
+	if !assert.Len(t, placed, 3) {
+		return
+	}
+	for _, order := range placed {
+		posSide, hasPosSide := order["positionSide"]
+		assert.False(t, hasPosSide && posSide != "BOTH", "单向持仓模式不应发送 LONG/SHORT positionSide，实际: %s", posSide)
+	}
+	_, openReduceOnly := placed[0]["reduceOnly"]
+	assert.False(t, openReduceOnly, "开仓单不应 reduceOnly")
+	assert.Equal(t, "true", placed[1]["reduceOnly"], "止损单应 reduceOnly")
+	assert.Equal(t, "true", placed[2]["reduceOnly"], "平仓单应 reduceOnly")
+	assert.Equal(t, 1, modeQueries, "持仓模式应被缓存")
+}
+
+// TestValidateOrderMinNotional 验证从交易规则读取 MIN_NOTIONAL，过小订单在下单前被拒绝
+func TestValidateOrderMinNotional(t *testing.T) {
+	var ordersPlaced atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case binanceExchangeInfoPath:
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"symbols": []map[string]interface{}{
+					{
+						"symbol": "BTCUSDT",
+						"filters": []map[string]interface{}{
+							{"filterType": "PRICE_FILTER", "tickSize": "0.10"},
+							{"filterType": "LOT_SIZE", "stepSize": "0.001", "minQty": "0.001"},
+							{"filterType": "MIN_NOTIONAL", "notional": "100"},
+						},
+					},
+					{
+						"symbol": "ETHUSDT",
+						"filters": []map[string]interface{}{
+							{"filterType": "LOT_SIZE", "stepSize": "0.001", "minQty": "0.001"},
+						},
+					},
+				},
+			})
+		case "/fapi/v2/positionRisk":
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"symbol": "BTCUSDT", "positionAmt": "0.010", "leverage": "10", "positionSide": "LONG"},
+			})
+		case "/fapi/v1/ticker/price", "/fapi/v2/ticker/price":
+			json.NewEncoder(w).Encode([]map[string]interface{}{{"symbol": "BTCUSDT", "price": "50000.00"}})
+		case binanceOrderPath:
+			ordersPlaced.Add(1)
+			json.NewEncoder(w).Encode(map[string]interface{}{"orderId": 1, "symbol": "BTCUSDT"})
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{})
+		}
+	}))
+	defer mockServer.Close()
+
+	trader := createTestTrader(mockServer.URL)
+	assert.Equal(t, 100.0, trader.GetMinNotional("BTCUSDT"))
+	assert.Equal(t, 10.0, trader.GetMinNotional("ETHUSDT"), "无 MIN_NOTIONAL 过滤器时使用默认值")
+
+	err := trader.ValidateOrder("BTCUSDT", 50000, 0.001)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "below min notional 100")
+	}
+	assert.NoError(t, trader.ValidateOrder("BTCUSDT", 50000, 0.002))
+	assert.NoError(t, trader.ValidateOrder("ETHUSDT", 3000, 0.004))
+
+	// 开仓路径：名义价值 50 USDT 低于 100，不应发送下单请求
+	_, err = trader.OpenLong("BTCUSDT", 0.001, 10)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "below min notional 100")
+	}
+	assert.Equal(t, int32(0), ordersPlaced.Load())
+}
+
+// TestGetIncomeHistory 验证收益流水查询参数与多种收益类型的解析
+func TestGetIncomeHistory(t *testing.T) {
+	var capturedQuery url.Values
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/fapi/v1/income" {
+			json.NewEncoder(w).Encode(map[string]interface{}{})
+			return
+		}
+		capturedQuery = r.URL.Query()
+		w.Write([]byte(`[
+			{"symbol":"BTCUSDT","incomeType":"REALIZED_PNL","income":"12.50000000","asset":"USDT","info":"","time":1700000000000,"tranId":9001,"tradeId":"555"},
+			{"symbol":"BTCUSDT","incomeType":"FUNDING_FEE","income":"-0.03125000","asset":"USDT","info":"","time":1700028800000,"tranId":9002,"tradeId":""},
+			{"symbol":"BTCUSDT","incomeType":"COMMISSION","income":"-0.42000000","asset":"USDT","info":"","time":1700000000000,"tranId":9003,"tradeId":"555"}
+		]`))
+	}))
+	defer mockServer.Close()
+
+	trader := createTestTrader(mockServer.URL)
+	records, err := trader.GetIncomeHistory("BTCUSDT", "", 1699990000000, 1700030000000)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "BTCUSDT", capturedQuery.Get("symbol"))
+	assert.Equal(t, "1699990000000", capturedQuery.Get("startTime"))
+	assert.Equal(t, "1700030000000", capturedQuery.Get("endTime"))
+	assert.Empty(t, capturedQuery.Get("incomeType"), "未指定类型时不过滤")
+
+	expected := []IncomeRecord{
+		{Symbol: "BTCUSDT", Type: IncomeTypeRealizedPnL, Amount: 12.5, Asset: "USDT", Time: 1700000000000, TranID: 9001, TradeID: "555"},
+		{Symbol: "BTCUSDT", Type: IncomeTypeFundingFee, Amount: -0.03125, Asset: "USDT", Time: 1700028800000, TranID: 9002},
+		{Symbol: "BTCUSDT", Type: IncomeTypeCommission, Amount: -0.42, Asset: "USDT", Time: 1700000000000, TranID: 9003, TradeID: "555"},
+	}
+	assert.Equal(t, expected, records)
+
+	// 按类型过滤时透传 incomeType，时间为 0 时不发送
+	_, err = trader.GetIncomeHistory("BTCUSDT", IncomeTypeFundingFee, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "FUNDING_FEE", capturedQuery.Get("incomeType"))
+	assert.False(t, capturedQuery.Has("startTime"))
+	assert.False(t, capturedQuery.Has("endTime"))
+}
+
 // TestSetStopLossWithClosePositionWouldFail 验证修复前的代码会失败
 // 证明：STOP + closePosition=true 会导致 -4136 错误
 func TestSetStopLossWithClosePositionWouldFail(t *testing.T) {
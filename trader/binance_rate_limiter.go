@@ -0,0 +1,171 @@
+package trader
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultBinanceMaxWeightPerMin 币安合约默认每分钟请求权重上限
+	defaultBinanceMaxWeightPerMin = 1200
+	// binanceUsedWeightHeader 币安返回的当前分钟已用权重
+	binanceUsedWeightHeader = "X-Mbx-Used-Weight-1m"
+)
+
+// weightRateLimiter 按请求权重限流的令牌桶：每个自然分钟补满 maxWeight 个令牌，
+// 每次请求按端点预估权重扣减，响应头 X-MBX-USED-WEIGHT-1M 到达后以服务端数值校准，
+// 并由前后两次已用权重之差（取最小值）学习各端点的实际权重；令牌不足或收到 429/418 时阻塞到可用为止
+type weightRateLimiter struct {
+	mu           sync.Mutex
+	maxWeight    int
+	used         int            // 当前分钟已用权重（本地预扣 + 服务端校准）
+	window       int64          // 当前分钟窗口（Unix 分钟）
+	serverUsed   int            // 当前窗口内服务端最近一次返回的已用权重，-1 表示未知
+	endpointCost map[string]int // 各端点学习到的权重
+	blockedUntil time.Time      // 429/418 后的退避截止时间
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+func newWeightRateLimiter(maxWeightPerMin int) *weightRateLimiter {
+	return &weightRateLimiter{
+		maxWeight:    maxWeightPerMin,
+		serverUsed:   -1,
+		endpointCost: make(map[string]int),
+		now:          time.Now,
+		sleep:        time.Sleep,
+	}
+}
+
+// setMaxWeight 调整每分钟权重上限（<= 0 表示不限流）
+func (l *weightRateLimiter) setMaxWeight(maxWeightPerMin int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxWeight = maxWeightPerMin
+}
+
+// rollWindow 进入新的分钟窗口时补满令牌（调用方持有锁）
+func (l *weightRateLimiter) rollWindow(now time.Time) {
+	minute := now.Unix() / 60
+	if minute != l.window {
+		l.window = minute
+		l.used = 0
+		l.serverUsed = -1
+	}
+}
+
+// costOf 返回端点的预估权重，未学习到时按 1 计（调用方持有锁）
+func (l *weightRateLimiter) costOf(endpoint string) int {
+	if cost, ok := l.endpointCost[endpoint]; ok && cost > 0 {
+		return cost
+	}
+	return 1
+}
+
+// acquire 为一次请求预扣权重，令牌不足时阻塞到下一分钟窗口
+// 返回预扣时服务端已用权重快照，供 observe 学习端点权重
+func (l *weightRateLimiter) acquire(endpoint string) int {
+	for {
+		l.mu.Lock()
+		now := l.now()
+		if now.Before(l.blockedUntil) {
+			wait := l.blockedUntil.Sub(now)
+			l.mu.Unlock()
+			l.sleep(wait)
+			continue
+		}
+
+		l.rollWindow(now)
+		cost := l.costOf(endpoint)
+		if l.maxWeight <= 0 || l.used+cost <= l.maxWeight {
+			l.used += cost
+			snapshot := l.serverUsed
+			l.mu.Unlock()
+			return snapshot
+		}
+
+		wait := time.Unix((l.window+1)*60, 0).Sub(now)
+		log.Printf("⏳ 币安请求权重接近上限 (%d/%d)，等待 %v", l.used, l.maxWeight, wait.Round(time.Millisecond))
+		l.mu.Unlock()
+		l.sleep(wait)
+	}
+}
+
+// observe 根据响应头校准已用权重，并处理 429/418 的 Retry-After 退避
+func (l *weightRateLimiter) observe(endpoint string, snapshot int, resp *http.Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.rollWindow(now)
+
+	if used, err := strconv.Atoi(resp.Header.Get(binanceUsedWeightHeader)); err == nil {
+		// 增量可能包含并发请求或其它进程的权重，只会偏大，因此取观测到的最小值
+		if delta := used - snapshot; snapshot >= 0 && delta > 0 {
+			if cost, ok := l.endpointCost[endpoint]; !ok || delta < cost {
+				l.endpointCost[endpoint] = delta
+			}
+		}
+		if used > l.used {
+			l.used = used
+		}
+		l.serverUsed = used
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusTeapot {
+		retryAfter := time.Minute
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			retryAfter = time.Duration(secs) * time.Second
+		}
+		l.blockedUntil = now.Add(retryAfter)
+		log.Printf("⚠️ 币安返回 %d，暂停请求 %v", resp.StatusCode, retryAfter)
+	}
+}
+
+// rateLimitedTransport 让所有请求经过权重限流器
+type rateLimitedTransport struct {
+	base    http.RoundTripper
+	limiter *weightRateLimiter
+}
+
+func (rt *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := req.Method + " " + req.URL.Path
+	snapshot := rt.limiter.acquire(endpoint)
+
+	resp, err := rt.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	rt.limiter.observe(endpoint, snapshot, resp)
+	return resp, nil
+}
+
+// SetRateLimit 设置每分钟请求权重上限（<= 0 关闭限流），首次调用时为客户端安装限流器
+func (t *FuturesTrader) SetRateLimit(maxWeightPerMin int) {
+	if t.rateLimiter == nil {
+		t.installRateLimiter(maxWeightPerMin)
+		return
+	}
+	t.rateLimiter.setMaxWeight(maxWeightPerMin)
+}
+
+// installRateLimiter 用带限流的 Transport 包装客户端的 HTTPClient
+// 复制一份 http.Client，避免修改被共享的 http.DefaultClient
+func (t *FuturesTrader) installRateLimiter(maxWeightPerMin int) {
+	t.rateLimiter = newWeightRateLimiter(maxWeightPerMin)
+
+	httpClient := http.Client{}
+	if t.client.HTTPClient != nil {
+		httpClient = *t.client.HTTPClient
+	}
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	httpClient.Transport = &rateLimitedTransport{base: base, limiter: t.rateLimiter}
+	t.client.HTTPClient = &httpClient
+}
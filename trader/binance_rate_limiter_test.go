@@ -0,0 +1,107 @@
+package trader
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLimiterClock 让限流器使用可控时钟，sleep 直接推进时间并记录等待时长 (helper)
+func fakeLimiterClock(l *weightRateLimiter, start time.Time) *[]time.Duration {
+	now := start
+	var slept []time.Duration
+	l.now = func() time.Time { return now }
+	l.sleep = func(d time.Duration) {
+		slept = append(slept, d)
+		now = now.Add(d)
+	}
+	return &slept
+}
+
+// TestRateLimiter_ThrottlesNearLimit 服务端返回接近上限的已用权重时，下一次请求应等待到下一分钟
+func TestRateLimiter_ThrottlesNearLimit(t *testing.T) {
+	var usedWeight atomic.Int32
+	var requests atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("X-MBX-USED-WEIGHT-1M", strconv.Itoa(int(usedWeight.Load())))
+		json.NewEncoder(w).Encode([]map[string]interface{}{{"symbol": "BTCUSDT", "price": "50000.00"}})
+	}))
+	defer mockServer.Close()
+
+	trader := createTestTrader(mockServer.URL)
+	trader.SetRateLimit(1200)
+	slept := fakeLimiterClock(trader.rateLimiter, time.Date(2024, 1, 1, 12, 0, 30, 0, time.UTC))
+
+	// 远离上限：不等待
+	usedWeight.Store(100)
+	_, err := trader.GetMarketPrice("BTCUSDT")
+	assert.NoError(t, err)
+	assert.Empty(t, *slept, "远离上限时不应等待")
+
+	// 服务端报告已用满 1200：下一次请求需等到 12:01:00
+	usedWeight.Store(1200)
+	_, err = trader.GetMarketPrice("BTCUSDT")
+	assert.NoError(t, err)
+	assert.Empty(t, *slept)
+
+	usedWeight.Store(1)
+	_, err = trader.GetMarketPrice("BTCUSDT")
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Duration{30 * time.Second}, *slept, "应等待到下一分钟窗口")
+	assert.Equal(t, int32(3), requests.Load())
+
+	// 关闭限流后不再等待
+	trader.SetRateLimit(0)
+	usedWeight.Store(5000)
+	_, err = trader.GetMarketPrice("BTCUSDT")
+	assert.NoError(t, err)
+	_, err = trader.GetMarketPrice("BTCUSDT")
+	assert.NoError(t, err)
+	assert.Len(t, *slept, 1)
+}
+
+// TestRateLimiter_LearnsEndpointWeight 由前后已用权重之差学习端点权重，并按该权重预扣
+func TestRateLimiter_LearnsEndpointWeight(t *testing.T) {
+	l := newWeightRateLimiter(100)
+	slept := fakeLimiterClock(l, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	respWithWeight := func(used int) *http.Response {
+		resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+		resp.Header.Set("X-MBX-USED-WEIGHT-1M", strconv.Itoa(used))
+		return resp
+	}
+
+	const endpoint = "GET /fapi/v2/account"
+	l.observe(endpoint, l.acquire(endpoint), respWithWeight(10))
+	l.observe(endpoint, l.acquire(endpoint), respWithWeight(15))
+	assert.Equal(t, 5, l.endpointCost[endpoint], "两次响应之差即端点权重")
+
+	// 其它请求导致的大幅增量不会放大端点权重
+	l.observe(endpoint, l.acquire(endpoint), respWithWeight(95))
+	assert.Equal(t, 5, l.endpointCost[endpoint])
+
+	// 已用 95：再预扣 5 恰好到上限，不等待；第二次超出上限需等待
+	l.acquire(endpoint)
+	assert.Empty(t, *slept)
+	l.acquire(endpoint)
+	assert.Equal(t, []time.Duration{time.Minute}, *slept)
+}
+
+// TestRateLimiter_BacksOffOn429 收到 429 时按 Retry-After 退避
+func TestRateLimiter_BacksOffOn429(t *testing.T) {
+	l := newWeightRateLimiter(1200)
+	slept := fakeLimiterClock(l, time.Date(2024, 1, 1, 12, 0, 10, 0, time.UTC))
+
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	resp.Header.Set("Retry-After", "7")
+	l.observe("GET /fapi/v1/ticker/price", l.acquire("GET /fapi/v1/ticker/price"), resp)
+
+	l.acquire("GET /fapi/v1/ticker/price")
+	assert.Equal(t, []time.Duration{7 * time.Second}, *slept)
+}
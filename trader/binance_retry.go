@@ -0,0 +1,130 @@
+package trader
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/adshao/go-binance/v2/futures"
+)
+
+const (
+	// defaultBinanceMaxRetries 瞬时错误的默认最大重试次数（不含首次请求）
+	defaultBinanceMaxRetries = 3
+
+	binanceErrDisconnected = -1001 // 服务端内部错误，可重试
+	binanceErrTimestamp    = -1021 // 时间戳超出 recvWindow，重新同步时间后可重试
+	binanceErrDuplicateID  = -4116 // clientOrderId 重复：之前的请求实际已被受理
+)
+
+var (
+	// binanceRetryBaseDelay 首次重试前的等待时间，之后每次翻倍
+	binanceRetryBaseDelay = 500 * time.Millisecond
+	// binanceRetrySleep 可在测试中替换以跳过真实等待
+	binanceRetrySleep = time.Sleep
+)
+
+// isRetryableBinanceError 判断错误是否为可重试的瞬时错误
+// 只重试白名单内的错误码（-1001、-1021）和 HTTP 5xx；参数校验类错误（如 -1111 精度错误、-4136）重试也不会成功
+// 币安的 4xx 错误总会带 JSON 错误码，响应体无法解析为错误码的只有网关返回的 5xx 页面
+func isRetryableBinanceError(err error) bool {
+	var apiErr *common.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if !apiErr.IsValid() {
+		return true
+	}
+	return apiErr.Code == binanceErrDisconnected || apiErr.Code == binanceErrTimestamp
+}
+
+// doWithRetry 执行 fn，遇到瞬时错误时按指数退避重试，最多重试 t.maxRetries 次
+// -1021 说明本地时钟与服务器偏差过大，重试前先重新同步服务器时间
+// 下单请求需在 fn 外构造（固定 clientOrderId），这样即使首次请求实际已成交，重试也会被币安以重复订单拒绝（下单请使用 placeOrderWithRetry）
+func doWithRetry[T any](t *FuturesTrader, op string, fn func() (T, error)) (T, error) {
+	delay := binanceRetryBaseDelay
+	for attempt := 0; ; attempt++ {
+		result, err := fn()
+		if err == nil || attempt >= t.maxRetries || !isRetryableBinanceError(err) {
+			return result, err
+		}
+
+		var apiErr *common.APIError
+		if errors.As(err, &apiErr) && apiErr.Code == binanceErrTimestamp {
+			syncBinanceServerTime(t.client)
+		}
+
+		log.Printf("⚠️ %s失败: %v，%v 后第 %d/%d 次重试", op, err, delay, attempt+1, t.maxRetries)
+		binanceRetrySleep(delay)
+		delay *= 2
+	}
+}
+
+// placeOrderWithRetry 带重试地提交下单请求
+// 若首次请求已被币安受理但响应丢失，重试会因 clientOrderId 重复（-4116）被拒绝；此时按 clientOrderId 查询原订单并返回其结果
+func placeOrderWithRetry(t *FuturesTrader, op, symbol, clientOrderID string, orderService *futures.CreateOrderService) (*futures.CreateOrderResponse, error) {
+	attempts := 0
+	return doWithRetry(t, op, func() (*futures.CreateOrderResponse, error) {
+		attempts++
+		order, err := orderService.Do(context.Background())
+		if err == nil || attempts == 1 || clientOrderID == "" {
+			return order, err
+		}
+		var apiErr *common.APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != binanceErrDuplicateID {
+			return order, err
+		}
+
+		log.Printf("⚠️ %s重试返回重复订单，查询已受理的订单 %s", op, clientOrderID)
+		existing, qerr := t.client.NewGetOrderService().
+			Symbol(symbol).
+			OrigClientOrderID(clientOrderID).
+			Do(context.Background())
+		if qerr != nil {
+			return nil, errors.Join(err, qerr)
+		}
+		return orderToCreateResponse(existing), nil
+	})
+}
+
+// orderToCreateResponse 将查询到的订单转换为下单响应结构
+func orderToCreateResponse(o *futures.Order) *futures.CreateOrderResponse {
+	return &futures.CreateOrderResponse{
+		Symbol:                  o.Symbol,
+		OrderID:                 o.OrderID,
+		ClientOrderID:           o.ClientOrderID,
+		Price:                   o.Price,
+		OrigQuantity:            o.OrigQuantity,
+		ExecutedQuantity:        o.ExecutedQuantity,
+		CumQuote:                o.CumQuote,
+		ReduceOnly:              o.ReduceOnly,
+		Status:                  o.Status,
+		StopPrice:               o.StopPrice,
+		TimeInForce:             o.TimeInForce,
+		Type:                    o.Type,
+		Side:                    o.Side,
+		UpdateTime:              o.UpdateTime,
+		WorkingType:             o.WorkingType,
+		ActivatePrice:           o.ActivatePrice,
+		PriceRate:               o.PriceRate,
+		AvgPrice:                o.AvgPrice,
+		PositionSide:            o.PositionSide,
+		ClosePosition:           o.ClosePosition,
+		PriceProtect:            o.PriceProtect,
+		PriceMatch:              o.PriceMatch,
+		SelfTradePreventionMode: o.SelfTradePreventionMode,
+		GoodTillDate:            o.GoodTillDate,
+		CumQty:                  o.ExecutedQuantity,
+		OrigType:                o.OrigType,
+	}
+}
+
+// SetMaxRetries 设置瞬时错误的最大重试次数（<= 0 表示不重试）
+func (t *FuturesTrader) SetMaxRetries(maxRetries int) {
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+	t.maxRetries = maxRetries
+}
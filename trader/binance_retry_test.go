@@ -0,0 +1,210 @@
+package trader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// disableRetryDelay 测试中跳过退避等待，并记录每次等待时长 (helper)
+func disableRetryDelay(t *testing.T) *[]time.Duration {
+	var slept []time.Duration
+	prev := binanceRetrySleep
+	binanceRetrySleep = func(d time.Duration) { slept = append(slept, d) }
+	t.Cleanup(func() { binanceRetrySleep = prev })
+	return &slept
+}
+
+// TestDoWithRetry_RetriesTimestampError 下单连续两次返回 -1021 后成功：应重试并在每次重试前同步服务器时间
+func TestDoWithRetry_RetriesTimestampError(t *testing.T) {
+	slept := disableRetryDelay(t)
+
+	var mu sync.Mutex
+	var orderAttempts, timeSyncs int
+	var clientOrderIDs []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case binanceOrderPath:
+			r.ParseForm()
+			orderAttempts++
+			clientOrderIDs = append(clientOrderIDs, r.FormValue("newClientOrderId"))
+			if orderAttempts <= 2 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"code": -1021,
+					"msg":  "Timestamp for this request is outside of the recvWindow.",
+				})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"orderId": 123456, "symbol": "BTCUSDT"})
+		case "/fapi/v1/time":
+			timeSyncs++
+			json.NewEncoder(w).Encode(map[string]interface{}{"serverTime": time.Now().UnixMilli()})
+		case binanceExchangeInfoPath:
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"symbols": []map[string]interface{}{{
+					"symbol": "BTCUSDT",
+					"filters": []map[string]interface{}{
+						{"filterType": "PRICE_FILTER", "tickSize": "0.01"},
+						{"filterType": "LOT_SIZE", "stepSize": "0.001"},
+					},
+				}},
+			})
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{})
+		}
+	}))
+	defer mockServer.Close()
+
+	trader := createTestTrader(mockServer.URL)
+	trader.SetMaxRetries(3)
+
+	err := trader.SetStopLoss("BTCUSDT", "LONG", 0.1, 48000)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, orderAttempts, "两次 -1021 后第三次成功")
+	assert.Equal(t, 2, timeSyncs, "每次 -1021 后重新同步服务器时间")
+	assert.Equal(t, []time.Duration{binanceRetryBaseDelay, 2 * binanceRetryBaseDelay}, *slept, "指数退避")
+	if assert.Len(t, clientOrderIDs, 3) {
+		assert.NotEmpty(t, clientOrderIDs[0])
+		assert.Equal(t, clientOrderIDs[0], clientOrderIDs[2], "重试应复用同一个 clientOrderId")
+	}
+}
+
+// TestDoWithRetry_ServerErrorAndLimit 5xx 可重试，但不超过最大重试次数
+func TestDoWithRetry_ServerErrorAndLimit(t *testing.T) {
+	disableRetryDelay(t)
+
+	var mu sync.Mutex
+	var attempts int
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprint(w, "<html>502 Bad Gateway</html>")
+	}))
+	defer mockServer.Close()
+
+	trader := createTestTrader(mockServer.URL)
+	trader.SetMaxRetries(2)
+
+	_, err := trader.GetBalance()
+	assert.Error(t, err)
+	assert.Equal(t, 3, attempts, "首次请求 + 2 次重试")
+
+	// 关闭重试后只请求一次
+	attempts = 0
+	trader.SetMaxRetries(0)
+	_, err = trader.GetPositions()
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestIsRetryableBinanceError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"-1001 内部错误", &common.APIError{Code: -1001, Message: "Internal error"}, true},
+		{"-1021 时间戳", &common.APIError{Code: -1021, Message: "Timestamp outside recvWindow"}, true},
+		{"5xx 非 JSON 响应", &common.APIError{Response: []byte("<html>503</html>")}, true},
+		{"包装后的 -1001", fmt.Errorf("下单失败: %w", &common.APIError{Code: -1001}), true},
+		{"-1111 精度错误", &common.APIError{Code: -1111, Message: "Precision is over the maximum"}, false},
+		{"-4136 参数错误", &common.APIError{Code: -4136, Message: "Target strategy invalid"}, false},
+		{"-2019 保证金不足", &common.APIError{Code: -2019, Message: "Margin is insufficient"}, false},
+		{"非 API 错误", errors.New("格式化数量失败"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isRetryableBinanceError(tt.err))
+		})
+	}
+}
+
+// TestDoWithRetry_NoRetryOnValidationError 参数校验错误不重试
+func TestDoWithRetry_NoRetryOnValidationError(t *testing.T) {
+	slept := disableRetryDelay(t)
+
+	trader := createTestTrader("http://127.0.0.1:0")
+	trader.SetMaxRetries(3)
+
+	calls := 0
+	_, err := doWithRetry(trader, "下单", func() (int, error) {
+		calls++
+		return 0, &common.APIError{Code: -4136, Message: "Target strategy invalid"}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, *slept)
+}
+
+// TestPlaceOrderWithRetry_DuplicateAfterLostResponse 首次下单已被受理但返回 5xx，重试报 -4116 重复订单：应按 clientOrderId 查回原订单
+func TestPlaceOrderWithRetry_DuplicateAfterLostResponse(t *testing.T) {
+	disableRetryDelay(t)
+
+	var mu sync.Mutex
+	var orderAttempts int
+	var placedID, queriedID string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == binanceOrderPath && r.Method == http.MethodPost:
+			r.ParseForm()
+			orderAttempts++
+			if orderAttempts == 1 {
+				placedID = r.FormValue("newClientOrderId")
+				w.WriteHeader(http.StatusBadGateway)
+				fmt.Fprint(w, "<html>502 Bad Gateway</html>")
+				return
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"code": -4116,
+				"msg":  "ClientOrderId is duplicated.",
+			})
+		case r.URL.Path == binanceOrderPath && r.Method == http.MethodGet:
+			queriedID = r.URL.Query().Get("origClientOrderId")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"orderId":       987654,
+				"symbol":        "BTCUSDT",
+				"clientOrderId": queriedID,
+				"status":        "NEW",
+			})
+		case r.URL.Path == binanceExchangeInfoPath:
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"symbols": []map[string]interface{}{{
+					"symbol": "BTCUSDT",
+					"filters": []map[string]interface{}{
+						{"filterType": "PRICE_FILTER", "tickSize": "0.01"},
+						{"filterType": "LOT_SIZE", "stepSize": "0.001"},
+					},
+				}},
+			})
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{})
+		}
+	}))
+	defer mockServer.Close()
+
+	trader := createTestTrader(mockServer.URL)
+	trader.SetMaxRetries(3)
+
+	orderID, err := trader.placeStopLoss("BTCUSDT", "LONG", 0.1, 48000)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(987654), orderID, "应返回首次已受理订单的 ID")
+	assert.Equal(t, 2, orderAttempts, "查回原订单后不再重试")
+	assert.NotEmpty(t, placedID)
+	assert.Equal(t, placedID, queriedID, "按首次请求的 clientOrderId 查询")
+}
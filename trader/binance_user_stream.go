@@ -0,0 +1,139 @@
+package trader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/adshao/go-binance/v2/futures"
+)
+
+// userDataKeepaliveInterval listenKey 保活间隔（币安 60 分钟无保活即失效）
+var userDataKeepaliveInterval = 30 * time.Minute
+
+// Fill 用户数据流推送的一笔成交
+type Fill struct {
+	Symbol        string
+	Side          string // "Buy" / "Sell"，与 GetRecentFills 一致
+	PositionSide  string // LONG / SHORT / BOTH
+	OrderID       int64
+	ClientOrderID string
+	OrderType     string
+	Price         float64 // 本次成交价
+	Quantity      float64 // 本次成交数量
+	Fee           float64
+	FeeAsset      string
+	RealizedPnL   float64
+	IsMaker       bool
+	Time          int64 // 成交时间（毫秒）
+}
+
+// StartUserDataStream 启动合约用户数据流，收到 ORDER_TRADE_UPDATE 成交事件时回调 onFill，
+// 联动止损止盈单一方成交时自动取消另一方
+// 创建 listenKey 后建立 WebSocket 连接，每 30 分钟保活一次；ctx 取消时断开连接并关闭 listenKey
+// 连接意外断开时数据流结束，调用方可重新调用以重建
+func (t *FuturesTrader) StartUserDataStream(ctx context.Context, onFill func(Fill)) error {
+	listenKey, err := t.client.NewStartUserStreamService().Do(ctx)
+	if err != nil {
+		return fmt.Errorf("创建 listenKey 失败: %w", err)
+	}
+
+	handler := func(event *futures.WsUserDataEvent) {
+		if event.Event != futures.UserDataEventTypeOrderTradeUpdate {
+			return
+		}
+		t.handleOrderTradeUpdate(event.OrderTradeUpdate, onFill)
+	}
+	errHandler := func(err error) {
+		log.Printf("⚠️ 用户数据流错误: %v", err)
+	}
+
+	doneC, stopC, err := futures.WsUserDataServe(listenKey, handler, errHandler)
+	if err != nil {
+		return fmt.Errorf("连接用户数据流失败: %w", err)
+	}
+	log.Printf("✓ 用户数据流已连接")
+
+	go func() {
+		ticker := time.NewTicker(userDataKeepaliveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				close(stopC)
+				<-doneC
+				if err := t.client.NewCloseUserStreamService().ListenKey(listenKey).Do(context.Background()); err != nil {
+					log.Printf("  ⚠ 关闭 listenKey 失败: %v", err)
+				}
+				log.Printf("  ✓ 用户数据流已关闭")
+				return
+			case <-doneC:
+				log.Printf("⚠️ 用户数据流连接已断开")
+				return
+			case <-ticker.C:
+				if err := t.client.NewKeepaliveUserStreamService().ListenKey(listenKey).Do(ctx); err != nil {
+					log.Printf("⚠️ listenKey 保活失败: %v", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// handleOrderTradeUpdate 处理一条 ORDER_TRADE_UPDATE：联动止损止盈单一方成交时取消另一方，成交事件回调 onFill
+func (t *FuturesTrader) handleOrderTradeUpdate(update futures.WsOrderTradeUpdate, onFill func(Fill)) {
+	if update.Status == futures.OrderStatusTypeFilled && t.isLinkedOrder(update.Symbol, update.ID) {
+		if err := t.CancelLinkedSiblings(update.Symbol); err != nil {
+			log.Printf("⚠️ %v", err)
+		}
+	}
+	if fill, ok := parseOrderTradeFill(update); ok {
+		onFill(fill)
+	}
+}
+
+// parseOrderTradeFill 把 ORDER_TRADE_UPDATE 转换为成交记录，非成交类事件（新建、撤单、过期等）返回 false
+func parseOrderTradeFill(update futures.WsOrderTradeUpdate) (Fill, bool) {
+	if update.ExecutionType != futures.OrderExecutionTypeTrade {
+		return Fill{}, false
+	}
+
+	price, err := strconv.ParseFloat(update.LastFilledPrice, 64)
+	if err != nil {
+		log.Printf("⚠️ 解析成交价格失败: %v", err)
+		return Fill{}, false
+	}
+	quantity, err := strconv.ParseFloat(update.LastFilledQty, 64)
+	if err != nil {
+		log.Printf("⚠️ 解析成交数量失败: %v", err)
+		return Fill{}, false
+	}
+	// 无手续费时币安不推送 n/N 字段
+	fee, _ := strconv.ParseFloat(update.Commission, 64)
+	realizedPnL, _ := strconv.ParseFloat(update.RealizedPnL, 64)
+
+	side := "Buy"
+	if update.Side == futures.SideTypeSell {
+		side = "Sell"
+	}
+
+	return Fill{
+		Symbol:        update.Symbol,
+		Side:          side,
+		PositionSide:  string(update.PositionSide),
+		OrderID:       update.ID,
+		ClientOrderID: update.ClientOrderID,
+		OrderType:     string(update.Type),
+		Price:         price,
+		Quantity:      quantity,
+		Fee:           fee,
+		FeeAsset:      update.CommissionAsset,
+		RealizedPnL:   realizedPnL,
+		IsMaker:       update.IsMaker,
+		Time:          update.TradeTime,
+	}, true
+}
@@ -0,0 +1,94 @@
+package trader
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStartUserDataStream mock 服务先推送一个 NEW 事件再推送一笔成交，只有成交触发回调；ctx 取消后关闭 listenKey
+func TestStartUserDataStream(t *testing.T) {
+	const listenKey = "test-listen-key"
+	var closed atomic.Bool
+	upgrader := websocket.Upgrader{}
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/fapi/v1/listenKey" && r.Method == http.MethodPost:
+			json.NewEncoder(w).Encode(map[string]interface{}{"listenKey": listenKey})
+		case r.URL.Path == "/fapi/v1/listenKey" && r.Method == http.MethodDelete:
+			closed.Store(true)
+			json.NewEncoder(w).Encode(map[string]interface{}{})
+		case r.URL.Path == "/ws/"+listenKey:
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				t.Errorf("upgrade: %v", err)
+				return
+			}
+			defer conn.Close()
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"e":"ORDER_TRADE_UPDATE","E":1700000000001,"T":1700000000000,
+				"o":{"s":"BTCUSDT","c":"x-KzrpZaP9abc","S":"BUY","o":"MARKET","x":"NEW","X":"NEW","i":42,"l":"0","L":"0","ps":"LONG"}}`))
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"e":"ORDER_TRADE_UPDATE","E":1700000000101,"T":1700000000100,
+				"o":{"s":"BTCUSDT","c":"x-KzrpZaP9abc","S":"BUY","o":"MARKET","x":"TRADE","X":"FILLED","i":42,
+				"l":"0.010","L":"50123.40","N":"USDT","n":"0.20049360","T":1700000000100,"m":false,"rp":"0","ps":"LONG"}}`))
+			// 保持连接直到客户端断开
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{})
+		}
+	}))
+	defer mockServer.Close()
+
+	trader := createTestTrader(mockServer.URL)
+	prevWsURL := futures.BaseWsTestnetUrl
+	futures.BaseWsTestnetUrl = "ws" + strings.TrimPrefix(mockServer.URL, "http") + "/ws"
+	defer func() { futures.BaseWsTestnetUrl = prevWsURL }()
+
+	fills := make(chan Fill, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	err := trader.StartUserDataStream(ctx, func(f Fill) { fills <- f })
+	if !assert.NoError(t, err) {
+		cancel()
+		return
+	}
+
+	select {
+	case fill := <-fills:
+		assert.Equal(t, Fill{
+			Symbol:        "BTCUSDT",
+			Side:          "Buy",
+			PositionSide:  "LONG",
+			OrderID:       42,
+			ClientOrderID: "x-KzrpZaP9abc",
+			OrderType:     "MARKET",
+			Price:         50123.4,
+			Quantity:      0.01,
+			Fee:           0.2004936,
+			FeeAsset:      "USDT",
+			Time:          1700000000100,
+		}, fill)
+	case <-time.After(5 * time.Second):
+		t.Fatal("未收到成交回调")
+	}
+	select {
+	case fill := <-fills:
+		t.Errorf("非成交事件不应回调: %+v", fill)
+	default:
+	}
+
+	cancel()
+	assert.Eventually(t, closed.Load, 5*time.Second, 10*time.Millisecond, "ctx 取消后应关闭 listenKey")
+}
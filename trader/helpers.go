@@ -6,6 +6,12 @@ const DefaultSlippage = 0.005
 // DefaultStopLossSlippage 默认止损滑点缓冲 (2%)，用于止损止盈单
 const DefaultStopLossSlippage = 0.02
 
+// DefaultMarginBuffer 计算最大可开仓数量时预留的可用保证金比例 (5%)
+const DefaultMarginBuffer = 0.05
+
+// DefaultTakerFeeRate 默认 Taker 手续费率 (0.05%)，计算最大可开仓数量时预留开仓手续费
+const DefaultTakerFeeRate = 0.0005
+
 // CalculateAggressiveLimitPrice 计算激进限价单价格 (用于开平仓)
 func CalculateAggressiveLimitPrice(side string, currentPrice float64, slippage float64) float64 {
 	if slippage <= 0 {
@@ -655,6 +655,7 @@ export function BacktestPage() {
             >
               <option value="next_open">{tr('form.fillPolicies.nextOpen')}</option>
               <option value="bar_vwap">{tr('form.fillPolicies.barVwap')}</option>
+              <option value="true_vwap">{tr('form.fillPolicies.trueVwap')}</option>
               <option value="mid">{tr('form.fillPolicies.midPrice')}</option>
             </select>
             <select
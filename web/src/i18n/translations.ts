@@ -138,6 +138,7 @@ export const translations = {
       fillPolicies: {
         nextOpen: 'Next open',
         barVwap: 'Bar VWAP',
+        trueVwap: 'Volume-weighted VWAP',
         midPrice: 'Mid price',
         },
         promptPresets: {
@@ -1167,6 +1168,7 @@ export const translations = {
       fillPolicies: {
         nextOpen: '下一根开盘价',
         barVwap: 'K线 VWAP',
+        trueVwap: '成交量加权 VWAP',
         midPrice: '中间价',
         },
         promptPresets: {